@@ -0,0 +1,247 @@
+package app
+
+import (
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// thermalStates are always listed in thermal_state_seconds, so CSV columns
+// do not depend on which states the first window saw.
+var thermalStates = []string{"Normal", "Fair", "Serious", "Critical"}
+
+// headlessAggregator summarises headless samples over fixed windows aligned
+// to the clock, for --aggregate.
+type headlessAggregator struct {
+	window time.Duration
+
+	start   time.Time // start of the current window
+	prev    time.Time // time of the previous sample, across windows
+	samples int
+	last    fieldObject
+	model   string
+	values  map[string][]float64
+	thermal map[string]float64 // seconds spent in each state
+	energy  [7]float64         // joules, in energyNames order
+}
+
+var energyNames = []string{"cpu", "gpu", "ane", "dram", "gpu_sram", "system", "total"}
+
+// headlessWindow is the summary of one window.
+type headlessWindow struct {
+	Start, End time.Time
+	Model      string
+	Record     fieldObject
+}
+
+func newHeadlessAggregator(window time.Duration) *headlessAggregator {
+	return &headlessAggregator{window: window}
+}
+
+// headlessTree is output in the --schema layout, cut down by --fields and
+// --exclude.
+func headlessTree(output HeadlessOutput) (fieldObject, error) {
+	version, _ := parseSchemaVersion(headlessSchema)
+	s := fieldFilter
+	if s == nil {
+		s = &fieldSelection{}
+	}
+	return s.Project(headlessSample(output, version))
+}
+
+// Add folds a sample into its window. When the sample starts a new window
+// the summary of the previous one is returned.
+func (a *headlessAggregator) Add(o HeadlessOutput) (*headlessWindow, error) {
+	tree, err := headlessTree(o)
+	if err != nil {
+		return nil, err
+	}
+	at := time.Unix(0, influxTimestamp(o))
+
+	var done *headlessWindow
+	if start := at.Truncate(a.window); a.samples > 0 && !start.Equal(a.start) {
+		done = a.Flush()
+	}
+	if a.samples == 0 {
+		a.start = at.Truncate(a.window)
+		a.values = make(map[string][]float64)
+		a.thermal = make(map[string]float64)
+		a.energy = [7]float64{}
+	}
+
+	dt := sampleSpan(a.prev, at)
+	a.prev = at
+	m := o.SocMetrics
+	for i, w := range []float64{m.CPUPower, m.GPUPower, m.ANEPower, m.DRAMPower, m.GPUSRAMPower, m.SystemPower, m.TotalPower} {
+		a.energy[i] += w * dt.Seconds()
+	}
+	a.thermal[o.ThermalState] += dt.Seconds()
+
+	walkNumbers("", tree, func(path string, v float64) {
+		a.values[path] = append(a.values[path], v)
+	})
+	a.last = tree
+	a.model = o.SystemInfo.Name
+	a.samples++
+	return done, nil
+}
+
+// Flush returns the summary of the current window and starts a new one. It
+// returns nil if the window has no samples.
+func (a *headlessAggregator) Flush() *headlessWindow {
+	if a == nil || a.samples == 0 {
+		return nil
+	}
+	w := &headlessWindow{Start: a.start, End: a.start.Add(a.window), Model: a.model}
+
+	// The summary always says which schema it summarises, even when
+	// --fields leaves schema_version out of the samples.
+	version, _ := parseSchemaVersion(headlessSchema)
+	rest := a.last
+	if len(rest) > 0 && rest[0].Key == "schema_version" {
+		rest = rest[1:]
+	}
+	record := fieldObject{
+		{Key: "schema_version", Value: version},
+		{Key: "window_start", Value: w.Start.Format(time.RFC3339)},
+		{Key: "window_end", Value: w.End.Format(time.RFC3339)},
+		{Key: "samples", Value: a.samples},
+	}
+	record = append(record, a.summarise("", rest).(fieldObject)...)
+
+	energy := fieldObject{}
+	for i, name := range energyNames {
+		energy = append(energy, fieldEntry{Key: name, Value: a.energy[i]})
+	}
+	thermal := fieldObject{}
+	for _, state := range thermalStates {
+		thermal = append(thermal, fieldEntry{Key: state, Value: a.thermal[state]})
+		delete(a.thermal, state)
+	}
+	var other []string
+	for state := range a.thermal {
+		other = append(other, state)
+	}
+	sort.Strings(other)
+	for _, state := range other {
+		thermal = append(thermal, fieldEntry{Key: state, Value: a.thermal[state]})
+	}
+	w.Record = append(record,
+		fieldEntry{Key: "energy_joules", Value: energy},
+		fieldEntry{Key: "thermal_state_seconds", Value: thermal},
+	)
+
+	a.samples = 0
+	return w
+}
+
+// summarise replaces every number in v with its statistics over the window.
+// Everything else keeps its last value.
+func (a *headlessAggregator) summarise(path string, v any) any {
+	switch v := v.(type) {
+	case fieldObject:
+		out := make(fieldObject, 0, len(v))
+		for _, f := range v {
+			if f.xmlOnly() {
+				continue
+			}
+			f.Value = a.summarise(joinFieldPath(path, f.Key), f.Value)
+			out = append(out, f)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = a.summarise(joinFieldPath(path, strconv.Itoa(i)), item)
+		}
+		return out
+	case int64, float64:
+		return windowStats(a.values[path])
+	}
+	return v
+}
+
+// windowStats is min, max, mean, median, 95th percentile (nearest rank) and
+// last of values, which must not be empty.
+func windowStats(values []float64) fieldObject {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	return fieldObject{
+		{Key: "min", Value: sorted[0]},
+		{Key: "max", Value: sorted[len(sorted)-1]},
+		{Key: "mean", Value: sum / float64(len(sorted))},
+		{Key: "p50", Value: nearestRank(sorted, 0.50)},
+		{Key: "p95", Value: nearestRank(sorted, 0.95)},
+		{Key: "last", Value: values[len(values)-1]},
+	}
+}
+
+// nearestRank is the p-th percentile (0-1) of sorted, which must not be
+// empty.
+func nearestRank(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func joinFieldPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// walkNumbers calls fn with the dotted path of every number in v.
+func walkNumbers(prefix string, v any, fn func(path string, v float64)) {
+	switch v := v.(type) {
+	case fieldObject:
+		for _, f := range v {
+			if !f.xmlOnly() {
+				walkNumbers(joinFieldPath(prefix, f.Key), f.Value, fn)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			walkNumbers(joinFieldPath(prefix, strconv.Itoa(i)), item, fn)
+		}
+	case int64:
+		fn(prefix, float64(v))
+	case int:
+		fn(prefix, float64(v))
+	case float64:
+		fn(prefix, v)
+	}
+}
+
+// writeHeadlessWindow prints a window summary. Line protocol gets a single
+// aggregate point with one field per number.
+func writeHeadlessWindow(format string, w *headlessWindow) error {
+	switch format {
+	case "csv":
+		return fieldFilter.WriteCSV(os.Stdout, w.Record)
+	case "influx":
+		host, _ := os.Hostname()
+		tags := []string{"host", host, "model", w.Model, "window", aggregateEvery.String()}
+		_, err := os.Stdout.Write(appendInfluxLine(nil, "aggregate", tags, windowInfluxFields(w.Record), w.End.UnixNano()))
+		return err
+	}
+	return writeHeadlessValue(format, w.Record)
+}
+
+// windowInfluxFields is one line protocol field per number of a window
+// summary. schema_version describes the output, not the machine, so it is
+// left out.
+func windowInfluxFields(record fieldObject) []influxField {
+	var fields []influxField
+	walkNumbers("", record, func(path string, v float64) {
+		if path != "schema_version" {
+			fields = append(fields, influxField{Key: path, Value: v})
+		}
+	})
+	return fields
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindowStats(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   string
+	}{
+		{[]float64{5}, `{"min":5,"max":5,"mean":5,"p50":5,"p95":5,"last":5}`},
+		{[]float64{4, 1, 3, 2}, `{"min":1,"max":4,"mean":2.5,"p50":2,"p95":4,"last":2}`},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+			`{"min":1,"max":20,"mean":10.5,"p50":10,"p95":19,"last":20}`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(windowStats(tt.values))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("windowStats(%v) = %s, want %s", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestHeadlessAggregator(t *testing.T) {
+	savedInterval, savedFilter, savedSchema := updateInterval, fieldFilter, headlessSchema
+	defer func() { updateInterval, fieldFilter, headlessSchema = savedInterval, savedFilter, savedSchema }()
+	updateInterval = 1000
+	headlessSchema = "v1"
+	var err error
+	if fieldFilter, err = parseFieldSelection("soc_metrics.total_power,thermal_state", "", headlessSchemaV1); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(sec int, watts float64, state string) HeadlessOutput {
+		at := base.Add(time.Duration(sec) * time.Second)
+		return HeadlessOutput{
+			SchemaVersion: headlessSchemaV1,
+			Timestamp:     at.Format(time.RFC3339),
+			SocMetrics:    SocMetrics{TotalPower: watts, CPUPower: watts / 2},
+			ThermalState:  state,
+			capturedAt:    at,
+		}
+	}
+
+	a := newHeadlessAggregator(time.Minute)
+	var windows []*headlessWindow
+	for _, s := range []HeadlessOutput{
+		sample(0, 10, "Normal"),
+		sample(1, 20, "Normal"),
+		sample(2, 30, "Fair"),
+		sample(60, 40, "Normal"), // starts the second window, after a gap
+	} {
+		w, err := a.Add(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w != nil {
+			windows = append(windows, w)
+		}
+	}
+	if len(windows) != 1 {
+		t.Fatalf("got %d windows before the minute ended, want 1", len(windows))
+	}
+	if w := a.Flush(); w != nil {
+		windows = append(windows, w)
+	}
+	if a.Flush() != nil {
+		t.Error("Flush of an empty window returned a summary")
+	}
+
+	tests := []struct {
+		name string
+		w    *headlessWindow
+		want string
+	}{
+		{
+			name: "full window",
+			w:    windows[0],
+			want: `{"schema_version":1,"window_start":"2025-01-01T00:00:00Z","window_end":"2025-01-01T00:01:00Z","samples":3,` +
+				`"soc_metrics":{"total_power":{"min":10,"max":30,"mean":20,"p50":20,"p95":30,"last":30}},"thermal_state":"Fair",` +
+				`"energy_joules":{"cpu":30,"gpu":0,"ane":0,"dram":0,"gpu_sram":0,"system":0,"total":60},` +
+				`"thermal_state_seconds":{"Normal":2,"Fair":1,"Serious":0,"Critical":0}}`,
+		},
+		{
+			name: "partial window",
+			w:    windows[1],
+			want: `{"schema_version":1,"window_start":"2025-01-01T00:01:00Z","window_end":"2025-01-01T00:02:00Z","samples":1,` +
+				`"soc_metrics":{"total_power":{"min":40,"max":40,"mean":40,"p50":40,"p95":40,"last":40}},"thermal_state":"Normal",` +
+				`"energy_joules":{"cpu":20,"gpu":0,"ane":0,"dram":0,"gpu_sram":0,"system":0,"total":40},` +
+				`"thermal_state_seconds":{"Normal":1,"Fair":0,"Serious":0,"Critical":0}}`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.w.Record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+
+	var keys []string
+	for _, f := range windowInfluxFields(windows[0].Record) {
+		keys = append(keys, f.Key)
+	}
+	if got := strings.Join(keys, ","); !strings.HasPrefix(got, "samples,soc_metrics.total_power.min,") {
+		t.Errorf("line protocol fields = %s, want samples first and no schema_version", got)
+	}
+}
@@ -0,0 +1,379 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertMetrics are the values a rule can test, read from one Snapshot. Sizes
+// are bytes, rates bytes/s, temperatures °C, power watts and usage percent.
+var alertMetrics = map[string]func(s Snapshot) float64{
+	"cpu_usage":      func(s Snapshot) float64 { return s.CPUUsage() },
+	"gpu_usage":      func(s Snapshot) float64 { return s.GPU.ActivePercent },
+	"cpu_temp":       func(s Snapshot) float64 { return s.CPU.CPUTemp },
+	"gpu_temp":       func(s Snapshot) float64 { return s.CPU.GPUTemp },
+	"cpu_power":      func(s Snapshot) float64 { return s.CPU.CPUW },
+	"gpu_power":      func(s Snapshot) float64 { return s.CPU.GPUW },
+	"ane_power":      func(s Snapshot) float64 { return s.CPU.ANEW },
+	"dram_power":     func(s Snapshot) float64 { return s.CPU.DRAMW },
+	"total_power":    func(s Snapshot) float64 { return s.CPU.PackageW },
+	"memory_used":    func(s Snapshot) float64 { return float64(s.Memory.Used) },
+	"memory_percent": memoryPercent,
+	"swap_used":      func(s Snapshot) float64 { return float64(s.Memory.SwapUsed) },
+	"net_in":         func(s Snapshot) float64 { return s.NetDisk.InBytesPerSec },
+	"net_out":        func(s Snapshot) float64 { return s.NetDisk.OutBytesPerSec },
+	"disk_read":      func(s Snapshot) float64 { return s.NetDisk.ReadKBytesPerSec * 1024 },
+	"disk_write":     func(s Snapshot) float64 { return s.NetDisk.WriteKBytesPerSec * 1024 },
+	"tb_net_in":      func(s Snapshot) float64 { in, _ := tbNetTotals(s.TBNetStats); return in },
+	"tb_net_out":     func(s Snapshot) float64 { _, out := tbNetTotals(s.TBNetStats); return out },
+	"thermal_state":  func(s Snapshot) float64 { return float64(thermalStateLevel(s.ThermalState)) },
+}
+
+func memoryPercent(s Snapshot) float64 {
+	if s.Memory.Total == 0 {
+		return 0
+	}
+	return float64(s.Memory.Used) / float64(s.Memory.Total) * 100
+}
+
+func tbNetTotals(stats []ThunderboltNetStats) (in, out float64) {
+	for _, stat := range stats {
+		in += stat.BytesInPerSec
+		out += stat.BytesOutPerSec
+	}
+	return in, out
+}
+
+// alertValues evaluates every alert metric against s.
+func alertValues(s Snapshot) map[string]float64 {
+	values := make(map[string]float64, len(alertMetrics))
+	for name, get := range alertMetrics {
+		values[name] = get(s)
+	}
+	return values
+}
+
+// AlertConfig is one entry of the "alerts" list in config.json.
+type AlertConfig struct {
+	Name       string `json:"name,omitempty"`
+	Rule       string `json:"rule"`
+	Hysteresis string `json:"hysteresis,omitempty"`
+	Cooldown   string `json:"cooldown,omitempty"`
+	Command    string `json:"command,omitempty"`
+}
+
+// AlertRule is a parsed threshold rule such as "cpu_temp > 90 for 30s".
+type AlertRule struct {
+	Name      string
+	Expr      string
+	Metric    string
+	Op        string
+	Threshold float64
+	For       time.Duration
+	// Hysteresis is how far past the threshold the value must move back
+	// before a firing alert resolves.
+	Hysteresis float64
+	// Cooldown is the minimum time between two firings of the rule.
+	Cooldown time.Duration
+	Command  string
+}
+
+var alertRulePattern = regexp.MustCompile(`^\s*([a-z_]+)\s*(>=|<=|==|!=|>|<)\s*(\S+)(?:\s+for\s+(\S+))?\s*$`)
+
+// ParseAlertRule parses "<metric> <op> <value>[unit] [for <duration>]".
+func ParseAlertRule(expr string) (AlertRule, error) {
+	m := alertRulePattern.FindStringSubmatch(strings.ToLower(expr))
+	if m == nil {
+		return AlertRule{}, fmt.Errorf("invalid alert rule %q: expected e.g. \"cpu_temp > 90 for 30s\"", expr)
+	}
+	rule := AlertRule{Name: m[1], Expr: strings.TrimSpace(expr), Metric: m[1], Op: m[2]}
+	if _, ok := alertMetrics[rule.Metric]; !ok {
+		return AlertRule{}, fmt.Errorf("invalid alert rule %q: unknown metric %s", expr, rule.Metric)
+	}
+	threshold, err := parseAlertValue(rule.Metric, m[3])
+	if err != nil {
+		return AlertRule{}, fmt.Errorf("invalid alert rule %q: %v", expr, err)
+	}
+	rule.Threshold = threshold
+	if m[4] != "" {
+		if rule.For, err = time.ParseDuration(m[4]); err != nil || rule.For < 0 {
+			return AlertRule{}, fmt.Errorf("invalid alert rule %q: bad duration %s", expr, m[4])
+		}
+	}
+	return rule, nil
+}
+
+// NewAlertRule parses a config entry, including its hysteresis and cooldown.
+func NewAlertRule(c AlertConfig) (AlertRule, error) {
+	rule, err := ParseAlertRule(c.Rule)
+	if err != nil {
+		return rule, err
+	}
+	if c.Name != "" {
+		rule.Name = c.Name
+	}
+	rule.Command = c.Command
+	if c.Hysteresis != "" {
+		if rule.Hysteresis, err = parseAlertValue(rule.Metric, c.Hysteresis); err != nil || rule.Hysteresis < 0 {
+			return rule, fmt.Errorf("alert %s: invalid hysteresis %q", rule.Name, c.Hysteresis)
+		}
+	}
+	if c.Cooldown != "" {
+		if rule.Cooldown, err = time.ParseDuration(c.Cooldown); err != nil || rule.Cooldown < 0 {
+			return rule, fmt.Errorf("alert %s: invalid cooldown %q", rule.Name, c.Cooldown)
+		}
+	}
+	return rule, nil
+}
+
+var alertUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9}, {"tb", 1e12},
+	{"°c", 1}, {"c", 1}, {"w", 1}, {"%", 1}, {"b", 1},
+}
+
+// parseAlertValue reads a threshold with an optional unit ("4GiB", "90c",
+// "100MB/s"). thermal_state also accepts state names such as "serious".
+func parseAlertValue(metric, s string) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if metric == "thermal_state" {
+		switch s {
+		case "normal", "nominal":
+			return 0, nil
+		case "fair", "serious", "critical":
+			return float64(thermalStateLevel(strings.ToUpper(s[:1]) + s[1:])), nil
+		}
+	}
+	s = strings.TrimSuffix(s, "/s")
+	scale := 1.0
+	for _, u := range alertUnits {
+		if rest, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, scale = rest, u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v * scale, nil
+}
+
+func compareAlert(op string, v, threshold float64) bool {
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "==":
+		return v == threshold
+	case "!=":
+		return v != threshold
+	}
+	return false
+}
+
+// holds reports whether v still satisfies the rule. A firing rule is held to
+// the threshold moved back by the hysteresis.
+func (r *AlertRule) holds(v float64, firing bool) bool {
+	threshold := r.Threshold
+	if firing {
+		switch r.Op {
+		case ">", ">=":
+			threshold -= r.Hysteresis
+		case "<", "<=":
+			threshold += r.Hysteresis
+		}
+	}
+	return compareAlert(r.Op, v, threshold)
+}
+
+// Alert is a rule that is currently firing.
+type Alert struct {
+	Name      string  `json:"name" yaml:"name" xml:"Name" toon:"name"`
+	Rule      string  `json:"rule" yaml:"rule" xml:"Rule" toon:"rule"`
+	Metric    string  `json:"metric" yaml:"metric" xml:"Metric" toon:"metric"`
+	Value     float64 `json:"value" yaml:"value" xml:"Value" toon:"value"`
+	Threshold float64 `json:"threshold" yaml:"threshold" xml:"Threshold" toon:"threshold"`
+	Since     string  `json:"since" yaml:"since" xml:"Since" toon:"since"`
+}
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertEvent is a state change reported by AlertEngine.Evaluate.
+type AlertEvent struct {
+	Rule  *AlertRule
+	State string
+	Value float64
+	At    time.Time
+}
+
+type alertState struct {
+	pendingSince time.Time
+	firingSince  time.Time
+	lastFired    time.Time
+	value        float64
+}
+
+// AlertEngine tracks each rule across samples. It is not safe for concurrent
+// use; the collector is its only caller.
+type AlertEngine struct {
+	rules  []AlertRule
+	states []alertState
+}
+
+func NewAlertEngine(rules []AlertRule) *AlertEngine {
+	return &AlertEngine{rules: rules, states: make([]alertState, len(rules))}
+}
+
+// newAlertEngineFromConfig builds an engine from config entries, skipping and
+// reporting the ones that do not parse.
+func newAlertEngineFromConfig(configs []AlertConfig) (*AlertEngine, []error) {
+	var rules []AlertRule
+	var errs []error
+	for _, c := range configs {
+		rule, err := NewAlertRule(c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, errs
+	}
+	return NewAlertEngine(rules), errs
+}
+
+// Evaluate applies one sample taken at `at`. It returns the alerts firing
+// after the sample and the state changes it caused. Rules whose metric is
+// missing from values keep their previous state.
+func (e *AlertEngine) Evaluate(at time.Time, values map[string]float64) ([]Alert, []AlertEvent) {
+	active := []Alert{}
+	var events []AlertEvent
+	for i := range e.rules {
+		rule, st := &e.rules[i], &e.states[i]
+		v, ok := values[rule.Metric]
+		if ok {
+			st.value = v
+			firing := !st.firingSince.IsZero()
+			switch {
+			case firing && !rule.holds(v, true):
+				st.firingSince, st.pendingSince = time.Time{}, time.Time{}
+				events = append(events, AlertEvent{Rule: rule, State: AlertResolved, Value: v, At: at})
+			case !firing && rule.holds(v, false):
+				if st.pendingSince.IsZero() {
+					st.pendingSince = at
+				}
+				cooledDown := st.lastFired.IsZero() || at.Sub(st.lastFired) >= rule.Cooldown
+				if at.Sub(st.pendingSince) >= rule.For && cooledDown {
+					st.firingSince, st.lastFired = at, at
+					events = append(events, AlertEvent{Rule: rule, State: AlertFiring, Value: v, At: at})
+				}
+			case !firing:
+				st.pendingSince = time.Time{}
+			}
+		}
+		if !st.firingSince.IsZero() {
+			active = append(active, Alert{
+				Name:      rule.Name,
+				Rule:      rule.Expr,
+				Metric:    rule.Metric,
+				Value:     st.value,
+				Threshold: rule.Threshold,
+				Since:     st.firingSince.Format(time.RFC3339),
+			})
+		}
+	}
+	return active, events
+}
+
+// alertCommandTimeout bounds how long a hook may run.
+const alertCommandTimeout = 30 * time.Second
+
+// evaluateAlerts runs the configured rules against s, stores the firing
+// alerts on it and starts the command hook of every rule that changed state.
+func evaluateAlerts(s *Snapshot) {
+	if alertEngine == nil {
+		return
+	}
+	var events []AlertEvent
+	s.Alerts, events = alertEngine.Evaluate(s.CapturedAt, alertValues(*s))
+	for _, ev := range events {
+		if ev.Rule.Command != "" {
+			go runAlertCommand(ev)
+		}
+	}
+}
+
+// runAlertCommand runs a rule's hook through /bin/sh with the alert described
+// in MACTOP_ALERT_* environment variables.
+func runAlertCommand(ev AlertEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", ev.Rule.Command)
+	cmd.Env = append(os.Environ(),
+		"MACTOP_ALERT_NAME="+ev.Rule.Name,
+		"MACTOP_ALERT_STATE="+ev.State,
+		"MACTOP_ALERT_RULE="+ev.Rule.Expr,
+		"MACTOP_ALERT_METRIC="+ev.Rule.Metric,
+		"MACTOP_ALERT_VALUE="+strconv.FormatFloat(ev.Value, 'f', -1, 64),
+		"MACTOP_ALERT_TIME="+ev.At.Format(time.RFC3339),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		stderrLogger.Printf("Alert %s command failed: %v: %s\n", ev.Rule.Name, err, strings.TrimSpace(string(out)))
+	}
+}
+
+// updateAlertBanner shows the firing alerts in place of the version in the
+// title of mainBlock.
+func updateAlertBanner(alerts []Alert) {
+	if mainBlock == nil {
+		return
+	}
+	if len(alerts) == 0 {
+		mainBlock.TitleRight = " " + version + " "
+		return
+	}
+	banner := fmt.Sprintf(" ⚠ %s (%s) ", alerts[0].Name, formatAlertValue(alerts[0].Metric, alerts[0].Value))
+	if len(alerts) > 1 {
+		banner += fmt.Sprintf("+%d ", len(alerts)-1)
+	}
+	mainBlock.TitleRight = banner
+}
+
+// formatAlertValue renders v in the metric's natural unit.
+func formatAlertValue(metric string, v float64) string {
+	switch metric {
+	case "cpu_temp", "gpu_temp":
+		return formatTemp(v)
+	case "memory_used", "swap_used":
+		return formatBytes(v, "auto")
+	case "net_in", "net_out", "disk_read", "disk_write", "tb_net_in", "tb_net_out":
+		return formatBytes(v, "auto") + "/s"
+	case "cpu_usage", "gpu_usage", "memory_percent":
+		return fmt.Sprintf("%.0f%%", v)
+	case "thermal_state":
+		return []string{"Normal", "Fair", "Serious", "Critical"}[min(max(int(v), 0), 3)]
+	}
+	if strings.HasSuffix(metric, "_power") {
+		return fmt.Sprintf("%.1fW", v)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
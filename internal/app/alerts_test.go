@@ -0,0 +1,183 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	tests := []struct {
+		expr      string
+		metric    string
+		op        string
+		threshold float64
+		dur       time.Duration
+		wantErr   bool
+	}{
+		{"cpu_temp > 90 for 30s", "cpu_temp", ">", 90, 30 * time.Second, false},
+		{"swap_used > 4GiB", "swap_used", ">", 4 << 30, 0, false},
+		{"memory_used>=16GB", "memory_used", ">=", 16e9, 0, false},
+		{"net_in > 100MB/s for 1m", "net_in", ">", 100e6, time.Minute, false},
+		{"gpu_temp >= 85°C", "gpu_temp", ">=", 85, 0, false},
+		{"total_power > 40W for 10s", "total_power", ">", 40, 10 * time.Second, false},
+		{"cpu_usage < 5% for 5m", "cpu_usage", "<", 5, 5 * time.Minute, false},
+		{"thermal_state >= serious", "thermal_state", ">=", 2, 0, false},
+		{"thermal_state != Nominal", "thermal_state", "!=", 0, 0, false},
+		{"fan_speed > 1000", "", "", 0, 0, true},
+		{"cpu_temp ~ 90", "", "", 0, 0, true},
+		{"cpu_temp > hot", "", "", 0, 0, true},
+		{"cpu_temp > 90 for ever", "", "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule, err := ParseAlertRule(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAlertRule(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if rule.Metric != tt.metric || rule.Op != tt.op || rule.Threshold != tt.threshold || rule.For != tt.dur {
+				t.Errorf("ParseAlertRule(%q) = %s %s %v for %v, want %s %s %v for %v", tt.expr,
+					rule.Metric, rule.Op, rule.Threshold, rule.For, tt.metric, tt.op, tt.threshold, tt.dur)
+			}
+		})
+	}
+}
+
+func TestNewAlertRule(t *testing.T) {
+	rule, err := NewAlertRule(AlertConfig{Name: "swap", Rule: "swap_used > 4GiB", Hysteresis: "512MiB", Cooldown: "5m"})
+	if err != nil {
+		t.Fatalf("NewAlertRule() error = %v", err)
+	}
+	if rule.Name != "swap" || rule.Hysteresis != 512<<20 || rule.Cooldown != 5*time.Minute {
+		t.Errorf("NewAlertRule() = %+v", rule)
+	}
+	if _, err := NewAlertRule(AlertConfig{Rule: "cpu_temp > 90", Cooldown: "later"}); err == nil {
+		t.Error("expected an error for an invalid cooldown")
+	}
+	if _, errs := newAlertEngineFromConfig([]AlertConfig{{Rule: "bogus"}}); len(errs) != 1 {
+		t.Errorf("newAlertEngineFromConfig() errors = %v, want 1", errs)
+	}
+}
+
+// alertStep is one synthetic sample fed to the engine.
+type alertStep struct {
+	at     int // seconds from the start
+	value  float64
+	firing bool
+	event  string
+}
+
+func runAlertSteps(t *testing.T, rule AlertRule, steps []alertStep) {
+	t.Helper()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := NewAlertEngine([]AlertRule{rule})
+	for _, step := range steps {
+		active, events := e.Evaluate(start.Add(time.Duration(step.at)*time.Second),
+			map[string]float64{rule.Metric: step.value})
+		if got := len(active) == 1; got != step.firing {
+			t.Errorf("t=%ds value %.0f: firing = %v, want %v", step.at, step.value, got, step.firing)
+		}
+		event := ""
+		if len(events) == 1 {
+			event = events[0].State
+		}
+		if event != step.event {
+			t.Errorf("t=%ds value %.0f: event = %q, want %q", step.at, step.value, event, step.event)
+		}
+	}
+}
+
+func TestAlertEngine(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  AlertConfig
+		steps []alertStep
+	}{
+		{"For delays firing", AlertConfig{Rule: "cpu_temp > 90 for 30s"}, []alertStep{
+			{0, 95, false, ""},
+			{20, 95, false, ""},
+			{25, 80, false, ""}, // resets the pending window
+			{30, 95, false, ""},
+			{60, 96, true, AlertFiring},
+			{61, 97, true, ""},
+			{62, 85, false, AlertResolved},
+		}},
+		{"Hysteresis holds until the value drops further", AlertConfig{Rule: "cpu_temp > 90", Hysteresis: "5"}, []alertStep{
+			{0, 91, true, AlertFiring},
+			{1, 88, true, ""},
+			{2, 86, true, ""},
+			{3, 85, false, AlertResolved},
+			{4, 89, false, ""},
+		}},
+		{"Hysteresis on a below rule", AlertConfig{Rule: "cpu_usage < 10", Hysteresis: "5"}, []alertStep{
+			{0, 5, true, AlertFiring},
+			{1, 14, true, ""},
+			{2, 15, false, AlertResolved},
+		}},
+		{"Cooldown suppresses refiring", AlertConfig{Rule: "swap_used > 1GiB", Cooldown: "1m"}, []alertStep{
+			{0, 2 << 30, true, AlertFiring},
+			{10, 0, false, AlertResolved},
+			{20, 2 << 30, false, ""},
+			{59, 2 << 30, false, ""},
+			{60, 2 << 30, true, AlertFiring},
+		}},
+		{"Thermal state", AlertConfig{Rule: "thermal_state >= serious for 10s"}, []alertStep{
+			{0, 1, false, ""},
+			{5, 2, false, ""},
+			{15, 3, true, AlertFiring},
+			{20, 0, false, AlertResolved},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := NewAlertRule(tt.rule)
+			if err != nil {
+				t.Fatalf("NewAlertRule() error = %v", err)
+			}
+			runAlertSteps(t, rule, tt.steps)
+		})
+	}
+}
+
+func TestAlertEngineMissingMetric(t *testing.T) {
+	rule, _ := ParseAlertRule("gpu_temp > 80")
+	e := NewAlertEngine([]AlertRule{rule})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	e.Evaluate(start, map[string]float64{"gpu_temp": 90})
+	active, events := e.Evaluate(start.Add(time.Second), map[string]float64{})
+	if len(active) != 1 || len(events) != 0 {
+		t.Errorf("missing metric changed state: active %v, events %v", active, events)
+	}
+	if active[0].Value != 90 || active[0].Since != start.Format(time.RFC3339) {
+		t.Errorf("active alert = %+v", active[0])
+	}
+}
+
+func TestAlertValues(t *testing.T) {
+	s := Snapshot{
+		CoreUsages:   []float64{20, 40},
+		Memory:       MemoryMetrics{Total: 200, Used: 50, SwapUsed: 7},
+		NetDisk:      NetDiskMetrics{ReadKBytesPerSec: 2},
+		TBNetStats:   []ThunderboltNetStats{{BytesInPerSec: 3}, {BytesInPerSec: 4}},
+		ThermalState: "Serious",
+	}
+	values := alertValues(s)
+	want := map[string]float64{
+		"cpu_usage":      30,
+		"memory_percent": 25,
+		"swap_used":      7,
+		"disk_read":      2048,
+		"tb_net_in":      7,
+		"thermal_state":  2,
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("%s = %v, want %v", name, values[name], v)
+		}
+	}
+}
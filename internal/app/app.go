@@ -3,6 +3,7 @@
 package app
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,8 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
-
 	"sync"
 
 	ui "github.com/metaspartan/gotui/v5"
@@ -23,7 +22,7 @@ import (
 var renderMutex sync.Mutex
 
 func setupUI() {
-	appleSiliconModel := getSOCInfo()
+	appleSiliconModel := metricSource.SystemInfo()
 	modelText, helpText, infoParagraph = w.NewParagraph(), w.NewParagraph(), w.NewParagraph()
 	modelText.Title = "Apple Silicon"
 	helpText.Title = "mactop help menu"
@@ -52,14 +51,6 @@ func setupUI() {
 	updateHelpText()
 	stderrLogger.Printf("Model: %s\nE-Core Count: %d\nP-Core Count: %d\nGPU Core Count: %d", modelName, eCoreCount, pCoreCount, gpuCoreCount)
 
-	systemInfoGauge.With(prometheus.Labels{
-		"model":          modelName,
-		"core_count":     fmt.Sprintf("%d", eCoreCount+pCoreCount),
-		"e_core_count":   fmt.Sprintf("%d", eCoreCount),
-		"p_core_count":   fmt.Sprintf("%d", pCoreCount),
-		"gpu_core_count": fmt.Sprintf("%d", gpuCoreCount),
-	}).Set(1)
-
 	processList = w.NewList()
 	processList.Title = "Process List"
 	processList.TextStyle = ui.NewStyle(ui.ColorGreen)
@@ -111,33 +102,28 @@ func setupUI() {
 		numPoints = 500 // Minimum buffer size
 	}
 
-	powerValues = make([]float64, numPoints)
-	gpuValues = make([]float64, numPoints)
-	memoryUsedHistory = make([]float64, numPoints)
-	swapUsedHistory = make([]float64, numPoints)
-	cpuUsageHistory = make([]float64, numPoints)
-	powerUsageHistory = make([]float64, numPoints)
+	historyWindow = numPoints
 
 	sparkline = w.NewSparkline()
 	sparkline.MaxHeight = 100
-	sparkline.Data = powerValues
+	sparkline.Data = make([]float64, historyWindow)
 
 	sparklineGroup = w.NewSparklineGroup(sparkline)
 
 	gpuSparkline = w.NewSparkline()
 	gpuSparkline.MaxHeight = 100
-	gpuSparkline.Data = gpuValues
+	gpuSparkline.Data = make([]float64, historyWindow)
 	gpuSparklineGroup = w.NewSparklineGroup(gpuSparkline)
 	gpuSparklineGroup.Title = "GPU Usage History"
 
 	// TB Net sparklines
 	tbNetSparklineIn = w.NewSparkline()
-	tbNetSparklineIn.Data = tbNetInValues
+	tbNetSparklineIn.Data = make([]float64, historyWindow)
 	tbNetSparklineIn.LineColor = ui.ColorGreen
 	tbNetSparklineIn.TitleStyle.Fg = ui.ColorGreen
 
 	tbNetSparklineOut = w.NewSparkline()
-	tbNetSparklineOut.Data = tbNetOutValues
+	tbNetSparklineOut.Data = make([]float64, historyWindow)
 	tbNetSparklineOut.LineColor = ui.ColorMagenta
 	tbNetSparklineOut.TitleStyle.Fg = ui.ColorMagenta
 
@@ -204,7 +190,7 @@ func setupUI() {
 }
 
 func updateModelText() {
-	appleSiliconModel := getSOCInfo()
+	appleSiliconModel := metricSource.SystemInfo()
 	modelName := appleSiliconModel.Name
 	if modelName == "" {
 		modelName = "Unknown Model"
@@ -228,6 +214,10 @@ func updateModelText() {
 }
 
 func updateIntervalText() {
+	if dropped := snapshotBus.Dropped(); dropped > 0 {
+		mainBlock.TitleBottomRight = fmt.Sprintf(" -/+ %dms | %d dropped ", updateInterval, dropped)
+		return
+	}
 	mainBlock.TitleBottomRight = fmt.Sprintf(" -/+ %dms ", updateInterval)
 }
 
@@ -282,22 +272,55 @@ func updateHelpText() {
 			"- /: Search process list\n"+
 			"- g/G: Jump to top/bottom of process list\n"+
 			"- + or -: Adjust update interval (faster/slower)\n"+
+			"- z: Cycle history charts between raw, 10s and 1m resolution\n"+
 			"- h or ?: Toggle this help menu\n"+
 			"- j/k or ↓/↑: Scroll help text\n"+
+			"- P: Pause/Resume replay\n"+
+			"- , or .: Seek replay back/forward 10s (< or > for 60s)\n"+
 			"- q or <C-c>: Quit the application\n\n"+
 			"----Start Flags----\n"+
 			"--help, -h: Show this help menu\n"+
 			"--version, -v: Show the version of mactop\n"+
 			"--interval, -i: Set the update interval in milliseconds. Default is 1000.\n"+
-			"--prometheus, -p: Set and enable a Prometheus metrics port. Default is none. (e.g. --prometheus=9090)\n"+
+			"--prometheus, -p: Enable the metrics server on a port or host:port (/metrics, /healthz, /api/v1/snapshot). Default is none. (e.g. --prometheus=9090)\n"+
+			"--web: Serve the browser dashboard on a port or host:port. Default is none. (e.g. --web=8081)\n"+
+			"--discover: Announce this node and list peers over UDP on the Thunderbolt bridge. Default is off.\n"+
+			"--discover-interface, --discover-port: Interfaces and UDP port for --discover. Default is the bridge / 47474.\n"+
 			"--headless: Run in headless mode (no TUI, output to stdout)\n"+
-			"--format: Output format for headless mode (json, yaml, xml, csv, toon). Default is json.\n"+
+			"--format: Output format for headless mode (json, ndjson, json-seq, yaml, xml, csv, toon, influx). Default is json.\n"+
 			"--pretty: Pretty print output in headless mode\n"+
 			"--count: Number of samples to collect in headless mode (0 = infinite)\n"+
+			"--fields, --exclude: Keep or drop dotted paths in headless output (e.g. soc_metrics.*_power). Default is all.\n"+
+			"--schema: Headless output schema, v1 or v2 (named, unit-suffixed fields). Default is v1.\n"+
+			"--aggregate: Print one summary per window in headless mode (e.g. 60s). Default is every sample.\n"+
 			"--dump-ioreport, -d: Dump all available IOReport channels and exit\n"+
 			"--unit-network: Network unit: auto, byte, kb, mb, gb (default: auto)\n"+
 			"--unit-disk: Disk unit: auto, byte, kb, mb, gb (default: auto)\n"+
 			"--unit-temp: Temperature unit: celsius, fahrenheit (default: celsius)\n"+
+			"--energy-price, --carbon-intensity: Price per kWh and grams of CO2 per kWh for the session energy. Default is none.\n"+
+			"--source: Metric source: darwin (live) or demo (synthetic load)\n"+
+			"--record: Record samples and process lists to a compressed file\n"+
+			"--replay: Replay a recording instead of collecting live metrics\n"+
+			"--speed: Replay speed multiplier (e.g. 4x). Default is 1x.\n"+
+			"--persist: Append samples to ~/.mactop/history (query with mactop history)\n"+
+			"--persist-max-age, --persist-max-size: History retention. Default is 7d / 512 MB.\n"+
+			"--webhook: POST batches of samples as JSON to a URL\n"+
+			"--webhook-header: Extra webhook request header (repeatable)\n"+
+			"--webhook-batch, --webhook-flush: Samples per request and partial batch delay. Default is 10 / 10s.\n"+
+			"--webhook-spool-size: Undelivered webhook batches kept on disk in MB. Default is 64.\n"+
+			"--otlp-endpoint: Push metrics to an OTLP/HTTP collector (e.g. http://localhost:4318)\n"+
+			"--otlp-header, --otlp-interval: Extra OTLP request header (repeatable) and push interval. Default interval is 10s.\n"+
+			"--influx-url: Write samples to an InfluxDB v2 server (e.g. http://localhost:8086)\n"+
+			"--influx-org, --influx-bucket, --influx-token: InfluxDB destination and API token (token defaults to $INFLUX_TOKEN)\n"+
+			"--influx-interval: How often to write InfluxDB batches. Default is 10s.\n"+
+			"--statsd: Send gauges to a StatsD/DogStatsD agent over UDP (host:port)\n"+
+			"--statsd-prefix, --statsd-tags: Metric name prefix (default mactop) and extra DogStatsD tags (k:v,k:v)\n"+
+			"--statsd-plain: Omit DogStatsD tags for plain StatsD servers\n"+
+			"--remote-write: Push the Prometheus metrics to a remote_write receiver\n"+
+			"--remote-write-label: External label name=value added to every series (repeatable)\n"+
+			"--remote-write-username, --remote-write-password, --remote-write-bearer-token: Receiver credentials\n"+
+			"--remote-write-interval, --remote-write-queue-size: Push interval and on-disk retry queue in MB. Default is 15s / 64.\n"+
+			"--listen, --serve-history: Address and /history window of mactop serve. Default is :8080 / 1h.\n"+
 			"--foreground: Set the UI foreground color (named or hex, e.g., green, #9580FF)\n"+
 			"--bg: Set the UI background color (named or hex, e.g., mocha-base, #22212C)\n\n"+
 			"Theme File: Create ~/.mactop/theme.json for custom colors:\n"+
@@ -501,6 +524,24 @@ func initializeTheme(colorName string, setColor bool, interval int, setInterval
 }
 
 func Run() {
+	// `mactop serve` takes the same flags as the TUI, so it is parsed by Run
+	// rather than handled as a subcommand.
+	serveMode := len(os.Args) > 1 && os.Args[1] == "serve"
+	if serveMode {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	if err := runSubcommand(os.Args[1:]); !errors.Is(err, errUnknownCommand) {
+		var status exitStatus
+		if errors.As(err, &status) {
+			os.Exit(int(status))
+		}
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	colorName, interval, setColor, setInterval := handleLegacyFlags()
 
 	logfile, err := setupLogfile()
@@ -514,7 +555,11 @@ func Run() {
 	flag.BoolVar(&headless, "headless", false, "Run in headless mode (no TUI, output JSON to stdout)")
 	flag.BoolVar(&headlessPretty, "pretty", false, "Pretty print output in headless mode")
 	flag.IntVar(&headlessCount, "count", 0, "Number of samples to collect in headless mode (0 = infinite)")
-	flag.StringVar(&headlessFormat, "format", "json", "Output format for headless mode: json, yaml, xml, csv, toon")
+	flag.StringVar(&headlessFormat, "format", "json", "Output format for headless mode: json, ndjson, json-seq, yaml, xml, csv, toon, influx")
+	flag.StringVar(&headlessSchema, "schema", "v1", "Headless output schema: v1 (compatible) or v2 (named, unit-suffixed fields)")
+	flag.DurationVar(&aggregateEvery, "aggregate", 0, "Print one summary per window in headless mode, e.g. 60s (min/max/mean/p50/p95/last, energy, time in thermal state)")
+	flag.StringVar(&headlessFields, "fields", "", "Comma-separated dotted paths to keep in headless output, e.g. soc_metrics.*_power,memory.used")
+	flag.StringVar(&excludeFields, "exclude", "", "Comma-separated dotted paths to drop from headless output, e.g. thunderbolt_info")
 	flag.IntVar(&updateInterval, "interval", 1000, "Update interval in milliseconds")
 	flag.IntVar(&updateInterval, "i", 1000, "Update interval in milliseconds")
 	flag.Bool("d", false, "Dump all available IOReport channels and exit")
@@ -525,20 +570,99 @@ func Run() {
 	flag.StringVar(&networkUnit, "unit-network", "auto", "Network unit: auto, byte, kb, mb, gb")
 	flag.StringVar(&diskUnit, "unit-disk", "auto", "Disk unit: auto, byte, kb, mb, gb")
 	flag.StringVar(&tempUnit, "unit-temp", "celsius", "Temperature unit: celsius, fahrenheit")
+	flag.Float64Var(&energyPrice, "energy-price", 0, "Electricity price per kWh, for the session energy cost (e.g. 0.30)")
+	flag.Float64Var(&carbonPerKWh, "carbon-intensity", 0, "Grid carbon intensity in grams of CO2 per kWh, for the session CO2 (e.g. 400)")
+	flag.StringVar(&sourceName, "source", defaultMetricSource, "Metric source: darwin (live IOReport/SMC) or demo (synthetic load)")
+	flag.StringVar(&recordPath, "record", "", "Record every sample and process list to a compressed NDJSON file")
+	flag.StringVar(&replayPath, "replay", "", "Replay a file written by --record instead of collecting live metrics")
+	flag.StringVar(&replaySpeed, "speed", "1x", "Replay speed multiplier (e.g. 0.5x, 4x)")
+	flag.BoolVar(&persistHistory, "persist", false, "Append every sample to ~/.mactop/history for mactop history")
+	flag.StringVar(&persistMaxAge, "persist-max-age", "7d", "Delete persisted history older than this (e.g. 48h, 30d)")
+	flag.IntVar(&persistMaxMB, "persist-max-size", 512, "Cap persisted history at this many megabytes")
+	flag.StringVar(&webhookURL, "webhook", "", "POST batches of samples as JSON to this URL")
+	flag.Var(&webhookHeaders, "webhook-header", "Extra header for --webhook requests, e.g. \"Authorization: Bearer <token>\" (repeatable)")
+	flag.IntVar(&webhookBatch, "webhook-batch", 10, "Samples per --webhook request")
+	flag.DurationVar(&webhookFlush, "webhook-flush", 10*time.Second, "Send a partial --webhook batch after this long")
+	flag.IntVar(&webhookSpoolMB, "webhook-spool-size", 64, "Megabytes of undelivered --webhook batches to keep on disk")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "Push metrics to an OTLP/HTTP collector, e.g. http://localhost:4318")
+	flag.Var(&otlpHeaders, "otlp-header", "Extra header for OTLP requests, e.g. \"Authorization: Bearer <token>\" (repeatable)")
+	flag.DurationVar(&otlpInterval, "otlp-interval", 10*time.Second, "How often to push metrics to --otlp-endpoint")
+	flag.StringVar(&influxURL, "influx-url", "", "Write samples to an InfluxDB v2 server, e.g. http://localhost:8086")
+	flag.StringVar(&influxOrg, "influx-org", "", "InfluxDB organization for --influx-url")
+	flag.StringVar(&influxBucket, "influx-bucket", "", "InfluxDB bucket for --influx-url")
+	flag.StringVar(&influxToken, "influx-token", "", "InfluxDB API token (default: $INFLUX_TOKEN)")
+	flag.DurationVar(&influxInterval, "influx-interval", 10*time.Second, "How often to write batches to --influx-url")
+	flag.StringVar(&statsdAddr, "statsd", "", "Send gauges to a StatsD/DogStatsD agent at host:port over UDP")
+	flag.StringVar(&statsdPrefix, "statsd-prefix", "mactop", "Metric name prefix for --statsd")
+	flag.StringVar(&statsdTags, "statsd-tags", "", "Extra DogStatsD tags for --statsd, e.g. team:ci,env:prod")
+	flag.BoolVar(&statsdPlain, "statsd-plain", false, "Send --statsd gauges without DogStatsD tags")
+	flag.StringVar(&rwURL, "remote-write", "", "Push the Prometheus metrics to this remote_write URL, e.g. http://localhost:9090/api/v1/write")
+	flag.Var(&rwLabels, "remote-write-label", "External label for --remote-write series, e.g. host=mac01 (repeatable)")
+	flag.StringVar(&rwUsername, "remote-write-username", "", "Basic auth username for --remote-write")
+	flag.StringVar(&rwPassword, "remote-write-password", "", "Basic auth password for --remote-write (default: $MACTOP_REMOTE_WRITE_PASSWORD)")
+	flag.StringVar(&rwBearerToken, "remote-write-bearer-token", "", "Bearer token for --remote-write (default: $MACTOP_REMOTE_WRITE_TOKEN)")
+	flag.DurationVar(&rwInterval, "remote-write-interval", 15*time.Second, "How often to push to --remote-write")
+	flag.IntVar(&rwQueueMB, "remote-write-queue-size", 64, "Megabytes of undelivered --remote-write requests to keep on disk")
+	flag.StringVar(&webAddr, "web", "", "Serve the browser dashboard on this port or address, e.g. :8081")
+	flag.BoolVar(&discoverPeers, "discover", false, "Announce this node and list other mactops on the Thunderbolt bridge")
+	flag.StringVar(&discoverIface, "discover-interface", "", "Comma-separated interfaces for --discover (default: the Thunderbolt bridge and its members)")
+	flag.IntVar(&discoverPort, "discover-port", discoveryDefaultPort, "UDP port for --discover")
+	serveListen := flag.String("listen", ":8080", "Address for mactop serve, e.g. :8080 or 127.0.0.1:8080")
+	serveRetention := flag.Duration("serve-history", time.Hour, "How much recent history mactop serve keeps for /history")
 
 	loadConfig()
+	if retention, err := currentConfig.History.Retention(); err != nil {
+		stderrLogger.Printf("%v, using defaults\n", err)
+	} else {
+		history = NewHistoryStore(retention)
+	}
+	var alertErrs []error
+	alertEngine, alertErrs = newAlertEngineFromConfig(currentConfig.Alerts)
+	for _, err := range alertErrs {
+		stderrLogger.Printf("Skipping alert: %v\n", err)
+	}
 
 	// Load saved sort column from config (only if explicitly set)
-	if currentConfig.SortColumn != nil && *currentConfig.SortColumn >= 0 && *currentConfig.SortColumn < len(columns) {
-		selectedColumn = *currentConfig.SortColumn
+	for i, col := range columns {
+		if col == currentConfig.SortBy {
+			selectedColumn = i
+		}
 	}
 	sortReverse = currentConfig.SortReverse
 
+	applyEnergyConfig()
+
 	flag.Parse()
+	if energyPrice < 0 || carbonPerKWh < 0 {
+		stderrLogger.Fatalf("--energy-price and --carbon-intensity must not be negative")
+	}
+
+	intervalSet := setInterval
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "interval" || f.Name == "i" {
+			intervalSet = true
+		}
+	})
+	if err := configureMetricSource(intervalSet); err != nil {
+		stderrLogger.Fatalf("failed to select metric source: %v", err)
+	}
+	if err := configureSinks(); err != nil {
+		stderrLogger.Fatalf("failed to configure exporters: %v", err)
+	}
 
 	currentUser = os.Getenv("USER")
 
+	if serveMode {
+		if err := runServe(*serveListen, *serveRetention); err != nil {
+			stderrLogger.Fatalf("mactop serve: %v", err)
+		}
+		return
+	}
+
 	if headless {
+		if replay != nil && (headlessCount == 0 || headlessCount > replay.Len()) {
+			headlessCount = replay.Len()
+		}
 		runHeadless(headlessCount)
 		return
 	}
@@ -550,16 +674,15 @@ func Run() {
 	}
 	defer ui.Close()
 
-	if err := initSocMetrics(); err != nil {
+	if err := metricSource.Init(); err != nil {
 		stderrLogger.Fatalf("failed to initialize metrics: %v", err)
 	}
-	defer cleanupSocMetrics()
+	defer metricSource.Close()
 
 	StderrToLogfile(logfile)
 
 	if prometheusPort != "" {
-		startPrometheusServer(prometheusPort)
-		stderrLogger.Printf("Prometheus metrics available at http://localhost:%s/metrics\n", prometheusPort)
+		startMetricsServer(prometheusPort)
 	}
 	setupUI()
 	initializeTheme(colorName, setColor, interval, setInterval)
@@ -576,54 +699,13 @@ func Run() {
 	}
 	renderUI()
 
-	initialSocMetrics := sampleSocMetrics(100)
-	_, throttled := getThermalStateString()
-	componentSum := initialSocMetrics.TotalPower
-	totalPower := componentSum
-	systemResidual := 0.0
-
-	if initialSocMetrics.SystemPower > componentSum {
-		totalPower = initialSocMetrics.SystemPower
-		systemResidual = initialSocMetrics.SystemPower - componentSum
-	}
-	cpuMetrics := CPUMetrics{
-		CPUW:      initialSocMetrics.CPUPower,
-		GPUW:      initialSocMetrics.GPUPower,
-		ANEW:      initialSocMetrics.ANEPower,
-		DRAMW:     initialSocMetrics.DRAMPower,
-		GPUSRAMW:  initialSocMetrics.GPUSRAMPower,
-		SystemW:   systemResidual,
-		PackageW:  totalPower,
-		Throttled: throttled,
-		CPUTemp:   float64(initialSocMetrics.CPUTemp),
-		GPUTemp:   float64(initialSocMetrics.GPUTemp),
-	}
-	gpuMetrics := GPUMetrics{
-		FreqMHz:       int(initialSocMetrics.GPUFreqMHz),
-		ActivePercent: initialSocMetrics.GPUActive,
-		Power:         initialSocMetrics.GPUPower + initialSocMetrics.GPUSRAMPower,
-		Temp:          initialSocMetrics.GPUTemp,
-	}
-
-	cpuMetricsChan <- cpuMetrics
-	gpuMetricsChan <- gpuMetrics
-
-	if processes, err := getProcessList(0.0); err == nil {
-		processMetricsChan <- processes
-	}
-
-	netdiskMetricsChan <- getNetDiskMetrics()
-
-	triggerProcessCollectionChan := make(chan struct{}, 1)
-
-	go collectMetrics(done, cpuMetricsChan, gpuMetricsChan, tbNetStatsChan, triggerProcessCollectionChan)
-	go collectProcessMetrics(done, processMetricsChan, triggerProcessCollectionChan)
-	go collectNetDiskMetrics(done, netdiskMetricsChan)
+	startSnapshotConsumers(done)
+	uiSnapshots := snapshotBus.Subscribe("tui", 1)
+	go collectSnapshots(done, snapshotBus, 2)
 
 	uiEvents := ui.PollEvents()
-	ticker = time.NewTicker(time.Duration(updateInterval) * time.Millisecond)
 
-	startBackgroundUpdates(done)
+	startBackgroundUpdates(done, uiSnapshots)
 	renderUI()
 
 	defer func() {
@@ -655,37 +737,25 @@ func setupLogfile() (*os.File, error) {
 	return logfile, nil
 }
 
-func updateTotalPowerChart(watts float64) {
+func updateTotalPowerChart(watts float64, thermalStr string) {
 	if watts > maxPowerSeen {
 		maxPowerSeen = watts * 1.1
 	}
-	scaledValue := int((watts / maxPowerSeen) * 8)
-	if watts > 0 && scaledValue == 0 {
-		scaledValue = 1
-	}
-	for i := 0; i < len(powerValues)-1; i++ {
-		powerValues[i] = powerValues[i+1]
-		powerUsageHistory[i] = powerUsageHistory[i+1]
-	}
-	powerValues[len(powerValues)-1] = float64(scaledValue)
-	powerUsageHistory[len(powerUsageHistory)-1] = watts
+	powerUsageHistory := history.Values(histPower, historyResolution, historyWindow)
+	avgWatts := meanNonZero(powerUsageHistory)
 
-	var sum float64
-	count := 0
-	for _, v := range powerUsageHistory {
-		if v > 0 {
-			sum += v
-			count++
+	// The sparkline draws eighths of the peak seen so far.
+	powerValues := make([]float64, len(powerUsageHistory))
+	for i, v := range powerUsageHistory {
+		scaledValue := int((v / maxPowerSeen) * 8)
+		if v > 0 && scaledValue == 0 {
+			scaledValue = 1
 		}
-	}
-	avgWatts := 0.0
-	if count > 0 {
-		avgWatts = sum / float64(count)
+		powerValues[i] = float64(scaledValue)
 	}
 	sparkline.Data = powerValues
 	sparkline.MaxVal = 8
 	sparklineGroup.Title = fmt.Sprintf("%.2f W Total (Max: %.2f W)", watts, maxPowerSeen)
-	thermalStr, _ := getThermalStateString()
 	sparkline.Title = fmt.Sprintf("Avg: %.2f W | %s", avgWatts, thermalStr)
 
 	// Update power history StepChart - use terminal width for reliable slicing
@@ -699,48 +769,42 @@ func updateTotalPowerChart(watts float64) {
 		powerHistoryChart.Data = [][]float64{visibleData}
 		powerHistoryChart.MaxVal = maxPowerSeen * 1.1
 		powerHistoryChart.DataLabels = []string{fmt.Sprintf("%.1fW", watts)}
-		powerHistoryChart.Title = fmt.Sprintf("Power History (Avg: %.1fW, Max: %.1fW)", avgWatts, maxPowerSeen)
+		powerHistoryChart.Title = fmt.Sprintf("Power History (Avg: %.1fW, Max: %.1fW)%s", avgWatts, maxPowerSeen, historyTitleSuffix())
 	}
 }
 
-func updateCPUUI(cpuMetrics CPUMetrics) {
-	coreUsages, err := GetCPUPercentages()
-	if err != nil {
-		stderrLogger.Printf("Error getting CPU percentages: %v\n", err)
+func updateCPUUI(s Snapshot) {
+	if len(s.CoreUsages) == 0 {
 		return
 	}
-	cpuCoreWidget.UpdateUsage(coreUsages)
-	var totalUsage float64
-	for _, usage := range coreUsages {
-		totalUsage += usage
-	}
-	totalUsage /= float64(len(coreUsages))
+	cpuMetrics := s.CPU
+	cpuCoreWidget.UpdateUsage(s.CoreUsages)
+	totalUsage := s.CPUUsage()
 	cpuGauge.Percent = int(totalUsage)
 
 	updateCPUHistory(totalUsage)
 
 	updateCPUGaugeTitles(totalUsage, cpuMetrics)
 
-	thermalStr, _ := getThermalStateString()
-	updatePowerChartText(cpuMetrics, thermalStr)
+	updatePowerChartText(cpuMetrics, s.ThermalState, s.Energy)
 
-	memoryMetrics := getMemoryMetrics()
+	memoryMetrics := s.Memory
 	updateMemoryGaugeTitle(memoryMetrics)
 	memoryPercent := (float64(memoryMetrics.Used) / float64(memoryMetrics.Total)) * 100
 	memoryGauge.Percent = int(memoryPercent)
 
 	updateMemoryHistory(memoryMetrics)
-	finalizeCPUUI(totalUsage, coreUsages, cpuMetrics, memoryMetrics)
+
+	// Update gauge colors with dynamic saturation if 1977 theme is active
+	if currentConfig.Theme == "1977" {
+		update1977GaugeColors()
+	}
 }
 
 func updateCPUHistory(totalUsage float64) {
 	// Update CPU history StepChart
-	for i := 0; i < len(cpuUsageHistory)-1; i++ {
-		cpuUsageHistory[i] = cpuUsageHistory[i+1]
-	}
-	cpuUsageHistory[len(cpuUsageHistory)-1] = totalUsage
-
 	if cpuHistoryChart != nil {
+		cpuUsageHistory := history.Values(histCPU, historyResolution, historyWindow)
 		termWidth, _ := GetCachedTerminalDimensions()
 		// CPU Chart is usually half width in LayoutHistoryFull
 		visibleWidth := (termWidth / 2) - 4
@@ -769,7 +833,7 @@ func updateCPUHistory(totalUsage float64) {
 			cpuHistoryChart.Data = [][]float64{visibleData}
 			cpuHistoryChart.MaxVal = scaleMax
 			cpuHistoryChart.DataLabels = []string{fmt.Sprintf("%.0f%%", totalUsage)}
-			cpuHistoryChart.Title = fmt.Sprintf("CPU Usage History (%.1f%%)", totalUsage)
+			cpuHistoryChart.Title = fmt.Sprintf("CPU Usage History (%.1f%%)%s", totalUsage, historyTitleSuffix())
 		}
 	}
 }
@@ -780,14 +844,9 @@ func updateMemoryHistory(memoryMetrics MemoryMetrics) {
 	swapGB := float64(memoryMetrics.SwapUsed) / 1024 / 1024 / 1024
 	totalGB := float64(memoryMetrics.Total) / 1024 / 1024 / 1024
 
-	for i := 0; i < len(memoryUsedHistory)-1; i++ {
-		memoryUsedHistory[i] = memoryUsedHistory[i+1]
-		swapUsedHistory[i] = swapUsedHistory[i+1]
-	}
-	memoryUsedHistory[len(memoryUsedHistory)-1] = usedGB
-	swapUsedHistory[len(swapUsedHistory)-1] = swapGB
-
 	if memoryHistoryChart != nil {
+		memoryUsedHistory := history.Values(histMemUsed, historyResolution, historyWindow)
+		swapUsedHistory := history.Values(histSwapUsed, historyResolution, historyWindow)
 		termWidth, _ := GetCachedTerminalDimensions()
 		visibleWidth := (termWidth / 2) - 4 // Half width, account for borders
 		if visibleWidth <= 0 || visibleWidth > len(memoryUsedHistory) {
@@ -803,18 +862,8 @@ func updateMemoryHistory(memoryMetrics MemoryMetrics) {
 			fmt.Sprintf("%.1fGB", usedGB),
 			fmt.Sprintf("%.1fGB", swapGB),
 		}
-		memoryHistoryChart.Title = fmt.Sprintf("Mem: %.1f/%.1fGB, Swap: %.1fGB",
-			usedGB, totalGB, swapGB)
-	}
-}
-
-func finalizeCPUUI(totalUsage float64, coreUsages []float64, cpuMetrics CPUMetrics, memoryMetrics MemoryMetrics) {
-	ecoreAvg, pcoreAvg := calculateCoreAverages(coreUsages)
-	updateCPUPrometheusMetrics(totalUsage, ecoreAvg, pcoreAvg, coreUsages, cpuMetrics, memoryMetrics)
-
-	// Update gauge colors with dynamic saturation if 1977 theme is active
-	if currentConfig.Theme == "1977" {
-		update1977GaugeColors()
+		memoryHistoryChart.Title = fmt.Sprintf("Mem: %.1f/%.1fGB, Swap: %.1fGB%s",
+			usedGB, totalGB, swapGB, historyTitleSuffix())
 	}
 }
 
@@ -846,20 +895,23 @@ func updateCPUGaugeTitles(totalUsage float64, cpuMetrics CPUMetrics) {
 	aneGauge.Percent = int(aneUtil)
 }
 
-func updatePowerChartText(cpuMetrics CPUMetrics, thermalStr string) {
+// updatePowerChartText shows the current draw per component and the energy
+// used this session.
+func updatePowerChartText(cpuMetrics CPUMetrics, thermalStr string, energy EnergyTotals) {
 	PowerChart.Title = "Power Usage"
 	if isCompactLayout() {
 		PowerChart.Title = "Power"
-		PowerChart.Text = fmt.Sprintf("C:%.1fW G:%.1fW\nA:%.1fW D:%.1fW\nTot:%.1fW %s",
+		PowerChart.Text = fmt.Sprintf("C:%.1fW G:%.1fW\nA:%.1fW D:%.1fW\nTot:%.1fW %s\nSess:%.1fWh",
 			cpuMetrics.CPUW,
 			cpuMetrics.GPUW+cpuMetrics.GPUSRAMW,
 			cpuMetrics.ANEW,
 			cpuMetrics.DRAMW,
 			cpuMetrics.PackageW,
 			thermalStr,
+			energy.WattHours(),
 		)
 	} else {
-		PowerChart.Text = fmt.Sprintf("CPU: %.2f W | GPU: %.2f W\nANE: %.2f W | DRAM: %.2f W\nSystem: %.2f W\nTotal: %.2f W\nThermals: %s",
+		PowerChart.Text = fmt.Sprintf("CPU: %.2f W | GPU: %.2f W\nANE: %.2f W | DRAM: %.2f W\nSystem: %.2f W\nTotal: %.2f W\nThermals: %s\nSession: %s",
 			cpuMetrics.CPUW,
 			cpuMetrics.GPUW+cpuMetrics.GPUSRAMW,
 			cpuMetrics.ANEW,
@@ -867,6 +919,7 @@ func updatePowerChartText(cpuMetrics CPUMetrics, thermalStr string) {
 			cpuMetrics.SystemW,
 			cpuMetrics.PackageW,
 			thermalStr,
+			energySummary(energy),
 		)
 	}
 }
@@ -879,64 +932,6 @@ func updateMemoryGaugeTitle(memoryMetrics MemoryMetrics) {
 	}
 }
 
-func calculateCoreAverages(coreUsages []float64) (ecoreAvg, pcoreAvg float64) {
-	if cpuCoreWidget.eCoreCount > 0 && len(coreUsages) >= cpuCoreWidget.eCoreCount {
-		for i := 0; i < cpuCoreWidget.eCoreCount; i++ {
-			ecoreAvg += coreUsages[i]
-		}
-		ecoreAvg /= float64(cpuCoreWidget.eCoreCount)
-	}
-	if cpuCoreWidget.pCoreCount > 0 && len(coreUsages) >= cpuCoreWidget.eCoreCount+cpuCoreWidget.pCoreCount {
-		for i := cpuCoreWidget.eCoreCount; i < cpuCoreWidget.eCoreCount+cpuCoreWidget.pCoreCount; i++ {
-			pcoreAvg += coreUsages[i]
-		}
-		pcoreAvg /= float64(cpuCoreWidget.pCoreCount)
-	}
-	return ecoreAvg, pcoreAvg
-}
-
-func updateCPUPrometheusMetrics(totalUsage, ecoreAvg, pcoreAvg float64, coreUsages []float64, cpuMetrics CPUMetrics, memoryMetrics MemoryMetrics) {
-	thermalStateVal, _ := getThermalStateString()
-	thermalStateNum := 0
-	switch thermalStateVal {
-	case "Fair":
-		thermalStateNum = 1
-	case "Serious":
-		thermalStateNum = 2
-	case "Critical":
-		thermalStateNum = 3
-	}
-
-	cpuUsage.Set(totalUsage)
-	ecoreUsage.Set(ecoreAvg)
-	pcoreUsage.Set(pcoreAvg)
-	powerUsage.With(prometheus.Labels{"component": "cpu"}).Set(cpuMetrics.CPUW)
-	powerUsage.With(prometheus.Labels{"component": "gpu"}).Set(cpuMetrics.GPUW)
-	powerUsage.With(prometheus.Labels{"component": "ane"}).Set(cpuMetrics.ANEW)
-	powerUsage.With(prometheus.Labels{"component": "dram"}).Set(cpuMetrics.DRAMW)
-	powerUsage.With(prometheus.Labels{"component": "gpu_sram"}).Set(cpuMetrics.GPUSRAMW)
-	powerUsage.With(prometheus.Labels{"component": "system"}).Set(cpuMetrics.SystemW)
-	powerUsage.With(prometheus.Labels{"component": "total"}).Set(cpuMetrics.PackageW)
-	socTemp.Set(cpuMetrics.CPUTemp)
-	gpuTemp.Set(cpuMetrics.GPUTemp)
-	thermalState.Set(float64(thermalStateNum))
-
-	memoryUsage.With(prometheus.Labels{"type": "used"}).Set(float64(memoryMetrics.Used) / 1024 / 1024 / 1024)
-	memoryUsage.With(prometheus.Labels{"type": "total"}).Set(float64(memoryMetrics.Total) / 1024 / 1024 / 1024)
-	memoryUsage.With(prometheus.Labels{"type": "swap_used"}).Set(float64(memoryMetrics.SwapUsed) / 1024 / 1024 / 1024)
-	memoryUsage.With(prometheus.Labels{"type": "swap_total"}).Set(float64(memoryMetrics.SwapTotal) / 1024 / 1024 / 1024)
-
-	// Update per-core CPU usage metrics
-	eCoreCount := cpuCoreWidget.eCoreCount
-	for i, usage := range coreUsages {
-		coreType := "p"
-		if i < eCoreCount {
-			coreType = "e"
-		}
-		cpuCoreUsage.With(prometheus.Labels{"core": fmt.Sprintf("%d", i), "type": coreType}).Set(usage)
-	}
-}
-
 func updateGPUUI(gpuMetrics GPUMetrics) {
 	if isCompactLayout() {
 		if gpuMetrics.Temp > 0 {
@@ -953,23 +948,8 @@ func updateGPUUI(gpuMetrics GPUMetrics) {
 	}
 	gpuGauge.Percent = int(gpuMetrics.ActivePercent)
 
-	for i := 0; i < len(gpuValues)-1; i++ {
-		gpuValues[i] = gpuValues[i+1]
-	}
-	gpuValues[len(gpuValues)-1] = gpuMetrics.ActivePercent
-
-	var sum float64
-	count := 0
-	for _, v := range gpuValues {
-		if v > 0 {
-			sum += v
-			count++
-		}
-	}
-	avgGPU := 0.0
-	if count > 0 {
-		avgGPU = sum / float64(count)
-	}
+	gpuValues := history.Values(histGPU, historyResolution, historyWindow)
+	avgGPU := meanNonZero(gpuValues)
 
 	gpuSparkline.Data = gpuValues
 	gpuSparkline.MaxVal = 100 // GPU usage is 0-100%
@@ -996,15 +976,8 @@ func updateGPUUI(gpuMetrics GPUMetrics) {
 		gpuHistoryChart.Data = [][]float64{visibleData}
 		gpuHistoryChart.MaxVal = 100 // GPU usage is 0-100%
 		gpuHistoryChart.DataLabels = []string{fmt.Sprintf("%.0f%%", gpuMetrics.ActivePercent)}
-		gpuHistoryChart.Title = fmt.Sprintf("GPU Usage History (Avg: %.1f%%)", avgGPU)
-	}
-
-	if gpuMetrics.ActivePercent > 0 {
-		gpuUsage.Set(gpuMetrics.ActivePercent)
-	} else {
-		gpuUsage.Set(0)
+		gpuHistoryChart.Title = fmt.Sprintf("GPU Usage History (Avg: %.1f%%)%s", avgGPU, historyTitleSuffix())
 	}
-	gpuFreqMHz.Set(float64(gpuMetrics.FreqMHz))
 
 	// Update gauge colors with dynamic saturation if 1977 theme is active
 	if currentConfig.Theme == "1977" {
@@ -1041,7 +1014,7 @@ func updateNetDiskUI(netdiskMetrics NetDiskMetrics) {
 
 }
 
-func updateTBNetUI(tbStats []ThunderboltNetStats) {
+func updateTBNetUI(tbStats []ThunderboltNetStats, rdmaStatus RDMAStatus) {
 	if tbStats == nil {
 		return
 	}
@@ -1053,7 +1026,6 @@ func updateTBNetUI(tbStats []ThunderboltNetStats) {
 	}
 	lastTBInBytes = totalBytesIn
 	lastTBOutBytes = totalBytesOut
-	rdmaStatus := CheckRDMAAvailable()
 	rdmaLabel := "RDMA: Disabled"
 	if rdmaStatus.Available {
 		rdmaLabel = "RDMA: Enabled"
@@ -1077,15 +1049,9 @@ func updateTBNetUI(tbStats []ThunderboltNetStats) {
 	// Show RDMA status and bandwidth in text, above device list
 	tbInfoParagraph.Text = fmt.Sprintf("%s | TB Net: ↓%s/s ↑%s/s\n%s", rdmaLabel, inStr, outStr, tbDeviceInfo)
 
-	// Update TB Net sparklines with separate download/upload
-	// Shift values left and add new values
-	// Scale bytes to KB for sparkline
-	for i := 0; i < len(tbNetInValues)-1; i++ {
-		tbNetInValues[i] = tbNetInValues[i+1]
-		tbNetOutValues[i] = tbNetOutValues[i+1]
-	}
-	tbNetInValues[len(tbNetInValues)-1] = totalBytesIn / 1024
-	tbNetOutValues[len(tbNetOutValues)-1] = totalBytesOut / 1024
+	// Update TB Net sparklines with separate download/upload, in KB
+	tbNetInValues := history.Values(histTBIn, historyResolution, historyWindow)
+	tbNetOutValues := history.Values(histTBOut, historyResolution, historyWindow)
 
 	// Calculate independent max values for specific scaling
 	maxValIn := 1.0
@@ -1114,12 +1080,4 @@ func updateTBNetUI(tbStats []ThunderboltNetStats) {
 		}
 	}
 
-	// Update Prometheus metrics for Thunderbolt network and RDMA
-	tbNetworkSpeed.With(prometheus.Labels{"direction": "download"}).Set(totalBytesIn)
-	tbNetworkSpeed.With(prometheus.Labels{"direction": "upload"}).Set(totalBytesOut)
-	if rdmaStatus.Available {
-		rdmaAvailable.Set(1)
-	} else {
-		rdmaAvailable.Set(0)
-	}
 }
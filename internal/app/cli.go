@@ -64,6 +64,13 @@ func handleFlag(arg string, idx int, args []string) (int, string, int, bool, boo
 
 func printHelpAndExit() {
 	fmt.Print(`Usage: mactop [options]
+       mactop history [--since 2h] [--metric path] [--step 1m] [--format csv]
+       mactop serve [--listen :8080] [--serve-history 1h] [options]
+       mactop cluster [-i 1000] [--once] host:port [host:port ...]
+       mactop schema [--format jsonschema] [--schema v1|v2]
+       mactop run [-i 250] [--format text|json|markdown] -- command [args ...]
+       mactop diff [--format table|json|markdown] [--metric path] baseline candidate
+       mactop report [-o report.html] [--title text] input
 
 Options:
   -h, --help              Show this help message
@@ -71,15 +78,58 @@ Options:
   -i, --interval <ms>     Set the update interval in milliseconds (default: 1000)
   --foreground <color>    Set the UI foreground color (named or hex, e.g., green, #9580FF)
   --bg <color>            Set the UI background color (named or hex, e.g., mocha-base, #22212C)
-  -p, --prometheus <port> Run Prometheus metrics server on specified port (e.g. :9090)
+  -p, --prometheus <addr> Run the metrics server on a port or host:port (e.g. 9090, 127.0.0.1:9090)
+                          Serves /metrics, /healthz and /api/v1/snapshot
+      --web <addr>        Serve the browser dashboard on a port or host:port (e.g. 8081)
+      --discover          Announce this node and list other mactops on the Thunderbolt bridge
+      --discover-interface <list> Interfaces to announce on (default: bridge0 and its members)
+      --discover-port <port> UDP port for peer discovery (default: 47474)
       --headless          Run in headless mode (no TUI, output JSON to stdout)
-      --format <format>   Set the output format (json, toon, etc.)
+      --format <format>   Set the output format (json, ndjson, json-seq, yaml, xml, csv, toon, influx)
       --pretty            Pretty print JSON output in headless mode
       --count <n>         Number of samples to collect in headless mode (0 = infinite)
+      --fields <paths>    Keep only these dotted paths in headless output (wildcards allowed)
+      --exclude <paths>   Drop these dotted paths from headless output
+      --schema <v1|v2>    Headless output schema (default: v1)
+      --aggregate <dur>   Print one min/max/mean/p50/p95/last summary per window, e.g. 60s
       --dump-ioreport, -d Dump all available IOReport channels and exit
       --unit-network <unit> Network unit: auto, byte, kb, mb, gb (default: auto)
       --unit-disk <unit>    Disk unit: auto, byte, kb, mb, gb (default: auto)
       --unit-temp <unit>    Temperature unit: celsius, fahrenheit (default: celsius)
+      --energy-price <p>    Electricity price per kWh, shows the session energy cost
+      --carbon-intensity <g> Grams of CO2 per kWh, shows the session CO2
+      --source <name>       Metric source: darwin (live) or demo (synthetic load)
+      --record <file>       Record samples and process lists to a compressed file
+      --replay <file>       Replay a recording instead of collecting live metrics
+      --speed <n>x          Replay speed multiplier (default: 1x)
+      --persist             Append samples to ~/.mactop/history for 'mactop history'
+      --persist-max-age <d> Delete persisted history older than this (default: 7d)
+      --persist-max-size <mb> Cap persisted history size in MB (default: 512)
+      --webhook <url>       POST batches of samples as JSON to a URL
+      --webhook-header <h>  Extra request header, e.g. "Authorization: Bearer x" (repeatable)
+      --webhook-batch <n>   Samples per webhook request (default: 10)
+      --webhook-flush <d>   Send a partial batch after this long (default: 10s)
+      --webhook-spool-size <mb> Undelivered batches kept on disk in MB (default: 64)
+      --otlp-endpoint <url> Push metrics to an OTLP/HTTP collector (e.g. http://localhost:4318)
+      --otlp-header <h>     Extra OTLP request header (repeatable)
+      --otlp-interval <d>   OTLP push interval (default: 10s)
+      --influx-url <url>    Write samples to an InfluxDB v2 server (e.g. http://localhost:8086)
+      --influx-org <org>    InfluxDB organization
+      --influx-bucket <b>   InfluxDB bucket
+      --influx-token <t>    InfluxDB API token (default: $INFLUX_TOKEN)
+      --influx-interval <d> InfluxDB write interval (default: 10s)
+      --statsd <host:port>  Send gauges to a StatsD/DogStatsD agent over UDP
+      --statsd-prefix <p>   StatsD metric name prefix (default: mactop)
+      --statsd-tags <tags>  Extra DogStatsD tags, e.g. team:ci,env:prod
+      --statsd-plain        Omit DogStatsD tags for plain StatsD servers
+      --remote-write <url>  Push the Prometheus metrics to a remote_write receiver
+      --remote-write-label <l> External label, e.g. host=mac01 (repeatable)
+      --remote-write-username <u>, --remote-write-password <p> Basic auth credentials
+      --remote-write-bearer-token <t> Bearer token (default: $MACTOP_REMOTE_WRITE_TOKEN)
+      --remote-write-interval <d> Push interval (default: 15s)
+      --remote-write-queue-size <mb> Undelivered requests kept on disk in MB (default: 64)
+      --listen <addr>       Address for mactop serve (default: :8080)
+      --serve-history <d>   Recent history kept by mactop serve for /history (default: 1h)
 
 Theme File:
   Create ~/.mactop/theme.json with custom hex colors:
@@ -0,0 +1,370 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ui "github.com/metaspartan/gotui/v5"
+	w "github.com/metaspartan/gotui/v5/widgets"
+)
+
+// clusterSnapshotPath is served by `mactop serve`, --prometheus and --web.
+const clusterSnapshotPath = "/api/v1/snapshot"
+
+var clusterColumns = []string{"HOST", "CPU", "GPU", "POWER", "TEMP", "MEMORY", "TB IN", "TB OUT", "RDMA", "STATUS"}
+
+// clusterHost is the latest state of one remote mactop.
+type clusterHost struct {
+	Addr     string
+	URL      string
+	Output   HeadlessOutput
+	LastSeen time.Time
+	Err      error
+}
+
+// Stale reports whether the host has not answered within staleAfter.
+func (h clusterHost) Stale(now time.Time, staleAfter time.Duration) bool {
+	return h.LastSeen.IsZero() || now.Sub(h.LastSeen) > staleAfter
+}
+
+// clusterPoller fetches the latest snapshot of every host.
+type clusterPoller struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	hosts []clusterHost
+}
+
+// clusterURL turns host:port into the snapshot URL of that host. Full URLs
+// are used as given, with the snapshot path added if they have none.
+func clusterURL(addr string) (string, error) {
+	raw := addr
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid host %q, want host:port", addr)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = clusterSnapshotPath
+	}
+	return u.String(), nil
+}
+
+func newClusterPoller(addrs []string, timeout time.Duration) (*clusterPoller, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no hosts given, e.g. mactop cluster studio1:8080 studio2:8080")
+	}
+	p := &clusterPoller{client: &http.Client{Timeout: timeout}}
+	for _, addr := range addrs {
+		u, err := clusterURL(addr)
+		if err != nil {
+			return nil, err
+		}
+		p.hosts = append(p.hosts, clusterHost{Addr: addr, URL: u})
+	}
+	return p, nil
+}
+
+// Poll fetches every host at once and returns when all have answered or
+// timed out. Hosts that fail keep their last good snapshot.
+func (p *clusterPoller) Poll() {
+	var wg sync.WaitGroup
+	for i, h := range p.Hosts() {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			out, err := p.fetch(u)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.hosts[i].Err = err
+			if err == nil {
+				p.hosts[i].Output = out
+				p.hosts[i].LastSeen = time.Now()
+			}
+		}(i, h.URL)
+	}
+	wg.Wait()
+}
+
+func (p *clusterPoller) fetch(u string) (HeadlessOutput, error) {
+	var out HeadlessOutput
+	resp, err := p.client.Get(u)
+	if err != nil {
+		// The URL is already in the row, so keep just the reason.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return out, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return out, fmt.Errorf("%s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return out, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	return out, nil
+}
+
+// Hosts returns a copy of every host's state, in the order given.
+func (p *clusterPoller) Hosts() []clusterHost {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]clusterHost(nil), p.hosts...)
+}
+
+func clusterMemory(m MemoryMetrics) string {
+	return fmt.Sprintf("%.1f/%.0fG", float64(m.Used)/1024/1024/1024, float64(m.Total)/1024/1024/1024)
+}
+
+func clusterRDMA(r RDMAStatus) string {
+	if !r.Available {
+		return "off"
+	}
+	return fmt.Sprintf("on (%d)", len(r.Devices))
+}
+
+// clusterTable builds one row per host followed by the cluster totals, which
+// only count hosts that are up. The indexes of stale rows are returned so
+// they can be dimmed.
+func clusterTable(hosts []clusterHost, now time.Time, staleAfter time.Duration) ([][]string, []int) {
+	rows := [][]string{clusterColumns}
+	var stale []int
+
+	var up, rdmaOn int
+	var cpu, gpu, power, maxTemp, tbIn, tbOut float64
+	var total MemoryMetrics
+	for _, h := range hosts {
+		o := h.Output
+		if h.LastSeen.IsZero() {
+			reason := "unreachable"
+			if h.Err != nil {
+				reason = h.Err.Error()
+			}
+			stale = append(stale, len(rows))
+			rows = append(rows, []string{h.Addr, "-", "-", "-", "-", "-", "-", "-", "-", "stale: " + reason})
+			continue
+		}
+
+		status := "ok"
+		if h.Stale(now, staleAfter) {
+			status = fmt.Sprintf("stale %s", now.Sub(h.LastSeen).Truncate(time.Second))
+			stale = append(stale, len(rows))
+		} else {
+			up++
+			cpu += o.CPUUsage
+			gpu += o.GPUUsage
+			power += o.SocMetrics.TotalPower
+			if t := float64(o.SocMetrics.SocTemp); t > maxTemp {
+				maxTemp = t
+			}
+			total.Used += o.Memory.Used
+			total.Total += o.Memory.Total
+			tbIn += o.TBNetTotalBytesInSec
+			tbOut += o.TBNetTotalBytesOutSec
+			if o.RDMAStatus.Available {
+				rdmaOn++
+			}
+		}
+		rows = append(rows, []string{
+			h.Addr,
+			fmt.Sprintf("%.1f%%", o.CPUUsage),
+			fmt.Sprintf("%.1f%%", o.GPUUsage),
+			fmt.Sprintf("%.1fW", o.SocMetrics.TotalPower),
+			formatTemp(float64(o.SocMetrics.SocTemp)),
+			clusterMemory(o.Memory),
+			formatBytes(o.TBNetTotalBytesInSec, "auto") + "/s",
+			formatBytes(o.TBNetTotalBytesOutSec, "auto") + "/s",
+			clusterRDMA(o.RDMAStatus),
+			status,
+		})
+	}
+
+	totals := []string{fmt.Sprintf("cluster %d/%d up", up, len(hosts)), "-", "-", "-", "-", "-", "-", "-", "-", ""}
+	if up > 0 {
+		totals = []string{
+			totals[0],
+			fmt.Sprintf("%.1f%%", cpu/float64(up)),
+			fmt.Sprintf("%.1f%%", gpu/float64(up)),
+			fmt.Sprintf("%.1fW", power),
+			formatTemp(maxTemp),
+			clusterMemory(total),
+			formatBytes(tbIn, "auto") + "/s",
+			formatBytes(tbOut, "auto") + "/s",
+			fmt.Sprintf("%d/%d on", rdmaOn, up),
+			"",
+		}
+	}
+	rows = append(rows, totals)
+	return rows, stale
+}
+
+// clusterStaleAfter is how long a host may go unanswered before it is
+// marked stale: three polls, but never less than metricsMinStaleAfter.
+func clusterStaleAfter(interval time.Duration) time.Duration {
+	if d := 3 * interval; d > metricsMinStaleAfter {
+		return d
+	}
+	return metricsMinStaleAfter
+}
+
+func runClusterCommand(args []string) error {
+	fs := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	interval := fs.Int("interval", 1000, "Poll interval in milliseconds")
+	fs.IntVar(interval, "i", 1000, "Poll interval in milliseconds")
+	timeout := fs.Duration("timeout", 2*time.Second, "Timeout for each request to a host")
+	once := fs.Bool("once", false, "Poll every host once and print the table instead of starting the TUI")
+	fs.StringVar(&tempUnit, "unit-temp", "celsius", "Temperature unit: celsius, fahrenheit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mactop cluster [options] host:port [host:port ...]")
+		fmt.Fprintln(fs.Output(), "\nShow several Macs side by side. Each host must run `mactop serve`,")
+		fmt.Fprintln(fs.Output(), "mactop --prometheus or mactop --web.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval < 100 {
+		return fmt.Errorf("interval must be at least 100ms")
+	}
+
+	p, err := newClusterPoller(fs.Args(), *timeout)
+	if err != nil {
+		return err
+	}
+	every := time.Duration(*interval) * time.Millisecond
+
+	if *once {
+		p.Poll()
+		rows, _ := clusterTable(p.Hosts(), time.Now(), clusterStaleAfter(every))
+		printClusterTable(rows)
+		return nil
+	}
+	loadConfig()
+	return runClusterTUI(p, every)
+}
+
+// clusterColumnWidths fits each column to its widest cell.
+func clusterColumnWidths(rows [][]string) []int {
+	widths := make([]int, len(clusterColumns))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	return widths
+}
+
+func printClusterTable(rows [][]string) {
+	widths := clusterColumnWidths(rows)
+	for _, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				b.WriteString("  ")
+			}
+			b.WriteString(cell)
+			if i < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-len([]rune(cell))))
+			}
+		}
+		fmt.Fprintln(os.Stdout, b.String())
+	}
+}
+
+func runClusterTUI(p *clusterPoller, interval time.Duration) error {
+	if err := ui.Init(); err != nil {
+		return fmt.Errorf("failed to initialize termui: %v", err)
+	}
+	defer ui.Close()
+
+	color := GetThemeColor(currentConfig.Theme)
+	table := w.NewTable()
+	table.Title = fmt.Sprintf(" mactop cluster (%d hosts) ", len(p.Hosts()))
+	table.TitleBottom = " Exit: q "
+	table.BorderStyle.Fg = color
+	table.TitleStyle.Fg = color
+	table.TitleBottomStyle.Fg = color
+	table.TextStyle = ui.NewStyle(ui.ColorWhite)
+	table.SelectedRow = -1
+	table.RowSeparator = false
+	table.FillRow = true
+
+	staleAfter := clusterStaleAfter(interval)
+	draw := func() {
+		termWidth, termHeight := ui.TerminalDimensions()
+		table.SetRect(0, 0, termWidth, termHeight)
+		rows, stale := clusterTable(p.Hosts(), time.Now(), staleAfter)
+		table.Rows = rows
+		// Fit every column but the last, which gets what is left for the
+		// status and any error.
+		widths := clusterColumnWidths(rows)
+		used := len(widths) - 1
+		for _, n := range widths[:len(widths)-1] {
+			used += n
+		}
+		widths[len(widths)-1] = max(table.Inner.Dx()-used, 0)
+		table.ColumnWidths = widths
+		table.RowStyles = map[int]ui.Style{
+			0:             ui.NewStyle(color, ui.ColorClear, ui.ModifierBold),
+			len(rows) - 1: ui.NewStyle(color, ui.ColorClear, ui.ModifierBold),
+		}
+		for _, i := range stale {
+			table.RowStyles[i] = ui.NewStyle(SecondaryTextColor)
+		}
+		ui.Render(table)
+	}
+
+	polled := make(chan struct{}, 1)
+	polling := true
+	go func() {
+		p.Poll()
+		polled <- struct{}{}
+	}()
+	draw()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	events := ui.PollEvents()
+	for {
+		select {
+		case e := <-events:
+			switch e.ID {
+			case "q", "<C-c>":
+				return nil
+			case "<Resize>":
+				ui.Clear()
+				draw()
+			}
+		case <-polled:
+			polling = false
+			draw()
+		case <-ticker.C:
+			// A slow host can make a poll outlast the interval; skip the
+			// tick rather than pile up requests.
+			if !polling {
+				polling = true
+				go func() {
+					p.Poll()
+					polled <- struct{}{}
+				}()
+			}
+			draw()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeMactop(t *testing.T, out HeadlessOutput) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != clusterSnapshotPath {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClusterURL(t *testing.T) {
+	tests := []struct {
+		input, want string
+		wantErr     bool
+	}{
+		{"studio1:8080", "http://studio1:8080/api/v1/snapshot", false},
+		{"10.0.0.2:9090/", "http://10.0.0.2:9090/api/v1/snapshot", false},
+		{"https://studio2.lab/mactop/api/v1/snapshot", "https://studio2.lab/mactop/api/v1/snapshot", false},
+		{"http://", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := clusterURL(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("clusterURL(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestClusterPoll(t *testing.T) {
+	tempUnit = "celsius"
+	a := fakeMactop(t, HeadlessOutput{
+		CPUUsage: 20, GPUUsage: 50,
+		SocMetrics:           SocMetrics{TotalPower: 30, SocTemp: 45},
+		Memory:               MemoryMetrics{Used: 64 << 30, Total: 192 << 30},
+		TBNetTotalBytesInSec: 1 << 30,
+		RDMAStatus:           RDMAStatus{Available: true, Devices: []RDMADevice{{Name: "rdma_en2"}}},
+	})
+	b := fakeMactop(t, HeadlessOutput{
+		CPUUsage: 40, GPUUsage: 10,
+		SocMetrics:            SocMetrics{TotalPower: 12.5, SocTemp: 61},
+		Memory:                MemoryMetrics{Used: 32 << 30, Total: 64 << 30},
+		TBNetTotalBytesOutSec: 1 << 30,
+	})
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no sample collected yet", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	hosts := []string{a.Listener.Addr().String(), b.Listener.Addr().String(), failing.Listener.Addr().String(), down.Listener.Addr().String()}
+	p, err := newClusterPoller(hosts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Poll()
+	now := time.Now()
+	rows, stale := clusterTable(p.Hosts(), now, 5*time.Second)
+
+	if len(rows) != 6 {
+		t.Fatalf("got %d rows, want header, 4 hosts and totals:\n%v", len(rows), rows)
+	}
+	if got := strings.Join(rows[1], "|"); got != hosts[0]+"|20.0%|50.0%|30.0W|45°C|64.0/192G|1.0GB/s|0.0B/s|on (1)|ok" {
+		t.Errorf("host a row = %s", got)
+	}
+	if got := rows[3][9]; got != "stale: 503 Service Unavailable" {
+		t.Errorf("failing host status = %q", got)
+	}
+	if got := rows[4][9]; !strings.HasPrefix(got, "stale: ") {
+		t.Errorf("unreachable host status = %q", got)
+	}
+	if len(stale) != 2 || stale[0] != 3 || stale[1] != 4 {
+		t.Errorf("stale rows = %v, want [3 4]", stale)
+	}
+	if got := strings.Join(rows[5], "|"); got != "cluster 2/4 up|30.0%|30.0%|42.5W|61°C|96.0/256G|1.0GB/s|1.0GB/s|1/2 on|" {
+		t.Errorf("totals = %s", got)
+	}
+
+	// Once a host stops answering it keeps its last values but drops out of
+	// the totals.
+	b.Close()
+	p.Poll()
+	rows, _ = clusterTable(p.Hosts(), now.Add(10*time.Second), 5*time.Second)
+	if got := rows[2][9]; !strings.HasPrefix(got, "stale ") || rows[2][1] != "40.0%" {
+		t.Errorf("stopped host row = %v", rows[2])
+	}
+	if got := rows[5][0]; got != "cluster 0/4 up" {
+		t.Errorf("totals after 10s = %q", got)
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"errors"
+	"strings"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+// runSubcommand handles `mactop <command> ...`. It returns errUnknownCommand
+// when args do not start with a command so Run can carry on as usual.
+func runSubcommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errUnknownCommand
+	}
+	switch args[0] {
+	case "history":
+		return runHistoryCommand(args[1:])
+	case "cluster":
+		return runClusterCommand(args[1:])
+	case "schema":
+		return runSchemaCommand(args[1:])
+	case "run":
+		return runRunCommand(args[1:])
+	case "diff":
+		return runDiffCommand(args[1:])
+	case "report":
+		return runReportCommand(args[1:])
+	}
+	return errUnknownCommand
+}
@@ -17,13 +17,32 @@ type AppConfig struct {
 	DefaultLayout string             `json:"default_layout"`
 	Theme         string             `json:"theme"`
 	Background    string             `json:"background,omitempty"`
-	SortColumn    *int               `json:"sort_column,omitempty"`
+	SortColumn    *int               `json:"sort_column,omitempty"` // replaced by sort_by
+	SortBy        string             `json:"sort_by,omitempty"`
 	SortReverse   bool               `json:"sort_reverse"`
 	CustomTheme   *CustomThemeConfig `json:"custom_theme,omitempty"`
+	History       *HistoryConfig     `json:"history,omitempty"`
+	Alerts        []AlertConfig      `json:"alerts,omitempty"`
+	Energy        *EnergyConfig      `json:"energy,omitempty"`
 }
 
 var currentConfig AppConfig
 
+// legacySortColumns are the process columns that sort_column indexed, before
+// WATTS and ENERGY were added and it was replaced by sort_by.
+var legacySortColumns = []string{"PID", "USER", "VIRT", "RES", "CPU", "GPU", "MEM", "TIME", "CMD"}
+
+// migrateSortColumn turns a saved sort_column index into a sort_by name.
+func migrateSortColumn(c *AppConfig) {
+	if c.SortColumn == nil {
+		return
+	}
+	if i := *c.SortColumn; c.SortBy == "" && i >= 0 && i < len(legacySortColumns) {
+		c.SortBy = legacySortColumns[i]
+	}
+	c.SortColumn = nil
+}
+
 // migrateThemeName converts old 'catppuccin-*' theme names to short form
 func migrateThemeName(theme string) string {
 	oldToNew := map[string]string{
@@ -61,6 +80,8 @@ func loadConfig() {
 		currentConfig = AppConfig{DefaultLayout: "default"}
 	}
 
+	migrateSortColumn(&currentConfig)
+
 	// Migrate old theme names
 	if currentConfig.Theme != "" {
 		newTheme := migrateThemeName(currentConfig.Theme)
@@ -0,0 +1,735 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diffSeries is every numeric field of a recorded session, keyed by its
+// dotted path in the headless output (or CSV column).
+type diffSeries struct {
+	metrics []string // in the order they first appear
+	values  map[string][]float64
+	times   []time.Time
+}
+
+func newDiffSeries() *diffSeries {
+	return &diffSeries{values: make(map[string][]float64)}
+}
+
+func (d *diffSeries) add(metric string, v float64) {
+	if _, ok := d.values[metric]; !ok {
+		d.metrics = append(d.metrics, metric)
+	}
+	d.values[metric] = append(d.values[metric], v)
+}
+
+func (d *diffSeries) addTree(tree fieldObject, at time.Time) {
+	walkNumbers("", tree, d.add)
+	if !at.IsZero() {
+		d.times = append(d.times, at)
+	}
+}
+
+// Samples is the number of samples read, or of timestamps when some samples
+// had numbers and others did not.
+func (d *diffSeries) Samples() int {
+	n := len(d.times)
+	for _, v := range d.values {
+		n = max(n, len(v))
+	}
+	return n
+}
+
+// Duration is how long the session ran, or 0 when the samples carry no
+// usable timestamps.
+func (d *diffSeries) Duration() time.Duration {
+	return sessionDuration(d.times)
+}
+
+// sessionDuration is the span of times plus one sample's share, so n samples
+// at interval i count as n*i. It is 0 for fewer than two distinct times.
+func sessionDuration(times []time.Time) time.Duration {
+	n := len(times)
+	if n < 2 || !times[n-1].After(times[0]) {
+		return 0
+	}
+	span := times[n-1].Sub(times[0])
+	return span + span/time.Duration(n-1)
+}
+
+// diffPowerMetrics are the total power fields of v1, v2 and v1 CSV output,
+// in that order of preference.
+var diffPowerMetrics = []string{"soc_metrics.total_power", "power.total_watts", "Total_Power"}
+
+// diffEnergyMetric is the session energy counter of v1 and v2 output.
+const diffEnergyMetric = "energy.total_joules"
+
+// EnergyJoules is the energy the session used, or false when the series has
+// neither an energy counter nor total power and a duration.
+func (d *diffSeries) EnergyJoules() (float64, bool) {
+	var watts []float64
+	for _, m := range diffPowerMetrics {
+		if v := d.values[m]; len(v) > 0 {
+			watts = v
+			break
+		}
+	}
+	return sessionEnergy(d.times, watts, d.values[diffEnergyMetric])
+}
+
+// sessionEnergy is the energy of a session sampled at times, for both
+// mactop diff and mactop report. The counter is what the collector metered;
+// without it the mean total power is taken over the session's duration.
+func sessionEnergy(times []time.Time, watts, counter []float64) (float64, bool) {
+	if n := len(counter); n >= 2 && counter[n-1] >= counter[0] {
+		return counter[n-1] - counter[0], true
+	}
+	if seconds := sessionDuration(times).Seconds(); len(watts) > 0 && seconds > 0 {
+		return mean(watts) * seconds, true
+	}
+	return 0, false
+}
+
+// spreadSampleTimes spaces runs of equal times evenly up to the next time,
+// or across one second for the last run.
+func spreadSampleTimes(times []time.Time) {
+	for i := 0; i < len(times); {
+		j := i + 1
+		for j < len(times) && times[j].Equal(times[i]) {
+			j++
+		}
+		next := times[i].Add(time.Second)
+		if j < len(times) && times[j].Before(next) {
+			next = times[j]
+		}
+		step := next.Sub(times[i]) / time.Duration(j-i)
+		for k := i + 1; k < j; k++ {
+			times[k] = times[i].Add(step * time.Duration(k-i))
+		}
+		i = j
+	}
+}
+
+// readDiffSeries loads a session written by --record (gzip), headless
+// json/ndjson/json-seq, or headless csv (with or without --fields).
+func readDiffSeries(path string) (*diffSeries, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d *diffSeries
+	trimmed := bytes.TrimLeft(data, " \t\r\n\x1e")
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		d, err = readRecordingSeries(bytes.NewReader(data))
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		d, err = readJSONSeries(data)
+	default:
+		d, err = readCSVSeries(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if d.Samples() == 0 {
+		return nil, fmt.Errorf("%s: no samples", path)
+	}
+	// Headless timestamps are whole seconds.
+	spreadSampleTimes(d.times)
+	return d, nil
+}
+
+func readRecordingSeries(r io.Reader) (*diffSeries, error) {
+	_, frames, err := readRecording(r)
+	if err != nil {
+		return nil, err
+	}
+	d := newDiffSeries()
+	sel := &fieldSelection{}
+	for _, f := range frames {
+		tree, err := sel.Project(f.Sample)
+		if err != nil {
+			return nil, err
+		}
+		d.addTree(tree, f.Time)
+	}
+	return d, nil
+}
+
+// readJSONSeries reads a stream of JSON samples, as NDJSON, json-seq or the
+// array written by --format json with --count.
+func readJSONSeries(data []byte) (*diffSeries, error) {
+	dec := json.NewDecoder(bytes.NewReader(bytes.ReplaceAll(data, []byte{0x1e}, nil)))
+	dec.UseNumber()
+	d := newDiffSeries()
+	var add func(v any) error
+	add = func(v any) error {
+		switch v := v.(type) {
+		case fieldObject:
+			d.addTree(v, diffSampleTime(v))
+		case []any:
+			for _, item := range v {
+				if err := add(item); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("expected JSON objects, got %T", v)
+		}
+		return nil
+	}
+	for {
+		v, err := decodeFieldValue(dec)
+		if errors.Is(err, io.EOF) {
+			return d, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		if err := add(v); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// diffSampleTime is the time of a JSON sample, or of the end of an
+// --aggregate window.
+func diffSampleTime(o fieldObject) time.Time {
+	for _, f := range o {
+		if f.Key != "timestamp" && f.Key != "window_end" {
+			continue
+		}
+		if s, ok := f.Value.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// readCSVSeries reads headless CSV. Every column that parses as a number is
+// a metric; Timestamp (or timestamp) gives the sample times.
+func readCSVSeries(data []byte) (*diffSeries, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	d := newDiffSeries()
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return d, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			if strings.EqualFold(header[i], "timestamp") || header[i] == "window_end" {
+				if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+					d.times = append(d.times, t)
+				}
+				continue
+			}
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				d.add(header[i], v)
+			}
+		}
+	}
+}
+
+// DiffStats summarises one metric of one session.
+type DiffStats struct {
+	Samples int     `json:"samples"`
+	Mean    float64 `json:"mean"`
+	P95     float64 `json:"p95"`
+	Peak    float64 `json:"peak"`
+}
+
+// MetricDiff compares a metric between the baseline (A) and the candidate
+// (B). PValue is nil when either side has too few samples to test.
+type MetricDiff struct {
+	Metric           string    `json:"metric"`
+	A                DiffStats `json:"a"`
+	B                DiffStats `json:"b"`
+	MeanDelta        float64   `json:"mean_delta"`
+	MeanDeltaPercent *float64  `json:"mean_delta_percent"`
+	P95Delta         float64   `json:"p95_delta"`
+	PeakDelta        float64   `json:"peak_delta"`
+	PValue           *float64  `json:"p_value"`
+	Status           string    `json:"status"`
+}
+
+// DiffRun describes one of the compared sessions.
+type DiffRun struct {
+	File            string   `json:"file"`
+	Samples         int      `json:"samples"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	EnergyJoules    *float64 `json:"energy_joules"`
+}
+
+// DiffReport is the result of `mactop diff`.
+type DiffReport struct {
+	A                  DiffRun      `json:"a"`
+	B                  DiffRun      `json:"b"`
+	EnergyDeltaJoules  *float64     `json:"energy_delta_joules"`
+	EnergyDeltaPercent *float64     `json:"energy_delta_percent"`
+	Alpha              float64      `json:"alpha"`
+	ThresholdPercent   float64      `json:"threshold_percent"`
+	Regressions        int          `json:"regressions"`
+	Improvements       int          `json:"improvements"`
+	Metrics            []MetricDiff `json:"metrics"`
+}
+
+// Statuses of a MetricDiff. Whether a change is a regression or an
+// improvement depends on diffDirection; metrics with no better direction
+// are only marked changed.
+const (
+	diffRegression  = "regression"
+	diffImprovement = "improvement"
+	diffChanged     = "changed"
+	diffUnchanged   = "unchanged"
+)
+
+// diffDirection is 1 for metrics that are better lower, as power,
+// temperature, utilisation and used memory are, -1 for available memory,
+// which is better higher, and 0 for clock frequencies, which follow the load.
+func diffDirection(metric string) int {
+	name := strings.ToLower(metric)
+	switch {
+	case strings.Contains(name, "freq_mhz"):
+		return 0
+	case strings.Contains(name, "available"):
+		return -1
+	}
+	return 1
+}
+
+// diffOptions are the `mactop diff` flags that shape the comparison.
+type diffOptions struct {
+	Metrics   []string // path prefixes to compare, all when empty
+	Alpha     float64  // significance level of the t-test
+	Threshold float64  // smallest change of the mean in percent to flag
+	All       bool     // include metrics that are identical in both runs
+}
+
+func (o diffOptions) selected(metric string) bool {
+	if len(o.Metrics) == 0 {
+		return true
+	}
+	for _, m := range o.Metrics {
+		if metric == m || strings.HasPrefix(metric, m+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// variance is the sample variance of values.
+func variance(values []float64, m float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum / float64(len(values)-1)
+}
+
+func diffStats(values []float64) DiffStats {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return DiffStats{
+		Samples: len(values),
+		Mean:    mean(values),
+		P95:     nearestRank(sorted, 0.95),
+		Peak:    sorted[len(sorted)-1],
+	}
+}
+
+// percentChange is the change from a to b in percent of a, or nil when a is
+// zero.
+func percentChange(a, b float64) *float64 {
+	if a == 0 {
+		return nil
+	}
+	p := (b - a) / math.Abs(a) * 100
+	return &p
+}
+
+// welchPValue is the two-sided p-value of Welch's t-test for a difference
+// between the means of a and b. Both need at least two values.
+func welchPValue(a, b []float64) float64 {
+	ma, mb := mean(a), mean(b)
+	va := variance(a, ma) / float64(len(a))
+	vb := variance(b, mb) / float64(len(b))
+	if va+vb == 0 {
+		if ma == mb {
+			return 1
+		}
+		return 0
+	}
+	t := (mb - ma) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/float64(len(a)-1) + vb*vb/float64(len(b)-1))
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// regIncBeta is the regularized incomplete beta function I_x(a, b).
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta
+// function with the modified Lentz method.
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	clamp := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c, d := 1.0, 1/clamp(1-(a+b)*x/(a+1))
+	h := d
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 / clamp(1+num*d)
+		c = clamp(1 + num/c)
+		h *= d * c
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 / clamp(1+num*d)
+		c = clamp(1 + num/c)
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-12 {
+			break
+		}
+	}
+	return h
+}
+
+// compareMetric diffs one metric. A change is flagged when the t-test is
+// significant at opts.Alpha and the mean moved by at least opts.Threshold
+// percent.
+func compareMetric(metric string, a, b []float64, opts diffOptions) MetricDiff {
+	d := MetricDiff{Metric: metric, A: diffStats(a), B: diffStats(b), Status: diffUnchanged}
+	d.MeanDelta = d.B.Mean - d.A.Mean
+	d.MeanDeltaPercent = percentChange(d.A.Mean, d.B.Mean)
+	d.P95Delta = d.B.P95 - d.A.P95
+	d.PeakDelta = d.B.Peak - d.A.Peak
+	if len(a) < 2 || len(b) < 2 {
+		return d
+	}
+	p := welchPValue(a, b)
+	d.PValue = &p
+	large := d.MeanDeltaPercent == nil || math.Abs(*d.MeanDeltaPercent) >= opts.Threshold
+	if p < opts.Alpha && large && d.MeanDelta != 0 {
+		switch dir := diffDirection(metric); {
+		case dir == 0:
+			d.Status = diffChanged
+		case d.MeanDelta*float64(dir) > 0:
+			d.Status = diffRegression
+		default:
+			d.Status = diffImprovement
+		}
+	}
+	return d
+}
+
+// sameConstant reports whether every value of a and b is the same.
+func sameConstant(a, b []float64) bool {
+	for _, v := range append(a[1:len(a):len(a)], b...) {
+		if v != a[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffSessions compares every metric the two sessions have in common, in the
+// order of a.
+func diffSessions(a, b *diffSeries, opts diffOptions) DiffReport {
+	r := DiffReport{
+		A:                DiffRun{Samples: a.Samples(), DurationSeconds: a.Duration().Seconds()},
+		B:                DiffRun{Samples: b.Samples(), DurationSeconds: b.Duration().Seconds()},
+		Alpha:            opts.Alpha,
+		ThresholdPercent: opts.Threshold,
+		Metrics:          []MetricDiff{},
+	}
+	ea, okA := a.EnergyJoules()
+	eb, okB := b.EnergyJoules()
+	if okA {
+		r.A.EnergyJoules = &ea
+	}
+	if okB {
+		r.B.EnergyJoules = &eb
+	}
+	if okA && okB {
+		delta := eb - ea
+		r.EnergyDeltaJoules = &delta
+		r.EnergyDeltaPercent = percentChange(ea, eb)
+	}
+
+	for _, metric := range a.metrics {
+		va, vb := a.values[metric], b.values[metric]
+		if len(vb) == 0 || !opts.selected(metric) {
+			continue
+		}
+		if strings.HasPrefix(metric, "energy.") {
+			// Session counters grow with the length of the run; the energy
+			// is compared as a whole above.
+			continue
+		}
+		if !opts.All && sameConstant(va, vb) {
+			// Core counts, schema_version and the like.
+			continue
+		}
+		d := compareMetric(metric, va, vb, opts)
+		switch d.Status {
+		case diffRegression:
+			r.Regressions++
+		case diffImprovement:
+			r.Improvements++
+		}
+		r.Metrics = append(r.Metrics, d)
+	}
+	return r
+}
+
+// writeDiffReport prints r as a table, json or markdown.
+func writeDiffReport(w io.Writer, format string, r DiffReport) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "markdown", "md":
+		return writeDiffMarkdown(w, r)
+	case "table", "text":
+		return writeDiffTable(w, r)
+	}
+	return fmt.Errorf("unknown format %q, want table, json or markdown", format)
+}
+
+func formatDiffFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func formatDiffDelta(v float64) string {
+	if v > 0 {
+		return "+" + formatDiffFloat(v)
+	}
+	return formatDiffFloat(v)
+}
+
+func formatDiffPercent(p *float64) string {
+	if p == nil {
+		return "n/a"
+	}
+	return formatDiffDelta(*p) + "%"
+}
+
+func formatDiffPValue(p *float64) string {
+	if p == nil {
+		return "n/a"
+	}
+	if *p < 0.001 {
+		return "<0.001"
+	}
+	return strconv.FormatFloat(*p, 'f', 3, 64)
+}
+
+// diffEnergyText is e.g. "12.40 Wh -> 10.85 Wh (-12.50%)".
+func diffEnergyText(r DiffReport) string {
+	side := func(e *float64) string {
+		if e == nil {
+			return "n/a"
+		}
+		return formatEnergy(*e)
+	}
+	s := side(r.A.EnergyJoules) + " -> " + side(r.B.EnergyJoules)
+	if r.EnergyDeltaJoules != nil {
+		s += " (" + formatDiffPercent(r.EnergyDeltaPercent) + ")"
+	}
+	return s
+}
+
+// diffRows is the table body shared by the table and markdown output.
+func diffRows(r DiffReport) [][]string {
+	rows := make([][]string, 0, len(r.Metrics))
+	for _, m := range r.Metrics {
+		rows = append(rows, []string{
+			m.Metric,
+			formatDiffFloat(m.A.Mean), formatDiffFloat(m.B.Mean),
+			formatDiffDelta(m.MeanDelta), formatDiffPercent(m.MeanDeltaPercent),
+			formatDiffDelta(m.P95Delta), formatDiffDelta(m.PeakDelta),
+			formatDiffPValue(m.PValue), m.Status,
+		})
+	}
+	return rows
+}
+
+var diffColumns = []string{"METRIC", "A MEAN", "B MEAN", "Δ MEAN", "Δ%", "Δ P95", "Δ PEAK", "P", "STATUS"}
+
+func writeDiffTable(w io.Writer, r DiffReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "A: %s (%d samples, %.1f s)\n", r.A.File, r.A.Samples, r.A.DurationSeconds)
+	fmt.Fprintf(&b, "B: %s (%d samples, %.1f s)\n", r.B.File, r.B.Samples, r.B.DurationSeconds)
+	fmt.Fprintf(&b, "Energy: %s\n", diffEnergyText(r))
+	fmt.Fprintf(&b, "%d regressions, %d improvements (p < %g, |Δ%%| >= %g)\n\n", r.Regressions, r.Improvements, r.Alpha, r.ThresholdPercent)
+
+	rows := diffRows(r)
+	widths := make([]int, len(diffColumns))
+	for i, c := range diffColumns {
+		widths[i] = len([]rune(c))
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+	line := func(cells []string) {
+		for i, cell := range cells {
+			pad := strings.Repeat(" ", widths[i]-len([]rune(cell)))
+			switch {
+			case i == 0:
+				b.WriteString(cell + pad)
+			case i == len(cells)-1:
+				b.WriteString("  " + cell)
+			default:
+				b.WriteString("  " + pad + cell)
+			}
+		}
+		b.WriteString("\n")
+	}
+	line(diffColumns)
+	for _, row := range rows {
+		line(row)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeDiffMarkdown(w io.Writer, r DiffReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## mactop diff\n\n")
+	fmt.Fprintf(&b, "| | File | Samples | Duration |\n|---|---|---:|---:|\n")
+	fmt.Fprintf(&b, "| A | `%s` | %d | %.1f s |\n", r.A.File, r.A.Samples, r.A.DurationSeconds)
+	fmt.Fprintf(&b, "| B | `%s` | %d | %.1f s |\n\n", r.B.File, r.B.Samples, r.B.DurationSeconds)
+	fmt.Fprintf(&b, "**Energy:** %s  \n", diffEnergyText(r))
+	fmt.Fprintf(&b, "**%d regressions, %d improvements** (p < %g, |Δ%%| >= %g)\n\n", r.Regressions, r.Improvements, r.Alpha, r.ThresholdPercent)
+	fmt.Fprintf(&b, "| %s |\n|---|---:|---:|---:|---:|---:|---:|---:|---|\n", strings.Join(diffColumns, " | "))
+	for _, row := range diffRows(r) {
+		row[0] = "`" + row[0] + "`"
+		if row[8] == diffRegression {
+			row[8] = "**" + row[8] + "**"
+		}
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(row, " | "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func runDiffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := fs.String("format", "table", "Output format: table, json or markdown")
+	metrics := fs.String("metric", "", "Comma-separated metric paths or prefixes to compare, e.g. soc_metrics,gpu_usage (default: all)")
+	alpha := fs.Float64("alpha", 0.05, "Significance level of the t-test")
+	threshold := fs.Float64("threshold", 5, "Smallest change of the mean, in percent, to flag")
+	all := fs.Bool("all", false, "Include metrics that are constant and equal in both runs")
+	failOn := fs.Bool("fail-on-regression", false, "Exit with status 1 when a regression is found")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mactop diff [options] baseline candidate")
+		fmt.Fprintln(fs.Output(), "\nCompare two sessions written by --record or by --headless as json, ndjson,")
+		fmt.Fprintln(fs.Output(), "json-seq or csv. Significant changes of a metric's mean are flagged as")
+		fmt.Fprintln(fs.Output(), "regressions or improvements.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("need exactly two files to compare")
+	}
+	if *alpha <= 0 || *alpha >= 1 {
+		return errors.New("--alpha must be between 0 and 1")
+	}
+	if *threshold < 0 {
+		return errors.New("--threshold must not be negative")
+	}
+	*format = strings.ToLower(*format)
+	if err := writeDiffReport(io.Discard, *format, DiffReport{}); err != nil {
+		return err
+	}
+
+	opts := diffOptions{Alpha: *alpha, Threshold: *threshold, All: *all}
+	for _, m := range strings.Split(*metrics, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			opts.Metrics = append(opts.Metrics, m)
+		}
+	}
+	a, err := readDiffSeries(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := readDiffSeries(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	r := diffSessions(a, b, opts)
+	r.A.File, r.B.File = fs.Arg(0), fs.Arg(1)
+	if len(r.Metrics) == 0 && r.EnergyDeltaJoules == nil {
+		return errors.New("the files have no metrics in common")
+	}
+	if err := writeDiffReport(os.Stdout, *format, r); err != nil {
+		return err
+	}
+	if *failOn && r.Regressions > 0 {
+		return exitStatus(1)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWelchPValue(t *testing.T) {
+	// Two-sided 5% critical values of Student's t.
+	for _, tt := range []struct{ df, t float64 }{{1, 12.706}, {10, 2.228}, {30, 2.042}} {
+		if p := regIncBeta(tt.df/2, 0.5, tt.df/(tt.df+tt.t*tt.t)); math.Abs(p-0.05) > 5e-4 {
+			t.Errorf("p(t=%g, df=%g) = %.5f, want 0.05", tt.t, tt.df, p)
+		}
+	}
+
+	tests := []struct {
+		name string
+		a, b []float64
+		want func(p float64) bool
+	}{
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, func(p float64) bool { return p == 1 }},
+		{"constant and different", []float64{5, 5}, []float64{6, 6}, func(p float64) bool { return p == 0 }},
+		{"overlapping", []float64{1, 3, 2, 4}, []float64{2, 4, 1, 3.5}, func(p float64) bool { return p > 0.5 }},
+		{"shifted", []float64{10, 11, 10, 11, 10}, []float64{20, 21, 20, 21, 20}, func(p float64) bool { return p < 0.001 }},
+	}
+	for _, tt := range tests {
+		if p := welchPValue(tt.a, tt.b); !tt.want(p) {
+			t.Errorf("%s: p = %g", tt.name, p)
+		}
+	}
+}
+
+func TestSpreadSampleTimes(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+
+	times := []time.Time{at(0), at(0), at(0), at(0), at(1000), at(1000), at(5000)}
+	spreadSampleTimes(times)
+	want := []time.Time{at(0), at(250), at(500), at(750), at(1000), at(1500), at(5000)}
+	for i := range want {
+		if !times[i].Equal(want[i]) {
+			t.Errorf("times[%d] = %v, want %v", i, times[i].Sub(base), want[i].Sub(base))
+		}
+	}
+}
+
+func TestReadDiffSeries(t *testing.T) {
+	dir := t.TempDir()
+	sample := func(ts string, watts string) string {
+		return `{"timestamp":"` + ts + `","soc_metrics":{"total_power":` + watts + `},"thermal_state":"Normal"}`
+	}
+	files := map[string]string{
+		"ndjson": sample("2025-01-01T00:00:00Z", "10") + "\n" + sample("2025-01-01T00:00:01Z", "20") + "\n",
+		"json":   "[" + sample("2025-01-01T00:00:00Z", "10") + ",\n" + sample("2025-01-01T00:00:01Z", "20") + "]\n",
+		"seq":    "\x1e" + sample("2025-01-01T00:00:00Z", "10") + "\n\x1e" + sample("2025-01-01T00:00:01Z", "20") + "\n",
+		"csv": "Timestamp,System_Name,Total_Power\n" +
+			"2025-01-01T00:00:00Z,Apple M4,10\n2025-01-01T00:00:01Z,Apple M4,20\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		d, err := readDiffSeries(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		metric := "soc_metrics.total_power"
+		if name == "csv" {
+			metric = "Total_Power"
+		}
+		if got := d.values[metric]; len(got) != 2 || got[0] != 10 || got[1] != 20 {
+			t.Errorf("%s: %s = %v, want [10 20]", name, metric, got)
+		}
+		if len(d.metrics) != 1 {
+			t.Errorf("%s: metrics = %v, want only %s", name, d.metrics, metric)
+		}
+		if e, ok := d.EnergyJoules(); !ok || e != 30 {
+			t.Errorf("%s: energy = %v, %v, want 30 J over 2 s", name, e, ok)
+		}
+	}
+
+	energy := []struct {
+		name, content string
+		want          float64
+	}{
+		// The collector's counter wins over the power estimate.
+		{"counter", `{"timestamp":"2025-01-01T00:00:00Z","soc_metrics":{"total_power":10},"energy":{"total_joules":100}}` + "\n" +
+			`{"timestamp":"2025-01-01T00:00:01Z","soc_metrics":{"total_power":20},"energy":{"total_joules":125}}` + "\n", 25},
+		// Five samples a second at 10 W share whole-second timestamps.
+		{"fast", strings.Repeat(sample("2025-01-01T00:00:00Z", "10")+"\n", 5) +
+			strings.Repeat(sample("2025-01-01T00:00:01Z", "10")+"\n", 5), 20},
+	}
+	for _, tt := range energy {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		d, err := readDiffSeries(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if e, ok := d.EnergyJoules(); !ok || math.Abs(e-tt.want) > 1e-9 {
+			t.Errorf("%s: energy = %v, %v, want %v J", tt.name, e, ok, tt.want)
+		}
+	}
+
+	path, live := recordDemoSession(t, 4)
+	d, err := readDiffSeries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Samples() != len(live) || d.Duration().Seconds() != 4 {
+		t.Errorf("recording: %d samples over %v, want %d over 4s", d.Samples(), d.Duration(), len(live))
+	}
+
+	if _, err := readDiffSeries(filepath.Join(dir, "missing")); err == nil {
+		t.Error("readDiffSeries of a missing file succeeded")
+	}
+}
+
+func TestDiffSessions(t *testing.T) {
+	series := func(power, temp []float64) *diffSeries {
+		d := newDiffSeries()
+		for i := range power {
+			d.add("soc_metrics.total_power", power[i])
+			d.add("soc_metrics.cpu_temp", temp[i])
+			d.add("system_info.core_count", 10)
+			d.add("energy.total_joules", float64(i)*power[i])
+		}
+		return d
+	}
+	a := series([]float64{10, 11, 10, 11, 10, 11}, []float64{50, 52, 51, 50, 52, 51})
+	b := series([]float64{20, 21, 20, 21, 20, 21}, []float64{51, 50, 52, 51, 50, 52})
+
+	r := diffSessions(a, b, diffOptions{Alpha: 0.05, Threshold: 5})
+	if r.Regressions != 1 || r.Improvements != 0 || len(r.Metrics) != 2 {
+		t.Fatalf("got %d regressions, %d improvements, metrics %+v", r.Regressions, r.Improvements, r.Metrics)
+	}
+	power, temp := r.Metrics[0], r.Metrics[1]
+	if power.Metric != "soc_metrics.total_power" || power.Status != diffRegression || power.MeanDelta != 10 || power.PeakDelta != 10 {
+		t.Errorf("power: %+v", power)
+	}
+	if temp.Status != diffUnchanged || *temp.PValue < 0.5 {
+		t.Errorf("temp: %+v", temp)
+	}
+
+	// Swapped, the same change is an improvement; below the threshold it is
+	// not flagged at all.
+	if r := diffSessions(b, a, diffOptions{Alpha: 0.05, Threshold: 5}); r.Improvements != 1 || r.Regressions != 0 {
+		t.Errorf("swapped: %d regressions, %d improvements", r.Regressions, r.Improvements)
+	}
+	if r := diffSessions(a, b, diffOptions{Alpha: 0.05, Threshold: 200}); r.Regressions != 0 {
+		t.Errorf("threshold 200%%: %d regressions", r.Regressions)
+	}
+
+	r = diffSessions(a, b, diffOptions{Alpha: 0.05, Threshold: 5, Metrics: []string{"system_info"}, All: true})
+	if len(r.Metrics) != 1 || r.Metrics[0].Metric != "system_info.core_count" {
+		t.Errorf("--metric system_info --all: %+v", r.Metrics)
+	}
+
+	// More available memory is better; frequencies are neither.
+	direction := func(metric string, a, b []float64) string {
+		return compareMetric(metric, a, b, diffOptions{Alpha: 0.05, Threshold: 5}).Status
+	}
+	low, high := []float64{10, 11, 10, 11}, []float64{20, 21, 20, 21}
+	tests := []struct {
+		metric string
+		want   string
+	}{
+		{"memory.used", diffRegression},
+		{"memory.available", diffImprovement},
+		{"memory.available_bytes", diffImprovement},
+		{"soc_metrics.gpu_freq_mhz", diffChanged},
+		{"cpu.p_cluster.freq_mhz", diffChanged},
+		{"ECPU_Freq_MHz", diffChanged},
+	}
+	for _, tt := range tests {
+		if got := direction(tt.metric, low, high); got != tt.want {
+			t.Errorf("%s going up: %s, want %s", tt.metric, got, tt.want)
+		}
+	}
+
+	r.A.File, r.B.File = "before.ndjson", "after.ndjson"
+	for _, format := range []string{"table", "markdown", "json"} {
+		var b strings.Builder
+		if err := writeDiffReport(&b, format, r); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !strings.Contains(b.String(), "system_info.core_count") || !strings.Contains(b.String(), "after.ndjson") {
+			t.Errorf("%s report:\n%s", format, b.String())
+		}
+	}
+}
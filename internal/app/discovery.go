@@ -0,0 +1,262 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryDefaultPort = 47474
+	discoveryInterval    = 5 * time.Second
+	// discoveryPeerTTL is how long a peer is listed after its last
+	// announcement.
+	discoveryPeerTTL = 3 * discoveryInterval
+	discoveryMagic   = "mactop-peer/1"
+)
+
+// peerAnnouncement is the UDP datagram each node broadcasts.
+type peerAnnouncement struct {
+	Magic      string     `json:"magic"`
+	ID         string     `json:"id"`
+	Hostname   string     `json:"hostname"`
+	Version    string     `json:"version"`
+	SystemInfo SystemInfo `json:"system_info"`
+	APIPort    int        `json:"api_port,omitempty"`
+}
+
+// Peer is another mactop seen on the network.
+type Peer struct {
+	Hostname   string     `json:"hostname" yaml:"hostname" xml:"Hostname" toon:"hostname"`
+	Address    string     `json:"address" yaml:"address" xml:"Address" toon:"address"`
+	APIPort    int        `json:"api_port,omitempty" yaml:"api_port,omitempty" xml:"APIPort,omitempty" toon:"api_port,omitempty"`
+	Model      string     `json:"model" yaml:"model" xml:"Model" toon:"model"`
+	SystemInfo SystemInfo `json:"system_info" yaml:"system_info" xml:"SystemInfo" toon:"system_info"`
+	Version    string     `json:"version" yaml:"version" xml:"Version" toon:"version"`
+	LastSeen   string     `json:"last_seen" yaml:"last_seen" xml:"LastSeen" toon:"last_seen"`
+
+	lastSeen time.Time
+}
+
+// peerDiscovery announces this node on a UDP socket and keeps track of the
+// announcements it receives from others.
+type peerDiscovery struct {
+	conn    *net.UDPConn
+	self    peerAnnouncement
+	targets func() []*net.UDPAddr
+
+	mu    sync.Mutex
+	peers map[string]Peer
+}
+
+func newPeerDiscovery(conn *net.UDPConn, self peerAnnouncement, targets func() []*net.UDPAddr) *peerDiscovery {
+	self.Magic = discoveryMagic
+	if self.ID == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		self.ID = hex.EncodeToString(id)
+	}
+	return &peerDiscovery{conn: conn, self: self, targets: targets, peers: make(map[string]Peer)}
+}
+
+// discoveryInterfaces returns the interfaces to announce on: the configured
+// comma-separated list, or the Thunderbolt bridge and its members.
+func discoveryInterfaces(configured string) []string {
+	var names []string
+	if configured != "" {
+		for _, name := range strings.Split(configured, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	for name := range getTBBridgeMembers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// broadcastTargets returns the IPv4 broadcast address of every named
+// interface. Loopback has no broadcast address, so its own address is used.
+func broadcastTargets(names []string, port int) []*net.UDPAddr {
+	var targets []*net.UDPAddr
+	seen := make(map[string]bool)
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			ip := ipnet.IP.To4()
+			target := make(net.IP, 4)
+			if iface.Flags&net.FlagLoopback != 0 {
+				copy(target, ip)
+			} else if iface.Flags&net.FlagBroadcast != 0 {
+				mask := ipnet.Mask
+				if len(mask) == 16 {
+					mask = mask[12:]
+				}
+				for i := range target {
+					target[i] = ip[i] | ^mask[i]
+				}
+			} else {
+				continue
+			}
+			if !seen[target.String()] {
+				seen[target.String()] = true
+				targets = append(targets, &net.UDPAddr{IP: target, Port: port})
+			}
+		}
+	}
+	return targets
+}
+
+// discoveryAPIPort is the port other nodes can fetch /api/v1/snapshot from:
+// mactop serve's listener, else --prometheus, else --web.
+func discoveryAPIPort() int {
+	for _, addr := range []string{serveAddr, prometheusPort, webAddr} {
+		if addr == "" {
+			continue
+		}
+		_, port, err := net.SplitHostPort(metricsListenAddr(addr))
+		if err != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(port); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// startPeerDiscovery listens on port and announces this node on the
+// discovery interfaces until done is closed.
+func startPeerDiscovery(done chan struct{}, interfaces string, port int) (*peerDiscovery, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for peers on port %d: %v", port, err)
+	}
+	names := discoveryInterfaces(interfaces)
+	if len(broadcastTargets(names, port)) == 0 {
+		stderrLogger.Printf("Peer discovery: no IPv4 address on %v, only listening; set --discover-interface to announce\n", names)
+	}
+	hostname, _ := os.Hostname()
+	d := newPeerDiscovery(conn, peerAnnouncement{
+		Hostname:   hostname,
+		Version:    version,
+		SystemInfo: metricSource.SystemInfo(),
+		APIPort:    discoveryAPIPort(),
+	}, func() []*net.UDPAddr { return broadcastTargets(names, port) })
+
+	go d.receive()
+	go func() {
+		ticker := time.NewTicker(discoveryInterval)
+		defer ticker.Stop()
+		failing := false
+		for {
+			err := d.Announce()
+			if err != nil && !failing {
+				stderrLogger.Printf("Peer announcement failed: %v\n", err)
+			}
+			failing = err != nil
+			select {
+			case <-done:
+				conn.Close()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return d, nil
+}
+
+// Announce sends this node's announcement to every target.
+func (d *peerDiscovery) Announce() error {
+	data, err := json.Marshal(d.self)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, target := range d.targets() {
+		if _, err := d.conn.WriteToUDP(data, target); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *peerDiscovery) receive() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		d.handle(buf[:n], from, time.Now())
+	}
+}
+
+// handle records an announcement sent from the given address. Datagrams that are not
+// mactop announcements, and this node's own, are ignored.
+func (d *peerDiscovery) handle(data []byte, from *net.UDPAddr, now time.Time) {
+	var a peerAnnouncement
+	if err := json.Unmarshal(data, &a); err != nil || a.Magic != discoveryMagic || a.ID == "" || a.ID == d.self.ID {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.peers[a.ID] = Peer{
+		Hostname:   a.Hostname,
+		Address:    from.IP.String(),
+		APIPort:    a.APIPort,
+		Model:      a.SystemInfo.Name,
+		SystemInfo: a.SystemInfo,
+		Version:    a.Version,
+		LastSeen:   now.Format(time.RFC3339),
+		lastSeen:   now,
+	}
+}
+
+// Peers returns the peers heard from within discoveryPeerTTL of now, sorted
+// by hostname, and forgets the rest.
+func (d *peerDiscovery) Peers(now time.Time) []Peer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	peers := make([]Peer, 0, len(d.peers))
+	for id, p := range d.peers {
+		if now.Sub(p.lastSeen) > discoveryPeerTTL {
+			delete(d.peers, id)
+			continue
+		}
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Hostname != peers[j].Hostname {
+			return peers[i].Hostname < peers[j].Hostname
+		}
+		return peers[i].Address < peers[j].Address
+	})
+	return peers
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func listenLoopback(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestPeerDiscoveryLoopback(t *testing.T) {
+	connA, connB := listenLoopback(t), listenLoopback(t)
+	addrA, addrB := connA.LocalAddr().(*net.UDPAddr), connB.LocalAddr().(*net.UDPAddr)
+
+	a := newPeerDiscovery(connA, peerAnnouncement{
+		Hostname: "studio-a", APIPort: 8080,
+		SystemInfo: SystemInfo{Name: "Apple M3 Ultra", CoreCount: 32, ECoreCount: 8, PCoreCount: 24, GPUCoreCount: 80},
+	}, func() []*net.UDPAddr { return []*net.UDPAddr{addrA, addrB} })
+	b := newPeerDiscovery(connB, peerAnnouncement{Hostname: "studio-b"},
+		func() []*net.UDPAddr { return []*net.UDPAddr{addrA, addrB} })
+	go a.receive()
+	go b.receive()
+
+	if err := a.Announce(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Announce(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(a.Peers(time.Now())) == 0 || len(b.Peers(time.Now())) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("peers not found: a sees %v, b sees %v", a.Peers(time.Now()), b.Peers(time.Now()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Each node hears itself too, but only lists the other.
+	peers := b.Peers(time.Now())
+	if len(peers) != 1 {
+		t.Fatalf("b sees %d peers, want 1: %+v", len(peers), peers)
+	}
+	p := peers[0]
+	if p.Hostname != "studio-a" || p.Address != "127.0.0.1" || p.APIPort != 8080 || p.Model != "Apple M3 Ultra" || p.SystemInfo.GPUCoreCount != 80 {
+		t.Errorf("peer = %+v", p)
+	}
+	if got := a.Peers(time.Now()); len(got) != 1 || got[0].Hostname != "studio-b" {
+		t.Errorf("a sees %+v, want studio-b", got)
+	}
+}
+
+func TestPeerDiscoveryHandle(t *testing.T) {
+	d := newPeerDiscovery(nil, peerAnnouncement{ID: "self"}, nil)
+	from := &net.UDPAddr{IP: net.IPv4(169, 254, 10, 2), Port: discoveryDefaultPort}
+	now := time.Now()
+
+	d.handle([]byte(`{"magic":"mactop-peer/1","id":"self","hostname":"me"}`), from, now)
+	d.handle([]byte(`{"magic":"other","id":"x","hostname":"stranger"}`), from, now)
+	d.handle([]byte(`not json`), from, now)
+	d.handle([]byte(`{"magic":"mactop-peer/1","id":"n2","hostname":"node2"}`), from, now)
+	d.handle([]byte(`{"magic":"mactop-peer/1","id":"n1","hostname":"node1"}`), from, now.Add(10*time.Second))
+
+	peers := d.Peers(now.Add(10 * time.Second))
+	if len(peers) != 2 || peers[0].Hostname != "node1" || peers[1].Hostname != "node2" {
+		t.Fatalf("peers = %+v, want node1 and node2", peers)
+	}
+
+	// node2 has gone quiet for longer than the TTL.
+	peers = d.Peers(now.Add(discoveryPeerTTL + time.Second))
+	if len(peers) != 1 || peers[0].Hostname != "node1" {
+		t.Errorf("peers after TTL = %+v, want only node1", peers)
+	}
+}
+
+func TestBroadcastTargets(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loopback string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = iface.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+
+	targets := broadcastTargets([]string{loopback, "no-such-interface"}, 4747)
+	if len(targets) != 1 || !targets[0].IP.Equal(net.IPv4(127, 0, 0, 1)) || targets[0].Port != 4747 {
+		t.Errorf("broadcastTargets(%s) = %v, want 127.0.0.1:4747", loopback, targets)
+	}
+}
@@ -0,0 +1,288 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EnergyConfig is the "energy" section of config.json. --energy-price and
+// --carbon-intensity override it.
+type EnergyConfig struct {
+	PricePerKWh  float64 `json:"price_per_kwh,omitempty"`
+	Currency     string  `json:"currency,omitempty"`
+	CarbonPerKWh float64 `json:"carbon_g_per_kwh,omitempty"`
+}
+
+// EnergyTotals is the energy used since mactop started, in joules per
+// component. System is the residual the measured components do not cover.
+type EnergyTotals struct {
+	Seconds float64
+	CPU     float64
+	GPU     float64
+	ANE     float64
+	DRAM    float64
+	GPUSRAM float64
+	System  float64
+	Total   float64
+}
+
+type energyComponent struct {
+	Name   string
+	Joules float64
+}
+
+// Components lists the totals with the labels used by mactop_power_watts.
+func (e EnergyTotals) Components() []energyComponent {
+	return []energyComponent{
+		{"cpu", e.CPU},
+		{"gpu", e.GPU},
+		{"ane", e.ANE},
+		{"dram", e.DRAM},
+		{"gpu_sram", e.GPUSRAM},
+		{"system", e.System},
+		{"total", e.Total},
+	}
+}
+
+// WattHours is the total energy in Wh.
+func (e EnergyTotals) WattHours() float64 {
+	return e.Total / 3600
+}
+
+// Cost is the price of the total energy at --energy-price per kWh.
+func (e EnergyTotals) Cost() float64 {
+	return e.WattHours() / 1000 * energyPrice
+}
+
+// CO2Grams is the carbon emitted for the total energy at --carbon-intensity.
+func (e EnergyTotals) CO2Grams() float64 {
+	return e.WattHours() / 1000 * carbonPerKWh
+}
+
+// applyEnergyConfig sets the price and carbon intensity from the "energy"
+// section of the loaded config, before flags override them.
+func applyEnergyConfig() {
+	e := currentConfig.Energy
+	if e == nil {
+		return
+	}
+	energyPrice, carbonPerKWh = e.PricePerKWh, e.CarbonPerKWh
+	if e.Currency != "" {
+		energyCurrency = e.Currency
+	}
+}
+
+// sampleSpan is how long a sample taken at `at` stands for: the time since
+// the previous one, or one interval for the first. Gaps longer than a few
+// intervals (the Mac slept, a replay seeked) also count as one interval, so
+// the last reading is not stretched across them.
+func sampleSpan(prev, at time.Time) time.Duration {
+	interval := time.Duration(updateInterval) * time.Millisecond
+	if prev.IsZero() || !at.After(prev) {
+		return interval
+	}
+	if dt := at.Sub(prev); dt <= 3*interval {
+		return dt
+	}
+	return interval
+}
+
+// processEnergyTTL is how long the energy of a PID missing from the process
+// list is kept. The list only holds the busiest processes, so a PID that
+// drops out of it for a while usually comes back.
+const processEnergyTTL = 10 * time.Minute
+
+// energyMeter integrates each snapshot's power over the time it covers, for
+// the session and for each process.
+type energyMeter struct {
+	prev   time.Time
+	totals EnergyTotals
+	procs  map[int]processEnergy
+}
+
+// processEnergy is the energy attributed to a PID while it ran command, and
+// when the PID was last listed.
+type processEnergy struct {
+	command string
+	joules  float64
+	seen    time.Time
+}
+
+// Add accounts for s. It sets the session totals of s, and the power and
+// energy of its processes: CPU power is split by CPU time and GPU power
+// (including GPU SRAM) by GPU time.
+func (m *energyMeter) Add(s *Snapshot) {
+	dt := sampleSpan(m.prev, s.CapturedAt).Seconds()
+	m.prev = s.CapturedAt
+
+	c := s.CPU
+	m.totals.Seconds += dt
+	m.totals.CPU += c.CPUW * dt
+	m.totals.GPU += c.GPUW * dt
+	m.totals.ANE += c.ANEW * dt
+	m.totals.DRAM += c.DRAMW * dt
+	m.totals.GPUSRAM += c.GPUSRAMW * dt
+	m.totals.System += c.SystemW * dt
+	m.totals.Total += c.PackageW * dt
+	s.Energy = m.totals
+
+	// A failed process listing keeps the energy counted so far.
+	if s.Processes == nil {
+		return
+	}
+	attributeProcessPower(s.Processes, c.CPUW, c.GPUW+c.GPUSRAMW)
+	if m.procs == nil {
+		m.procs = make(map[int]processEnergy, len(s.Processes))
+	}
+	for pid, e := range m.procs {
+		if s.CapturedAt.Sub(e.seen) > processEnergyTTL {
+			delete(m.procs, pid)
+		}
+	}
+	for i, p := range s.Processes {
+		e := m.procs[p.PID]
+		if e.command != p.Command {
+			// The PID was reused.
+			e = processEnergy{command: p.Command}
+		}
+		e.joules += p.Watts * dt
+		e.seen = s.CapturedAt
+		m.procs[p.PID] = e
+		s.Processes[i].Energy = e.joules
+	}
+}
+
+// EnergyOutput is the session energy in headless output. Cost and CO2Grams
+// are only set when a price or carbon intensity is configured.
+type EnergyOutput struct {
+	DurationSeconds float64  `json:"duration_seconds" yaml:"duration_seconds" xml:"DurationSeconds" toon:"duration_seconds"`
+	CPUJoules       float64  `json:"cpu_joules" yaml:"cpu_joules" xml:"CPUJoules" toon:"cpu_joules"`
+	GPUJoules       float64  `json:"gpu_joules" yaml:"gpu_joules" xml:"GPUJoules" toon:"gpu_joules"`
+	ANEJoules       float64  `json:"ane_joules" yaml:"ane_joules" xml:"ANEJoules" toon:"ane_joules"`
+	DRAMJoules      float64  `json:"dram_joules" yaml:"dram_joules" xml:"DRAMJoules" toon:"dram_joules"`
+	GPUSRAMJoules   float64  `json:"gpu_sram_joules" yaml:"gpu_sram_joules" xml:"GPUSRAMJoules" toon:"gpu_sram_joules"`
+	SystemJoules    float64  `json:"system_joules" yaml:"system_joules" xml:"SystemJoules" toon:"system_joules"`
+	TotalJoules     float64  `json:"total_joules" yaml:"total_joules" xml:"TotalJoules" toon:"total_joules"`
+	TotalWh         float64  `json:"total_wh" yaml:"total_wh" xml:"TotalWh" toon:"total_wh"`
+	Cost            *float64 `json:"cost,omitempty" yaml:"cost,omitempty" xml:"Cost,omitempty" toon:"cost,omitempty"`
+	Currency        string   `json:"currency,omitempty" yaml:"currency,omitempty" xml:"Currency,omitempty" toon:"currency,omitempty"`
+	CO2Grams        *float64 `json:"co2_grams,omitempty" yaml:"co2_grams,omitempty" xml:"CO2Grams,omitempty" toon:"co2_grams,omitempty"`
+}
+
+// energyOutput converts session totals for headless output. It returns nil
+// before any energy has been accounted, e.g. for persisted history.
+func energyOutput(e EnergyTotals) *EnergyOutput {
+	if e.Seconds == 0 {
+		return nil
+	}
+	out := &EnergyOutput{
+		DurationSeconds: e.Seconds,
+		CPUJoules:       e.CPU,
+		GPUJoules:       e.GPU,
+		ANEJoules:       e.ANE,
+		DRAMJoules:      e.DRAM,
+		GPUSRAMJoules:   e.GPUSRAM,
+		SystemJoules:    e.System,
+		TotalJoules:     e.Total,
+		TotalWh:         e.WattHours(),
+	}
+	if energyPrice > 0 {
+		cost := e.Cost()
+		out.Cost, out.Currency = &cost, energyCurrency
+	}
+	if carbonPerKWh > 0 {
+		co2 := e.CO2Grams()
+		out.CO2Grams = &co2
+	}
+	return out
+}
+
+// energyCollector exposes the session totals as mactop_energy_joules_total.
+// It reports the latest totals rather than adding to a counter, so several
+// exporters can update it from the same snapshot.
+type energyCollector struct {
+	desc   *prometheus.Desc
+	mu     sync.Mutex
+	totals EnergyTotals
+}
+
+func newEnergyCollector() *energyCollector {
+	return &energyCollector{desc: prometheus.NewDesc(
+		"mactop_energy_joules_total",
+		"Energy used since mactop started in joules",
+		[]string{"component"}, nil,
+	)}
+}
+
+func (c *energyCollector) Set(e EnergyTotals) {
+	c.mu.Lock()
+	c.totals = e
+	c.mu.Unlock()
+}
+
+func (c *energyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *energyCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	totals := c.totals
+	c.mu.Unlock()
+	for _, comp := range totals.Components() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, comp.Joules, comp.Name)
+	}
+}
+
+// formatEnergy prints joules as Wh, or kWh from 1000 Wh.
+func formatEnergy(joules float64) string {
+	wh := joules / 3600
+	if wh >= 1000 {
+		return fmt.Sprintf("%.2f kWh", wh/1000)
+	}
+	return fmt.Sprintf("%.2f Wh", wh)
+}
+
+// formatProcessEnergy prints joules as Wh for the ENERGY column.
+func formatProcessEnergy(joules float64) string {
+	wh := joules / 3600
+	switch {
+	case wh < 10:
+		return fmt.Sprintf("%.2fWh", wh)
+	case wh < 1000:
+		return fmt.Sprintf("%.1fWh", wh)
+	}
+	return fmt.Sprintf("%.0fWh", wh)
+}
+
+// formatCost prints an amount in energyCurrency, with more decimals for the
+// fractions of a cent a short session costs.
+func formatCost(amount float64) string {
+	if amount < 1 {
+		return fmt.Sprintf("%s%.4f", energyCurrency, amount)
+	}
+	return fmt.Sprintf("%s%.2f", energyCurrency, amount)
+}
+
+// formatCO2 prints grams of CO2, or kg from 1000 g.
+func formatCO2(grams float64) string {
+	if grams >= 1000 {
+		return fmt.Sprintf("%.2f kg CO2", grams/1000)
+	}
+	return fmt.Sprintf("%.1f g CO2", grams)
+}
+
+// energySummary is the session total with its cost and CO2 when configured,
+// e.g. "1.25 Wh | $0.0004 | 0.4 g CO2".
+func energySummary(e EnergyTotals) string {
+	s := formatEnergy(e.Total)
+	if energyPrice > 0 {
+		s += " | " + formatCost(e.Cost())
+	}
+	if carbonPerKWh > 0 {
+		s += " | " + formatCO2(e.CO2Grams())
+	}
+	return s
+}
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEnergyMeter(t *testing.T) {
+	saved := updateInterval
+	defer func() { updateInterval = saved }()
+	updateInterval = 1000
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(sec float64, cpu, system float64) Snapshot {
+		return Snapshot{
+			CapturedAt: base.Add(time.Duration(sec * float64(time.Second))),
+			CPU:        CPUMetrics{CPUW: cpu, SystemW: system, PackageW: cpu + system},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		samples []Snapshot
+		want    EnergyTotals
+	}{
+		{
+			name:    "first sample counts one interval",
+			samples: []Snapshot{sample(0, 10, 2)},
+			want:    EnergyTotals{Seconds: 1, CPU: 10, System: 2, Total: 12},
+		},
+		{
+			name:    "time since the previous sample",
+			samples: []Snapshot{sample(0, 10, 0), sample(0.5, 20, 0), sample(2.5, 5, 0)},
+			want:    EnergyTotals{Seconds: 3.5, CPU: 30, Total: 30},
+		},
+		{
+			name:    "a long gap counts one interval",
+			samples: []Snapshot{sample(0, 10, 0), sample(3600, 10, 0)},
+			want:    EnergyTotals{Seconds: 2, CPU: 20, Total: 20},
+		},
+		{
+			name:    "time going backwards counts one interval",
+			samples: []Snapshot{sample(10, 4, 0), sample(5, 4, 0)},
+			want:    EnergyTotals{Seconds: 2, CPU: 8, Total: 8},
+		},
+	}
+	for _, tt := range tests {
+		var m energyMeter
+		var got EnergyTotals
+		for _, s := range tt.samples {
+			m.Add(&s)
+			got = s.Energy
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnergyOutput(t *testing.T) {
+	savedPrice, savedCarbon, savedCurrency := energyPrice, carbonPerKWh, energyCurrency
+	defer func() { energyPrice, carbonPerKWh, energyCurrency = savedPrice, savedCarbon, savedCurrency }()
+
+	// 7.2 kJ is 2 Wh.
+	e := EnergyTotals{Seconds: 60, CPU: 3600, GPU: 1800, System: 1800, Total: 7200}
+
+	tests := []struct {
+		name          string
+		price, carbon float64
+		currency      string
+		json, summary string
+	}{
+		{
+			name:    "no price or carbon",
+			json:    `{"duration_seconds":60,"cpu_joules":3600,"gpu_joules":1800,"ane_joules":0,"dram_joules":0,"gpu_sram_joules":0,"system_joules":1800,"total_joules":7200,"total_wh":2}`,
+			summary: "2.00 Wh",
+		},
+		{
+			name:     "price and carbon",
+			price:    0.25,
+			carbon:   400,
+			currency: "€",
+			json:     `{"duration_seconds":60,"cpu_joules":3600,"gpu_joules":1800,"ane_joules":0,"dram_joules":0,"gpu_sram_joules":0,"system_joules":1800,"total_joules":7200,"total_wh":2,"cost":0.0005,"currency":"€","co2_grams":0.8}`,
+			summary:  "2.00 Wh | €0.0005 | 0.8 g CO2",
+		},
+	}
+	for _, tt := range tests {
+		energyPrice, carbonPerKWh, energyCurrency = tt.price, tt.carbon, tt.currency
+		got, err := json.Marshal(energyOutput(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.json {
+			t.Errorf("%s: energyOutput = %s, want %s", tt.name, got, tt.json)
+		}
+		if got := energySummary(e); got != tt.summary {
+			t.Errorf("%s: energySummary = %q, want %q", tt.name, got, tt.summary)
+		}
+	}
+
+	if energyOutput(EnergyTotals{}) != nil {
+		t.Error("energyOutput of no samples is not nil")
+	}
+}
+
+func TestFormatEnergy(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{formatEnergy(1800), "0.50 Wh"},
+		{formatEnergy(3.6e6 * 1.5), "1.50 kWh"},
+		{formatCO2(12.34), "12.3 g CO2"},
+		{formatCO2(2500), "2.50 kg CO2"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestEnergyMeterProcesses(t *testing.T) {
+	saved := updateInterval
+	defer func() { updateInterval = saved }()
+	updateInterval = 1000
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(sec int, procs ...ProcessMetrics) Snapshot {
+		return Snapshot{
+			CapturedAt: base.Add(time.Duration(sec) * time.Second),
+			CPU:        CPUMetrics{CPUW: 10, GPUW: 3, GPUSRAMW: 1, PackageW: 14},
+			Processes:  procs,
+		}
+	}
+
+	var m energyMeter
+	steps := []struct {
+		s    Snapshot
+		want map[int]float64 // joules by PID
+	}{
+		{sample(0, ProcessMetrics{PID: 1, Command: "a", CPU: 100}, ProcessMetrics{PID: 2, Command: "b", GPU: 50}),
+			map[int]float64{1: 10, 2: 4}},
+		{sample(2, ProcessMetrics{PID: 1, Command: "a", CPU: 50}, ProcessMetrics{PID: 2, Command: "b", CPU: 50}),
+			map[int]float64{1: 20, 2: 14}},
+		// No process list this time: the energy so far is kept.
+		{sample(3), nil},
+		// PID 2 now runs something else and starts from zero.
+		{sample(4, ProcessMetrics{PID: 1, Command: "a", CPU: 100}, ProcessMetrics{PID: 2, Command: "c", GPU: 10}),
+			map[int]float64{1: 30, 2: 4}},
+		// PID 1 drops out of the list for a sample and keeps its energy.
+		{sample(5, ProcessMetrics{PID: 2, Command: "c", GPU: 10}),
+			map[int]float64{2: 8}},
+		{sample(6, ProcessMetrics{PID: 1, Command: "a", CPU: 100}, ProcessMetrics{PID: 2, Command: "c", GPU: 10}),
+			map[int]float64{1: 40, 2: 12}},
+		// Gone for longer than processEnergyTTL, it starts from zero.
+		{sample(7, ProcessMetrics{PID: 2, Command: "c", GPU: 10}),
+			map[int]float64{2: 16}},
+		{sample(8+int(processEnergyTTL/time.Second), ProcessMetrics{PID: 1, Command: "a", CPU: 100}),
+			map[int]float64{1: 10}},
+	}
+	for i, st := range steps {
+		s := st.s
+		m.Add(&s)
+		for _, p := range s.Processes {
+			if math.Abs(p.Energy-st.want[p.PID]) > 1e-9 {
+				t.Errorf("step %d: PID %d energy = %v J, want %v", i, p.PID, p.Energy, st.want[p.PID])
+			}
+		}
+	}
+}
+
+func TestFormatProcessEnergy(t *testing.T) {
+	tests := []struct {
+		joules float64
+		want   string
+	}{
+		{0, "0.00Wh"},
+		{90, "0.03Wh"},
+		{3600 * 12.34, "12.3Wh"},
+		{3600 * 1234.4, "1234Wh"},
+	}
+	for _, tt := range tests {
+		if got := formatProcessEnergy(tt.joules); got != tt.want {
+			t.Errorf("formatProcessEnergy(%v) = %q, want %q", tt.joules, got, tt.want)
+		}
+	}
+}
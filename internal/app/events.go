@@ -7,69 +7,47 @@ import (
 	ui "github.com/metaspartan/gotui/v5"
 )
 
-func startBackgroundUpdates(done chan struct{}) {
+func startBackgroundUpdates(done chan struct{}, sub *Subscription) {
 	go func() {
 		for {
 			select {
 			case <-done:
 				return
-			case <-ticker.C:
-				select {
-				case cpuMetrics := <-cpuMetricsChan:
-					renderMutex.Lock()
-					lastCPUMetrics = cpuMetrics
-					updateCPUUI(cpuMetrics)
-					updateTotalPowerChart(cpuMetrics.PackageW)
-					renderMutex.Unlock()
-				default:
-				}
-				select {
-				case gpuMetrics := <-gpuMetricsChan:
-					renderMutex.Lock()
-					lastGPUMetrics = gpuMetrics
-					updateGPUUI(gpuMetrics)
-					renderMutex.Unlock()
-				default:
-				}
-				select {
-				case tbNetStats := <-tbNetStatsChan:
-					renderMutex.Lock()
-					updateTBNetUI(tbNetStats)
-					renderMutex.Unlock()
-				default:
-				}
-				select {
-				case netdiskMetrics := <-netdiskMetricsChan:
-					renderMutex.Lock()
-					lastNetDiskMetrics = netdiskMetrics
-					updateNetDiskUI(netdiskMetrics)
-					renderMutex.Unlock()
-				default:
-				}
-				select {
-				case processes := <-processMetricsChan:
-					renderMutex.Lock()
-					if !isFrozen && !killPending {
-						lastProcesses = processes
-						if searchText != "" {
-							refreshFilteredProcesses()
-						}
-						updateProcessList()
-					}
-					renderMutex.Unlock()
-				default:
-				}
-				// Update info UI once per cycle instead of multiple times
+			case s := <-sub.C:
 				renderMutex.Lock()
-				updateInfoUI()
+				applySnapshot(s)
 				renderMutex.Unlock()
 				renderUI()
-
 			}
 		}
 	}()
 }
 
+// applySnapshot pushes one sample into every widget. Callers hold renderMutex.
+func applySnapshot(s Snapshot) {
+	lastSnapshot = s
+	recordHistory(s)
+	updateCPUUI(s)
+	updateTotalPowerChart(s.CPU.PackageW, s.ThermalState)
+	updateGPUUI(s.GPU)
+	updateTBNetUI(s.TBNetStats, s.RDMA)
+	updateNetDiskUI(s.NetDisk)
+	if !isFrozen && !killPending && s.Processes != nil {
+		lastProcesses = s.Processes
+		if searchText != "" {
+			refreshFilteredProcesses()
+		}
+		updateProcessList()
+	}
+	// Update info UI once per cycle instead of multiple times
+	updateInfoUI()
+	updateIntervalText()
+	updateAlertBanner(s.Alerts)
+	if replay != nil {
+		updateReplayTitle()
+	}
+}
+
 func updateLayout(w, h int) {
 	mainBlock.SetRect(0, 0, w, h)
 	if w < 93 {
@@ -112,6 +90,7 @@ func handleModeKeys(key string, done chan struct{}) {
 	switch key {
 	case "q", "<C-c>":
 		close(done)
+		waitForSnapshotWriters()
 		ui.Close()
 		os.Exit(0)
 	case "r":
@@ -138,6 +117,22 @@ func handleModeKeys(key string, done chan struct{}) {
 	}
 }
 
+// handleHistoryKeys cycles the charts between raw samples and the 10s and 1m
+// downsampled tiers.
+func handleHistoryKeys() {
+	renderMutex.Lock()
+	historyResolution = historyResolution.Next()
+	s := lastSnapshot
+	updateTotalPowerChart(s.CPU.PackageW, s.ThermalState)
+	updateCPUHistory(s.CPUUsage())
+	updateMemoryHistory(s.Memory)
+	updateGPUUI(s.GPU)
+	updateTBNetUI(s.TBNetStats, s.RDMA)
+	w, h := ui.TerminalDimensions()
+	drawScreen(w, h)
+	renderMutex.Unlock()
+}
+
 func handleIntervalKeys(key string) {
 	delta := 0
 	switch key {
@@ -155,7 +150,11 @@ func handleIntervalKeys(key string) {
 		if updateInterval > 5000 {
 			updateInterval = 5000
 		}
-		ticker.Reset(time.Duration(updateInterval) * time.Millisecond)
+		// Wake the collector so the new interval applies immediately.
+		select {
+		case interruptChan <- struct{}{}:
+		default:
+		}
 		if partyMode && partyTicker != nil {
 			partyTicker.Reset(time.Duration(updateInterval/2) * time.Millisecond)
 		}
@@ -212,6 +211,12 @@ func handleKeyboardEvent(e ui.Event, done chan struct{}) {
 		handleModeKeys(key, done)
 	case "-", "_", "+", "=":
 		handleIntervalKeys(key)
+	case "z":
+		handleHistoryKeys()
+	case "P", ",", ".", "<", ">":
+		if replay != nil {
+			handleReplayKeys(key)
+		}
 	case "j", "<Down>":
 		// Scroll down in Info layout
 		if currentConfig.DefaultLayout == LayoutInfo {
@@ -0,0 +1,492 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/toon-format/toon-go"
+	"gopkg.in/yaml.v3"
+)
+
+// fieldSelection cuts headless samples down to the --fields paths and drops
+// the --exclude paths. Paths are the dotted JSON names used by mactop history
+// --metric, and each segment may be a wildcard such as * or *_power.
+type fieldSelection struct {
+	include [][]string
+	exclude [][]string
+
+	// columns is the CSV header, taken from the first projected sample.
+	columns []string
+}
+
+// fieldEntry is one key of a projected sample. XML is the element name
+// encoding/xml gives the struct field it was projected from, if any.
+type fieldEntry struct {
+	Key   string
+	XML   string
+	Value any
+}
+
+// xmlOnlyValue holds a struct field that encoding/json leaves out but
+// encoding/xml does not. Only MarshalXML writes it.
+type xmlOnlyValue struct {
+	v any
+}
+
+func (f fieldEntry) xmlOnly() bool {
+	_, ok := f.Value.(xmlOnlyValue)
+	return ok
+}
+
+// fieldObject is a JSON object that keeps its keys in the order the sample
+// type declares them. Values are fieldObject, []any, string,
+// int64, float64, bool or nil.
+type fieldObject []fieldEntry
+
+// parseFieldSelection parses the comma-separated --fields and --exclude
+// lists. It returns nil when both are empty.
+func parseFieldSelection(fields, exclude string, version int) (*fieldSelection, error) {
+	s := &fieldSelection{}
+	top := headlessFieldNames(version)
+	var err error
+	if s.include, err = parseFieldPaths("--fields", fields, top); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = parseFieldPaths("--exclude", exclude, top); err != nil {
+		return nil, err
+	}
+	if len(s.include) == 0 && len(s.exclude) == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+func parseFieldPaths(flagName, list string, top []string) ([][]string, error) {
+	var paths [][]string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		segs := strings.Split(p, ".")
+		for _, seg := range segs {
+			if seg == "" {
+				return nil, fmt.Errorf("invalid %s path %q", flagName, p)
+			}
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("invalid %s path %q: %v", flagName, p, err)
+			}
+		}
+		known := false
+		for _, name := range top {
+			if ok, _ := path.Match(segs[0], name); ok {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown %s field %q, expected one of: %s", flagName, segs[0], strings.Join(top, ", "))
+		}
+		paths = append(paths, segs)
+	}
+	return paths, nil
+}
+
+// headlessFieldNames lists the top-level JSON names of a sample in the given
+// schema version.
+func headlessFieldNames(version int) []string {
+	var names []string
+	t := headlessSchemaType(version)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// matchFieldPath reports whether pattern selects p itself or one of its
+// parents (full), or only something below p (partial).
+func matchFieldPath(pattern, p []string) (full, partial bool) {
+	for i := 0; i < len(pattern) && i < len(p); i++ {
+		if ok, _ := path.Match(pattern[i], p[i]); !ok {
+			return false, false
+		}
+	}
+	if len(pattern) <= len(p) {
+		return true, false
+	}
+	return false, true
+}
+
+// Project returns the selected part of v, which must encode to a JSON object.
+func (s *fieldSelection) Project(v any) (fieldObject, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	tree, err := decodeFieldValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := tree.(fieldObject)
+	if !ok {
+		return nil, fmt.Errorf("cannot select fields of %T", v)
+	}
+	root = nameXMLFields(root, reflect.ValueOf(v)).(fieldObject)
+	projected, _ := s.filter(root, nil, len(s.include) == 0)
+	return projected.(fieldObject), nil
+}
+
+// filter keeps node if it is selected, or the parts of it that are, and
+// drops whatever is excluded.
+func (s *fieldSelection) filter(node any, p []string, selected bool) (any, bool) {
+	for _, pattern := range s.exclude {
+		if full, _ := matchFieldPath(pattern, p); full {
+			return nil, false
+		}
+	}
+	partial := false
+	for _, pattern := range s.include {
+		if selected {
+			break
+		}
+		full, below := matchFieldPath(pattern, p)
+		selected = full
+		partial = partial || below
+	}
+	if !selected && !partial {
+		return nil, false
+	}
+
+	// Children get their own copy of the path.
+	child := func(seg string) []string {
+		return append(p[:len(p):len(p)], seg)
+	}
+	switch n := node.(type) {
+	case fieldObject:
+		out := fieldObject{}
+		for _, f := range n {
+			if v, ok := s.filter(f.Value, child(f.Key), selected); ok {
+				f.Value = v
+				out = append(out, f)
+			}
+		}
+		return out, selected || len(out) > 0 || len(p) == 0
+	case []any:
+		out := []any{}
+		for i, item := range n {
+			if v, ok := s.filter(item, child(strconv.Itoa(i)), selected); ok {
+				out = append(out, v)
+			}
+		}
+		return out, selected || len(out) > 0
+	}
+	return node, selected
+}
+
+// nameXMLFields sets the XML names in node, the JSON tree of v, from the
+// struct tags of v. The fields JSON leaves out (json:"-" or omitempty) are
+// added as xmlOnlyValue, so a projected sample encodes to the same XML
+// elements as the whole one.
+func nameXMLFields(node any, v reflect.Value) any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return node
+		}
+		v = v.Elem()
+	}
+	switch n := node.(type) {
+	case fieldObject:
+		if v.Kind() != reflect.Struct {
+			return n
+		}
+		byKey := make(map[string]fieldEntry, len(n))
+		for _, f := range n {
+			byKey[f.Key] = f
+		}
+		out := make(fieldObject, 0, len(n))
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			key, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if key == "" {
+				key = sf.Name
+			}
+			name, opts, _ := strings.Cut(sf.Tag.Get("xml"), ",")
+			if name == "" {
+				name = sf.Name
+			}
+			if f, ok := byKey[key]; ok && key != "-" {
+				f.XML = name
+				f.Value = nameXMLFields(f.Value, v.Field(i))
+				out = append(out, f)
+				delete(byKey, key)
+				continue
+			}
+			omit := strings.Contains(opts, "omitempty") && v.Field(i).IsZero() && !strings.Contains(name, ">")
+			if name == "-" || omit {
+				continue
+			}
+			if key == "-" {
+				key = sf.Name
+			}
+			out = append(out, fieldEntry{Key: key, XML: name, Value: xmlOnlyValue{v.Field(i).Interface()}})
+		}
+		// Keys that are not struct fields, if any, keep their place at the end.
+		for _, f := range n {
+			if _, ok := byKey[f.Key]; ok {
+				out = append(out, f)
+			}
+		}
+		return out
+	case []any:
+		if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Len() == len(n) {
+			for i := range n {
+				n[i] = nameXMLFields(n[i], v.Index(i))
+			}
+		}
+	}
+	return node
+}
+
+// decodeFieldValue reads the next JSON value from dec, keeping object keys
+// in order.
+func decodeFieldValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			o := fieldObject{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeFieldValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				o = append(o, fieldEntry{Key: key.(string), Value: v})
+			}
+			_, err := dec.Token()
+			return o, err
+		}
+		a := []any{}
+		for dec.More() {
+			v, err := decodeFieldValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		_, err := dec.Token()
+		return a, err
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	}
+	return tok, nil
+}
+
+func (o fieldObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for _, f := range o {
+		if f.xmlOnly() {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.Key)
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (o fieldObject) MarshalYAML() (any, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	for _, f := range o {
+		if f.xmlOnly() {
+			continue
+		}
+		var value yaml.Node
+		if err := value.Encode(f.Value); err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.Key}, &value)
+	}
+	return n, nil
+}
+
+// MarshalXML names elements as encoding/xml names the struct fields they
+// were projected from, or after the JSON keys for the rest. Arrays become
+// repeated elements, as encoding/xml does for slices.
+func (o fieldObject) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if start.Name.Local == "fieldObject" {
+		// The root element is named after the type it stands in for.
+		version, _ := parseSchemaVersion(headlessSchema)
+		start.Name.Local = headlessSchemaType(version).Name()
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, f := range o {
+		name := f.XML
+		if name == "" {
+			name = f.Key
+		}
+		if name == "-" {
+			continue
+		}
+		if err := encodeXMLField(e, name, f.Value); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+func encodeXMLField(e *xml.Encoder, name string, v any) error {
+	if parent, child, ok := strings.Cut(name, ">"); ok {
+		// a>b nests b in a, as in struct tags.
+		start := xml.StartElement{Name: xml.Name{Local: parent}}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := encodeXMLField(e, child, v); err != nil {
+			return err
+		}
+		return e.EncodeToken(start.End())
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case xmlOnlyValue:
+		return e.EncodeElement(v.v, xml.StartElement{Name: xml.Name{Local: name}})
+	case []any:
+		for _, item := range v {
+			if err := encodeXMLField(e, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+// toonValue converts v to the ordered objects toon-go encodes.
+func toonValue(v any) any {
+	switch v := v.(type) {
+	case fieldObject:
+		fields := make([]toon.Field, 0, len(v))
+		for _, f := range v {
+			if !f.xmlOnly() {
+				fields = append(fields, toon.Field{Key: f.Key, Value: toonValue(f.Value)})
+			}
+		}
+		return toon.NewObject(fields...)
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = toonValue(item)
+		}
+		return items
+	}
+	return v
+}
+
+// flattenFields calls fn for every CSV column of v. Objects are split into
+// dotted paths and arrays of scalars into one column per index; other
+// arrays, whose length changes between samples, stay in one column as JSON.
+func flattenFields(prefix string, v any, fn func(column, value string)) {
+	switch v := v.(type) {
+	case fieldObject:
+		for _, f := range v {
+			if f.xmlOnly() {
+				continue
+			}
+			flattenFields(joinFieldPath(prefix, f.Key), f.Value, fn)
+		}
+		return
+	case []any:
+		scalars := len(v) > 0
+		for _, item := range v {
+			switch item.(type) {
+			case fieldObject, []any:
+				scalars = false
+			}
+		}
+		if !scalars {
+			data, _ := json.Marshal(v)
+			fn(prefix, string(data))
+			return
+		}
+		for i, item := range v {
+			flattenFields(joinFieldPath(prefix, strconv.Itoa(i)), item, fn)
+		}
+		return
+	case nil:
+		fn(prefix, "")
+	case string:
+		fn(prefix, v)
+	case int64:
+		fn(prefix, strconv.FormatInt(v, 10))
+	case float64:
+		fn(prefix, strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		fn(prefix, fmt.Sprint(v))
+	}
+}
+
+// WriteCSV writes o as a CSV row. The first call also writes the header,
+// so the columns are fixed by the first sample.
+func (s *fieldSelection) WriteCSV(w io.Writer, o fieldObject) error {
+	values := make(map[string]string)
+	var columns []string
+	flattenFields("", o, func(column, value string) {
+		columns = append(columns, column)
+		values[column] = value
+	})
+
+	writer := csv.NewWriter(w)
+	if s.columns == nil {
+		s.columns = columns
+		if s.columns == nil {
+			s.columns = []string{}
+		}
+		writer.Write(s.columns)
+	}
+	record := make([]string, len(s.columns))
+	for i, column := range s.columns {
+		record[i] = values[column]
+	}
+	writer.Write(record)
+	writer.Flush()
+	return writer.Error()
+}
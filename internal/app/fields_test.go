@@ -0,0 +1,233 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testFieldSample() HeadlessOutput {
+	return HeadlessOutput{
+		Timestamp:  "2025-01-01T00:00:00Z",
+		SocMetrics: SocMetrics{CPUPower: 4.5, GPUPower: 1.25, ANEPower: 0, SocTemp: 40},
+		Memory:     MemoryMetrics{Total: 64, Used: 32},
+		CoreUsages: []float64{10, 20, 30},
+		SystemInfo: SystemInfo{Name: "Apple M4", CoreCount: 3},
+		Alerts:     []Alert{{Name: "cpu_hot"}},
+	}
+}
+
+func TestFieldSelectionProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  string
+		exclude string
+		want    string
+	}{
+		{
+			name:   "paths",
+			fields: "soc_metrics.cpu_power,memory.used",
+			want:   `{"soc_metrics":{"cpu_power":4.5},"memory":{"used":32}}`,
+		},
+		{
+			name:   "declaration order",
+			fields: "memory.used,timestamp",
+			want:   `{"timestamp":"2025-01-01T00:00:00Z","memory":{"used":32}}`,
+		},
+		{
+			name:   "wildcard segment",
+			fields: "soc_metrics.*_power",
+			want:   `{"soc_metrics":{"cpu_power":4.5,"gpu_power":1.25,"ane_power":0,"dram_power":0,"gpu_sram_power":0,"system_power":0,"total_power":0}}`,
+		},
+		{
+			name:   "whole array and index",
+			fields: "core_usages,alerts.0.name",
+			want:   `{"core_usages":[10,20,30],"alerts":[{"name":"cpu_hot"}]}`,
+		},
+		{
+			name:    "exclude within fields",
+			fields:  "memory,core_usages",
+			exclude: "memory.total,memory.swap_*,core_usages.1",
+			want:    `{"memory":{"used":32,"available":0},"core_usages":[10,30]}`,
+		},
+		{
+			name:   "nothing matched",
+			fields: "soc_metrics.no_such_field",
+			want:   `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		s, err := parseFieldSelection(tt.fields, tt.exclude, headlessSchemaV1)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		o, err := s.Project(testFieldSample())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := json.Marshal(o)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFieldSelectionExcludeOnly(t *testing.T) {
+	s, err := parseFieldSelection("", "thunderbolt_info,system_info,alerts", headlessSchemaV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := s.Project(testFieldSample())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, f := range o {
+		if !f.xmlOnly() {
+			keys = append(keys, f.Key)
+		}
+	}
+	got := strings.Join(keys, ",")
+	want := "schema_version,timestamp,soc_metrics,memory,net_disk,cpu_usage,ecpu_usage,pcpu_usage,gpu_usage,core_usages,thermal_state,tb_net_total_bytes_in_per_sec,tb_net_total_bytes_out_per_sec,rdma_status"
+	if got != want {
+		t.Errorf("keys = %s, want %s", got, want)
+	}
+}
+
+func TestParseFieldSelection(t *testing.T) {
+	tests := []struct {
+		fields, exclude string
+		wantNil         bool
+		wantErr         string
+	}{
+		{"", "", true, ""},
+		{" , ", "", true, ""},
+		{"soc_metrics.cpu_power", "", false, ""},
+		{"*_usage", "", false, ""},
+		{"bogus", "", false, `unknown --fields field "bogus"`},
+		{"", "memory..used", false, `invalid --exclude path "memory..used"`},
+		{"soc_metrics.[", "", false, "syntax error in pattern"},
+	}
+
+	for _, tt := range tests {
+		s, err := parseFieldSelection(tt.fields, tt.exclude, headlessSchemaV1)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parse(%q, %q) error = %v, want %q", tt.fields, tt.exclude, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse(%q, %q): %v", tt.fields, tt.exclude, err)
+			continue
+		}
+		if (s == nil) != tt.wantNil {
+			t.Errorf("parse(%q, %q) = %v, want nil %v", tt.fields, tt.exclude, s, tt.wantNil)
+		}
+	}
+}
+
+func TestFieldSelectionFormats(t *testing.T) {
+	s, err := parseFieldSelection("memory.used,core_usages.0,system_info.name", "", headlessSchemaV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := s.Project(testFieldSample())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"yaml", "memory:\n    used: 32\ncore_usages:\n    - 10\nsystem_info:\n    name: Apple M4\n"},
+		{"xml", "<HeadlessOutput><Memory><Used>32</Used></Memory><CoreUsages>10</CoreUsages><SystemInfo><Name>Apple M4</Name></SystemInfo></HeadlessOutput>"},
+		{"toon", "memory:\n  used: 32\ncore_usages[1]: 10\nsystem_info:\n  name: Apple M4"},
+	}
+
+	for _, tt := range tests {
+		got, err := marshalHeadless(tt.format, o)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+// A filtered sample uses the same XML elements as an unfiltered one,
+// including the fields that only XML encodes.
+func TestFieldSelectionXML(t *testing.T) {
+	defer func(schema string) { headlessSchema = schema }(headlessSchema)
+	sample := testFieldSample()
+	sample.SocMetrics.GPUActive = 12.5
+	// The sample has no Thunderbolt info, so excluding it changes nothing.
+	for _, tt := range []struct{ schema, fields, exclude string }{
+		{"v1", "", "thunderbolt_info"},
+		{"v1", "*", ""},
+		{"v2", "*", ""},
+	} {
+		headlessSchema = tt.schema
+		version, _ := parseSchemaVersion(tt.schema)
+		v := headlessSample(sample, version)
+		want, err := marshalHeadless("xml", v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := parseFieldSelection(tt.fields, tt.exclude, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := s.Project(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := marshalHeadless("xml", o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s filtered XML:\n got %s\nwant %s", tt.schema, got, want)
+		}
+		if data, _ := json.Marshal(o); strings.Contains(string(data), "12.5") {
+			t.Errorf("%s: XML-only field in JSON: %s", tt.schema, data)
+		}
+	}
+}
+
+func TestFieldSelectionCSV(t *testing.T) {
+	s, err := parseFieldSelection("timestamp,soc_metrics.cpu_power,core_usages,alerts", "", headlessSchemaV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		sample := testFieldSample()
+		if i == 1 {
+			// Later samples keep the first sample's columns.
+			sample.Alerts = nil
+			sample.CoreUsages = append(sample.CoreUsages, 40)
+		}
+		o, err := s.Project(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.WriteCSV(&buf, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "timestamp,soc_metrics.cpu_power,core_usages.0,core_usages.1,core_usages.2,alerts\n" +
+		`2025-01-01T00:00:00Z,4.5,10,20,30,"[{""name"":""cpu_hot"",""rule"":"""",""metric"":"""",""value"":0,""threshold"":0,""since"":""""}]"` + "\n" +
+		"2025-01-01T00:00:00Z,4.5,10,20,30,\n"
+	if got := buf.String(); got != want {
+		t.Errorf("csv:\n got %s\nwant %s", got, want)
+	}
+}
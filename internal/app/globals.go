@@ -36,15 +36,14 @@ var (
 
 	// StepChart widgets for History layout
 	gpuHistoryChart, powerHistoryChart, memoryHistoryChart, cpuHistoryChart *w.StepChart
-	memoryUsedHistory                                                       = make([]float64, 100)
-	swapUsedHistory                                                         = make([]float64, 100)
-	cpuUsageHistory                                                         = make([]float64, 100)
-	powerUsageHistory                                                       = make([]float64, 100)
+
+	// history backs every sparkline and StepChart; historyWindow is how many
+	// points each chart asks it for.
+	history           = NewHistoryStore(DefaultHistoryRetention())
+	historyWindow     = 100
+	historyResolution = HistoryRaw
 
 	cpuCoreWidget                 *CPUCoreWidget
-	powerValues                   = make([]float64, 35)
-	tbNetInValues                 = make([]float64, 100)
-	tbNetOutValues                = make([]float64, 100)
 	lastTBInBytes, lastTBOutBytes float64
 	lastUpdateTime                time.Time
 	stderrLogger                  = log.New(os.Stderr, "", 0)
@@ -55,50 +54,100 @@ var (
 	lastCPUTimes                  []CPUUsage
 	firstRun                      = true
 	sortReverse                   = false
-	columns                       = []string{"PID", "USER", "VIRT", "RES", "CPU", "GPU", "MEM", "TIME", "CMD"}
+	columns                       = []string{"PID", "USER", "VIRT", "RES", "CPU", "GPU", "MEM", "WATTS", "ENERGY", "TIME", "CMD"}
 	selectedColumn                = 4
 	maxPowerSeen                  = 0.1
-	gpuValues                     = make([]float64, 100)
 
 	prometheusPort string
+	metricsSrv     *metricsServer
+	webAddr        string
+	serveAddr      string // mactop serve's listen address, announced to peers
+	discoverPeers  bool
+	discoverIface  string
+	discoverPort   int
+	discovery      *peerDiscovery
+	metricSource   MetricSource
+	sourceName     string
+	recordPath     string
+	replayPath     string
+	replaySpeed    string
+	recording      *sessionRecorder
+	replay         *replaySource
+	persistHistory bool
+	persistMaxAge  string
+	persistMaxMB   int
+	historyFile    *historyWriter
+	alertEngine    *AlertEngine
+	webhookURL     string
+	webhookHeaders headerFlags
+	webhookBatch   int
+	webhookFlush   time.Duration
+	webhookSpoolMB int
+	webhook        *webhookSink
+	otlpEndpoint   string
+	otlpHeaders    headerFlags
+	otlpInterval   time.Duration
+	otlp           *otlpExporter
+	influxURL      string
+	influxOrg      string
+	influxBucket   string
+	influxToken    string
+	influxInterval time.Duration
+	influx         *influxWriter
+	statsdAddr     string
+	statsdPrefix   string
+	statsdTags     string
+	statsdPlain    bool
+	statsd         *statsdSink
+	rwURL          string
+	rwLabels       labelFlags
+	rwUsername     string
+	rwPassword     string
+	rwBearerToken  string
+	rwInterval     time.Duration
+	rwQueueMB      int
+	remoteWrite    *remoteWriter
 	headless       bool
 	headlessPretty bool
 	headlessCount  int
 	headlessFormat string
+	headlessFields string
+	headlessSchema string
+	aggregateEvery time.Duration
+	excludeFields  string
+	fieldFilter    *fieldSelection
+	energyPrice    float64
+	energyCurrency = "$"
+	carbonPerKWh   float64
 	cliBgColor     string // Background color from --bg flag
 	interruptChan  = make(chan struct{}, 10)
 
-	cachedTermWidth    int
-	cachedTermHeight   int
-	cachedTermMutex    sync.RWMutex
-	lastNetStats       NativeNetMetric
-	lastDiskStats      NativeDiskMetric
-	lastNetDiskTime    time.Time
-	netDiskMutex       sync.Mutex
-	killPending        bool
-	killPID            int
-	currentUser        string
-	lastProcesses      []ProcessMetrics
-	networkUnit        string
-	diskUnit           string
-	tempUnit           string
-	currentLayoutNum   int
-	totalLayouts       int
-	currentColorName   string
-	lastCPUMetrics     CPUMetrics
-	lastGPUMetrics     GPUMetrics
-	lastNetDiskMetrics NetDiskMetrics
-	lastActiveLayout   string = "default"
+	cachedTermWidth  int
+	cachedTermHeight int
+	cachedTermMutex  sync.RWMutex
+	lastNetStats     NativeNetMetric
+	lastDiskStats    NativeDiskMetric
+	lastNetDiskTime  time.Time
+	netDiskMutex     sync.Mutex
+	killPending      bool
+	killPID          int
+	currentUser      string
+	lastProcesses    []ProcessMetrics
+	networkUnit      string
+	diskUnit         string
+	tempUnit         string
+	currentLayoutNum int
+	totalLayouts     int
+	currentColorName string
+	lastSnapshot     Snapshot
+	lastActiveLayout string = "default"
 	// Per-process GPU time tracking
 	lastGPUProcessStats     map[int]uint64
 	lastGPUProcessStatsTime time.Time
 	gpuProcessStatsMutex    sync.Mutex
-	cpuMetricsChan          = make(chan CPUMetrics, 1)
-	gpuMetricsChan          = make(chan GPUMetrics, 1)
-	netdiskMetricsChan      = make(chan NetDiskMetrics, 1)
-	tbNetStatsChan          = make(chan []ThunderboltNetStats, 1)
-	processMetricsChan      = make(chan []ProcessMetrics, 1)
-	ticker                  *time.Ticker
+	snapshotBus             = NewSnapshotBus()
+	// snapshotWriters tracks subscribers that must flush files on exit.
+	snapshotWriters sync.WaitGroup
 
 	cachedHostname      string
 	cachedCurrentUser   string
@@ -232,6 +281,18 @@ var (
 		[]string{"core", "type"},
 	)
 
+	// Snapshots a bus subscriber was too slow to receive
+	snapshotsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mactop_snapshots_dropped_total",
+			Help: "Samples dropped because a consumer fell behind",
+		},
+		[]string{"subscriber"},
+	)
+
+	// Session energy, kept in step with the snapshot it came from
+	energyCounters = newEnergyCollector()
+
 	// System info metrics (static labels)
 	systemInfoGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
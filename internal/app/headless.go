@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
 	"os/signal"
 	"sort"
@@ -14,7 +14,6 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/toon-format/toon-go"
 	"gopkg.in/yaml.v3"
 )
@@ -27,6 +26,7 @@ func safeFloat64At(slice []float64, index int) float64 {
 }
 
 type HeadlessOutput struct {
+	SchemaVersion         int                `json:"schema_version" yaml:"schema_version" xml:"SchemaVersion" toon:"schema_version"`
 	Timestamp             string             `json:"timestamp" yaml:"timestamp" xml:"Timestamp" toon:"timestamp"`
 	SocMetrics            SocMetrics         `json:"soc_metrics" yaml:"soc_metrics" xml:"SocMetrics" toon:"soc_metrics"`
 	Memory                MemoryMetrics      `json:"memory" yaml:"memory" xml:"Memory" toon:"memory"`
@@ -42,67 +42,110 @@ type HeadlessOutput struct {
 	TBNetTotalBytesInSec  float64            `json:"tb_net_total_bytes_in_per_sec" yaml:"tb_net_total_bytes_in_per_sec" xml:"TBNetTotalBytesInSec" toon:"tb_net_total_bytes_in_per_sec"`
 	TBNetTotalBytesOutSec float64            `json:"tb_net_total_bytes_out_per_sec" yaml:"tb_net_total_bytes_out_per_sec" xml:"TBNetTotalBytesOutSec" toon:"tb_net_total_bytes_out_per_sec"`
 	RDMAStatus            RDMAStatus         `json:"rdma_status" yaml:"rdma_status" xml:"RDMAStatus" toon:"rdma_status"`
+	Energy                *EnergyOutput      `json:"energy,omitempty" yaml:"energy,omitempty" xml:"Energy,omitempty" toon:"energy,omitempty"`
+	Alerts                []Alert            `json:"alerts" yaml:"alerts" xml:"Alerts>Alert" toon:"alerts"`
+	Peers                 []Peer             `json:"peers,omitempty" yaml:"peers,omitempty" xml:"Peers>Peer,omitempty" toon:"peers,omitempty"`
+
+	capturedAt time.Time // full-precision sample time for line protocol
 }
 
 func runHeadless(count int) {
-	if err := initSocMetrics(); err != nil {
+	if err := metricSource.Init(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize metrics: %v\n", err)
 		os.Exit(1)
 	}
-	defer cleanupSocMetrics()
+	defer metricSource.Close()
 
-	startHeadlessPrometheus()
+	if prometheusPort != "" {
+		startMetricsServer(prometheusPort)
+	}
 
 	// Validate format
 	format := strings.ToLower(headlessFormat)
 	switch format {
-	case "json", "yaml", "xml", "toon", "csv":
+	case "json", "ndjson", "json-seq", "yaml", "xml", "toon", "csv", "influx":
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown format: %s. Defaulting to json.\n", format)
 		format = "json"
 	}
+	if err := setupHeadlessOutput(format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	tbInfo := performHeadlessWarmup()
 
-	printHeadlessStart(format, count)
+	// Cache SystemInfo since it doesn't change
+	cachedHeadlessSysInfo := metricSource.SystemInfo()
+
+	csvHeader := headlessCSVHeader(cachedHeadlessSysInfo.CoreCount)
+	if fieldFilter != nil {
+		// Written with the first sample, from the selected paths.
+		csvHeader = nil
+	}
+	printHeadlessStart(format, count, csvHeader)
 
 	// Setup signal handling for graceful shutdown (to close XML tags)
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	samplesCollected := 0
-
-	// Cache SystemInfo since it doesn't change
-	cachedHeadlessSysInfo := getSOCInfo()
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		waitForSnapshotWriters()
+	}()
+	// Exporters subscribe first so they already hold the final sample when
+	// the output loop sees it and shuts down.
+	startSnapshotConsumers(done)
+	samples := snapshotBus.Subscribe("headless", 16)
+	go collectSnapshots(done, snapshotBus, 1)
 
-	// First manual collection
-	if err := processHeadlessSample(format, tbInfo, cachedHeadlessSysInfo); err != nil {
-		fmt.Fprintf(os.Stderr, "Error formatting output: %v\n", err)
+	samplesCollected := 0
+	defer func() {
+		if dropped := samples.Dropped(); dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Dropped %d samples: output could not keep up\n", dropped)
+		}
+	}()
+
+	// write prints one record, a sample or a window summary, and reports
+	// whether --count is reached.
+	write := func(emit func() error) bool {
+		printHeadlessSeparator(format, count, samplesCollected)
+		if err := emit(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting output: %v\n", err)
+		}
+		samplesCollected++
+		return count > 0 && samplesCollected >= count
 	}
-	samplesCollected++
 
-	if count > 0 && samplesCollected >= count {
-		printHeadlessEnd(format, count)
-		return
+	var agg *headlessAggregator
+	if aggregateEvery > 0 {
+		agg = newHeadlessAggregator(aggregateEvery)
 	}
 
-	ticker := time.NewTicker(time.Duration(updateInterval) * time.Millisecond)
-	defer ticker.Stop()
-
 	for {
 		select {
 		case <-sigChan:
+			// Keep the partial window rather than lose it.
+			if w := agg.Flush(); w != nil {
+				write(func() error { return writeHeadlessWindow(format, w) })
+			}
 			printHeadlessEnd(format, count)
 			return
-		case <-ticker.C:
-			printHeadlessSeparator(format, count, samplesCollected)
-
-			if err := processHeadlessSample(format, tbInfo, cachedHeadlessSysInfo); err != nil {
-				fmt.Fprintf(os.Stderr, "Error formatting output: %v\n", err)
+		case s := <-samples.C:
+			output := buildHeadlessOutput(s, cachedHeadlessSysInfo, tbInfo)
+			emit := func() error { return processHeadlessSample(format, output) }
+			if agg != nil {
+				w, err := agg.Add(output)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error formatting output: %v\n", err)
+				}
+				if w == nil {
+					continue
+				}
+				emit = func() error { return writeHeadlessWindow(format, w) }
 			}
-
-			samplesCollected++
-			if count > 0 && samplesCollected >= count {
+			if write(emit) {
 				printHeadlessEnd(format, count)
 				return
 			}
@@ -110,7 +153,31 @@ func runHeadless(count int) {
 	}
 }
 
-func printHeadlessStart(format string, count int) {
+// setupHeadlessOutput checks --schema, --fields, --exclude and --aggregate
+// against format and sets fieldFilter.
+func setupHeadlessOutput(format string) error {
+	version, err := parseSchemaVersion(headlessSchema)
+	if err != nil {
+		return err
+	}
+	if format == "influx" && (version != headlessSchemaV1 || headlessFields != "" || excludeFields != "") {
+		return fmt.Errorf("--format influx has its own schema and cannot be combined with --schema v2, --fields or --exclude")
+	}
+	if fieldFilter, err = parseFieldSelection(headlessFields, excludeFields, version); err != nil {
+		return err
+	}
+	if aggregateEvery < 0 || (aggregateEvery > 0 && aggregateEvery < time.Second) {
+		return fmt.Errorf("--aggregate must be at least 1s")
+	}
+	if fieldFilter == nil && format == "csv" && (version != headlessSchemaV1 || aggregateEvery > 0) {
+		// Only v1 samples have a hand-written CSV layout; other schemas
+		// and window summaries get one column per path.
+		fieldFilter = &fieldSelection{}
+	}
+	return nil
+}
+
+func printHeadlessStart(format string, count int, csvHeader []string) {
 	if count > 0 {
 		switch format {
 		case "json":
@@ -118,7 +185,9 @@ func printHeadlessStart(format string, count int) {
 		case "xml":
 			fmt.Print("<MactopOutputList>")
 		case "csv":
-			printCSVHeader()
+			if csvHeader != nil {
+				fmt.Println(strings.Join(csvHeader, ","))
+			}
 		}
 	} else {
 		switch format {
@@ -126,12 +195,14 @@ func printHeadlessStart(format string, count int) {
 			// XML always needs a root element, even in infinite mode
 			fmt.Print("<MactopOutputList>")
 		case "csv":
-			printCSVHeader()
+			if csvHeader != nil {
+				fmt.Println(strings.Join(csvHeader, ","))
+			}
 		}
 	}
 }
 
-func printCSVHeader() {
+func headlessCSVHeader(coreCount int) []string {
 	headers := []string{
 		"Timestamp",
 		"System_Name", "Core_Count", "E_Core_Count", "P_Core_Count", "GPU_Core_Count",
@@ -146,16 +217,12 @@ func printCSVHeader() {
 	}
 
 	// Add dynamic core headers
-	sysInfo := getSOCInfo()
-	for i := 0; i < sysInfo.CoreCount; i++ {
+	for i := 0; i < coreCount; i++ {
 		headers = append(headers, fmt.Sprintf("Core_%d", i))
 	}
 
 	// Add JSON blob header for complex nested data
-	headers = append(headers, "Thunderbolt_Info_JSON")
-
-	// Print CSV header line
-	fmt.Println(strings.Join(headers, ","))
+	return append(headers, "Thunderbolt_Info_JSON", "Alerts")
 }
 
 func printHeadlessEnd(format string, count int) {
@@ -185,21 +252,14 @@ func printHeadlessSeparator(format string, count int, samplesCollected int) {
 	}
 }
 
-func startHeadlessPrometheus() {
-	if prometheusPort != "" {
-		go func() {
-			http.Handle("/metrics", promhttp.Handler())
-			if err := http.ListenAndServe(prometheusPort, nil); err != nil {
-				fmt.Fprintf(os.Stderr, "Prometheus server error: %v\n", err)
-			}
-		}()
+func performHeadlessWarmup() *ThunderboltOutput {
+	if replay != nil {
+		return nil
 	}
-}
 
-func performHeadlessWarmup() *ThunderboltOutput {
-	GetCPUPercentages()
-	getNetDiskMetrics()
-	GetThunderboltNetStats()
+	metricSource.CPUPercentages()
+	metricSource.NetDisk()
+	metricSource.ThunderboltNetStats()
 
 	startInit := time.Now()
 	tbInfo, _ := GetFormattedThunderboltInfo()
@@ -212,121 +272,151 @@ func performHeadlessWarmup() *ThunderboltOutput {
 	return tbInfo
 }
 
-func processHeadlessSample(format string, tbInfo *ThunderboltOutput, sysInfo SystemInfo) error {
-	output := collectHeadlessData(tbInfo, sysInfo)
-	var data []byte
-	var err error
-
-	switch format {
-	case "json":
-		if headlessPretty {
-			data, err = json.MarshalIndent(output, "", "  ")
-		} else {
-			data, err = json.Marshal(output)
+func processHeadlessSample(format string, output HeadlessOutput) error {
+	version, _ := parseSchemaVersion(headlessSchema)
+	v := headlessSample(output, version)
+	if fieldFilter != nil && format != "influx" {
+		sample, err := fieldFilter.Project(v)
+		if err != nil {
+			return err
 		}
-	case "yaml":
-		data, err = yaml.Marshal(output)
-	case "xml":
-		if headlessPretty {
-			data, err = xml.MarshalIndent(output, "", "  ")
-		} else {
-			data, err = xml.Marshal(output)
+		if format == "csv" {
+			return fieldFilter.WriteCSV(os.Stdout, sample)
 		}
-	case "toon":
-		data, err = toon.Marshal(output)
+		v = sample
+	}
+	switch format {
 	case "csv":
-		// Use encoding/csv for correct escaping
-		writer := csv.NewWriter(os.Stdout)
-
-		var record []string
-
-		// Standard fields
-		record = append(record,
-			output.Timestamp,
-			output.SystemInfo.Name,
-			fmt.Sprintf("%d", output.SystemInfo.CoreCount),
-			fmt.Sprintf("%d", output.SystemInfo.ECoreCount),
-			fmt.Sprintf("%d", output.SystemInfo.PCoreCount),
-			fmt.Sprintf("%d", output.SystemInfo.GPUCoreCount),
-			fmt.Sprintf("%.2f", output.CPUUsage),
-			fmt.Sprintf("%.2f", safeFloat64At(output.ECPUUsage, 0)),
-			fmt.Sprintf("%.2f", safeFloat64At(output.ECPUUsage, 1)),
-			fmt.Sprintf("%.2f", safeFloat64At(output.PCPUUsage, 0)),
-			fmt.Sprintf("%.2f", safeFloat64At(output.PCPUUsage, 1)),
-			fmt.Sprintf("%.2f", output.GPUUsage),
-			fmt.Sprintf("%d", output.Memory.Used),
-			fmt.Sprintf("%d", output.Memory.Total),
-			fmt.Sprintf("%d", output.Memory.SwapUsed),
-			fmt.Sprintf("%.2f", output.NetDisk.ReadKBytesPerSec),
-			fmt.Sprintf("%.2f", output.NetDisk.WriteKBytesPerSec),
-			fmt.Sprintf("%.2f", output.NetDisk.InBytesPerSec),
-			fmt.Sprintf("%.2f", output.NetDisk.OutBytesPerSec),
-			fmt.Sprintf("%.2f", output.TBNetTotalBytesInSec),
-			fmt.Sprintf("%.2f", output.TBNetTotalBytesOutSec),
-			fmt.Sprintf("%.2f", output.SocMetrics.TotalPower),
-			fmt.Sprintf("%.2f", output.SocMetrics.SystemPower),
-			fmt.Sprintf("%.2f", output.SocMetrics.CPUTemp),
-			fmt.Sprintf("%.2f", output.SocMetrics.GPUTemp),
-			output.ThermalState,
-			fmt.Sprintf("%t", output.RDMAStatus.Available),
-			output.RDMAStatus.Status,
-			fmt.Sprintf("%d", len(output.RDMAStatus.Devices)),
-		)
-
-		for i := 0; i < output.SystemInfo.CoreCount; i++ {
-			val := 0.0
-			if i < len(output.CoreUsages) {
-				val = output.CoreUsages[i]
-			}
-			record = append(record, fmt.Sprintf("%.2f", val))
-		}
-
-		tbJSON, _ := json.Marshal(output.ThunderboltInfo)
-		record = append(record, string(tbJSON))
-
-		writer.Write(record)
-		writer.Flush()
+		writeHeadlessCSV(output)
+		return nil
+	case "influx":
+		writeHeadlessInflux(output)
 		return nil
 	}
+	return writeHeadlessValue(format, v)
+}
 
+// writeHeadlessValue prints v in one of the structured formats.
+func writeHeadlessValue(format string, v any) error {
+	if format == "ndjson" || format == "json-seq" {
+		return writeJSONRecord(os.Stdout, format, v)
+	}
+	data, err := marshalHeadless(format, v)
 	if err != nil {
 		return err
 	}
-
 	fmt.Println(string(data))
 	return nil
 }
 
-func collectHeadlessData(tbInfo *ThunderboltOutput, sysInfo SystemInfo) HeadlessOutput {
-	m := sampleSocMetrics(updateInterval)
-	mem := getMemoryMetrics()
-	netDisk := getNetDiskMetrics()
-
-	var cpuUsage float64
-	percentages, err := GetCPUPercentages()
-	if err == nil && len(percentages) > 0 {
-		var total float64
-		for _, p := range percentages {
-			total += p
+// writeJSONRecord writes v as one compact JSON text and a newline, with the
+// RFC 7464 record separator in front for json-seq. --pretty is ignored so that
+// every record stays on one line, and the record goes out in a single write
+// so a reader never sees half a sample.
+func writeJSONRecord(w io.Writer, format string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 0, len(data)+2)
+	if format == "json-seq" {
+		record = append(record, 0x1e)
+	}
+	record = append(append(record, data...), '\n')
+	_, err = w.Write(record)
+	return err
+}
+
+// marshalHeadless encodes v in one of the structured headless formats. CSV
+// rows are written by the caller since their columns depend on the data.
+func marshalHeadless(format string, v any) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(v)
+	case "xml":
+		if headlessPretty {
+			return xml.MarshalIndent(v, "", "  ")
 		}
-		cpuUsage = total / float64(len(percentages))
+		return xml.Marshal(v)
+	case "toon":
+		return toon.Marshal(toonValue(v))
+	default:
+		if headlessPretty {
+			return json.MarshalIndent(v, "", "  ")
+		}
+		return json.Marshal(v)
 	}
+}
 
-	thermalStr, _ := getThermalStateString()
+func writeHeadlessCSV(output HeadlessOutput) {
+	// Use encoding/csv for correct escaping
+	writer := csv.NewWriter(os.Stdout)
+
+	var record []string
+
+	// Standard fields
+	record = append(record,
+		output.Timestamp,
+		output.SystemInfo.Name,
+		fmt.Sprintf("%d", output.SystemInfo.CoreCount),
+		fmt.Sprintf("%d", output.SystemInfo.ECoreCount),
+		fmt.Sprintf("%d", output.SystemInfo.PCoreCount),
+		fmt.Sprintf("%d", output.SystemInfo.GPUCoreCount),
+		fmt.Sprintf("%.2f", output.CPUUsage),
+		fmt.Sprintf("%.2f", safeFloat64At(output.ECPUUsage, 0)),
+		fmt.Sprintf("%.2f", safeFloat64At(output.ECPUUsage, 1)),
+		fmt.Sprintf("%.2f", safeFloat64At(output.PCPUUsage, 0)),
+		fmt.Sprintf("%.2f", safeFloat64At(output.PCPUUsage, 1)),
+		fmt.Sprintf("%.2f", output.GPUUsage),
+		fmt.Sprintf("%d", output.Memory.Used),
+		fmt.Sprintf("%d", output.Memory.Total),
+		fmt.Sprintf("%d", output.Memory.SwapUsed),
+		fmt.Sprintf("%.2f", output.NetDisk.ReadKBytesPerSec),
+		fmt.Sprintf("%.2f", output.NetDisk.WriteKBytesPerSec),
+		fmt.Sprintf("%.2f", output.NetDisk.InBytesPerSec),
+		fmt.Sprintf("%.2f", output.NetDisk.OutBytesPerSec),
+		fmt.Sprintf("%.2f", output.TBNetTotalBytesInSec),
+		fmt.Sprintf("%.2f", output.TBNetTotalBytesOutSec),
+		fmt.Sprintf("%.2f", output.SocMetrics.TotalPower),
+		fmt.Sprintf("%.2f", output.SocMetrics.SystemPower),
+		fmt.Sprintf("%.2f", output.SocMetrics.CPUTemp),
+		fmt.Sprintf("%.2f", output.SocMetrics.GPUTemp),
+		output.ThermalState,
+		fmt.Sprintf("%t", output.RDMAStatus.Available),
+		output.RDMAStatus.Status,
+		fmt.Sprintf("%d", len(output.RDMAStatus.Devices)),
+	)
+
+	for i := 0; i < output.SystemInfo.CoreCount; i++ {
+		val := 0.0
+		if i < len(output.CoreUsages) {
+			val = output.CoreUsages[i]
+		}
+		record = append(record, fmt.Sprintf("%.2f", val))
+	}
 
-	componentSum := m.TotalPower
-	totalPower := m.SystemPower
+	tbJSON, _ := json.Marshal(output.ThunderboltInfo)
+	record = append(record, string(tbJSON))
 
-	if totalPower < componentSum {
-		totalPower = componentSum
+	alertNames := make([]string, len(output.Alerts))
+	for i, a := range output.Alerts {
+		alertNames[i] = a.Name
 	}
+	record = append(record, strings.Join(alertNames, ";"))
 
-	residualSystem := totalPower - componentSum
+	writer.Write(record)
+	writer.Flush()
+}
 
-	m.SystemPower = residualSystem
-	m.TotalPower = totalPower
+// buildHeadlessOutput turns a Snapshot into the headless sample. The
+// SocMetrics power fields are rewritten so TotalPower is the full system draw
+// and SystemPower is the residual beyond the measured components.
+func buildHeadlessOutput(s Snapshot, sysInfo SystemInfo, tbInfo *ThunderboltOutput) HeadlessOutput {
+	m := s.Soc
+	m.SystemPower = s.CPU.SystemW
+	m.TotalPower = s.CPU.PackageW
+	tbNetStats := s.TBNetStats
 
-	tbNetStats := GetThunderboltNetStats()
 	var tbNetTotalIn, tbNetTotalOut float64
 	for _, stat := range tbNetStats {
 		tbNetTotalIn += stat.BytesInPerSec
@@ -335,26 +425,36 @@ func collectHeadlessData(tbInfo *ThunderboltOutput, sysInfo SystemInfo) Headless
 
 	mapTBNetStatsToBuses(tbNetStats, tbInfo)
 
-	// Get RDMA status and map devices to TB buses
-	rdmaStatus := CheckRDMAAvailable()
+	// Map RDMA devices to TB buses
+	rdmaStatus := s.RDMA
 	mapRDMADevicesToBuses(rdmaStatus.Devices, tbInfo)
 
+	alerts := s.Alerts
+	if alerts == nil {
+		alerts = []Alert{}
+	}
+
 	return HeadlessOutput{
-		Timestamp:             time.Now().Format(time.RFC3339),
+		SchemaVersion:         headlessSchemaV1,
+		Timestamp:             s.CapturedAt.Format(time.RFC3339),
 		SocMetrics:            m,
-		Memory:                mem,
-		NetDisk:               netDisk,
-		CPUUsage:              cpuUsage,
+		Memory:                s.Memory,
+		NetDisk:               s.NetDisk,
+		CPUUsage:              s.CPUUsage(),
 		ECPUUsage:             []float64{float64(m.EClusterFreqMHz), m.EClusterActive},
 		PCPUUsage:             []float64{float64(m.PClusterFreqMHz), m.PClusterActive},
 		GPUUsage:              m.GPUActive,
-		CoreUsages:            percentages,
+		CoreUsages:            s.CoreUsages,
 		SystemInfo:            sysInfo,
 		ThunderboltInfo:       tbInfo,
 		TBNetTotalBytesInSec:  tbNetTotalIn,
 		TBNetTotalBytesOutSec: tbNetTotalOut,
 		RDMAStatus:            rdmaStatus,
-		ThermalState:          thermalStr,
+		ThermalState:          s.ThermalState,
+		Energy:                energyOutput(s.Energy),
+		Alerts:                alerts,
+		Peers:                 s.Peers,
+		capturedAt:            s.CapturedAt,
 	}
 }
 
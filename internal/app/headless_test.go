@@ -65,3 +65,28 @@ func TestHeadlessIntegration(t *testing.T) {
 		t.Error("Expected non-zero core count")
 	}
 }
+
+func TestWriteJSONRecord(t *testing.T) {
+	saved := headlessPretty
+	headlessPretty = true
+	defer func() { headlessPretty = saved }()
+
+	v := map[string]any{"cpu_usage": 12.5, "nested": map[string]int{"a": 1}}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"ndjson", "{\"cpu_usage\":12.5,\"nested\":{\"a\":1}}\n"},
+		{"json-seq", "\x1e{\"cpu_usage\":12.5,\"nested\":{\"a\":1}}\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeJSONRecord(&buf, tt.format, v); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HistoryResolution selects which tier of a Series a chart reads from.
+type HistoryResolution int
+
+const (
+	HistoryRaw HistoryResolution = iota
+	History10s
+	History1m
+)
+
+func (r HistoryResolution) String() string {
+	switch r {
+	case History10s:
+		return "10s"
+	case History1m:
+		return "1m"
+	default:
+		return "raw"
+	}
+}
+
+// Next cycles raw -> 10s -> 1m -> raw.
+func (r HistoryResolution) Next() HistoryResolution {
+	return (r + 1) % 3
+}
+
+// Series names kept by the UI history store.
+const (
+	histCPU      = "cpu_usage"
+	histGPU      = "gpu_usage"
+	histPower    = "power_watts"
+	histMemUsed  = "memory_used_gb"
+	histSwapUsed = "swap_used_gb"
+	histTBIn     = "tb_net_in_kbps"
+	histTBOut    = "tb_net_out_kbps"
+)
+
+// HistoryRetention sets how much each tier keeps. Raw is counted in samples
+// because its spacing follows the update interval.
+type HistoryRetention struct {
+	RawSamples int
+	Tier10s    time.Duration
+	Tier1m     time.Duration
+}
+
+func DefaultHistoryRetention() HistoryRetention {
+	return HistoryRetention{RawSamples: 1000, Tier10s: time.Hour, Tier1m: 24 * time.Hour}
+}
+
+// HistoryConfig is the "history" section of config.json. Durations use Go
+// syntax, e.g. "1h" or "30m".
+type HistoryConfig struct {
+	RawSamples int    `json:"raw_samples,omitempty"`
+	Tier10s    string `json:"tier_10s,omitempty"`
+	Tier1m     string `json:"tier_1m,omitempty"`
+}
+
+// Retention merges the configured values over the defaults.
+func (c *HistoryConfig) Retention() (HistoryRetention, error) {
+	r := DefaultHistoryRetention()
+	if c == nil {
+		return r, nil
+	}
+	if c.RawSamples > 0 {
+		r.RawSamples = c.RawSamples
+	}
+	for _, f := range []struct {
+		value string
+		dst   *time.Duration
+		step  time.Duration
+	}{
+		{c.Tier10s, &r.Tier10s, 10 * time.Second},
+		{c.Tier1m, &r.Tier1m, time.Minute},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil || d < f.step {
+			return DefaultHistoryRetention(), fmt.Errorf("invalid history retention %q: must be a duration of at least %s", f.value, f.step)
+		}
+		*f.dst = d
+	}
+	return r, nil
+}
+
+// HistoryPoint summarises the samples that fell into one bucket. Raw points
+// hold a single sample, so Min, Max and Avg are equal.
+type HistoryPoint struct {
+	Time  time.Time
+	Min   float64
+	Max   float64
+	Avg   float64
+	Count int
+}
+
+func (p *HistoryPoint) add(v float64) {
+	if p.Count == 0 || v < p.Min {
+		p.Min = v
+	}
+	if p.Count == 0 || v > p.Max {
+		p.Max = v
+	}
+	p.Avg += (v - p.Avg) / float64(p.Count+1)
+	p.Count++
+}
+
+// pointRing is a fixed-capacity ring that overwrites its oldest point.
+type pointRing struct {
+	buf  []HistoryPoint
+	head int // index of the oldest point
+	n    int
+}
+
+func newPointRing(capacity int) pointRing {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return pointRing{buf: make([]HistoryPoint, capacity)}
+}
+
+func (r *pointRing) push(p HistoryPoint) {
+	if r.n < len(r.buf) {
+		r.buf[(r.head+r.n)%len(r.buf)] = p
+		r.n++
+		return
+	}
+	r.buf[r.head] = p
+	r.head = (r.head + 1) % len(r.buf)
+}
+
+// last appends the newest n points to dst, oldest first.
+func (r *pointRing) last(dst []HistoryPoint, n int) []HistoryPoint {
+	if n > r.n {
+		n = r.n
+	}
+	for i := r.n - n; i < r.n; i++ {
+		dst = append(dst, r.buf[(r.head+i)%len(r.buf)])
+	}
+	return dst
+}
+
+// historyTier downsamples into fixed-width buckets aligned to step. The
+// bucket being filled is reported as the newest point.
+type historyTier struct {
+	step    time.Duration
+	ring    pointRing
+	pending HistoryPoint
+}
+
+func (t *historyTier) add(at time.Time, v float64) {
+	start := at.Truncate(t.step)
+	if t.pending.Count > 0 && !start.Equal(t.pending.Time) {
+		t.ring.push(t.pending)
+		t.pending = HistoryPoint{}
+	}
+	if t.pending.Count == 0 {
+		t.pending.Time = start
+	}
+	t.pending.add(v)
+}
+
+func (t *historyTier) points(n int) []HistoryPoint {
+	if t.pending.Count == 0 {
+		return t.ring.last(nil, n)
+	}
+	out := t.ring.last(make([]HistoryPoint, 0, n), n-1)
+	return append(out, t.pending)
+}
+
+// Series is one metric kept at every resolution.
+type Series struct {
+	raw   pointRing
+	tiers [2]historyTier
+}
+
+func newSeries(r HistoryRetention) *Series {
+	return &Series{
+		raw: newPointRing(r.RawSamples),
+		tiers: [2]historyTier{
+			{step: 10 * time.Second, ring: newPointRing(int(r.Tier10s / (10 * time.Second)))},
+			{step: time.Minute, ring: newPointRing(int(r.Tier1m / time.Minute))},
+		},
+	}
+}
+
+func (s *Series) Add(at time.Time, v float64) {
+	p := HistoryPoint{Time: at}
+	p.add(v)
+	s.raw.push(p)
+	for i := range s.tiers {
+		s.tiers[i].add(at, v)
+	}
+}
+
+// Points returns up to the newest n points at res, oldest first.
+func (s *Series) Points(res HistoryResolution, n int) []HistoryPoint {
+	switch res {
+	case History10s:
+		return s.tiers[0].points(n)
+	case History1m:
+		return s.tiers[1].points(n)
+	default:
+		return s.raw.last(nil, n)
+	}
+}
+
+// HistoryStore holds a named Series per charted metric.
+type HistoryStore struct {
+	mu        sync.RWMutex
+	retention HistoryRetention
+	series    map[string]*Series
+}
+
+func NewHistoryStore(r HistoryRetention) *HistoryStore {
+	return &HistoryStore{retention: r, series: make(map[string]*Series)}
+}
+
+func (h *HistoryStore) Add(name string, at time.Time, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[name]
+	if !ok {
+		s = newSeries(h.retention)
+		h.series[name] = s
+	}
+	s.Add(at, v)
+}
+
+func (h *HistoryStore) Points(name string, res HistoryResolution, n int) []HistoryPoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s, ok := h.series[name]
+	if !ok {
+		return nil
+	}
+	return s.Points(res, n)
+}
+
+// Values returns exactly n averages for a chart, left-padded with zeros until
+// enough history has been collected.
+func (h *HistoryStore) Values(name string, res HistoryResolution, n int) []float64 {
+	if n < 1 {
+		return nil
+	}
+	points := h.Points(name, res, n)
+	values := make([]float64, n)
+	offset := n - len(points)
+	for i, p := range points {
+		values[offset+i] = p.Avg
+	}
+	return values
+}
+
+// recordHistory adds one snapshot to the UI history store.
+func recordHistory(s Snapshot) {
+	at := s.CapturedAt
+	if len(s.CoreUsages) > 0 {
+		history.Add(histCPU, at, s.CPUUsage())
+		history.Add(histMemUsed, at, float64(s.Memory.Used)/1024/1024/1024)
+		history.Add(histSwapUsed, at, float64(s.Memory.SwapUsed)/1024/1024/1024)
+	}
+	history.Add(histPower, at, s.CPU.PackageW)
+	history.Add(histGPU, at, s.GPU.ActivePercent)
+
+	if s.TBNetStats != nil {
+		var in, out float64
+		for _, stat := range s.TBNetStats {
+			in += stat.BytesInPerSec
+			out += stat.BytesOutPerSec
+		}
+		history.Add(histTBIn, at, in/1024)
+		history.Add(histTBOut, at, out/1024)
+	}
+}
+
+// historyTitleSuffix labels charts that are showing a downsampled tier.
+func historyTitleSuffix() string {
+	if historyResolution == HistoryRaw {
+		return ""
+	}
+	return fmt.Sprintf(" [%s avg]", historyResolution)
+}
+
+// meanNonZero averages the non-zero values, matching how the charts ignored
+// the empty slots before history filled up.
+func meanNonZero(values []float64) float64 {
+	var sum float64
+	count := 0
+	for _, v := range values {
+		if v > 0 {
+			sum += v
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
@@ -0,0 +1,330 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryRow is one downsampled value of a metric from `mactop history`.
+type HistoryRow struct {
+	Timestamp string  `json:"timestamp" yaml:"timestamp" xml:"Timestamp" toon:"timestamp"`
+	Metric    string  `json:"metric" yaml:"metric" xml:"Metric" toon:"metric"`
+	Avg       float64 `json:"avg" yaml:"avg" xml:"Avg" toon:"avg"`
+	Min       float64 `json:"min" yaml:"min" xml:"Min" toon:"min"`
+	Max       float64 `json:"max" yaml:"max" xml:"Max" toon:"max"`
+	Count     int     `json:"count" yaml:"count" xml:"Count" toon:"count"`
+}
+
+// historyQuery selects persisted samples and how to summarise them.
+type historyQuery struct {
+	Dir     string
+	Since   time.Time
+	Until   time.Time
+	Metrics []string
+	Step    time.Duration
+}
+
+func runHistoryCommand(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	dir := fs.String("dir", defaultHistoryDir(), "History directory written by --persist")
+	since := fs.String("since", "1h", "Start of the range: a duration back from now (e.g. 2h, 7d) or an RFC3339 time")
+	until := fs.String("until", "", "End of the range, same forms as --since (default: now)")
+	metrics := fs.String("metric", "", "Comma-separated metric paths, e.g. soc_metrics.cpu_power,core_usages.0")
+	step := fs.Duration("step", 0, "Downsample into buckets of this width (e.g. 10s, 1m). 0 keeps every sample")
+	format := fs.String("format", "json", "Output format: json, ndjson, json-seq, yaml, xml, csv, toon, influx (whole samples only)")
+	fs.BoolVar(&headlessPretty, "pretty", false, "Pretty print json and xml output")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mactop history [options]")
+		fmt.Fprintln(fs.Output(), "\nQuery samples saved with --persist.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	q := historyQuery{Dir: *dir, Step: *step, Until: now}
+	var err error
+	if q.Since, err = parseHistoryTime(*since, now); err != nil {
+		return err
+	}
+	if *until != "" {
+		if q.Until, err = parseHistoryTime(*until, now); err != nil {
+			return err
+		}
+	}
+	for _, m := range strings.Split(*metrics, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			q.Metrics = append(q.Metrics, m)
+		}
+	}
+
+	f := strings.ToLower(*format)
+	switch f {
+	case "json", "ndjson", "json-seq", "yaml", "xml", "toon", "csv", "influx":
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+
+	if f == "influx" && len(q.Metrics) > 0 {
+		return fmt.Errorf("--format influx writes whole samples and cannot be combined with --metric")
+	}
+	if len(q.Metrics) == 0 {
+		samples, err := queryHistorySamples(q)
+		if err != nil {
+			return err
+		}
+		coreCount := 0
+		if len(samples) > 0 {
+			coreCount = samples[0].SystemInfo.CoreCount
+		}
+		return printHistory(f, len(samples), headlessCSVHeader(coreCount), func(i int) error {
+			return processHeadlessSample(f, samples[i])
+		})
+	}
+
+	rows, err := queryHistoryRows(q)
+	if err != nil {
+		return err
+	}
+	header := []string{"Timestamp", "Metric", "Avg", "Min", "Max", "Count"}
+	return printHistory(f, len(rows), header, func(i int) error {
+		return printHistoryRow(f, rows[i])
+	})
+}
+
+// printHistory writes count items as a finite headless stream so the output
+// matches `--headless --count N`.
+func printHistory(format string, count int, csvHeader []string, write func(i int) error) error {
+	printHeadlessStart(format, count, csvHeader)
+	for i := 0; i < count; i++ {
+		printHeadlessSeparator(format, count, i)
+		if err := write(i); err != nil {
+			return err
+		}
+	}
+	if count == 0 && format == "json" {
+		fmt.Println("[]")
+		return nil
+	}
+	printHeadlessEnd(format, count)
+	return nil
+}
+
+func printHistoryRow(format string, r HistoryRow) error {
+	if format == "csv" {
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{r.Timestamp, r.Metric,
+			strconv.FormatFloat(r.Avg, 'f', -1, 64),
+			strconv.FormatFloat(r.Min, 'f', -1, 64),
+			strconv.FormatFloat(r.Max, 'f', -1, 64),
+			strconv.Itoa(r.Count)})
+		writer.Flush()
+		return writer.Error()
+	}
+	return writeHeadlessValue(format, r)
+}
+
+// parseHistoryTime accepts a duration before now ("90m", "2h", "7d") or an
+// RFC3339 timestamp.
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use a duration such as 2h or 7d, or an RFC3339 time", s)
+	}
+	return now.Add(-d), nil
+}
+
+// parseAge is time.ParseDuration plus a "d" suffix for days.
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration: %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+	return d, nil
+}
+
+// scanHistory calls fn with the timestamp and raw JSON of every persisted
+// sample in [q.Since, q.Until], oldest first.
+func scanHistory(q historyQuery, fn func(at time.Time, line []byte) error) error {
+	segments, err := listHistorySegments(q.Dir)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("no history in %s (run mactop with --persist to record it)", q.Dir)
+	}
+
+	var stamp struct {
+		Timestamp string `json:"timestamp"`
+	}
+	for i, seg := range segments {
+		if i+1 < len(segments) && !segments[i+1].Start.After(q.Since) {
+			continue // ends before the range
+		}
+		if seg.Start.After(q.Until) {
+			break
+		}
+		err := readHistorySegment(seg.Path, func(line []byte) error {
+			stamp.Timestamp = ""
+			if err := json.Unmarshal(line, &stamp); err != nil {
+				return nil
+			}
+			at, err := time.Parse(time.RFC3339, stamp.Timestamp)
+			if err != nil || at.Before(q.Since) || at.After(q.Until) {
+				return nil
+			}
+			return fn(at, line)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryHistorySamples returns whole samples, keeping the last one per step.
+func queryHistorySamples(q historyQuery) ([]HeadlessOutput, error) {
+	var samples []HeadlessOutput
+	var bucket time.Time
+	err := scanHistory(q, func(at time.Time, line []byte) error {
+		var s HeadlessOutput
+		if err := json.Unmarshal(line, &s); err != nil {
+			return nil
+		}
+		if q.Step > 0 {
+			b := at.Truncate(q.Step)
+			if len(samples) > 0 && b.Equal(bucket) {
+				samples[len(samples)-1] = s
+				return nil
+			}
+			bucket = b
+		}
+		samples = append(samples, s)
+		return nil
+	})
+	return samples, err
+}
+
+// queryHistoryRows extracts each metric and summarises it per step.
+func queryHistoryRows(q historyQuery) ([]HistoryRow, error) {
+	return summariseHistory(q.Metrics, q.Step, func(fn func(at time.Time, line []byte) error) error {
+		return scanHistory(q, fn)
+	})
+}
+
+// summariseHistory reads the metric paths from every sample that scan yields
+// and averages them per step, or keeps every value when step is 0.
+func summariseHistory(metrics []string, step time.Duration, scan func(fn func(at time.Time, line []byte) error) error) ([]HistoryRow, error) {
+	var rows []HistoryRow
+	pending := make([]HistoryPoint, len(metrics))
+	flush := func(i int) {
+		p := pending[i]
+		if p.Count == 0 {
+			return
+		}
+		rows = append(rows, HistoryRow{
+			Timestamp: p.Time.Format(time.RFC3339),
+			Metric:    metrics[i],
+			Avg:       p.Avg,
+			Min:       p.Min,
+			Max:       p.Max,
+			Count:     p.Count,
+		})
+		pending[i] = HistoryPoint{}
+	}
+
+	found := make([]bool, len(metrics))
+	scanned := 0
+	err := scan(func(at time.Time, line []byte) error {
+		var doc any
+		if err := json.Unmarshal(line, &doc); err != nil {
+			return nil
+		}
+		scanned++
+		bucket := at
+		if step > 0 {
+			bucket = at.Truncate(step)
+		}
+		for i, path := range metrics {
+			v, ok := lookupMetric(doc, path)
+			if !ok {
+				continue
+			}
+			found[i] = true
+			if pending[i].Count > 0 && !pending[i].Time.Equal(bucket) {
+				flush(i)
+			}
+			if pending[i].Count == 0 {
+				pending[i].Time = bucket
+			}
+			pending[i].add(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		flush(i)
+	}
+	for i, ok := range found {
+		if !ok && scanned > 0 {
+			return nil, fmt.Errorf("metric %q not found in history", metrics[i])
+		}
+	}
+	return rows, nil
+}
+
+// lookupMetric walks a dotted path such as "soc_metrics.cpu_power" or
+// "core_usages.3" through a decoded JSON sample.
+func lookupMetric(doc any, path string) (float64, bool) {
+	cur := doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[part]
+			if !ok {
+				return 0, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return 0, false
+			}
+			cur = node[i]
+		default:
+			return 0, false
+		}
+	}
+	switch v := cur.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
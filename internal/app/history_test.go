@@ -0,0 +1,118 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeriesTiers(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newSeries(HistoryRetention{RawSamples: 5, Tier10s: time.Minute, Tier1m: time.Hour})
+
+	// 25 one-second samples with values 0..24 span three 10s buckets.
+	for i := 0; i < 25; i++ {
+		s.Add(start.Add(time.Duration(i)*time.Second), float64(i))
+	}
+
+	tests := []struct {
+		name string
+		res  HistoryResolution
+		want []HistoryPoint
+	}{
+		{"raw keeps the newest samples", HistoryRaw, []HistoryPoint{
+			{Min: 22, Max: 22, Avg: 22, Count: 1},
+			{Min: 23, Max: 23, Avg: 23, Count: 1},
+			{Min: 24, Max: 24, Avg: 24, Count: 1},
+		}},
+		{"10s buckets include the open one", History10s, []HistoryPoint{
+			{Min: 0, Max: 9, Avg: 4.5, Count: 10},
+			{Min: 10, Max: 19, Avg: 14.5, Count: 10},
+			{Min: 20, Max: 24, Avg: 22, Count: 5},
+		}},
+		{"1m bucket still open", History1m, []HistoryPoint{
+			{Min: 0, Max: 24, Avg: 12, Count: 25},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.Points(tt.res, len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d points, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				if g.Min != want.Min || g.Max != want.Max || g.Avg != want.Avg || g.Count != want.Count {
+					t.Errorf("point %d = %+v, want min %.1f max %.1f avg %.1f count %d",
+						i, g, want.Min, want.Max, want.Avg, want.Count)
+				}
+			}
+		})
+	}
+}
+
+func TestSeriesRetentionWraps(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newSeries(HistoryRetention{RawSamples: 3, Tier10s: 20 * time.Second, Tier1m: time.Minute})
+	for i := 0; i < 100; i++ {
+		s.Add(start.Add(time.Duration(i)*time.Second), float64(i))
+	}
+
+	if got := s.Points(HistoryRaw, 10); len(got) != 3 || got[0].Avg != 97 {
+		t.Errorf("raw points = %+v, want the last 3 samples", got)
+	}
+	// Two closed 10s buckets plus the open one.
+	if got := s.Points(History10s, 10); len(got) != 3 || got[0].Min != 70 {
+		t.Errorf("10s points = %+v, want buckets from 70s", got)
+	}
+}
+
+func TestHistoryStoreValuesPadding(t *testing.T) {
+	h := NewHistoryStore(DefaultHistoryRetention())
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.Add(histGPU, start, 40)
+	h.Add(histGPU, start.Add(time.Second), 60)
+
+	got := h.Values(histGPU, HistoryRaw, 4)
+	want := []float64{0, 0, 40, 60}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Values() = %v, want %v", got, want)
+		}
+	}
+	if avg := meanNonZero(got); avg != 50 {
+		t.Errorf("meanNonZero() = %.1f, want 50", avg)
+	}
+	if got := h.Values("missing", HistoryRaw, 2); len(got) != 2 || got[0] != 0 {
+		t.Errorf("Values() for unknown series = %v, want zeros", got)
+	}
+}
+
+func TestHistoryConfigRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *HistoryConfig
+		want    HistoryRetention
+		wantErr bool
+	}{
+		{"Nil uses defaults", nil, DefaultHistoryRetention(), false},
+		{"Overrides", &HistoryConfig{RawSamples: 200, Tier10s: "2h", Tier1m: "48h"},
+			HistoryRetention{RawSamples: 200, Tier10s: 2 * time.Hour, Tier1m: 48 * time.Hour}, false},
+		{"Partial", &HistoryConfig{Tier10s: "30m"},
+			HistoryRetention{RawSamples: 1000, Tier10s: 30 * time.Minute, Tier1m: 24 * time.Hour}, false},
+		{"Shorter than a bucket", &HistoryConfig{Tier1m: "30s"}, DefaultHistoryRetention(), true},
+		{"Not a duration", &HistoryConfig{Tier10s: "soon"}, DefaultHistoryRetention(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.Retention()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Retention() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Retention() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
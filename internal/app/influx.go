@@ -0,0 +1,380 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// influxField is one field of a line protocol point. Value is a float64,
+// int64, uint64, bool or string.
+type influxField struct {
+	Key   string
+	Value any
+}
+
+var (
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxStringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+)
+
+// appendInfluxLine appends one point. Tags are key/value pairs; empty tag
+// values are left out as line protocol does not allow them.
+func appendInfluxLine(b []byte, measurement string, tags []string, fields []influxField, ts int64) []byte {
+	b = append(b, influxMeasurementEscaper.Replace(measurement)...)
+	for i := 0; i+1 < len(tags); i += 2 {
+		if tags[i+1] == "" {
+			continue
+		}
+		b = append(b, ',')
+		b = append(b, influxTagEscaper.Replace(tags[i])...)
+		b = append(b, '=')
+		b = append(b, influxTagEscaper.Replace(tags[i+1])...)
+	}
+	for i, f := range fields {
+		if i == 0 {
+			b = append(b, ' ')
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, influxTagEscaper.Replace(f.Key)...)
+		b = append(b, '=')
+		switch v := f.Value.(type) {
+		case float64:
+			b = strconv.AppendFloat(b, v, 'f', -1, 64)
+		case int64:
+			b = strconv.AppendInt(b, v, 10)
+			b = append(b, 'i')
+		case uint64:
+			b = strconv.AppendUint(b, v, 10)
+			b = append(b, 'i')
+		case bool:
+			b = strconv.AppendBool(b, v)
+		case string:
+			b = append(b, '"')
+			b = append(b, influxStringEscaper.Replace(v)...)
+			b = append(b, '"')
+		}
+	}
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, ts, 10)
+	return append(b, '\n')
+}
+
+// influxTimestamp is the sample time in nanoseconds. Samples read back from
+// disk only carry the second-resolution Timestamp string.
+func influxTimestamp(o HeadlessOutput) int64 {
+	if !o.capturedAt.IsZero() {
+		return o.capturedAt.UnixNano()
+	}
+	if t, err := time.Parse(time.RFC3339, o.Timestamp); err == nil {
+		return t.UnixNano()
+	}
+	return time.Now().UnixNano()
+}
+
+// appendInfluxSample encodes a headless sample as the soc, memory, net_disk,
+// cpu_core and thunderbolt_bus measurements. coreLabels names each entry of
+// CoreUsages (E0, P3, ...).
+func appendInfluxSample(b []byte, o HeadlessOutput, host string, coreLabels []string) []byte {
+	ts := influxTimestamp(o)
+	tags := []string{"host", host, "model", o.SystemInfo.Name}
+	m := o.SocMetrics
+
+	b = appendInfluxLine(b, "soc", tags, []influxField{
+		{"cpu_power", m.CPUPower},
+		{"gpu_power", m.GPUPower},
+		{"ane_power", m.ANEPower},
+		{"dram_power", m.DRAMPower},
+		{"gpu_sram_power", m.GPUSRAMPower},
+		{"system_power", m.SystemPower},
+		{"total_power", m.TotalPower},
+		{"cpu_usage", o.CPUUsage},
+		{"gpu_usage", o.GPUUsage},
+		{"gpu_freq_mhz", int64(m.GPUFreqMHz)},
+		{"e_cluster_active", m.EClusterActive},
+		{"e_cluster_freq_mhz", int64(m.EClusterFreqMHz)},
+		{"p_cluster_active", m.PClusterActive},
+		{"p_cluster_freq_mhz", int64(m.PClusterFreqMHz)},
+		{"cpu_temp", float64(m.CPUTemp)},
+		{"gpu_temp", float64(m.GPUTemp)},
+		{"thermal_state", o.ThermalState},
+		{"thermal_level", int64(thermalStateLevel(o.ThermalState))},
+	}, ts)
+
+	b = appendInfluxLine(b, "memory", tags, []influxField{
+		{"total", o.Memory.Total},
+		{"used", o.Memory.Used},
+		{"available", o.Memory.Available},
+		{"swap_total", o.Memory.SwapTotal},
+		{"swap_used", o.Memory.SwapUsed},
+	}, ts)
+
+	n := o.NetDisk
+	b = appendInfluxLine(b, "net_disk", tags, []influxField{
+		{"in_bytes_per_sec", n.InBytesPerSec},
+		{"out_bytes_per_sec", n.OutBytesPerSec},
+		{"in_packets_per_sec", n.InPacketsPerSec},
+		{"out_packets_per_sec", n.OutPacketsPerSec},
+		{"read_bytes_per_sec", n.ReadKBytesPerSec * 1024},
+		{"write_bytes_per_sec", n.WriteKBytesPerSec * 1024},
+		{"read_ops_per_sec", n.ReadOpsPerSec},
+		{"write_ops_per_sec", n.WriteOpsPerSec},
+		{"tb_in_bytes_per_sec", o.TBNetTotalBytesInSec},
+		{"tb_out_bytes_per_sec", o.TBNetTotalBytesOutSec},
+	}, ts)
+
+	if e := o.Energy; e != nil {
+		fields := []influxField{
+			{"duration_seconds", e.DurationSeconds},
+			{"cpu_joules", e.CPUJoules},
+			{"gpu_joules", e.GPUJoules},
+			{"ane_joules", e.ANEJoules},
+			{"dram_joules", e.DRAMJoules},
+			{"gpu_sram_joules", e.GPUSRAMJoules},
+			{"system_joules", e.SystemJoules},
+			{"total_joules", e.TotalJoules},
+			{"total_wh", e.TotalWh},
+		}
+		if e.Cost != nil {
+			fields = append(fields, influxField{"cost", *e.Cost})
+		}
+		if e.CO2Grams != nil {
+			fields = append(fields, influxField{"co2_grams", *e.CO2Grams})
+		}
+		b = appendInfluxLine(b, "energy", tags, fields, ts)
+	}
+
+	for i, usage := range o.CoreUsages {
+		label := strconv.Itoa(i)
+		if i < len(coreLabels) && coreLabels[i] != "" {
+			label = coreLabels[i]
+		}
+		coreType := ""
+		switch label[0] {
+		case 'E':
+			coreType = "e"
+		case 'P':
+			coreType = "p"
+		}
+		b = appendInfluxLine(b, "cpu_core", append(tags, "core", label, "type", coreType),
+			[]influxField{{"usage", usage}}, ts)
+	}
+
+	if o.ThunderboltInfo != nil {
+		for _, bus := range o.ThunderboltInfo.Buses {
+			fields := []influxField{{"active", bus.Status == "Active"}}
+			if bus.Speed != "" {
+				fields = append(fields, influxField{"speed", bus.Speed})
+			}
+			if s := bus.NetworkStats; s != nil {
+				fields = append(fields,
+					influxField{"bytes_in_per_sec", s.BytesInPerSec},
+					influxField{"bytes_out_per_sec", s.BytesOutPerSec},
+					influxField{"bytes_in", s.BytesIn},
+					influxField{"bytes_out", s.BytesOut},
+				)
+			}
+			busTags := append(tags, "bus", bus.Name, "receptacle", bus.ReceptacleID)
+			if bus.NetworkStats != nil {
+				busTags = append(busTags, "interface", bus.NetworkStats.InterfaceName)
+			}
+			b = appendInfluxLine(b, "thunderbolt_bus", busTags, fields, ts)
+		}
+	}
+	return b
+}
+
+var (
+	influxLabelsOnce sync.Once
+	influxHost       string
+	influxLabels     []string
+)
+
+// writeHeadlessInflux prints a sample as InfluxDB line protocol.
+func writeHeadlessInflux(o HeadlessOutput) {
+	influxLabelsOnce.Do(func() {
+		influxHost, _ = os.Hostname()
+		influxLabels = coreLabelsByIndex(o.SystemInfo)
+	})
+	os.Stdout.Write(appendInfluxSample(nil, o, influxHost, influxLabels))
+}
+
+// influxMaxPending caps the points kept while the server is unreachable.
+const influxMaxPending = 4 << 20
+
+// influxWriter pushes line protocol to the InfluxDB v2 write API in gzip
+// compressed batches.
+type influxWriter struct {
+	endpoint string
+	token    string
+	interval time.Duration
+	client   *http.Client
+
+	pending []byte
+	failing bool
+}
+
+// influxWriteURL builds the /api/v2/write URL for an org and bucket. A URL
+// that already names a write path is used as given.
+func influxWriteURL(base, org, bucket string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q", base)
+	}
+	if !strings.HasSuffix(u.Path, "/write") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+	}
+	q := u.Query()
+	if org != "" {
+		q.Set("org", org)
+	}
+	if bucket != "" {
+		q.Set("bucket", bucket)
+	}
+	if q.Get("bucket") == "" {
+		return "", errors.New("a bucket is required (--influx-bucket)")
+	}
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func newInfluxWriter(base, org, bucket, token string, interval time.Duration) (*influxWriter, error) {
+	endpoint, err := influxWriteURL(base, org, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, errors.New("flush interval must be positive")
+	}
+	return &influxWriter{
+		endpoint: endpoint,
+		token:    token,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Add queues a sample.
+func (w *influxWriter) Add(o HeadlessOutput, host string, coreLabels []string) {
+	w.pending = appendInfluxSample(w.pending, o, host, coreLabels)
+	if over := len(w.pending) - influxMaxPending; over > 0 {
+		// Drop whole lines from the front.
+		if i := bytes.IndexByte(w.pending[over:], '\n'); i >= 0 {
+			w.pending = append(w.pending[:0], w.pending[over+i+1:]...)
+		}
+	}
+}
+
+// Flush sends the queued points. They are kept for the next flush when the
+// server is unreachable or returns a 5xx or 429.
+func (w *influxWriter) Flush(ctx context.Context) error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	err := w.write(ctx, w.pending)
+	var rejected *influxRejectedError
+	if err == nil || errors.As(err, &rejected) {
+		w.pending = w.pending[:0]
+	}
+	return err
+}
+
+type influxRejectedError struct{ msg string }
+
+func (e *influxRejectedError) Error() string { return e.msg }
+
+func (w *influxWriter) write(ctx context.Context, lines []byte) error {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write(lines)
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("User-Agent", "mactop/"+version)
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return &influxRejectedError{fmt.Sprintf("influx rejected write: %s: %s", resp.Status, strings.TrimSpace(string(msg)))}
+	}
+	return fmt.Errorf("influx returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (w *influxWriter) flush(ctx context.Context) {
+	err := w.Flush(ctx)
+	switch {
+	case err != nil && !w.failing:
+		stderrLogger.Printf("Influx write failed: %v\n", err)
+	case err == nil && w.failing:
+		stderrLogger.Printf("Influx write recovered\n")
+	}
+	w.failing = err != nil
+}
+
+// runInfluxWriter batches every snapshot and writes every interval, then
+// once more when done is closed.
+func runInfluxWriter(done chan struct{}, w *influxWriter, sub *Subscription) {
+	info := metricSource.SystemInfo()
+	host, _ := os.Hostname()
+	labels := coreLabelsByIndex(info)
+	var tbInfo *ThunderboltOutput
+	if replay == nil {
+		tbInfo, _ = GetFormattedThunderboltInfo()
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+		drain:
+			for {
+				select {
+				case s := <-sub.C:
+					w.Add(buildHeadlessOutput(s, info, tbInfo), host, labels)
+				default:
+					break drain
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			w.flush(ctx)
+			cancel()
+			return
+		case s := <-sub.C:
+			w.Add(buildHeadlessOutput(s, info, tbInfo), host, labels)
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+			w.flush(ctx)
+			cancel()
+		}
+	}
+}
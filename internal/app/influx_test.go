@@ -0,0 +1,153 @@
+package app
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendInfluxLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement string
+		tags        []string
+		fields      []influxField
+		want        string
+	}{
+		{"Types", "soc", []string{"host", "mac"},
+			[]influxField{{"power", 1.5}, {"freq", int64(912)}, {"bytes", uint64(7)}, {"on", true}, {"state", "Fair"}},
+			`soc,host=mac power=1.5,freq=912i,bytes=7i,on=true,state="Fair" 42`},
+		{"Escaping", "net disk", []string{"model", "Apple M4, Pro", "k=v", "a"},
+			[]influxField{{"note", `say "hi"`}},
+			`net\ disk,model=Apple\ M4\,\ Pro,k\=v=a note="say \"hi\"" 42`},
+		{"Empty tags are skipped", "memory", []string{"host", "", "model", "M1"},
+			[]influxField{{"used", uint64(1)}},
+			`memory,model=M1 used=1i 42`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(appendInfluxLine(nil, tt.measurement, tt.tags, tt.fields, 42))
+			if got != tt.want+"\n" {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendInfluxSample(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 123456789, time.UTC)
+	o := buildHeadlessOutput(Snapshot{
+		CapturedAt: at,
+		Soc:        SocMetrics{CPUPower: 4.5, CPUTemp: 50},
+		CoreUsages: []float64{10, 90},
+		Memory:     MemoryMetrics{Used: 100},
+	}, SystemInfo{Name: "M4", CoreCount: 2, ECoreCount: 1, PCoreCount: 1}, &ThunderboltOutput{
+		Buses: []ThunderboltBusOutput{{Name: "TB4 @ Port 1", Status: "Active", Speed: "40 Gb/s"}},
+	})
+
+	lines := strings.Split(strings.TrimSpace(string(appendInfluxSample(nil, o, "studio", []string{"E0", "P0"}))), "\n")
+	measurements := map[string]string{}
+	for _, line := range lines {
+		name := line[:strings.IndexAny(line, ", ")]
+		measurements[name] += line + "\n"
+		if !strings.HasSuffix(line, " 1735689600123456789") {
+			t.Errorf("line without nanosecond timestamp: %s", line)
+		}
+	}
+	for _, name := range []string{"soc", "memory", "net_disk", "cpu_core", "thunderbolt_bus"} {
+		if measurements[name] == "" {
+			t.Errorf("missing measurement %s", name)
+		}
+	}
+	for _, want := range []string{
+		"soc,host=studio,model=M4 cpu_power=4.5,",
+		"memory,host=studio,model=M4 total=0i,used=100i,",
+		"cpu_core,host=studio,model=M4,core=E0,type=e usage=10 ",
+		"cpu_core,host=studio,model=M4,core=P0,type=p usage=90 ",
+		`thunderbolt_bus,host=studio,model=M4,bus=TB4\ @\ Port\ 1 active=true,speed="40 Gb/s" `,
+	} {
+		if !strings.Contains(strings.Join(lines, "\n"), want) {
+			t.Errorf("output missing %q:\n%s", want, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestInfluxWriter(t *testing.T) {
+	var body, query, auth, encoding string
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		query, auth, encoding = r.URL.RawQuery, r.Header.Get("Authorization"), r.Header.Get("Content-Encoding")
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("body is not gzip: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(gz)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w, err := newInfluxWriter(srv.URL, "lab", "metrics", "s3cret", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := HeadlessOutput{capturedAt: time.Unix(1, 0), CoreUsages: []float64{5}}
+	w.Add(o, "mac", nil)
+
+	// A 503 keeps the batch for the next flush.
+	if err := w.Flush(context.Background()); err == nil {
+		t.Fatal("expected an error for a 503 response")
+	}
+	w.Add(o, "mac", nil)
+	status = http.StatusNoContent
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if query != "bucket=metrics&org=lab&precision=ns" || auth != "Token s3cret" || encoding != "gzip" {
+		t.Errorf("query %q, auth %q, encoding %q", query, auth, encoding)
+	}
+	if n := strings.Count(body, "cpu_core,host=mac"); n != 2 {
+		t.Errorf("wrote %d cpu_core points, want 2 (retried and new):\n%s", n, body)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("%d bytes still pending after a successful write", len(w.pending))
+	}
+}
+
+func TestInfluxWriteURL(t *testing.T) {
+	tests := []struct {
+		base, org, bucket string
+		want              string
+		wantErr           bool
+	}{
+		{"http://localhost:8086", "lab", "mac", "http://localhost:8086/api/v2/write?bucket=mac&org=lab&precision=ns", false},
+		{"https://influx.example.com/proxy/", "", "mac", "https://influx.example.com/proxy/api/v2/write?bucket=mac&precision=ns", false},
+		{"http://localhost:8086/api/v2/write?bucket=b", "", "", "http://localhost:8086/api/v2/write?bucket=b&precision=ns", false},
+		{"http://localhost:8086", "lab", "", "", true},
+		{"localhost:8086", "lab", "mac", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			got, err := influxWriteURL(tt.base, tt.org, tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("influxWriteURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("influxWriteURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package app
 
 import (
 	"fmt"
+	"net"
 	"regexp"
+	"strconv"
 	"strings"
 
 	ui "github.com/metaspartan/gotui/v5"
@@ -14,15 +16,15 @@ func buildInfoLines(themeColor string) []string {
 
 	appleSiliconModel := cachedSystemInfo
 
-	memMetrics := getMemoryMetrics()
+	memMetrics := lastSnapshot.Memory
 	usedMem := float64(memMetrics.Used) / 1024 / 1024 / 1024
 	totalMem := float64(memMetrics.Total) / 1024 / 1024 / 1024
 	swapUsed := float64(memMetrics.SwapUsed) / 1024 / 1024 / 1024
 	swapTotal := float64(memMetrics.SwapTotal) / 1024 / 1024 / 1024
 
-	thermalStr, _ := getThermalStateString()
-	if lastCPUMetrics.CPUTemp > 0 {
-		thermalStr = fmt.Sprintf("%s (%s)", thermalStr, formatTemp(lastCPUMetrics.CPUTemp))
+	thermalStr := lastSnapshot.ThermalState
+	if lastSnapshot.CPU.CPUTemp > 0 {
+		thermalStr = fmt.Sprintf("%s (%s)", thermalStr, formatTemp(lastSnapshot.CPU.CPUTemp))
 	}
 
 	formatLine := func(label, value string) string {
@@ -30,22 +32,10 @@ func buildInfoLines(themeColor string) []string {
 		return fmt.Sprintf("[%s](fg:%s,mod:bold): [%s](fg:%s)", paddedLabel, themeColor, value, themeColor)
 	}
 
-	var sumWatts float64
-	countWatts := 0
-	for _, v := range powerValues {
-		if v > 0 {
-			actualWatts := (v / 8.0) * maxPowerSeen
-			sumWatts += actualWatts
-			countWatts++
-		}
-	}
-	avgWatts := 0.0
-	if countWatts > 0 {
-		avgWatts = sumWatts / float64(countWatts)
-	}
+	avgWatts := meanNonZero(history.Values(histPower, historyResolution, historyWindow))
+	energy := lastSnapshot.Energy
 
-	// Get RDMA status
-	rdmaStatus := CheckRDMAAvailable()
+	rdmaStatus := lastSnapshot.RDMA
 	rdmaLabel := "Disabled"
 	if rdmaStatus.Available {
 		rdmaLabel = "Enabled"
@@ -65,12 +55,17 @@ func buildInfoLines(themeColor string) []string {
 		formatLine("Swap", fmt.Sprintf("%.2f GB / %.2f GB", swapUsed, swapTotal)),
 		"",
 		formatLine("CPU Usage", fmt.Sprintf("%.2f%%", float64(cpuGauge.Percent))),
-		formatLine("GPU Usage", fmt.Sprintf("%d%%", int(lastGPUMetrics.ActivePercent))),
-		formatLine("ANE Usage", fmt.Sprintf("%d%%", int(lastCPUMetrics.ANEW/8.0*100))),
-		formatLine("Power", fmt.Sprintf("%.2f W (Avg %.0f W)", lastCPUMetrics.PackageW, avgWatts)),
+		formatLine("GPU Usage", fmt.Sprintf("%d%%", int(lastSnapshot.GPU.ActivePercent))),
+		formatLine("ANE Usage", fmt.Sprintf("%d%%", int(lastSnapshot.CPU.ANEW/8.0*100))),
+		formatLine("Power", fmt.Sprintf("%.2f W (Avg %.0f W)", lastSnapshot.CPU.PackageW, avgWatts)),
+		formatLine("Energy", energySummary(energy)),
+		formatLine(" CPU / GPU", fmt.Sprintf("%s / %s", formatEnergy(energy.CPU), formatEnergy(energy.GPU+energy.GPUSRAM))),
+		formatLine(" ANE / DRAM", fmt.Sprintf("%s / %s", formatEnergy(energy.ANE), formatEnergy(energy.DRAM))),
+		formatLine(" System", formatEnergy(energy.System)),
 		formatLine("Thermals", thermalStr),
-		formatLine("Network", fmt.Sprintf("↑ %s/s ↓ %s/s", formatBytes(lastNetDiskMetrics.OutBytesPerSec, networkUnit), formatBytes(lastNetDiskMetrics.InBytesPerSec, networkUnit))),
-		formatLine("Disk", fmt.Sprintf("R %s/s W %s/s", formatBytes(lastNetDiskMetrics.ReadKBytesPerSec*1024, diskUnit), formatBytes(lastNetDiskMetrics.WriteKBytesPerSec*1024, diskUnit))),
+		formatLine("Network", fmt.Sprintf("↑ %s/s ↓ %s/s", formatBytes(lastSnapshot.NetDisk.OutBytesPerSec, networkUnit), formatBytes(lastSnapshot.NetDisk.InBytesPerSec, networkUnit))),
+		formatLine("Disk", fmt.Sprintf("R %s/s W %s/s", formatBytes(lastSnapshot.NetDisk.ReadKBytesPerSec*1024, diskUnit), formatBytes(lastSnapshot.NetDisk.WriteKBytesPerSec*1024, diskUnit))),
+		formatLine("Samples", fmt.Sprintf("#%d, %d dropped", lastSnapshot.Seq, snapshotBus.Dropped())),
 	}
 
 	volumes := getVolumes()
@@ -92,6 +87,18 @@ func buildInfoLines(themeColor string) []string {
 
 	infoLines = append(infoLines, formatLine("RDMA", rdmaLabel))
 
+	if discovery != nil {
+		infoLines = append(infoLines, formatLine("Peers", fmt.Sprintf("%d found", len(lastSnapshot.Peers))))
+		for _, p := range lastSnapshot.Peers {
+			addr := p.Address
+			if p.APIPort != 0 {
+				addr = net.JoinHostPort(p.Address, strconv.Itoa(p.APIPort))
+			}
+			infoLines = append(infoLines, formatLine(" "+p.Hostname, fmt.Sprintf("%s %dC (%dE/%dP) %dGPU @ %s",
+				p.Model, p.SystemInfo.CoreCount, p.SystemInfo.ECoreCount, p.SystemInfo.PCoreCount, p.SystemInfo.GPUCoreCount, addr)))
+		}
+	}
+
 	tbInfoMutex.Lock()
 	tbInfo := tbDeviceInfo
 	tbInfoMutex.Unlock()
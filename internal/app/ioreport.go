@@ -1,3 +1,5 @@
+//go:build darwin
+
 // Copyright (c) 2024-2026 Carsen Klock under MIT License
 // ioreport.go - Go wrappers for IOReport power/thermal metrics
 package app
@@ -69,25 +71,6 @@ extern void debugMonitorChannels(int durationMs);
 */
 import "C"
 
-type SocMetrics struct {
-	CPUPower        float64 `json:"cpu_power"`
-	GPUPower        float64 `json:"gpu_power"`
-	ANEPower        float64 `json:"ane_power"`
-	DRAMPower       float64 `json:"dram_power"`
-	GPUSRAMPower    float64 `json:"gpu_sram_power"`
-	SystemPower     float64 `json:"system_power"`
-	TotalPower      float64 `json:"total_power"`
-	GPUFreqMHz      int32   `json:"gpu_freq_mhz"`
-	GPUActive       float64 `json:"-"`
-	EClusterActive  float64 `json:"e_cluster_active"`
-	PClusterActive  float64 `json:"p_cluster_active"`
-	EClusterFreqMHz int32   `json:"e_cluster_freq_mhz"`
-	PClusterFreqMHz int32   `json:"p_cluster_freq_mhz"`
-	SocTemp         float32 `json:"soc_temp"`
-	CPUTemp         float32 `json:"cpu_temp"`
-	GPUTemp         float32 `json:"gpu_temp"`
-}
-
 func initSocMetrics() error {
 	if ret := C.initIOReport(); ret != 0 {
 		return nil
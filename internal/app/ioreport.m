@@ -1,3 +1,5 @@
+//go:build darwin
+
 // Copyright (c) 2024-2026 Carsen Klock under MIT License
 // ioreport.m - Objective-C implementation for IOReport power/thermal metrics
 
@@ -0,0 +1,20 @@
+//go:build !darwin
+
+package app
+
+import "fmt"
+
+func initSocMetrics() error {
+	return fmt.Errorf("IOReport is only available on macOS")
+}
+
+func sampleSocMetrics(durationMs int) SocMetrics {
+	return SocMetrics{}
+}
+
+func cleanupSocMetrics() {}
+
+// DebugIOReport prints all available IOReport channels and groups to stdout
+func DebugIOReport() {
+	fmt.Println("IOReport is only available on macOS")
+}
@@ -1,14 +1,16 @@
 package app
 
 import (
-	"net/http"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func startPrometheusServer(port string) {
+// newPrometheusRegistry registers the gauges kept up to date by
+// updatePrometheusMetrics. It backs both /metrics and --remote-write.
+func newPrometheusRegistry() *prometheus.Registry {
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(cpuUsage)
 	registry.MustRegister(ecoreUsage)
@@ -27,16 +29,9 @@ func startPrometheusServer(port string) {
 	registry.MustRegister(rdmaAvailable)
 	registry.MustRegister(cpuCoreUsage)
 	registry.MustRegister(systemInfoGauge)
-
-	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-
-	http.Handle("/metrics", handler)
-	go func() {
-		err := http.ListenAndServe(":"+port, nil)
-		if err != nil {
-			stderrLogger.Printf("Failed to start Prometheus metrics server: %v\n", err)
-		}
-	}()
+	registry.MustRegister(snapshotsDropped)
+	registry.MustRegister(energyCounters)
+	return registry
 }
 
 func GetCPUPercentages() ([]float64, error) {
@@ -127,136 +122,96 @@ func getNetDiskMetrics() NetDiskMetrics {
 		lastDiskStats = totalDisk
 	}
 
-	networkSpeed.With(prometheus.Labels{"direction": "upload"}).Set(metrics.OutBytesPerSec)
-	networkSpeed.With(prometheus.Labels{"direction": "download"}).Set(metrics.InBytesPerSec)
-	diskIOSpeed.With(prometheus.Labels{"operation": "read"}).Set(metrics.ReadKBytesPerSec * 1024)
-	diskIOSpeed.With(prometheus.Labels{"operation": "write"}).Set(metrics.WriteKBytesPerSec * 1024)
-	diskIOPS.With(prometheus.Labels{"operation": "read"}).Set(metrics.ReadOpsPerSec)
-	diskIOPS.With(prometheus.Labels{"operation": "write"}).Set(metrics.WriteOpsPerSec)
-
 	lastNetDiskTime = now
 	return metrics
 }
 
-func collectNetDiskMetrics(done chan struct{}, netdiskMetricsChan chan NetDiskMetrics) {
-	for {
-		start := time.Now()
-
-		netdiskMetrics := getNetDiskMetrics()
-		select {
-		case <-done:
-			return
-		case netdiskMetricsChan <- netdiskMetrics:
-		default:
-		}
-
-		elapsed := time.Since(start)
-		sleepTime := time.Duration(updateInterval)*time.Millisecond - elapsed
-		if sleepTime > 0 {
-			select {
-			case <-time.After(sleepTime):
-			case <-interruptChan:
-			}
-		}
+// setSystemInfoGauge publishes the model and core counts as labels of
+// mactop_system_info.
+func setSystemInfoGauge(info SystemInfo) {
+	model := info.Name
+	if model == "" {
+		model = "Unknown Model"
 	}
+	systemInfoGauge.With(prometheus.Labels{
+		"model":          model,
+		"core_count":     fmt.Sprintf("%d", info.ECoreCount+info.PCoreCount),
+		"e_core_count":   fmt.Sprintf("%d", info.ECoreCount),
+		"p_core_count":   fmt.Sprintf("%d", info.PCoreCount),
+		"gpu_core_count": fmt.Sprintf("%d", info.GPUCoreCount),
+	}).Set(1)
 }
 
-func collectMetrics(done chan struct{}, cpumetricsChan chan CPUMetrics, gpumetricsChan chan GPUMetrics, tbNetStatsChan chan []ThunderboltNetStats, triggerProcessCollectionChan chan struct{}) {
-	for {
-		start := time.Now()
-
-		sampleDuration := updateInterval
-		if sampleDuration < 100 {
-			sampleDuration = 100
-		}
-
-		m := sampleSocMetrics(sampleDuration / 2)
-
-		_, throttled := getThermalStateString()
-
-		componentSum := m.TotalPower
-		totalPower := componentSum
-		systemResidual := 0.0
-
-		if m.SystemPower > componentSum {
-			totalPower = m.SystemPower
-			systemResidual = m.SystemPower - componentSum
-		}
-
-		cpuMetrics := CPUMetrics{
-			CPUW:            m.CPUPower,
-			GPUW:            m.GPUPower,
-			ANEW:            m.ANEPower,
-			DRAMW:           m.DRAMPower,
-			GPUSRAMW:        m.GPUSRAMPower,
-			SystemW:         systemResidual,
-			PackageW:        totalPower,
-			Throttled:       throttled,
-			CPUTemp:         float64(m.CPUTemp),
-			GPUTemp:         float64(m.GPUTemp),
-			EClusterActive:  int(m.EClusterActive),
-			PClusterActive:  int(m.PClusterActive),
-			EClusterFreqMHz: int(m.EClusterFreqMHz),
-			PClusterFreqMHz: int(m.PClusterFreqMHz),
-		}
-
-		gpuMetrics := GPUMetrics{
-			FreqMHz:       int(m.GPUFreqMHz),
-			ActivePercent: m.GPUActive,
-			Power:         m.GPUPower + m.GPUSRAMPower,
-			Temp:          m.GPUTemp,
-		}
+func updatePrometheusMetrics(s Snapshot, eCoreCount, pCoreCount int) {
+	ecoreAvg, pcoreAvg := calculateCoreAverages(s.CoreUsages, eCoreCount, pCoreCount)
+
+	cpuUsage.Set(s.CPUUsage())
+	ecoreUsage.Set(ecoreAvg)
+	pcoreUsage.Set(pcoreAvg)
+	powerUsage.With(prometheus.Labels{"component": "cpu"}).Set(s.CPU.CPUW)
+	powerUsage.With(prometheus.Labels{"component": "gpu"}).Set(s.CPU.GPUW)
+	powerUsage.With(prometheus.Labels{"component": "ane"}).Set(s.CPU.ANEW)
+	powerUsage.With(prometheus.Labels{"component": "dram"}).Set(s.CPU.DRAMW)
+	powerUsage.With(prometheus.Labels{"component": "gpu_sram"}).Set(s.CPU.GPUSRAMW)
+	powerUsage.With(prometheus.Labels{"component": "system"}).Set(s.CPU.SystemW)
+	powerUsage.With(prometheus.Labels{"component": "total"}).Set(s.CPU.PackageW)
+	energyCounters.Set(s.Energy)
+	socTemp.Set(s.CPU.CPUTemp)
+	gpuTemp.Set(s.CPU.GPUTemp)
+	thermalState.Set(float64(thermalStateLevel(s.ThermalState)))
+
+	memoryUsage.With(prometheus.Labels{"type": "used"}).Set(float64(s.Memory.Used) / 1024 / 1024 / 1024)
+	memoryUsage.With(prometheus.Labels{"type": "total"}).Set(float64(s.Memory.Total) / 1024 / 1024 / 1024)
+	memoryUsage.With(prometheus.Labels{"type": "swap_used"}).Set(float64(s.Memory.SwapUsed) / 1024 / 1024 / 1024)
+	memoryUsage.With(prometheus.Labels{"type": "swap_total"}).Set(float64(s.Memory.SwapTotal) / 1024 / 1024 / 1024)
+
+	// Update per-core CPU usage metrics
+	for i, usage := range s.CoreUsages {
+		coreType := "p"
+		if i < eCoreCount {
+			coreType = "e"
+		}
+		cpuCoreUsage.With(prometheus.Labels{"core": fmt.Sprintf("%d", i), "type": coreType}).Set(usage)
+	}
 
-		tbNetStats := GetThunderboltNetStats()
+	gpuUsage.Set(math.Max(s.GPU.ActivePercent, 0))
+	gpuFreqMHz.Set(float64(s.GPU.FreqMHz))
 
-		select {
-		case <-done:
-			return
-		case cpumetricsChan <- cpuMetrics:
-		default:
-		}
-		select {
-		case gpumetricsChan <- gpuMetrics:
-		default:
-		}
-		select {
-		case tbNetStatsChan <- tbNetStats:
-		default:
-		}
+	networkSpeed.With(prometheus.Labels{"direction": "upload"}).Set(s.NetDisk.OutBytesPerSec)
+	networkSpeed.With(prometheus.Labels{"direction": "download"}).Set(s.NetDisk.InBytesPerSec)
+	diskIOSpeed.With(prometheus.Labels{"operation": "read"}).Set(s.NetDisk.ReadKBytesPerSec * 1024)
+	diskIOSpeed.With(prometheus.Labels{"operation": "write"}).Set(s.NetDisk.WriteKBytesPerSec * 1024)
+	diskIOPS.With(prometheus.Labels{"operation": "read"}).Set(s.NetDisk.ReadOpsPerSec)
+	diskIOPS.With(prometheus.Labels{"operation": "write"}).Set(s.NetDisk.WriteOpsPerSec)
 
-		select {
-		case triggerProcessCollectionChan <- struct{}{}:
-		default:
-		}
-
-		elapsed := time.Since(start)
-		sleepTime := time.Duration(updateInterval)*time.Millisecond - elapsed
-		if sleepTime > 0 {
-			select {
-			case <-time.After(sleepTime):
-			case <-interruptChan:
-			}
-		}
+	var tbIn, tbOut float64
+	for _, stat := range s.TBNetStats {
+		tbIn += stat.BytesInPerSec
+		tbOut += stat.BytesOutPerSec
+	}
+	tbNetworkSpeed.With(prometheus.Labels{"direction": "download"}).Set(tbIn)
+	tbNetworkSpeed.With(prometheus.Labels{"direction": "upload"}).Set(tbOut)
+	if s.RDMA.Available {
+		rdmaAvailable.Set(1)
+	} else {
+		rdmaAvailable.Set(0)
 	}
 }
 
-func collectProcessMetrics(done chan struct{}, processMetricsChan chan []ProcessMetrics, triggerChan chan struct{}) {
-	for {
-		select {
-		case <-done:
-			return
-		case <-triggerChan:
-			renderMutex.Lock()
-			sysPct := lastGPUMetrics.ActivePercent
-			renderMutex.Unlock()
-
-			if processes, err := getProcessList(sysPct); err == nil {
-				processMetricsChan <- processes
-			} else {
-				stderrLogger.Printf("Error getting process list: %v\n", err)
-			}
+func calculateCoreAverages(coreUsages []float64, eCoreCount, pCoreCount int) (ecoreAvg, pcoreAvg float64) {
+	if eCoreCount > 0 && len(coreUsages) >= eCoreCount {
+		for i := 0; i < eCoreCount; i++ {
+			ecoreAvg += coreUsages[i]
+		}
+		ecoreAvg /= float64(eCoreCount)
+	}
+	if pCoreCount > 0 && len(coreUsages) >= eCoreCount+pCoreCount {
+		for i := eCoreCount; i < eCoreCount+pCoreCount; i++ {
+			pcoreAvg += coreUsages[i]
 		}
+		pcoreAvg /= float64(pCoreCount)
 	}
+	return ecoreAvg, pcoreAvg
 }
 
 func getMemoryMetrics() MemoryMetrics {
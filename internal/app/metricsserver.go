@@ -0,0 +1,179 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsMinStaleAfter is the shortest time without a sample before /healthz
+// reports the collector as stale.
+const metricsMinStaleAfter = 5 * time.Second
+
+// promRegistry is the one registry behind /metrics and --remote-write.
+var promRegistry = newPrometheusRegistry()
+
+// metricsServer serves /metrics, /healthz and /api/v1/snapshot. It is shared
+// by the TUI and headless mode.
+type metricsServer struct {
+	mu         sync.RWMutex
+	latest     Snapshot
+	observedAt time.Time
+	gap        time.Duration // time between the last two samples
+	info       SystemInfo
+	tbInfo     *ThunderboltOutput
+}
+
+// metricsListenAddr turns a bare --prometheus port into ":port" and passes
+// host:port addresses through.
+func metricsListenAddr(v string) string {
+	if _, err := strconv.Atoi(v); err == nil {
+		return ":" + v
+	}
+	return v
+}
+
+// startMetricsServer listens on addr and sets metricsSrv, which
+// startSnapshotConsumers then keeps up to date.
+func startMetricsServer(addr string) {
+	metricsSrv = &metricsServer{}
+	addr = metricsListenAddr(addr)
+	go func() {
+		if err := http.ListenAndServe(addr, metricsSrv.Handler(promRegistry)); err != nil {
+			stderrLogger.Printf("Failed to start Prometheus metrics server: %v\n", err)
+		}
+	}()
+	stderrLogger.Printf("Prometheus metrics available at http://%s/metrics\n", metricsDisplayAddr(addr))
+}
+
+func metricsDisplayAddr(addr string) string {
+	if len(addr) > 0 && addr[0] == ':' {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+// Handler routes the server's endpoints.
+func (m *metricsServer) Handler(gatherer prometheus.Gatherer) http.Handler {
+	mux := http.NewServeMux()
+	m.register(mux, gatherer)
+	return mux
+}
+
+func (m *metricsServer) register(mux *http.ServeMux, gatherer prometheus.Gatherer) {
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", m.serveHealth)
+	mux.HandleFunc("/api/v1/snapshot", m.serveSnapshot)
+}
+
+// Observe records s as the latest sample.
+func (m *metricsServer) Observe(s Snapshot, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.observedAt.IsZero() {
+		m.gap = at.Sub(m.observedAt)
+	}
+	m.latest = s
+	m.observedAt = at
+}
+
+// Latest returns the newest sample, if any has been observed.
+func (m *metricsServer) Latest() (Snapshot, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.latest, !m.observedAt.IsZero()
+}
+
+// Output builds the HeadlessOutput of s. buildHeadlessOutput annotates the
+// Thunderbolt buses in place, and the result is encoded after the lock is
+// released, so every call gets its own copy of them.
+func (m *metricsServer) Output(s Snapshot) HeadlessOutput {
+	m.mu.RLock()
+	info, tbInfo := m.info, m.tbInfo.clone()
+	m.mu.RUnlock()
+	return buildHeadlessOutput(s, info, tbInfo)
+}
+
+type healthResponse struct {
+	Status     string  `json:"status"`
+	LastSample string  `json:"last_sample,omitempty"`
+	AgeSeconds float64 `json:"age_seconds"`
+	Seq        uint64  `json:"seq"`
+	Dropped    uint64  `json:"dropped"`
+}
+
+// health reports "ok" while samples keep arriving, "starting" before the
+// first one and "stale" once none has arrived for three intervals.
+func (m *metricsServer) health(now time.Time) healthResponse {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.observedAt.IsZero() {
+		return healthResponse{Status: "starting"}
+	}
+	age := now.Sub(m.observedAt)
+	h := healthResponse{
+		Status:     "ok",
+		LastSample: m.latest.CapturedAt.Format(time.RFC3339Nano),
+		AgeSeconds: age.Seconds(),
+		Seq:        m.latest.Seq,
+		Dropped:    snapshotBus.Dropped(),
+	}
+	staleAfter := 3 * m.gap
+	if staleAfter < metricsMinStaleAfter {
+		staleAfter = metricsMinStaleAfter
+	}
+	if age > staleAfter {
+		h.Status = "stale"
+	}
+	return h
+}
+
+func (m *metricsServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	h := m.health(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	if h.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
+}
+
+func (m *metricsServer) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	s, ok := m.Latest()
+	if !ok {
+		http.Error(w, "no sample collected yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Output(s))
+}
+
+// runMetricsServer feeds the server every snapshot and, unless the remote
+// writer already does, keeps the Prometheus gauges in step with the bus.
+func runMetricsServer(done chan struct{}, m *metricsServer, sub *Subscription, updateGauges bool) {
+	info := metricSource.SystemInfo()
+	var tbInfo *ThunderboltOutput
+	if replay == nil {
+		tbInfo, _ = GetFormattedThunderboltInfo()
+	}
+	m.mu.Lock()
+	m.info, m.tbInfo = info, tbInfo
+	m.mu.Unlock()
+	setSystemInfoGauge(info)
+
+	for {
+		select {
+		case <-done:
+			return
+		case s := <-sub.C:
+			if updateGauges {
+				updatePrometheusMetrics(s, info.ECoreCount, info.PCoreCount)
+			}
+			m.Observe(s, time.Now())
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetricsServerEndpoints(t *testing.T) {
+	m := &metricsServer{info: SystemInfo{Name: "Apple M4", CoreCount: 2, ECoreCount: 1, PCoreCount: 1}}
+	srv := httptest.NewServer(m.Handler(promRegistry))
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || !strings.Contains(body, `"starting"`) {
+		t.Errorf("/healthz before the first sample = %d %s", code, body)
+	}
+	if code, _ := get("/api/v1/snapshot"); code != http.StatusServiceUnavailable {
+		t.Errorf("/api/v1/snapshot before the first sample = %d", code)
+	}
+
+	s := Snapshot{
+		Seq: 7, CapturedAt: time.Now(), CoreUsages: []float64{20, 40},
+		CPU: CPUMetrics{CPUW: 3.5}, Soc: SocMetrics{CPUPower: 3.5},
+		Energy: EnergyTotals{Seconds: 2, CPU: 7, Total: 7},
+	}
+	updatePrometheusMetrics(s, 1, 1)
+	m.Observe(s, time.Now())
+
+	code, body := get("/healthz")
+	var h healthResponse
+	if err := json.Unmarshal([]byte(body), &h); err != nil {
+		t.Fatalf("/healthz is not JSON: %v", err)
+	}
+	if code != http.StatusOK || h.Status != "ok" || h.Seq != 7 {
+		t.Errorf("/healthz = %d %+v", code, h)
+	}
+
+	code, body = get("/api/v1/snapshot")
+	var out HeadlessOutput
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatalf("/api/v1/snapshot is not JSON: %v", err)
+	}
+	if code != http.StatusOK || out.SocMetrics.CPUPower != 3.5 || out.SystemInfo.Name != "Apple M4" || out.CPUUsage != 30 {
+		t.Errorf("/api/v1/snapshot = %d %s", code, body)
+	}
+
+	code, body = get("/metrics")
+	if code != http.StatusOK || !strings.Contains(body, `mactop_power_watts{component="cpu"} 3.5`) {
+		t.Errorf("/metrics = %d, missing mactop gauges:\n%s", code, body)
+	}
+	if !strings.Contains(body, `mactop_energy_joules_total{component="cpu"} 7`) {
+		t.Errorf("/metrics is missing the energy counters:\n%s", body)
+	}
+	if strings.Contains(body, "go_goroutines") {
+		t.Error("/metrics exposes Go runtime metrics from the default registry")
+	}
+}
+
+// Concurrent snapshot requests must not share the Thunderbolt buses that
+// each response annotates. Run with -race.
+func TestMetricsServerSnapshotConcurrent(t *testing.T) {
+	m := &metricsServer{tbInfo: &ThunderboltOutput{Buses: []ThunderboltBusOutput{{Name: "TB4 Bus 0"}, {Name: "TB4 Bus 1"}}}}
+	m.Observe(Snapshot{
+		CapturedAt: time.Now(),
+		TBNetStats: []ThunderboltNetStats{{InterfaceName: "en2", BytesInPerSec: 10}, {InterfaceName: "en3", BytesInPerSec: 20}},
+		RDMA:       RDMAStatus{Devices: []RDMADevice{{Interface: "en2"}}},
+	}, time.Now())
+	srv := httptest.NewServer(m.Handler(promRegistry))
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				resp, err := http.Get(srv.URL + "/api/v1/snapshot")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var out HeadlessOutput
+				err = json.NewDecoder(resp.Body).Decode(&out)
+				resp.Body.Close()
+				if err != nil || out.ThunderboltInfo == nil || out.ThunderboltInfo.Buses[1].NetworkStats == nil {
+					t.Errorf("/api/v1/snapshot = %+v, %v", out.ThunderboltInfo, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, bus := range m.tbInfo.Buses {
+		if bus.NetworkStats != nil || bus.RDMADevice != nil {
+			t.Errorf("shared bus %s was annotated", bus.Name)
+		}
+	}
+}
+
+func TestMetricsServerHealthStale(t *testing.T) {
+	m := &metricsServer{}
+	start := time.Now()
+	m.Observe(Snapshot{}, start)
+	m.Observe(Snapshot{}, start.Add(2*time.Second))
+
+	tests := []struct {
+		after time.Duration
+		want  string
+	}{
+		{time.Second, "ok"},
+		{5 * time.Second, "ok"},
+		{7 * time.Second, "stale"},
+	}
+
+	for _, tt := range tests {
+		if got := m.health(start.Add(2*time.Second + tt.after)).Status; got != tt.want {
+			t.Errorf("health %v after the last sample = %q, want %q", tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsListenAddr(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"9090", ":9090"},
+		{":9090", ":9090"},
+		{"127.0.0.1:9090", "127.0.0.1:9090"},
+		{"[::1]:9090", "[::1]:9090"},
+	}
+
+	for _, tt := range tests {
+		if got := metricsListenAddr(tt.input); got != tt.want {
+			t.Errorf("metricsListenAddr(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -1,3 +1,5 @@
+//go:build darwin
+
 package app
 
 /*
@@ -584,14 +586,6 @@ import (
 	"unsafe"
 )
 
-type NativeMemoryMetrics struct {
-	Total     uint64
-	Used      uint64
-	Available uint64
-	SwapTotal uint64
-	SwapUsed  uint64
-}
-
 var (
 	pageSize    uint64
 	totalMemory uint64
@@ -755,15 +749,6 @@ func GetNativeDiskUsage(path string) (NativeDiskUsage, error) {
 	}, nil
 }
 
-// NativeNetMetric represents network interface statistics
-type NativeNetMetric struct {
-	Name        string
-	BytesSent   uint64
-	BytesRecv   uint64
-	PacketsSent uint64
-	PacketsRecv uint64
-}
-
 // GetNativeNetworkMetrics returns network statistics for all interfaces
 func GetNativeNetworkMetrics() (map[string]NativeNetMetric, error) {
 	var ifap *C.struct_ifaddrs
@@ -807,17 +792,6 @@ func GetNativeNetworkMetrics() (map[string]NativeNetMetric, error) {
 	return metrics, nil
 }
 
-// NativeDiskMetric represents disk I/O statistics
-type NativeDiskMetric struct {
-	Name       string
-	ReadBytes  uint64
-	WriteBytes uint64
-	ReadOps    uint64
-	WriteOps   uint64
-	ReadTime   uint64
-	WriteTime  uint64
-}
-
 // GetNativeDiskMetrics returns disk I/O statistics
 func GetNativeDiskMetrics() (map[string]NativeDiskMetric, error) {
 	maxStats := 32 // Reasonable limit for internal disks
@@ -1027,19 +1001,6 @@ func GetGPUCoreCountFast() int {
 	return int(C.get_gpu_core_count())
 }
 
-type ThunderboltSwitchInfo struct {
-	UID                uint64
-	ParentUID          uint64
-	RouterID           int
-	VendorID           int
-	DeviceID           int
-	VendorName         string
-	DeviceName         string
-	PortCount          int
-	Depth              int
-	ThunderboltVersion int
-}
-
 func GetThunderboltSwitchesIOKit() []ThunderboltSwitchInfo {
 	maxSwitches := 32
 	switches := make([]C.tb_switch_info_t, maxSwitches)
@@ -1066,15 +1027,6 @@ func GetThunderboltSwitchesIOKit() []ThunderboltSwitchInfo {
 	return result
 }
 
-type USBDeviceInfo struct {
-	VendorID    int
-	ProductID   int
-	LocationID  uint32
-	VendorName  string
-	ProductName string
-	Serial      string
-}
-
 func GetUSBDevicesIOKit() []USBDeviceInfo {
 	maxDevices := 64
 	devices := make([]C.usb_device_info_t, maxDevices)
@@ -1097,16 +1049,6 @@ func GetUSBDevicesIOKit() []USBDeviceInfo {
 	return result
 }
 
-type StorageDeviceInfo struct {
-	Name       string
-	BSDName    string
-	Protocol   string
-	MediumType string
-	IsInternal bool
-	IsWhole    bool
-	SizeBytes  uint64
-}
-
 func GetStorageDevicesIOKit() []StorageDeviceInfo {
 	maxDevices := 32
 	devices := make([]C.storage_device_info_t, maxDevices)
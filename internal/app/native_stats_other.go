@@ -0,0 +1,53 @@
+//go:build !darwin
+
+package app
+
+import "fmt"
+
+var errNativeStatsUnsupported = fmt.Errorf("native stats are only available on macOS")
+
+func GetNativeMemoryMetrics() (NativeMemoryMetrics, error) {
+	return NativeMemoryMetrics{}, errNativeStatsUnsupported
+}
+
+// GetNativeUptime returns the system uptime in seconds
+func GetNativeUptime() (uint64, error) {
+	return 0, errNativeStatsUnsupported
+}
+
+// GetNativeNetworkMetrics returns network statistics for all interfaces
+func GetNativeNetworkMetrics() (map[string]NativeNetMetric, error) {
+	return nil, errNativeStatsUnsupported
+}
+
+// GetNativeDiskMetrics returns disk I/O statistics
+func GetNativeDiskMetrics() (map[string]NativeDiskMetric, error) {
+	return nil, errNativeStatsUnsupported
+}
+
+// BuildCoreLabels has no IORegistry topology to read outside macOS, so callers
+// fall back to the sysctl-style E/P counts from SystemInfo.
+func BuildCoreLabels() ([]string, int, int, []int) {
+	return nil, 0, 0, nil
+}
+
+// GetGPUProcessStats returns per-process GPU statistics from IOKit AGXDeviceUserClient
+func GetGPUProcessStats() map[int]uint64 {
+	return nil
+}
+
+func GetGPUCoreCountFast() int {
+	return 0
+}
+
+func GetThunderboltSwitchesIOKit() []ThunderboltSwitchInfo {
+	return nil
+}
+
+func GetUSBDevicesIOKit() []USBDeviceInfo {
+	return nil
+}
+
+func GetStorageDevicesIOKit() []StorageDeviceInfo {
+	return nil
+}
@@ -0,0 +1,61 @@
+package app
+
+type NativeMemoryMetrics struct {
+	Total     uint64
+	Used      uint64
+	Available uint64
+	SwapTotal uint64
+	SwapUsed  uint64
+}
+
+// NativeNetMetric represents network interface statistics
+type NativeNetMetric struct {
+	Name        string
+	BytesSent   uint64
+	BytesRecv   uint64
+	PacketsSent uint64
+	PacketsRecv uint64
+}
+
+// NativeDiskMetric represents disk I/O statistics
+type NativeDiskMetric struct {
+	Name       string
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadOps    uint64
+	WriteOps   uint64
+	ReadTime   uint64
+	WriteTime  uint64
+}
+
+type ThunderboltSwitchInfo struct {
+	UID                uint64
+	ParentUID          uint64
+	RouterID           int
+	VendorID           int
+	DeviceID           int
+	VendorName         string
+	DeviceName         string
+	PortCount          int
+	Depth              int
+	ThunderboltVersion int
+}
+
+type USBDeviceInfo struct {
+	VendorID    int
+	ProductID   int
+	LocationID  uint32
+	VendorName  string
+	ProductName string
+	Serial      string
+}
+
+type StorageDeviceInfo struct {
+	Name       string
+	BSDName    string
+	Protocol   string
+	MediumType string
+	IsInternal bool
+	IsWhole    bool
+	SizeBytes  uint64
+}
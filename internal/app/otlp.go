@@ -0,0 +1,317 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpAttr is one OTLP KeyValue. Value is a string, int or float64.
+type otlpAttr struct {
+	Key   string
+	Value any
+}
+
+// otlpPoint is one gauge data point.
+type otlpPoint struct {
+	Attrs []otlpAttr
+	Value float64
+}
+
+// otlpMetric is one OTel gauge instrument and its points for a sample.
+type otlpMetric struct {
+	Name        string
+	Description string
+	Unit        string
+	Points      []otlpPoint
+}
+
+func otlpGauge(name, desc, unit string, value float64) otlpMetric {
+	return otlpMetric{Name: name, Description: desc, Unit: unit, Points: []otlpPoint{{Value: value}}}
+}
+
+// otlpSplit builds a gauge with one point per value of a single attribute.
+func otlpSplit(name, desc, unit, key string, values ...any) otlpMetric {
+	m := otlpMetric{Name: name, Description: desc, Unit: unit}
+	for i := 0; i+1 < len(values); i += 2 {
+		m.Points = append(m.Points, otlpPoint{
+			Attrs: []otlpAttr{{Key: key, Value: values[i]}},
+			Value: values[i+1].(float64),
+		})
+	}
+	return m
+}
+
+// otlpMetrics maps a snapshot to the instruments mactop exports over OTLP.
+// Names follow the Prometheus exporter with OTel units.
+func otlpMetrics(s Snapshot, eCoreCount, pCoreCount int) []otlpMetric {
+	ecoreAvg, pcoreAvg := calculateCoreAverages(s.CoreUsages, eCoreCount, pCoreCount)
+	tbIn, tbOut := tbNetTotals(s.TBNetStats)
+	return []otlpMetric{
+		otlpSplit("mactop.cpu.utilization", "CPU usage by core type", "%", "core.type",
+			"all", s.CPUUsage(), "efficiency", ecoreAvg, "performance", pcoreAvg),
+		otlpGauge("mactop.gpu.utilization", "GPU active residency", "%", math.Max(s.GPU.ActivePercent, 0)),
+		otlpGauge("mactop.gpu.frequency", "GPU frequency", "MHz", float64(s.GPU.FreqMHz)),
+		otlpSplit("mactop.power", "Power draw by component", "W", "component",
+			"cpu", s.CPU.CPUW, "gpu", s.CPU.GPUW, "ane", s.CPU.ANEW, "dram", s.CPU.DRAMW,
+			"gpu_sram", s.CPU.GPUSRAMW, "system", s.CPU.SystemW, "total", s.CPU.PackageW),
+		otlpSplit("mactop.temperature", "SoC temperature", "Cel", "sensor",
+			"cpu", s.CPU.CPUTemp, "gpu", s.CPU.GPUTemp),
+		otlpGauge("mactop.thermal_state", "Thermal state (0 nominal, 1 fair, 2 serious, 3 critical)", "1",
+			float64(thermalStateLevel(s.ThermalState))),
+		otlpSplit("mactop.memory.usage", "Memory and swap", "By", "state",
+			"used", float64(s.Memory.Used), "total", float64(s.Memory.Total),
+			"swap_used", float64(s.Memory.SwapUsed), "swap_total", float64(s.Memory.SwapTotal)),
+		otlpSplit("mactop.network.io.rate", "Network throughput", "By/s", "direction",
+			"receive", s.NetDisk.InBytesPerSec, "transmit", s.NetDisk.OutBytesPerSec),
+		otlpSplit("mactop.disk.io.rate", "Disk throughput", "By/s", "direction",
+			"read", s.NetDisk.ReadKBytesPerSec*1024, "write", s.NetDisk.WriteKBytesPerSec*1024),
+		otlpSplit("mactop.disk.operations.rate", "Disk operations", "{operation}/s", "direction",
+			"read", s.NetDisk.ReadOpsPerSec, "write", s.NetDisk.WriteOpsPerSec),
+		otlpSplit("mactop.thunderbolt.io.rate", "Thunderbolt Bridge throughput", "By/s", "direction",
+			"receive", tbIn, "transmit", tbOut),
+	}
+}
+
+// otlpResource describes this machine using SystemInfo and the host name.
+func otlpResource(info SystemInfo) []otlpAttr {
+	host, _ := os.Hostname()
+	return []otlpAttr{
+		{"service.name", "mactop"},
+		{"service.version", version},
+		{"host.name", host},
+		{"host.arch", runtime.GOARCH},
+		{"os.type", runtime.GOOS},
+		{"host.model", info.Name},
+		{"mactop.cpu.cores", info.CoreCount},
+		{"mactop.cpu.efficiency_cores", info.ECoreCount},
+		{"mactop.cpu.performance_cores", info.PCoreCount},
+		{"mactop.gpu.cores", info.GPUCoreCount},
+	}
+}
+
+// Field numbers from opentelemetry/proto/collector/metrics/v1 and
+// opentelemetry/proto/metrics/v1.
+const (
+	otlpRequestResourceMetrics = 1
+	otlpResourceMetricsRes     = 1
+	otlpResourceMetricsScope   = 2
+	otlpResourceAttributes     = 1
+	otlpScopeMetricsScope      = 1
+	otlpScopeMetricsMetrics    = 2
+	otlpScopeName              = 1
+	otlpScopeVersion           = 2
+	otlpMetricName             = 1
+	otlpMetricDescription      = 2
+	otlpMetricUnit             = 3
+	otlpMetricGauge            = 5
+	otlpGaugeDataPoints        = 1
+	otlpPointStartTime         = 2
+	otlpPointTime              = 3
+	otlpPointAsDouble          = 4
+	otlpPointAttributes        = 7
+	otlpKeyValueKey            = 1
+	otlpKeyValueValue          = 2
+	otlpAnyString              = 1
+	otlpAnyInt                 = 3
+	otlpAnyDouble              = 4
+)
+
+func appendOTLPMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendOTLPString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendOTLPAttrs(b []byte, num protowire.Number, attrs []otlpAttr) []byte {
+	for _, a := range attrs {
+		var v []byte
+		switch val := a.Value.(type) {
+		case string:
+			v = appendOTLPString(v, otlpAnyString, val)
+		case int:
+			v = protowire.AppendTag(v, otlpAnyInt, protowire.VarintType)
+			v = protowire.AppendVarint(v, uint64(val))
+		case float64:
+			v = protowire.AppendTag(v, otlpAnyDouble, protowire.Fixed64Type)
+			v = protowire.AppendFixed64(v, math.Float64bits(val))
+		}
+		var kv []byte
+		kv = appendOTLPString(kv, otlpKeyValueKey, a.Key)
+		kv = appendOTLPMessage(kv, otlpKeyValueValue, v)
+		b = appendOTLPMessage(b, num, kv)
+	}
+	return b
+}
+
+// encodeOTLPRequest builds an ExportMetricsServiceRequest holding one
+// resource, one scope and every metric sampled at `at`.
+func encodeOTLPRequest(resource []otlpAttr, metrics []otlpMetric, start, at time.Time) []byte {
+	var scope []byte
+	scope = appendOTLPString(scope, otlpScopeName, "github.com/metaspartan/mactop")
+	scope = appendOTLPString(scope, otlpScopeVersion, version)
+
+	var sm []byte
+	sm = appendOTLPMessage(sm, otlpScopeMetricsScope, scope)
+	for _, m := range metrics {
+		var gauge []byte
+		for _, p := range m.Points {
+			var dp []byte
+			dp = protowire.AppendTag(dp, otlpPointStartTime, protowire.Fixed64Type)
+			dp = protowire.AppendFixed64(dp, uint64(start.UnixNano()))
+			dp = protowire.AppendTag(dp, otlpPointTime, protowire.Fixed64Type)
+			dp = protowire.AppendFixed64(dp, uint64(at.UnixNano()))
+			dp = protowire.AppendTag(dp, otlpPointAsDouble, protowire.Fixed64Type)
+			dp = protowire.AppendFixed64(dp, math.Float64bits(p.Value))
+			dp = appendOTLPAttrs(dp, otlpPointAttributes, p.Attrs)
+			gauge = appendOTLPMessage(gauge, otlpGaugeDataPoints, dp)
+		}
+		var mb []byte
+		mb = appendOTLPString(mb, otlpMetricName, m.Name)
+		mb = appendOTLPString(mb, otlpMetricDescription, m.Description)
+		mb = appendOTLPString(mb, otlpMetricUnit, m.Unit)
+		mb = appendOTLPMessage(mb, otlpMetricGauge, gauge)
+		sm = appendOTLPMessage(sm, otlpScopeMetricsMetrics, mb)
+	}
+
+	var res []byte
+	res = appendOTLPAttrs(res, otlpResourceAttributes, resource)
+
+	var rm []byte
+	rm = appendOTLPMessage(rm, otlpResourceMetricsRes, res)
+	rm = appendOTLPMessage(rm, otlpResourceMetricsScope, sm)
+
+	return appendOTLPMessage(nil, otlpRequestResourceMetrics, rm)
+}
+
+// otlpExporter pushes the latest snapshot to an OTLP/HTTP collector.
+type otlpExporter struct {
+	endpoint string
+	headers  http.Header
+	interval time.Duration
+	client   *http.Client
+	start    time.Time
+	failing  bool
+}
+
+// otlpMetricsURL appends the standard /v1/metrics path when the endpoint is
+// a bare collector address such as http://localhost:4318.
+func otlpMetricsURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	return u.String(), nil
+}
+
+func newOTLPExporter(endpoint string, headers http.Header, interval time.Duration) (*otlpExporter, error) {
+	target, err := otlpMetricsURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, errors.New("export interval must be positive")
+	}
+	return &otlpExporter{
+		endpoint: target,
+		headers:  headers,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		start:    time.Now(),
+	}, nil
+}
+
+// Export sends one snapshot.
+func (e *otlpExporter) Export(ctx context.Context, s Snapshot, info SystemInfo) error {
+	body := encodeOTLPRequest(otlpResource(info), otlpMetrics(s, info.ECoreCount, info.PCoreCount), e.start, s.CapturedAt)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range e.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "mactop/"+version)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// export logs the first failure of a streak and the recovery after it.
+func (e *otlpExporter) export(ctx context.Context, s Snapshot, info SystemInfo) {
+	err := e.Export(ctx, s, info)
+	switch {
+	case err != nil && !e.failing:
+		stderrLogger.Printf("OTLP export failed: %v\n", err)
+	case err == nil && e.failing:
+		stderrLogger.Printf("OTLP export recovered\n")
+	}
+	e.failing = err != nil
+}
+
+// runOTLPExporter exports the newest snapshot every interval and once more
+// when done is closed.
+func runOTLPExporter(done chan struct{}, e *otlpExporter, sub *Subscription) {
+	info := metricSource.SystemInfo()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	var latest Snapshot
+	fresh := false
+	for {
+		select {
+		case <-done:
+		drain:
+			for {
+				select {
+				case latest = <-sub.C:
+					fresh = true
+				default:
+					break drain
+				}
+			}
+			if fresh {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				e.export(ctx, latest, info)
+				cancel()
+			}
+			return
+		case latest = <-sub.C:
+			fresh = true
+		case <-ticker.C:
+			if fresh {
+				ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+				e.export(ctx, latest, info)
+				cancel()
+				fresh = false
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// pbFields splits a protobuf message into its fields by number. Length
+// delimited fields are returned as raw bytes, fixed64 ones as uint64.
+func pbFields(t *testing.T, b []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := map[protowire.Number][]any{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		if n < 0 {
+			t.Fatalf("bad field %d: %v", num, protowire.ParseError(n))
+		}
+		fields[num] = append(fields[num], v)
+		b = b[n:]
+	}
+	return fields
+}
+
+// otlpDecoded is what the fake collector keeps of a request.
+type otlpDecoded struct {
+	resource map[string]any
+	// values maps "metric{attr=value}" to the point value.
+	values map[string]float64
+	units  map[string]string
+}
+
+func pbAttrs(t *testing.T, kvs []any) map[string]any {
+	attrs := map[string]any{}
+	for _, kv := range kvs {
+		f := pbFields(t, kv.([]byte))
+		val := pbFields(t, f[otlpKeyValueValue][0].([]byte))
+		key := string(f[otlpKeyValueKey][0].([]byte))
+		switch {
+		case val[otlpAnyString] != nil:
+			attrs[key] = string(val[otlpAnyString][0].([]byte))
+		case val[otlpAnyInt] != nil:
+			attrs[key] = int(val[otlpAnyInt][0].(uint64))
+		}
+	}
+	return attrs
+}
+
+func decodeOTLPRequest(t *testing.T, body []byte) otlpDecoded {
+	t.Helper()
+	d := otlpDecoded{values: map[string]float64{}, units: map[string]string{}}
+	req := pbFields(t, body)
+	rm := pbFields(t, req[otlpRequestResourceMetrics][0].([]byte))
+	res := pbFields(t, rm[otlpResourceMetricsRes][0].([]byte))
+	d.resource = pbAttrs(t, res[otlpResourceAttributes])
+
+	sm := pbFields(t, rm[otlpResourceMetricsScope][0].([]byte))
+	for _, raw := range sm[otlpScopeMetricsMetrics] {
+		m := pbFields(t, raw.([]byte))
+		name := string(m[otlpMetricName][0].([]byte))
+		d.units[name] = string(m[otlpMetricUnit][0].([]byte))
+		gauge := pbFields(t, m[otlpMetricGauge][0].([]byte))
+		for _, rawPoint := range gauge[otlpGaugeDataPoints] {
+			p := pbFields(t, rawPoint.([]byte))
+			key := name
+			for k, v := range pbAttrs(t, p[otlpPointAttributes]) {
+				key += "{" + k + "=" + v.(string) + "}"
+			}
+			d.values[key] = math.Float64frombits(p[otlpPointAsDouble][0].(uint64))
+		}
+	}
+	return d
+}
+
+func TestOTLPExport(t *testing.T) {
+	var got otlpDecoded
+	var contentType, auth, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		contentType, auth, path = r.Header.Get("Content-Type"), r.Header.Get("Authorization"), r.URL.Path
+		got = decodeOTLPRequest(t, body)
+	}))
+	defer srv.Close()
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer token")
+	e, err := newOTLPExporter(srv.URL, headers, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Snapshot{
+		CapturedAt: time.Now(),
+		CPU:        CPUMetrics{CPUW: 5.5, ANEW: 1.25, DRAMW: 0.75, CPUTemp: 61, GPUTemp: 55},
+		GPU:        GPUMetrics{ActivePercent: 42},
+		CoreUsages: []float64{10, 30, 50, 70},
+		Memory:     MemoryMetrics{Used: 8 << 30, Total: 16 << 30},
+		NetDisk:    NetDiskMetrics{InBytesPerSec: 1000, ReadKBytesPerSec: 2},
+		TBNetStats: []ThunderboltNetStats{{BytesOutPerSec: 300}, {BytesOutPerSec: 200}},
+	}
+	info := SystemInfo{Name: "Apple M4 Pro", CoreCount: 4, ECoreCount: 2, PCoreCount: 2, GPUCoreCount: 16}
+	if err := e.Export(context.Background(), s, info); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	if path != "/v1/metrics" || contentType != "application/x-protobuf" || auth != "Bearer token" {
+		t.Errorf("request path %q, content type %q, auth %q", path, contentType, auth)
+	}
+	wantResource := map[string]any{
+		"service.name": "mactop", "host.model": "Apple M4 Pro",
+		"mactop.cpu.cores": 4, "mactop.cpu.efficiency_cores": 2, "mactop.gpu.cores": 16,
+	}
+	for k, v := range wantResource {
+		if got.resource[k] != v {
+			t.Errorf("resource %s = %v, want %v", k, got.resource[k], v)
+		}
+	}
+	if got.resource["host.name"] == "" {
+		t.Error("resource host.name is empty")
+	}
+
+	wantValues := map[string]float64{
+		"mactop.cpu.utilization{core.type=all}":          40,
+		"mactop.cpu.utilization{core.type=efficiency}":   20,
+		"mactop.gpu.utilization":                         42,
+		"mactop.power{component=cpu}":                    5.5,
+		"mactop.power{component=ane}":                    1.25,
+		"mactop.power{component=dram}":                   0.75,
+		"mactop.temperature{sensor=gpu}":                 55,
+		"mactop.memory.usage{state=used}":                8 << 30,
+		"mactop.network.io.rate{direction=receive}":      1000,
+		"mactop.disk.io.rate{direction=read}":            2048,
+		"mactop.thunderbolt.io.rate{direction=transmit}": 500,
+	}
+	for k, v := range wantValues {
+		if g, ok := got.values[k]; !ok || g != v {
+			t.Errorf("%s = %v (present %v), want %v", k, g, ok, v)
+		}
+	}
+	if got.units["mactop.temperature"] != "Cel" || got.units["mactop.memory.usage"] != "By" {
+		t.Errorf("units = %v", got.units)
+	}
+}
+
+func TestOTLPExportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	e, _ := newOTLPExporter(srv.URL+"/otlp/v1/metrics", nil, time.Second)
+	if err := e.Export(context.Background(), Snapshot{CapturedAt: time.Now()}, SystemInfo{}); err == nil {
+		t.Error("expected an error for a 429 response")
+	}
+}
+
+func TestOTLPMetricsURL(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"http://localhost:4318", "http://localhost:4318/v1/metrics", false},
+		{"https://otel.example.com/", "https://otel.example.com/v1/metrics", false},
+		{"https://otel.example.com/custom/metrics", "https://otel.example.com/custom/metrics", false},
+		{"localhost:4318", "", true},
+		{"grpc://localhost:4317", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := otlpMetricsURL(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("otlpMetricsURL(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("otlpMetricsURL(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	historySegmentSuffix = ".ndjson.gz"
+	historySegmentLayout = "20060102T150405Z"
+	// Segments are closed after this span or size so retention can drop old
+	// data without rewriting files.
+	historySegmentSpan     = time.Hour
+	historySegmentMaxBytes = 16 << 20
+)
+
+// defaultHistoryDir is ~/.mactop/history.
+func defaultHistoryDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = os.TempDir()
+	}
+	return filepath.Join(homeDir, ".mactop", "history")
+}
+
+// historySegment is one file of persisted samples, named after its first one.
+type historySegment struct {
+	Path  string
+	Start time.Time
+	Size  int64
+}
+
+// listHistorySegments returns the segments in dir, oldest first.
+func listHistorySegments(dir string) ([]historySegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var segments []historySegment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, historySegmentSuffix) {
+			continue
+		}
+		start, err := time.Parse(historySegmentLayout, strings.TrimSuffix(name, historySegmentSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, historySegment{Path: filepath.Join(dir, name), Start: start, Size: info.Size()})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Start.Before(segments[j].Start) })
+	return segments, nil
+}
+
+// pruneHistory deletes segments that ended before now-maxAge, then the oldest
+// ones until the directory fits in maxBytes. The active segment is kept.
+func pruneHistory(dir string, maxAge time.Duration, maxBytes int64, now time.Time, active string) error {
+	segments, err := listHistorySegments(dir)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, s := range segments {
+		total += s.Size
+	}
+	for i, s := range segments {
+		if s.Path == active {
+			break
+		}
+		expired := false
+		if maxAge > 0 && i+1 < len(segments) {
+			// A segment ends where the next one starts.
+			expired = segments[i+1].Start.Before(now.Add(-maxAge))
+		}
+		oversize := maxBytes > 0 && total > maxBytes
+		if !expired && !oversize {
+			break
+		}
+		if err := os.Remove(s.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		total -= s.Size
+	}
+	return nil
+}
+
+// historyWriter appends headless samples to gzip NDJSON segments. Each sample
+// is flushed so a crash loses at most the gzip trailer, which readers tolerate.
+type historyWriter struct {
+	dir      string
+	maxAge   time.Duration
+	maxBytes int64
+
+	file     *os.File
+	gz       *gzip.Writer
+	enc      *json.Encoder
+	segStart time.Time
+}
+
+func newHistoryWriter(dir string, maxAge time.Duration, maxBytes int64) (*historyWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %v", err)
+	}
+	if err := pruneHistory(dir, maxAge, maxBytes, time.Now(), ""); err != nil {
+		return nil, fmt.Errorf("failed to prune history: %v", err)
+	}
+	return &historyWriter{dir: dir, maxAge: maxAge, maxBytes: maxBytes}, nil
+}
+
+func (w *historyWriter) Write(at time.Time, sample HeadlessOutput) error {
+	if w.file == nil || at.Sub(w.segStart) >= historySegmentSpan || w.size() >= historySegmentMaxBytes {
+		if err := w.rotate(at); err != nil {
+			return err
+		}
+	}
+	if err := w.enc.Encode(sample); err != nil {
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	return w.gz.Flush()
+}
+
+func (w *historyWriter) size() int64 {
+	info, err := w.file.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func (w *historyWriter) rotate(at time.Time) error {
+	if err := w.Close(); err != nil {
+		stderrLogger.Printf("Error closing history segment: %v\n", err)
+	}
+	path := filepath.Join(w.dir, at.UTC().Format(historySegmentLayout)+historySegmentSuffix)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create history segment: %v", err)
+	}
+	w.file, w.gz, w.segStart = f, gzip.NewWriter(f), at
+	w.enc = json.NewEncoder(w.gz)
+
+	if err := pruneHistory(w.dir, w.maxAge, w.maxBytes, at, path); err != nil {
+		stderrLogger.Printf("Error pruning history: %v\n", err)
+	}
+	return nil
+}
+
+func (w *historyWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	gzErr := w.gz.Close()
+	fileErr := w.file.Close()
+	w.file = nil
+	if gzErr != nil {
+		return gzErr
+	}
+	return fileErr
+}
+
+// runHistoryWriter persists every snapshot it receives until done is closed.
+func runHistoryWriter(done chan struct{}, w *historyWriter, sub *Subscription) {
+	sysInfo := metricSource.SystemInfo()
+	write := func(s Snapshot) {
+		if err := w.Write(s.CapturedAt, buildHeadlessOutput(s, sysInfo, nil)); err != nil {
+			stderrLogger.Printf("Error writing history: %v\n", err)
+		}
+	}
+	defer w.Close()
+	for {
+		select {
+		case <-done:
+			for {
+				select {
+				case s := <-sub.C:
+					write(s)
+				default:
+					return
+				}
+			}
+		case s := <-sub.C:
+			write(s)
+		}
+	}
+}
+
+// readHistorySegment calls fn with each sample line of a segment. A truncated
+// tail ends the segment without an error.
+func readHistorySegment(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil // created but never written
+		}
+		return fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if !json.Valid(scanner.Bytes()) {
+			break
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestHistory(t *testing.T, dir string, start time.Time, n int, step time.Duration) {
+	t.Helper()
+	w, err := newHistoryWriter(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("newHistoryWriter() error = %v", err)
+	}
+	for i := 0; i < n; i++ {
+		at := start.Add(time.Duration(i) * step)
+		sample := HeadlessOutput{
+			Timestamp:  at.Format(time.RFC3339),
+			SocMetrics: SocMetrics{CPUPower: float64(i)},
+			CoreUsages: []float64{float64(i * 10)},
+			GPUUsage:   50,
+		}
+		if err := w.Write(at, sample); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistoryWriterRotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Three hours of samples every 20 minutes span three segments.
+	writeTestHistory(t, dir, start, 9, 20*time.Minute)
+
+	segments, err := listHistorySegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(segments))
+	}
+	if !segments[0].Start.Equal(start) {
+		t.Errorf("first segment starts %v, want %v", segments[0].Start, start)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxBytes int64
+		now      time.Time
+		want     int
+	}{
+		{"Keeps everything", 0, 0, start.Add(100 * time.Hour), 4},
+		{"Drops expired segments", 2 * time.Hour, 0, start.Add(5 * time.Hour), 2},
+		{"Never drops the newest", time.Minute, 0, start.Add(100 * time.Hour), 1},
+		{"Drops oldest over size", 0, 1, start, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestHistory(t, dir, start, 4, time.Hour)
+			segments, _ := listHistorySegments(dir)
+			active := segments[len(segments)-1].Path
+
+			if err := pruneHistory(dir, tt.maxAge, tt.maxBytes, tt.now, active); err != nil {
+				t.Fatalf("pruneHistory() error = %v", err)
+			}
+			left, _ := listHistorySegments(dir)
+			if len(left) != tt.want {
+				t.Errorf("%d segments left, want %d", len(left), tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryHistoryRows(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestHistory(t, dir, start, 120, time.Second)
+
+	q := historyQuery{
+		Dir:     dir,
+		Since:   start.Add(30 * time.Second),
+		Until:   start.Add(89 * time.Second),
+		Metrics: []string{"soc_metrics.cpu_power", "core_usages.0"},
+		Step:    30 * time.Second,
+	}
+	rows, err := queryHistoryRows(q)
+	if err != nil {
+		t.Fatalf("queryHistoryRows() error = %v", err)
+	}
+	want := []HistoryRow{
+		{Timestamp: "2025-01-01T00:00:30Z", Metric: "soc_metrics.cpu_power", Avg: 44.5, Min: 30, Max: 59, Count: 30},
+		{Timestamp: "2025-01-01T00:00:30Z", Metric: "core_usages.0", Avg: 445, Min: 300, Max: 590, Count: 30},
+		{Timestamp: "2025-01-01T00:01:00Z", Metric: "soc_metrics.cpu_power", Avg: 74.5, Min: 60, Max: 89, Count: 30},
+		{Timestamp: "2025-01-01T00:01:00Z", Metric: "core_usages.0", Avg: 745, Min: 600, Max: 890, Count: 30},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+
+	q.Metrics = []string{"soc_metrics.missing"}
+	if _, err := queryHistoryRows(q); err == nil {
+		t.Error("expected an error for an unknown metric")
+	}
+}
+
+func TestQueryHistorySamplesStep(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestHistory(t, dir, start, 60, time.Second)
+
+	q := historyQuery{Dir: dir, Since: start, Until: start.Add(time.Hour), Step: 20 * time.Second}
+	samples, err := queryHistorySamples(q)
+	if err != nil {
+		t.Fatalf("queryHistorySamples() error = %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("got %d samples, want 3", len(samples))
+	}
+	if got := samples[0].SocMetrics.CPUPower; got != 19 {
+		t.Errorf("first bucket kept CPUPower %.0f, want the last sample (19)", got)
+	}
+}
+
+func TestReadHistorySegmentTruncated(t *testing.T) {
+	dir := t.TempDir()
+	writeTestHistory(t, dir, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 10, time.Second)
+	segments, _ := listHistorySegments(dir)
+	path := segments[0].Path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated")
+	if err := os.WriteFile(truncated, data[:len(data)-8], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+	if err := readHistorySegment(truncated, func([]byte) error { lines++; return nil }); err != nil {
+		t.Fatalf("readHistorySegment() error = %v", err)
+	}
+	if lines != 10 {
+		t.Errorf("read %d samples, want 10", lines)
+	}
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"90m", now.Add(-90 * time.Minute), false},
+		{"7d", now.Add(-7 * 24 * time.Hour), false},
+		{"2025-05-31T00:00:00Z", time.Date(2025, 5, 31, 0, 0, 0, 0, time.UTC), false},
+		{"-1h", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseHistoryTime(tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHistoryTime(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseHistoryTime(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,221 +1,16 @@
 package app
 
-/*
-#include <sys/sysctl.h>
-#include <pwd.h>
-#include <unistd.h>
-#include <libproc.h>
-#include <mach/mach_host.h>
-#include <mach/processor_info.h>
-#include <mach/mach_init.h>
-#include <mach/mach_time.h>
-
-extern kern_return_t vm_deallocate(vm_map_t target_task, vm_address_t address, vm_size_t size);
-*/
-import "C"
 import (
 	"fmt"
-	"path/filepath"
+	"math"
 	"sort"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
-	"unsafe"
 
 	ui "github.com/metaspartan/gotui/v5"
 )
 
-var uidCache = make(map[uint32]string)
-var uidCacheMutex sync.RWMutex
-
-func getUsername(uid uint32) string {
-	uidCacheMutex.RLock()
-	name, ok := uidCache[uid]
-	uidCacheMutex.RUnlock()
-	if ok {
-		return name
-	}
-
-	uidCacheMutex.Lock()
-	defer uidCacheMutex.Unlock()
-
-	// Double check
-	if name, ok := uidCache[uid]; ok {
-		return name
-	}
-
-	// Use C.getpwuid
-	pwd := C.getpwuid(C.uid_t(uid))
-	if pwd != nil {
-		name = C.GoString(pwd.pw_name)
-	} else {
-		name = fmt.Sprintf("%d", uid)
-	}
-	uidCache[uid] = name
-	return name
-}
-
-type ProcessTimeState struct {
-	Time      uint64
-	Timestamp time.Time
-}
-
-var prevProcessTimes = make(map[int]ProcessTimeState)
-var prevProcessTimesMutex sync.Mutex
-
-var timebaseInfo C.mach_timebase_info_data_t
-var timebaseOnce sync.Once
-
-func getTimebase() {
-	C.mach_timebase_info(&timebaseInfo)
-}
-
-func processOsProc(kp C.struct_kinfo_proc, now time.Time, prevProcessTimes map[int]ProcessTimeState, totalMem uint64, numer, denom uint64) (ProcessMetrics, int, ProcessTimeState, bool) {
-	pid := int(kp.kp_proc.p_pid)
-	if pid == 0 {
-		return ProcessMetrics{}, 0, ProcessTimeState{}, false
-	}
-
-	comm := C.GoString(&kp.kp_proc.p_comm[0])
-	var pathBuf [C.PROC_PIDPATHINFO_MAXSIZE]C.char
-	if C.proc_pidpath(C.int(pid), unsafe.Pointer(&pathBuf), C.PROC_PIDPATHINFO_MAXSIZE) > 0 {
-		fullPath := C.GoString(&pathBuf[0])
-		comm = filepath.Base(fullPath)
-	}
-
-	rssBytes := int64(0)
-	vszBytes := int64(0)
-	totalTimeNs := uint64(0)
-
-	var taskInfo C.struct_proc_taskinfo
-	ret := C.proc_pidinfo(C.int(pid), C.PROC_PIDTASKINFO, 0, unsafe.Pointer(&taskInfo), C.int(C.sizeof_struct_proc_taskinfo))
-	if ret == C.int(C.sizeof_struct_proc_taskinfo) {
-		rssBytes = int64(taskInfo.pti_resident_size)
-		vszBytes = int64(taskInfo.pti_virtual_size)
-		rawTime := uint64(taskInfo.pti_total_user) + uint64(taskInfo.pti_total_system)
-		totalTimeNs = (rawTime * numer) / denom
-	}
-
-	cpuPercent := 0.0
-	if prevState, ok := prevProcessTimes[pid]; ok {
-		timeDelta := totalTimeNs - prevState.Time
-		wallDelta := now.Sub(prevState.Timestamp).Nanoseconds()
-		if wallDelta > 0 && timeDelta > 0 {
-			cpuPercent = (float64(timeDelta) / float64(wallDelta)) * 100.0
-		}
-	}
-
-	newState := ProcessTimeState{
-		Time:      totalTimeNs,
-		Timestamp: now,
-	}
-
-	memPercent := 0.0
-	if totalMem > 0 {
-		memPercent = (float64(rssBytes) / float64(totalMem)) * 100.0
-	}
-
-	state := ""
-	switch kp.kp_proc.p_stat {
-	case C.SIDL:
-		state = "I"
-	case C.SRUN:
-		state = "R"
-	case C.SSLEEP:
-		state = "S"
-	case C.SSTOP:
-		state = "T"
-	case C.SZOMB:
-		state = "Z"
-	default:
-		state = "?"
-	}
-
-	uid := uint32(kp.kp_eproc.e_ucred.cr_uid)
-	user := getUsername(uid)
-
-	totalSeconds := float64(totalTimeNs) / 1e9
-	timeStr := formatTime(totalSeconds)
-
-	pm := ProcessMetrics{
-		PID:         pid,
-		User:        user,
-		CPU:         cpuPercent,
-		Memory:      memPercent,
-		VSZ:         vszBytes / 1024,
-		RSS:         rssBytes / 1024,
-		Command:     comm,
-		State:       state,
-		Started:     "",
-		Time:        timeStr,
-		LastUpdated: now,
-	}
-	return pm, pid, newState, true
-}
-
-func getProcessList(systemGpuPercent float64) ([]ProcessMetrics, error) {
-	mib := []C.int{C.CTL_KERN, C.KERN_PROC, C.KERN_PROC_ALL}
-	var size C.size_t
-
-	if _, err := C.sysctl(&mib[0], 3, nil, &size, nil, 0); err != nil {
-		return nil, fmt.Errorf("sysctl size check failed: %v", err)
-	}
-
-	buf := make([]byte, size)
-	if _, err := C.sysctl(&mib[0], 3, unsafe.Pointer(&buf[0]), &size, nil, 0); err != nil {
-		return nil, fmt.Errorf("sysctl fetch failed: %v", err)
-	}
-
-	count := int(size) / int(C.sizeof_struct_kinfo_proc)
-	kprocs := (*[1 << 30]C.struct_kinfo_proc)(unsafe.Pointer(&buf[0]))[:count:count]
-
-	var processes []ProcessMetrics
-	now := time.Now()
-
-	prevProcessTimesMutex.Lock()
-	defer prevProcessTimesMutex.Unlock()
-
-	nextProcessTimes := make(map[int]ProcessTimeState)
-
-	mibMem := []C.int{6, 24}
-	var memSize C.uint64_t
-	memLen := C.size_t(unsafe.Sizeof(memSize))
-	totalMem := uint64(0)
-	if _, err := C.sysctl(&mibMem[0], 2, unsafe.Pointer(&memSize), &memLen, nil, 0); err == nil {
-		totalMem = uint64(memSize)
-	}
-
-	timebaseOnce.Do(getTimebase)
-	numer := uint64(timebaseInfo.numer)
-	denom := uint64(timebaseInfo.denom)
-	if denom == 0 {
-		denom = 1
-	}
-
-	for _, kp := range kprocs {
-		pm, pid, ns, ok := processOsProc(kp, now, prevProcessTimes, totalMem, numer, denom)
-		if ok {
-			processes = append(processes, pm)
-			nextProcessTimes[pid] = ns
-		}
-	}
-
-	prevProcessTimes = nextProcessTimes
-
-	updateProcessGPUMetrics(processes, now, systemGpuPercent)
-
-	sort.Slice(processes, func(i, j int) bool {
-		return processes[i].CPU > processes[j].CPU
-	})
-
-	if len(processes) > 500 {
-		processes = processes[:500]
-	}
-
-	return processes, nil
-}
-
 // updateProcessGPUMetrics calculates per-process GPU usage and updates process metrics
 func updateProcessGPUMetrics(processes []ProcessMetrics, now time.Time, systemGpuPercent float64) {
 	gpuProcessStatsMutex.Lock()
@@ -257,37 +52,41 @@ func updateProcessGPUMetrics(processes []ProcessMetrics, now time.Time, systemGp
 	lastGPUProcessStatsTime = now
 }
 
-func GetCPUUsage() ([]CPUUsage, error) {
-	var numCPUs C.natural_t
-	var cpuLoad *C.processor_cpu_load_info_data_t
-	var cpuMsgCount C.mach_msg_type_number_t
-	host := C.mach_host_self()
-	kernReturn := C.host_processor_info(
-		host,
-		C.PROCESSOR_CPU_LOAD_INFO,
-		&numCPUs,
-		(*C.processor_info_array_t)(unsafe.Pointer(&cpuLoad)),
-		&cpuMsgCount,
-	)
-	if kernReturn != C.KERN_SUCCESS {
-		return nil, fmt.Errorf("error getting CPU info: %d", kernReturn)
-	}
-	defer C.vm_deallocate(
-		C.mach_task_self_,
-		(C.vm_address_t)(uintptr(unsafe.Pointer(cpuLoad))),
-		C.vm_size_t(cpuMsgCount)*C.sizeof_processor_cpu_load_info_data_t,
-	)
-	cpuLoadInfo := (*[1 << 30]C.processor_cpu_load_info_data_t)(unsafe.Pointer(cpuLoad))[:numCPUs:numCPUs]
-	cpuUsage := make([]CPUUsage, numCPUs)
-	for i := 0; i < int(numCPUs); i++ {
-		cpuUsage[i] = CPUUsage{
-			User:   float64(cpuLoadInfo[i].cpu_ticks[C.CPU_STATE_USER]),
-			System: float64(cpuLoadInfo[i].cpu_ticks[C.CPU_STATE_SYSTEM]),
-			Idle:   float64(cpuLoadInfo[i].cpu_ticks[C.CPU_STATE_IDLE]),
-			Nice:   float64(cpuLoadInfo[i].cpu_ticks[C.CPU_STATE_NICE]),
+// attributeProcessPower sets each process's Watts to its share of cpuWatts by
+// CPU time plus its share of gpuWatts by GPU time. Power no process accounts
+// for, e.g. GPU power while no process reports GPU time, is not attributed.
+func attributeProcessPower(processes []ProcessMetrics, cpuWatts, gpuWatts float64) {
+	var cpuTotal, gpuTotal float64
+	for _, p := range processes {
+		cpuTotal += math.Max(p.CPU, 0)
+		gpuTotal += math.Max(p.GPU, 0)
+	}
+	for i := range processes {
+		watts := 0.0
+		if cpuTotal > 0 {
+			watts += cpuWatts * math.Max(processes[i].CPU, 0) / cpuTotal
+		}
+		if gpuTotal > 0 {
+			watts += gpuWatts * math.Max(processes[i].GPU, 0) / gpuTotal
+		}
+		processes[i].Watts = watts
+	}
+}
+
+// carryProcessPower copies Watts and Energy from prev to the processes of a
+// fresh listing that still run the same command under the same PID, so a
+// relisting between snapshots keeps those columns.
+func carryProcessPower(processes, prev []ProcessMetrics) {
+	byPID := make(map[int]ProcessMetrics, len(prev))
+	for _, p := range prev {
+		byPID[p.PID] = p
+	}
+	for i, p := range processes {
+		if old, ok := byPID[p.PID]; ok && old.Command == p.Command {
+			processes[i].Watts = old.Watts
+			processes[i].Energy = old.Energy
 		}
 	}
-	return cpuUsage, nil
 }
 
 func getThemeColorName(themeColor ui.Color) string {
@@ -326,11 +125,17 @@ func getThemeColorName(themeColor ui.Color) string {
 }
 
 func sortProcesses(processes []ProcessMetrics) {
+	sortProcessesBy(processes, columns[selectedColumn], sortReverse)
+}
+
+// sortProcessesBy orders processes by one of columns. Numeric columns sort
+// descending and text columns ascending unless reverse is set.
+func sortProcessesBy(processes []ProcessMetrics, column string, reverse bool) {
 	sort.Slice(processes, func(i, j int) bool {
 		var less bool
 		var equal bool
 
-		switch columns[selectedColumn] {
+		switch column {
 		case "PID":
 			less = processes[i].PID < processes[j].PID
 			equal = processes[i].PID == processes[j].PID
@@ -353,6 +158,12 @@ func sortProcesses(processes []ProcessMetrics) {
 		case "MEM":
 			less = processes[i].Memory > processes[j].Memory // Descending default
 			equal = processes[i].Memory == processes[j].Memory
+		case "WATTS":
+			less = processes[i].Watts > processes[j].Watts // Descending default
+			equal = processes[i].Watts == processes[j].Watts
+		case "ENERGY":
+			less = processes[i].Energy > processes[j].Energy // Descending default
+			equal = processes[i].Energy == processes[j].Energy
 		case "TIME":
 			iTime := parseTimeString(processes[i].Time)
 			jTime := parseTimeString(processes[j].Time)
@@ -372,7 +183,7 @@ func sortProcesses(processes []ProcessMetrics) {
 			return processes[i].PID < processes[j].PID
 		}
 
-		if sortReverse {
+		if reverse {
 			return !less
 		}
 		return less
@@ -381,15 +192,17 @@ func sortProcesses(processes []ProcessMetrics) {
 
 func calculateMaxWidths(availableWidth int) map[string]int {
 	maxWidths := map[string]int{
-		"PID":  5,
-		"USER": 8,
-		"VIRT": 6,
-		"RES":  6,
-		"CPU":  6,
-		"GPU":  6,
-		"MEM":  5,
-		"TIME": 8,
-		"CMD":  15,
+		"PID":    5,
+		"USER":   8,
+		"VIRT":   6,
+		"RES":    6,
+		"CPU":    6,
+		"GPU":    6,
+		"MEM":    5,
+		"WATTS":  6,
+		"ENERGY": 8,
+		"TIME":   8,
+		"CMD":    15,
 	}
 	usedWidth := 0
 	for col, width := range maxWidths {
@@ -431,7 +244,7 @@ func buildHeader(maxWidths map[string]int, themeColorStr, selectedHeaderFg strin
 			format = fmt.Sprintf("%%-%ds", width) // Left-align
 		case "VIRT", "RES":
 			format = fmt.Sprintf("%%%ds", width) // Right-align
-		case "CPU", "GPU", "MEM":
+		case "CPU", "GPU", "MEM", "WATTS", "ENERGY":
 			format = fmt.Sprintf("%%%ds", width) // Right-align
 		case "TIME":
 			format = fmt.Sprintf("%%%ds", width) // Right-align
@@ -464,7 +277,7 @@ func buildProcessRows(processes []ProcessMetrics, maxWidths map[string]int) []st
 		// 1000 ms/s = 100% GPU utilization
 		gpuPercent := p.GPU / 10.0
 
-		line := fmt.Sprintf("%*d %-*s %*s %*s %*.1f%% %*.1f%% %*.1f%% %*s %-s",
+		line := fmt.Sprintf("%*d %-*s %*s %*s %*.1f%% %*.1f%% %*.1f%% %*.2f %*s %*s %-s",
 			maxWidths["PID"], p.PID,
 			maxWidths["USER"], username,
 			maxWidths["VIRT"], virtStr,
@@ -472,6 +285,8 @@ func buildProcessRows(processes []ProcessMetrics, maxWidths map[string]int) []st
 			maxWidths["CPU"]-1, p.CPU,
 			maxWidths["GPU"]-1, gpuPercent,
 			maxWidths["MEM"]-1, p.Memory,
+			maxWidths["WATTS"], p.Watts,
+			maxWidths["ENERGY"], formatProcessEnergy(p.Energy),
 			maxWidths["TIME"], timeStr,
 			truncateWithEllipsis(cmdName, maxWidths["CMD"]),
 		)
@@ -676,7 +491,8 @@ func executeKill() {
 	if err := syscall.Kill(killPID, syscall.SIGTERM); err == nil {
 		stderrLogger.Printf("Sent SIGTERM to PID %d\n", killPID)
 
-		if procs, err := getProcessList(lastGPUMetrics.ActivePercent); err == nil {
+		if procs, err := metricSource.Processes(lastSnapshot.GPU.ActivePercent); err == nil {
+			carryProcessPower(procs, lastProcesses)
 			lastProcesses = procs
 			if searchMode || searchText != "" {
 				updateFilteredProcesses()
@@ -706,7 +522,10 @@ func handleNavigation(e ui.Event) {
 	case "<Enter>", "<Space>":
 		handleSortToggle()
 	case "<F9>":
-		attemptKillProcess()
+		// Recorded PIDs belong to another session; never signal them.
+		if replay == nil {
+			attemptKillProcess()
+		}
 	}
 }
 
@@ -129,14 +129,14 @@ func handleColumnNavigation(e ui.Event) {
 	case "<Left>":
 		if selectedColumn > 0 {
 			selectedColumn--
-			currentConfig.SortColumn = &selectedColumn
+			currentConfig.SortBy = columns[selectedColumn]
 			saveConfig()
 			updateProcessList()
 		}
 	case "<Right>":
 		if selectedColumn < len(columns)-1 {
 			selectedColumn++
-			currentConfig.SortColumn = &selectedColumn
+			currentConfig.SortBy = columns[selectedColumn]
 			saveConfig()
 			updateProcessList()
 		}
@@ -0,0 +1,13 @@
+//go:build !darwin
+
+package app
+
+import "fmt"
+
+func getProcessList(systemGpuPercent float64) ([]ProcessMetrics, error) {
+	return nil, fmt.Errorf("process sampling is only available on macOS")
+}
+
+func GetCPUUsage() ([]CPUUsage, error) {
+	return nil, fmt.Errorf("per-core CPU ticks are only available on macOS")
+}
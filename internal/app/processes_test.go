@@ -0,0 +1,97 @@
+package app
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAttributeProcessPower(t *testing.T) {
+	tests := []struct {
+		name               string
+		procs              []ProcessMetrics
+		cpuWatts, gpuWatts float64
+		want               []float64
+	}{
+		{
+			name:     "split by CPU time",
+			procs:    []ProcessMetrics{{CPU: 75}, {CPU: 25}, {CPU: 0}},
+			cpuWatts: 8,
+			want:     []float64{6, 2, 0},
+		},
+		{
+			name:     "GPU by GPU time",
+			procs:    []ProcessMetrics{{CPU: 50, GPU: 0}, {CPU: 50, GPU: 300}, {GPU: 100}},
+			cpuWatts: 4,
+			gpuWatts: 10,
+			want:     []float64{2, 2 + 7.5, 2.5},
+		},
+		{
+			name:     "nothing to split by",
+			procs:    []ProcessMetrics{{}, {}},
+			cpuWatts: 3,
+			gpuWatts: 1,
+			want:     []float64{0, 0},
+		},
+		{
+			name:     "negative readings count as zero",
+			procs:    []ProcessMetrics{{CPU: -5}, {CPU: 10}},
+			cpuWatts: 2,
+			want:     []float64{0, 2},
+		},
+		{
+			name: "empty list",
+		},
+	}
+	for _, tt := range tests {
+		attributeProcessPower(tt.procs, tt.cpuWatts, tt.gpuWatts)
+		for i, p := range tt.procs {
+			if math.Abs(p.Watts-tt.want[i]) > 1e-9 {
+				t.Errorf("%s: process %d = %v W, want %v", tt.name, i, p.Watts, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCarryProcessPower(t *testing.T) {
+	prev := []ProcessMetrics{
+		{PID: 1, Command: "a", Watts: 2, Energy: 30},
+		{PID: 2, Command: "b", Watts: 1, Energy: 5},
+		{PID: 3, Command: "killed", Watts: 4, Energy: 9},
+		{PID: 5, Command: "old", Watts: 3, Energy: 7},
+	}
+	procs := []ProcessMetrics{
+		{PID: 2, Command: "b"},
+		{PID: 1, Command: "a"},
+		{PID: 4, Command: "new"},
+		{PID: 5, Command: "c"}, // PID reused since the snapshot
+	}
+	carryProcessPower(procs, prev)
+
+	want := map[int][2]float64{1: {2, 30}, 2: {1, 5}, 4: {0, 0}, 5: {0, 0}}
+	for _, p := range procs {
+		if got := [2]float64{p.Watts, p.Energy}; got != want[p.PID] {
+			t.Errorf("PID %d: watts, energy = %v, want %v", p.PID, got, want[p.PID])
+		}
+	}
+}
+
+func TestMigrateSortColumn(t *testing.T) {
+	index := func(i int) *int { return &i }
+	tests := []struct {
+		config AppConfig
+		want   string
+	}{
+		{AppConfig{}, ""},
+		{AppConfig{SortColumn: index(4)}, "CPU"},
+		{AppConfig{SortColumn: index(8)}, "CMD"},
+		{AppConfig{SortColumn: index(42)}, ""},
+		{AppConfig{SortColumn: index(0), SortBy: "ENERGY"}, "ENERGY"},
+	}
+	for _, tt := range tests {
+		c := tt.config
+		migrateSortColumn(&c)
+		if c.SortBy != tt.want || c.SortColumn != nil {
+			t.Errorf("migrateSortColumn(%v) = %q, %v, want %q", tt.config.SortColumn, c.SortBy, c.SortColumn, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const recordingFormatVersion = 1
+
+// recordHeader is the first line of a recording and describes the session.
+type recordHeader struct {
+	Recording  int        `json:"mactop_recording"`
+	Version    string     `json:"version"`
+	Source     string     `json:"source"`
+	IntervalMs int        `json:"interval_ms"`
+	SystemInfo SystemInfo `json:"system_info"`
+	Started    time.Time  `json:"started"`
+}
+
+// recordFrame is one collection cycle: the headless sample plus the data the
+// TUI needs that HeadlessOutput does not carry.
+type recordFrame struct {
+	Time       time.Time             `json:"t"`
+	Sample     HeadlessOutput        `json:"sample"`
+	Processes  []ProcessMetrics      `json:"processes,omitempty"`
+	TBNetStats []ThunderboltNetStats `json:"tb_net,omitempty"`
+}
+
+// sessionRecorder writes a gzip-compressed NDJSON stream. Every frame is
+// flushed so a recording stays readable if mactop is killed mid-session.
+type sessionRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func newSessionRecorder(path string, header recordHeader) (*sessionRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %v", err)
+	}
+	r := &sessionRecorder{file: f, gz: gzip.NewWriter(f)}
+	r.enc = json.NewEncoder(r.gz)
+
+	header.Recording = recordingFormatVersion
+	if err := r.write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *sessionRecorder) write(v any) error {
+	if err := r.enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write recording: %v", err)
+	}
+	return r.gz.Flush()
+}
+
+func (r *sessionRecorder) WriteFrame(frame recordFrame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.write(frame)
+}
+
+func (r *sessionRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	gzErr := r.gz.Close()
+	fileErr := r.file.Close()
+	r.file = nil
+	if gzErr != nil {
+		return gzErr
+	}
+	return fileErr
+}
+
+// readRecording loads a recording written by sessionRecorder. A truncated
+// tail, as left behind by a crash, ends the stream without an error.
+func readRecording(r io.Reader) (recordHeader, []recordFrame, error) {
+	var header recordHeader
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return header, nil, fmt.Errorf("not a mactop recording: %v", err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	if !scanner.Scan() {
+		return header, nil, errors.New("recording is empty")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Recording == 0 {
+		return header, nil, errors.New("not a mactop recording: missing header")
+	}
+	if header.Recording > recordingFormatVersion {
+		return header, nil, fmt.Errorf("recording format %d is newer than this mactop supports (%d)", header.Recording, recordingFormatVersion)
+	}
+
+	var frames []recordFrame
+	for scanner.Scan() {
+		var frame recordFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			break
+		}
+		frames = append(frames, frame)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return header, frames, fmt.Errorf("failed to read recording: %v", err)
+	}
+	if len(frames) == 0 {
+		return header, nil, errors.New("recording has no samples")
+	}
+	return header, frames, nil
+}
+
+// snapshot rebuilds the Snapshot a frame was recorded from.
+func (f recordFrame) snapshot() Snapshot {
+	state := f.Sample.ThermalState
+	if state == "" {
+		state = "Normal"
+	}
+	s := Snapshot{
+		CapturedAt:   f.Time,
+		Soc:          restoreSocMetrics(f.Sample),
+		CoreUsages:   append([]float64(nil), f.Sample.CoreUsages...),
+		Memory:       f.Sample.Memory,
+		NetDisk:      f.Sample.NetDisk,
+		TBNetStats:   append([]ThunderboltNetStats(nil), f.TBNetStats...),
+		Processes:    append([]ProcessMetrics(nil), f.Processes...),
+		ThermalState: state,
+		Throttled:    state != "Normal",
+		RDMA:         f.Sample.RDMAStatus,
+	}
+	s.deriveMetrics()
+	return s
+}
+
+// restoreSocMetrics undoes the power rewrite done by buildHeadlessOutput so
+// replays see the same raw readings the live source produced.
+func restoreSocMetrics(sample HeadlessOutput) SocMetrics {
+	m := sample.SocMetrics
+	m.GPUActive = sample.GPUUsage
+	m.SystemPower = sample.SocMetrics.TotalPower
+	m.TotalPower = sample.SocMetrics.TotalPower - sample.SocMetrics.SystemPower
+	return m
+}
+
+// runRecorder writes every snapshot it receives to rec. Once done is closed it
+// drains what is still queued and closes the recording.
+func runRecorder(done chan struct{}, rec *sessionRecorder, sub *Subscription) {
+	sysInfo := metricSource.SystemInfo()
+	write := func(s Snapshot) {
+		if err := rec.WriteFrame(recordFrame{
+			Time:       s.CapturedAt,
+			Sample:     buildHeadlessOutput(s, sysInfo, nil),
+			Processes:  s.Processes,
+			TBNetStats: s.TBNetStats,
+		}); err != nil {
+			stderrLogger.Printf("Error writing recording: %v\n", err)
+		}
+	}
+	defer func() {
+		if err := rec.Close(); err != nil {
+			stderrLogger.Printf("Error closing recording: %v\n", err)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			for {
+				select {
+				case s := <-sub.C:
+					write(s)
+				default:
+					return
+				}
+			}
+		case s := <-sub.C:
+			write(s)
+		}
+	}
+}
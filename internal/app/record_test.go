@@ -0,0 +1,222 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseReplaySpeed(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{"1x", 1, false},
+		{"4x", 4, false},
+		{"0.5X", 0.5, false},
+		{"2", 2, false},
+		{" 8x ", 8, false},
+		{"0x", 0, true},
+		{"-2x", 0, true},
+		{"fast", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseReplaySpeed(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReplaySpeed(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseReplaySpeed(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// recordDemoSession feeds demo snapshots through runRecorder the same way the
+// collector does and returns the path of the finished recording.
+func recordDemoSession(t *testing.T, cycles int) (string, []SocMetrics) {
+	t.Helper()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	demo := newDemoSource()
+	demo.now = func() time.Time { return clock }
+	if err := demo.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	prev := metricSource
+	metricSource = demo
+	t.Cleanup(func() { metricSource = prev })
+
+	path := filepath.Join(t.TempDir(), "session.rec")
+	rec, err := newSessionRecorder(path, recordHeader{
+		Version:    version,
+		Source:     demo.Name(),
+		IntervalMs: updateInterval,
+		SystemInfo: demo.SystemInfo(),
+		Started:    clock,
+	})
+	if err != nil {
+		t.Fatalf("newSessionRecorder() error = %v", err)
+	}
+
+	bus := NewSnapshotBus()
+	sub := bus.Subscribe("recorder", cycles)
+	var live []SocMetrics
+	for i := 0; i < cycles; i++ {
+		clock = clock.Add(time.Second)
+		s := takeSnapshot(demo, updateInterval)
+		s.CapturedAt = clock
+		live = append(live, s.Soc)
+		bus.Publish(s)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	runRecorder(done, rec, sub)
+	return path, live
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	path, live := recordDemoSession(t, 5)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	header, frames, err := readRecording(f)
+	if err != nil {
+		t.Fatalf("readRecording() error = %v", err)
+	}
+	if header.Source != SourceDemo || header.SystemInfo.CoreCount == 0 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+	if len(frames) != len(live) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(live))
+	}
+	for i, frame := range frames {
+		if len(frame.Processes) == 0 {
+			t.Errorf("frame %d: missing process list", i)
+		}
+		if len(frame.TBNetStats) == 0 {
+			t.Errorf("frame %d: missing thunderbolt stats", i)
+		}
+		if frame.Sample.GPUUsage != live[i].GPUActive {
+			t.Errorf("frame %d: GPUUsage = %.2f, want %.2f", i, frame.Sample.GPUUsage, live[i].GPUActive)
+		}
+	}
+}
+
+func TestReadRecordingTruncated(t *testing.T) {
+	path, _ := recordDemoSession(t, 4)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the gzip trailer as a crash mid-session would.
+	_, frames, err := readRecording(bytes.NewReader(data[:len(data)-8]))
+	if err != nil {
+		t.Fatalf("readRecording() on truncated file error = %v", err)
+	}
+	if len(frames) == 0 {
+		t.Error("expected frames from the intact part of the recording")
+	}
+
+	if _, _, err := readRecording(bytes.NewReader([]byte("not gzip"))); err == nil {
+		t.Error("expected an error for a non-recording file")
+	}
+}
+
+func TestReplaySourceRestoresRawMetrics(t *testing.T) {
+	path, live := recordDemoSession(t, 3)
+	src, err := newReplaySource(path, 1)
+	if err != nil {
+		t.Fatalf("newReplaySource() error = %v", err)
+	}
+	clock := time.Unix(0, 0)
+	src.now = func() time.Time { return clock }
+	src.Init()
+
+	got := src.SocMetrics(updateInterval)
+	want := live[0]
+	if diff := got.TotalPower - want.TotalPower; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("TotalPower = %.3f, want %.3f", got.TotalPower, want.TotalPower)
+	}
+	if got.SystemPower < want.SystemPower-1e-9 {
+		t.Errorf("SystemPower = %.3f, want at least %.3f", got.SystemPower, want.SystemPower)
+	}
+	if got.GPUActive != want.GPUActive {
+		t.Errorf("GPUActive = %.2f, want %.2f", got.GPUActive, want.GPUActive)
+	}
+}
+
+func TestReplaySourcePlayback(t *testing.T) {
+	path, _ := recordDemoSession(t, 11) // ten seconds between first and last frame
+	src, err := newReplaySource(path, 2)
+	if err != nil {
+		t.Fatalf("newReplaySource() error = %v", err)
+	}
+	clock := time.Unix(0, 0)
+	src.now = func() time.Time { return clock }
+	src.Init()
+
+	steps := []struct {
+		name   string
+		action func()
+		want   time.Duration
+		paused bool
+	}{
+		{"start", func() {}, 0, false},
+		{"plays at speed", func() { clock = clock.Add(time.Second) }, 2 * time.Second, false},
+		{"pause", func() { src.TogglePause() }, 2 * time.Second, true},
+		{"holds while paused", func() { clock = clock.Add(5 * time.Second) }, 2 * time.Second, true},
+		{"seek forward", func() { src.Seek(3 * time.Second) }, 5 * time.Second, true},
+		{"seek before start", func() { src.Seek(-time.Minute) }, 0, true},
+		{"resume", func() { src.TogglePause(); clock = clock.Add(500 * time.Millisecond) }, time.Second, false},
+		{"stops at end", func() { clock = clock.Add(time.Minute) }, 10 * time.Second, true},
+		{"restart after end", func() { src.TogglePause() }, 0, false},
+	}
+
+	for _, step := range steps {
+		step.action()
+		if got := src.Position(); got != step.want {
+			t.Errorf("%s: Position() = %v, want %v", step.name, got, step.want)
+		}
+		if got := src.Paused(); got != step.paused {
+			t.Errorf("%s: Paused() = %v, want %v", step.name, got, step.paused)
+		}
+	}
+}
+
+func TestReplaySourceSequentialSnapshots(t *testing.T) {
+	path, live := recordDemoSession(t, 3)
+	src, err := newReplaySource(path, 1)
+	if err != nil {
+		t.Fatalf("newReplaySource() error = %v", err)
+	}
+	src.sequential = true
+
+	var times []time.Time
+	for i := 0; i < src.Len()+2; i++ {
+		s := src.Snapshot()
+		if i < len(live) && s.Soc.GPUActive != live[i].GPUActive {
+			t.Errorf("snapshot %d: GPUActive = %.2f, want %.2f", i, s.Soc.GPUActive, live[i].GPUActive)
+		}
+		times = append(times, s.CapturedAt)
+	}
+	for i := 1; i < src.Len(); i++ {
+		if !times[i].After(times[i-1]) {
+			t.Errorf("snapshots out of order: %s then %s", times[i-1], times[i])
+		}
+	}
+	if last := times[len(times)-1]; !last.Equal(times[src.Len()-1]) {
+		t.Errorf("expected the last snapshot to repeat after the end, got %s", last)
+	}
+}
@@ -0,0 +1,323 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	remoteWriteRetries       = 4
+	remoteWriteFirstBackoff  = 500 * time.Millisecond
+	remoteWriteMaxBackoff    = 30 * time.Second
+	remoteWriteClientTimeout = 10 * time.Second
+	remoteWriteShutdownWait  = time.Second
+)
+
+// Field numbers of the prometheus.WriteRequest messages (remote write 1.0).
+const (
+	rwRequestTimeseries protowire.Number = 1
+	rwSeriesLabels      protowire.Number = 1
+	rwSeriesSamples     protowire.Number = 2
+	rwLabelName         protowire.Number = 1
+	rwLabelValue        protowire.Number = 2
+	rwSampleValue       protowire.Number = 1
+	rwSampleTimestamp   protowire.Number = 2
+)
+
+// errRemoteWriteRejected marks a 4xx response other than 429, which the
+// remote write spec says must not be retried.
+var errRemoteWriteRejected = errors.New("rejected by receiver")
+
+var promLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// labelFlags collects repeated "name=value" flags into Prometheus labels.
+type labelFlags []string
+
+func (l *labelFlags) String() string { return strings.Join(*l, ",") }
+
+func (l *labelFlags) Set(v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !promLabelName.MatchString(name) || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("expected \"name=value\" with a valid label name, got %q", v)
+	}
+	*l = append(*l, name+"="+value)
+	return nil
+}
+
+// Labels returns the collected labels.
+func (l labelFlags) Labels() []promLabel {
+	labels := make([]promLabel, 0, len(l))
+	for _, v := range l {
+		name, value, _ := strings.Cut(v, "=")
+		labels = append(labels, promLabel{name, value})
+	}
+	return labels
+}
+
+type promLabel struct {
+	Name, Value string
+}
+
+type promSample struct {
+	Value     float64
+	Timestamp int64 // milliseconds since the epoch
+}
+
+type promSeries struct {
+	Labels  []promLabel // sorted by name
+	Samples []promSample
+}
+
+// remoteWriter pushes the Prometheus gauges to a remote_write receiver. Each
+// snapshot is sampled into pending series, which are sent every flushEvery
+// as one snappy-compressed WriteRequest. Requests that cannot be delivered
+// are queued on disk and replayed in order once the receiver recovers.
+type remoteWriter struct {
+	url            string
+	username       string
+	password       string
+	bearerToken    string
+	externalLabels []promLabel
+	gatherer       prometheus.Gatherer
+	client         *http.Client
+	flushEvery     time.Duration
+	spoolSender
+
+	pending map[string]*promSeries
+	order   []string
+}
+
+func newRemoteWriter(rawURL, username, password, bearerToken string, externalLabels []promLabel,
+	flushEvery time.Duration, queueDir string, queueBytes int64) (*remoteWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if username != "" && bearerToken != "" {
+		return nil, errors.New("basic auth and a bearer token are mutually exclusive")
+	}
+	if flushEvery <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	queue, err := newDiskSpool(queueDir, ".pb", queueBytes)
+	if err != nil {
+		return nil, err
+	}
+	w := &remoteWriter{
+		url:            rawURL,
+		username:       username,
+		password:       password,
+		bearerToken:    bearerToken,
+		externalLabels: externalLabels,
+		gatherer:       promRegistry,
+		client:         &http.Client{Timeout: remoteWriteClientTimeout},
+		flushEvery:     flushEvery,
+		pending:        map[string]*promSeries{},
+	}
+	w.spoolSender = spoolSender{
+		spool:      queue,
+		post:       w.post,
+		rejected:   errRemoteWriteRejected,
+		retries:    remoteWriteRetries,
+		backoff:    remoteWriteFirstBackoff,
+		maxBackoff: remoteWriteMaxBackoff,
+		name:       "remote write request",
+	}
+	return w, nil
+}
+
+// Sample gathers the current value of every series and queues it with the
+// given timestamp.
+func (w *remoteWriter) Sample(at time.Time) error {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	ts := at.UnixMilli()
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var value float64
+			switch f.GetType() {
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+			labels := w.seriesLabels(f.GetName(), m.GetLabel())
+			key := promSeriesKey(labels)
+			series, ok := w.pending[key]
+			if !ok {
+				series = &promSeries{Labels: labels}
+				w.pending[key] = series
+				w.order = append(w.order, key)
+			}
+			series.Samples = append(series.Samples, promSample{value, ts})
+		}
+	}
+	return nil
+}
+
+// seriesLabels returns the sorted labels of a series. External labels do not
+// override labels the metric already has, as in Prometheus.
+func (w *remoteWriter) seriesLabels(name string, pairs []*dto.LabelPair) []promLabel {
+	labels := make([]promLabel, 0, len(pairs)+len(w.externalLabels)+1)
+	labels = append(labels, promLabel{"__name__", name})
+	seen := map[string]bool{}
+	for _, p := range pairs {
+		labels = append(labels, promLabel{p.GetName(), p.GetValue()})
+		seen[p.GetName()] = true
+	}
+	for _, l := range w.externalLabels {
+		if !seen[l.Name] {
+			labels = append(labels, l)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+func promSeriesKey(labels []promLabel) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// encodeWriteRequest marshals series as a prometheus.WriteRequest.
+func encodeWriteRequest(series []*promSeries) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, rwLabelName, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, rwLabelValue, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+			ts = protowire.AppendTag(ts, rwSeriesLabels, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+		for _, p := range s.Samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, rwSampleValue, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(p.Value))
+			sb = protowire.AppendTag(sb, rwSampleTimestamp, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(p.Timestamp))
+			ts = protowire.AppendTag(ts, rwSeriesSamples, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sb)
+		}
+		req = protowire.AppendTag(req, rwRequestTimeseries, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+// Flush sends the pending samples.
+func (w *remoteWriter) Flush(ctx context.Context) {
+	if len(w.order) == 0 {
+		return
+	}
+	series := make([]*promSeries, 0, len(w.order))
+	for _, key := range w.order {
+		series = append(series, w.pending[key])
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+	w.pending = map[string]*promSeries{}
+	w.order = w.order[:0]
+	w.Deliver(ctx, body)
+}
+
+func (w *remoteWriter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "mactop/"+version)
+	switch {
+	case w.username != "":
+		req.SetBasicAuth(w.username, w.password)
+	case w.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s: %s", errRemoteWriteRejected, resp.Status, bytes.TrimSpace(msg))
+	}
+	return fmt.Errorf("remote write returned %s", resp.Status)
+}
+
+// runRemoteWriter keeps the Prometheus gauges in step with the snapshot bus,
+// samples them after every update and flushes on a ticker until done is
+// closed.
+func runRemoteWriter(done chan struct{}, w *remoteWriter, sub *Subscription) {
+	// Batches are delivered off this loop, so a slow endpoint never holds
+	// up sampling.
+	w.Start()
+	ctx := context.Background()
+	sysInfo := metricSource.SystemInfo()
+	setSystemInfoGauge(sysInfo)
+	sample := func(s Snapshot) {
+		updatePrometheusMetrics(s, sysInfo.ECoreCount, sysInfo.PCoreCount)
+		if err := w.Sample(s.CapturedAt); err != nil {
+			stderrLogger.Printf("Error gathering metrics for remote write: %v\n", err)
+		}
+	}
+	ticker := time.NewTicker(w.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+		drain:
+			for {
+				select {
+				case s := <-sub.C:
+					sample(s)
+				default:
+					break drain
+				}
+			}
+			w.Flush(ctx)
+			w.Stop(remoteWriteShutdownWait)
+			return
+		case s := <-sub.C:
+			sample(s)
+		case <-ticker.C:
+			w.Flush(ctx)
+		}
+	}
+}
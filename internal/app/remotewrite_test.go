@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rwReceiver is a fake remote_write endpoint. It decodes every accepted
+// request into "name{l=v,...}" -> samples.
+type rwReceiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	status   int
+	requests []map[string][]promSample
+	headers  http.Header
+}
+
+func (r *rwReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != http.StatusNoContent {
+		http.Error(w, "unavailable", r.status)
+		return
+	}
+	compressed, _ := io.ReadAll(req.Body)
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		r.t.Errorf("body is not snappy: %v", err)
+		return
+	}
+	r.headers = req.Header.Clone()
+
+	series := map[string][]promSample{}
+	for _, raw := range pbFields(r.t, body)[rwRequestTimeseries] {
+		ts := pbFields(r.t, raw.([]byte))
+		var name string
+		var labels []string
+		for _, rawLabel := range ts[rwSeriesLabels] {
+			l := pbFields(r.t, rawLabel.([]byte))
+			k, v := string(l[rwLabelName][0].([]byte)), string(l[rwLabelValue][0].([]byte))
+			if k == "__name__" {
+				name = v
+				continue
+			}
+			labels = append(labels, k+"="+v)
+		}
+		key := name + "{" + strings.Join(labels, ",") + "}"
+		for _, rawSample := range ts[rwSeriesSamples] {
+			s := pbFields(r.t, rawSample.([]byte))
+			series[key] = append(series[key], promSample{
+				Value:     math.Float64frombits(s[rwSampleValue][0].(uint64)),
+				Timestamp: int64(s[rwSampleTimestamp][0].(uint64)),
+			})
+		}
+	}
+	r.requests = append(r.requests, series)
+	w.WriteHeader(r.status)
+}
+
+func newTestRemoteWriter(t *testing.T, url string, labels []promLabel) (*remoteWriter, *prometheus.GaugeVec) {
+	t.Helper()
+	w, err := newRemoteWriter(url, "mac", "s3cret", "", labels, time.Second, t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.backoff = time.Millisecond
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "mactop_test_usage"}, []string{"core", "type"})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gauge)
+	w.gatherer = registry
+	return w, gauge
+}
+
+func TestRemoteWriterFlush(t *testing.T) {
+	rec := &rwReceiver{t: t, status: http.StatusNoContent}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	w, gauge := newTestRemoteWriter(t, srv.URL, []promLabel{{"instance", "mac01"}, {"type", "ignored"}})
+	gauge.WithLabelValues("0", "e").Set(10)
+	w.Sample(time.UnixMilli(1000))
+	gauge.WithLabelValues("0", "e").Set(20)
+	w.Sample(time.UnixMilli(2000))
+	w.Flush(context.Background())
+
+	if len(rec.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(rec.requests))
+	}
+	got := rec.requests[0]["mactop_test_usage{core=0,instance=mac01,type=e}"]
+	want := []promSample{{10, 1000}, {20, 2000}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("samples = %v, want %v (series: %v)", got, want, rec.requests[0])
+	}
+
+	for name, want := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if rec.headers.Get(name) != want {
+			t.Errorf("%s = %q, want %q", name, rec.headers.Get(name), want)
+		}
+	}
+	req := http.Request{Header: rec.headers}
+	if user, pass, ok := req.BasicAuth(); !ok || user != "mac" || pass != "s3cret" {
+		t.Errorf("basic auth = %q, %q, %v", user, pass, ok)
+	}
+}
+
+func TestRemoteWriterQueue(t *testing.T) {
+	rec := &rwReceiver{t: t, status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	w, gauge := newTestRemoteWriter(t, srv.URL, nil)
+	gauge.WithLabelValues("0", "e").Set(1)
+	w.Sample(time.UnixMilli(1000))
+	w.Flush(context.Background())
+	if n := w.spool.Len(); n != 1 {
+		t.Fatalf("queue has %d requests while the receiver is down, want 1", n)
+	}
+
+	rec.status = http.StatusNoContent
+	gauge.WithLabelValues("0", "e").Set(2)
+	w.Sample(time.UnixMilli(2000))
+	w.Flush(context.Background())
+	if n := w.spool.Len(); n != 0 {
+		t.Errorf("queue has %d requests after recovery, want 0", n)
+	}
+	if len(rec.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(rec.requests))
+	}
+	for i, want := range []float64{1, 2} {
+		if got := rec.requests[i]["mactop_test_usage{core=0,type=e}"]; len(got) != 1 || got[0].Value != want {
+			t.Errorf("request %d = %v, want value %v", i, got, want)
+		}
+	}
+
+	// A 400 is not retried or queued.
+	rec.status = http.StatusBadRequest
+	w.Sample(time.UnixMilli(3000))
+	w.Flush(context.Background())
+	if n := w.spool.Len(); n != 0 {
+		t.Errorf("queue has %d requests after a 400, want 0", n)
+	}
+}
+
+func TestLabelFlags(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"instance=mac01", false},
+		{"env=", false},
+		{"team=ci=builds", false},
+		{"noequals", true},
+		{"1bad=x", true},
+		{"__name__=x", true},
+		{"has-dash=x", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var l labelFlags
+			if err := l.Set(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("Set(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
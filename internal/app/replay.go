@@ -0,0 +1,251 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ui "github.com/metaspartan/gotui/v5"
+)
+
+// replaySource plays a recording back through the MetricSource interface so
+// every layout renders it like a live session. Playback position follows a
+// wall clock scaled by speed and can be paused or seeked.
+type replaySource struct {
+	header recordHeader
+	frames []recordFrame
+	speed  float64
+	now    func() time.Time
+
+	mu         sync.Mutex
+	anchorWall time.Time
+	anchorPos  time.Duration
+	paused     bool
+	next       int  // next frame handed out in sequential mode
+	sequential bool // hand out every frame in order instead of following the clock
+}
+
+func newReplaySource(path string, speed float64) (*replaySource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %v", err)
+	}
+	defer f.Close()
+
+	header, frames, err := readRecording(f)
+	if err != nil {
+		return nil, err
+	}
+	return &replaySource{
+		header: header,
+		frames: frames,
+		speed:  speed,
+		now:    time.Now,
+	}, nil
+}
+
+// parseReplaySpeed accepts a playback multiplier such as "4x", "0.5x" or "2".
+func parseReplaySpeed(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "x"), 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid replay speed: %q (expected e.g. 1x, 4x, 0.5x)", s)
+	}
+	return v, nil
+}
+
+// PlaybackInterval is the tick interval that shows each recorded sample once
+// at the configured speed.
+func (r *replaySource) PlaybackInterval() int {
+	interval := int(float64(r.header.IntervalMs) / r.speed)
+	if interval < 1 {
+		interval = 1
+	}
+	return interval
+}
+
+func (r *replaySource) Len() int { return len(r.frames) }
+
+func (r *replaySource) Duration() time.Duration {
+	return r.frames[len(r.frames)-1].Time.Sub(r.frames[0].Time)
+}
+
+func (r *replaySource) positionLocked() time.Duration {
+	pos := r.anchorPos
+	if !r.paused && !r.anchorWall.IsZero() {
+		pos += time.Duration(float64(r.now().Sub(r.anchorWall)) * r.speed)
+	}
+	if end := r.Duration(); pos >= end {
+		// Hold the last frame once playback runs off the end.
+		r.anchorPos, r.anchorWall, r.paused = end, r.now(), true
+		return end
+	}
+	if pos < 0 {
+		return 0
+	}
+	return pos
+}
+
+func (r *replaySource) current() recordFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos := r.positionLocked()
+	start := r.frames[0].Time
+	i := sort.Search(len(r.frames), func(i int) bool {
+		return r.frames[i].Time.Sub(start) > pos
+	})
+	if i > 0 {
+		i--
+	}
+	return r.frames[i]
+}
+
+// Position reports the playback offset into the recording.
+func (r *replaySource) Position() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.positionLocked()
+}
+
+func (r *replaySource) Paused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.positionLocked()
+	return r.paused
+}
+
+func (r *replaySource) TogglePause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.anchorPos = r.positionLocked()
+	r.anchorWall = r.now()
+	if r.paused && r.anchorPos >= r.Duration() {
+		r.anchorPos = 0 // resume from the start after reaching the end
+	}
+	r.paused = !r.paused
+}
+
+// Seek moves the playback position by delta, clamped to the recording.
+func (r *replaySource) Seek(delta time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos := r.positionLocked() + delta
+	if pos < 0 {
+		pos = 0
+	}
+	if end := r.Duration(); pos > end {
+		pos = end
+	}
+	r.anchorPos = pos
+	r.anchorWall = r.now()
+}
+
+// Snapshot returns the recorded snapshot at the playback position. In
+// sequential mode, used for headless output, every frame is returned once in
+// order and the last one is held once the recording is exhausted.
+func (r *replaySource) Snapshot() Snapshot {
+	if !r.sequential {
+		return r.current().snapshot()
+	}
+	r.mu.Lock()
+	i := r.next
+	if i >= len(r.frames) {
+		i = len(r.frames) - 1
+	} else {
+		r.next++
+	}
+	r.mu.Unlock()
+	return r.frames[i].snapshot()
+}
+
+func (r *replaySource) Name() string { return "replay" }
+
+func (r *replaySource) Init() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.anchorWall = r.now()
+	return nil
+}
+
+func (r *replaySource) Close() {}
+
+func (r *replaySource) SystemInfo() SystemInfo { return r.header.SystemInfo }
+
+func (r *replaySource) SocMetrics(durationMs int) SocMetrics {
+	return restoreSocMetrics(r.current().Sample)
+}
+
+func (r *replaySource) CPUPercentages() ([]float64, error) {
+	cores := r.current().Sample.CoreUsages
+	return append([]float64(nil), cores...), nil
+}
+
+func (r *replaySource) Memory() MemoryMetrics { return r.current().Sample.Memory }
+
+func (r *replaySource) NetDisk() NetDiskMetrics { return r.current().Sample.NetDisk }
+
+func (r *replaySource) Processes(systemGpuPercent float64) ([]ProcessMetrics, error) {
+	return append([]ProcessMetrics(nil), r.current().Processes...), nil
+}
+
+func (r *replaySource) ThunderboltNetStats() []ThunderboltNetStats {
+	return append([]ThunderboltNetStats(nil), r.current().TBNetStats...)
+}
+
+func (r *replaySource) ThermalState() (string, bool) {
+	state := r.current().Sample.ThermalState
+	if state == "" {
+		state = "Normal"
+	}
+	return state, state != "Normal"
+}
+
+func formatReplayClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d / time.Hour)
+	m := int(d/time.Minute) % 60
+	s := int(d/time.Second) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
+
+func updateReplayTitle() {
+	state := "▶"
+	if replay.Paused() {
+		state = "⏸"
+	}
+	mainBlock.Title = fmt.Sprintf(" mactop [replay %s %s / %s %gx] ", state,
+		formatReplayClock(replay.Position()), formatReplayClock(replay.Duration()), replay.speed)
+}
+
+func handleReplayKeys(key string) {
+	switch key {
+	case "P":
+		replay.TogglePause()
+	case ",":
+		replay.Seek(-10 * time.Second)
+	case ".":
+		replay.Seek(10 * time.Second)
+	case "<":
+		replay.Seek(-time.Minute)
+	case ">":
+		replay.Seek(time.Minute)
+	}
+
+	// Nudge the collectors so the new position shows without waiting a tick.
+	select {
+	case interruptChan <- struct{}{}:
+	default:
+	}
+
+	renderMutex.Lock()
+	updateReplayTitle()
+	w, h := ui.TerminalDimensions()
+	drawScreen(w, h)
+	renderMutex.Unlock()
+}
@@ -0,0 +1,564 @@
+package app
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// Chart geometry of mactop report, in SVG user units.
+const (
+	reportWidth     = 860
+	reportHeight    = 220
+	reportPadLeft   = 64
+	reportPadRight  = 12
+	reportPadTop    = 10
+	reportPadBottom = 24
+	reportMaxPoints = 1200 // per line; longer sessions are averaged down
+)
+
+// readReportSamples loads a recording, or headless json, ndjson or json-seq
+// output in either schema. path "-" reads stdin.
+func readReportSamples(path string) ([]HeadlessOutput, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []HeadlessOutput
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		_, frames, err := readRecording(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range frames {
+			s := f.Sample
+			s.capturedAt = f.Time
+			samples = append(samples, s)
+		}
+	} else if samples, err = decodeReportSamples(data); err != nil {
+		return nil, err
+	}
+	if len(samples) < 2 {
+		return nil, errors.New("need at least two samples for a report")
+	}
+	return samples, nil
+}
+
+// decodeReportSamples reads headless JSON output. Samples only have whole
+// second timestamps, so those that share one are spread across it.
+func decodeReportSamples(data []byte) ([]HeadlessOutput, error) {
+	data = bytes.ReplaceAll(data, []byte{0x1e}, nil)
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, errors.New("expected a recording or headless json, ndjson or json-seq output")
+	}
+
+	var raws []json.RawMessage
+	if trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		for {
+			var raw json.RawMessage
+			err := dec.Decode(&raw)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON: %v", err)
+			}
+			raws = append(raws, raw)
+		}
+	}
+
+	samples := make([]HeadlessOutput, 0, len(raws))
+	times := make([]time.Time, 0, len(raws))
+	for i, raw := range raws {
+		var version struct {
+			SchemaVersion int `json:"schema_version"`
+		}
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("sample %d: %v", i+1, err)
+		}
+		var o HeadlessOutput
+		if version.SchemaVersion == headlessSchemaV2 {
+			var v2 HeadlessOutputV2
+			if err := json.Unmarshal(raw, &v2); err != nil {
+				return nil, fmt.Errorf("sample %d: %v", i+1, err)
+			}
+			o = headlessOutputFromV2(v2)
+		} else if err := json.Unmarshal(raw, &o); err != nil {
+			return nil, fmt.Errorf("sample %d: %v", i+1, err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, o.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d has no timestamp", i+1)
+		}
+		samples = append(samples, o)
+		times = append(times, t)
+	}
+	spreadSampleTimes(times)
+	for i := range samples {
+		samples[i].capturedAt = times[i]
+	}
+	return samples, nil
+}
+
+// sampleDurations is how long each sample stands for: the time to the next
+// one, and the average step for the last.
+func sampleDurations(times []time.Time) []time.Duration {
+	n := len(times)
+	spans := make([]time.Duration, n)
+	for i := 0; i < n-1; i++ {
+		spans[i] = times[i+1].Sub(times[i])
+	}
+	spans[n-1] = sessionDuration(times) - times[n-1].Sub(times[0])
+	return spans
+}
+
+// reportMetric is one line of a chart and one row of the summary.
+type reportMetric struct {
+	name   string // legend label
+	stat   string // summary row, empty to leave it out
+	color  string
+	dashed bool
+	value  func(o HeadlessOutput) float64
+}
+
+type reportChartSpec struct {
+	title   string
+	metrics []reportMetric
+	max     float64 // fixed top of the y axis, 0 to fit the data
+	fitMin  bool    // start the y axis near the lowest value instead of 0
+	format  func(v float64) string
+	bands   bool // shade the thermal states
+}
+
+// Colors follow the component, so CPU is the same blue in every chart.
+const (
+	reportBlue   = "#4e79a7"
+	reportGreen  = "#59a14f"
+	reportPurple = "#b07aa1"
+	reportOrange = "#f28e2b"
+	reportTeal   = "#76b7b2"
+	reportBrown  = "#9c755f"
+	reportRed    = "#e15759"
+	reportGrey   = "#8c8c8c"
+)
+
+func formatReportPercent(v float64) string { return fmt.Sprintf("%.1f%%", v) }
+func formatReportWatts(v float64) string   { return fmt.Sprintf("%.2f W", v) }
+func formatReportCelsius(v float64) string { return fmt.Sprintf("%.1f °C", v) }
+func formatReportBytes(v float64) string   { return formatBytes(v, "auto") }
+func formatReportRate(v float64) string    { return formatBytes(v, "auto") + "/s" }
+
+var reportCharts = []reportChartSpec{
+	{
+		title: "Utilization", max: 100, format: formatReportPercent,
+		metrics: []reportMetric{
+			{"CPU", "CPU usage", reportBlue, false, func(o HeadlessOutput) float64 { return o.CPUUsage }},
+			{"GPU", "GPU usage", reportGreen, false, func(o HeadlessOutput) float64 { return math.Max(o.GPUUsage, 0) }},
+			{"ANE", "ANE usage", reportPurple, false, func(o HeadlessOutput) float64 { return aneUsagePercent(o.SocMetrics.ANEPower) }},
+		},
+	},
+	{
+		title: "Power", format: formatReportWatts,
+		metrics: []reportMetric{
+			{"CPU", "CPU power", reportBlue, false, func(o HeadlessOutput) float64 { return o.SocMetrics.CPUPower }},
+			{"GPU", "GPU power", reportGreen, false, func(o HeadlessOutput) float64 { return o.SocMetrics.GPUPower }},
+			{"ANE", "ANE power", reportPurple, false, func(o HeadlessOutput) float64 { return o.SocMetrics.ANEPower }},
+			{"DRAM", "DRAM power", reportOrange, false, func(o HeadlessOutput) float64 { return o.SocMetrics.DRAMPower }},
+			{"GPU SRAM", "GPU SRAM power", reportTeal, false, func(o HeadlessOutput) float64 { return o.SocMetrics.GPUSRAMPower }},
+			{"System", "System power", reportBrown, false, func(o HeadlessOutput) float64 { return o.SocMetrics.SystemPower }},
+			{"Total", "Total power", reportRed, false, func(o HeadlessOutput) float64 { return o.SocMetrics.TotalPower }},
+		},
+	},
+	{
+		title: "Temperature", format: formatReportCelsius, bands: true, fitMin: true,
+		metrics: []reportMetric{
+			{"CPU", "CPU temperature", reportBlue, false, func(o HeadlessOutput) float64 { return float64(o.SocMetrics.CPUTemp) }},
+			{"GPU", "GPU temperature", reportGreen, false, func(o HeadlessOutput) float64 { return float64(o.SocMetrics.GPUTemp) }},
+			{"SoC", "SoC temperature", reportRed, false, func(o HeadlessOutput) float64 { return float64(o.SocMetrics.SocTemp) }},
+		},
+	},
+	{
+		title: "Memory", format: formatReportBytes,
+		metrics: []reportMetric{
+			{"Used", "Memory used", reportBlue, false, func(o HeadlessOutput) float64 { return float64(o.Memory.Used) }},
+			{"Swap", "Swap used", reportOrange, false, func(o HeadlessOutput) float64 { return float64(o.Memory.SwapUsed) }},
+			{"Total", "", reportGrey, true, func(o HeadlessOutput) float64 { return float64(o.Memory.Total) }},
+		},
+	},
+	{
+		title: "Network", format: formatReportRate,
+		metrics: []reportMetric{
+			{"In", "Network in", reportBlue, false, func(o HeadlessOutput) float64 { return o.NetDisk.InBytesPerSec }},
+			{"Out", "Network out", reportOrange, false, func(o HeadlessOutput) float64 { return o.NetDisk.OutBytesPerSec }},
+		},
+	},
+	{
+		title: "Disk", format: formatReportRate,
+		metrics: []reportMetric{
+			{"Read", "Disk read", reportBlue, false, func(o HeadlessOutput) float64 { return o.NetDisk.ReadKBytesPerSec * 1024 }},
+			{"Write", "Disk write", reportOrange, false, func(o HeadlessOutput) float64 { return o.NetDisk.WriteKBytesPerSec * 1024 }},
+		},
+	},
+}
+
+// thermalBand is a run of samples in one thermal state other than Normal.
+type thermalBand struct {
+	State      string
+	Start, End time.Time
+}
+
+func thermalBands(samples []HeadlessOutput, spans []time.Duration) []thermalBand {
+	var bands []thermalBand
+	for i, s := range samples {
+		state := s.ThermalState
+		end := s.capturedAt.Add(spans[i])
+		if state == "" || state == "Normal" {
+			continue
+		}
+		if n := len(bands); n > 0 && bands[n-1].State == state && bands[n-1].End.Equal(s.capturedAt) {
+			bands[n-1].End = end
+			continue
+		}
+		bands = append(bands, thermalBand{State: state, Start: s.capturedAt, End: end})
+	}
+	return bands
+}
+
+// niceCeil rounds v up to 1, 2, 2.5 or 5 times a power of ten.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 2.5, 5} {
+		if m*exp >= v {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+// renderReportChart draws spec as an inline SVG line chart over the session.
+func renderReportChart(spec reportChartSpec, samples []HeadlessOutput, bands []thermalBand) template.HTML {
+	start, end := samples[0].capturedAt, samples[len(samples)-1].capturedAt
+	if len(bands) > 0 && bands[len(bands)-1].End.After(end) {
+		end = bands[len(bands)-1].End
+	}
+	span := end.Sub(start).Seconds()
+	if span <= 0 {
+		span = 1
+	}
+	plotW := float64(reportWidth - reportPadLeft - reportPadRight)
+	plotH := float64(reportHeight - reportPadTop - reportPadBottom)
+	x := func(t time.Time) float64 {
+		return reportPadLeft + t.Sub(start).Seconds()/span*plotW
+	}
+
+	// Average runs of samples down to at most reportMaxPoints per line.
+	n := len(samples)
+	k := min(n, reportMaxPoints)
+	lines := make([][]float64, len(spec.metrics))
+	xs := make([]float64, k)
+	peak, low := 0.0, math.Inf(1)
+	for b := 0; b < k; b++ {
+		lo, hi := b*n/k, (b+1)*n/k
+		xs[b] = x(samples[(lo+hi-1)/2].capturedAt)
+		for i, m := range spec.metrics {
+			sum := 0.0
+			for _, s := range samples[lo:hi] {
+				sum += m.value(s)
+			}
+			v := sum / float64(hi-lo)
+			lines[i] = append(lines[i], v)
+			peak, low = math.Max(peak, v), math.Min(low, v)
+		}
+	}
+	bottom := 0.0
+	if spec.fitMin && low > 0 {
+		bottom = math.Floor(low/10) * 10
+	}
+	top := spec.max
+	if top == 0 {
+		top = bottom + niceCeil(peak-bottom)
+	}
+	y := func(v float64) float64 {
+		v = math.Min(math.Max(v, bottom), top)
+		return reportPadTop + plotH - (v-bottom)/(top-bottom)*plotH
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" role="img" aria-label="%s">`,
+		reportWidth, reportHeight, html.EscapeString(spec.title))
+	for _, band := range bands {
+		fmt.Fprintf(&b, `<rect class="band-%s" x="%.1f" y="%d" width="%.1f" height="%.0f"><title>%s</title></rect>`,
+			strings.ToLower(html.EscapeString(band.State)), x(band.Start), reportPadTop,
+			math.Max(x(band.End)-x(band.Start), 1), plotH, html.EscapeString(band.State))
+	}
+	for i := 0; i <= 4; i++ {
+		v := bottom + (top-bottom)*float64(i)/4
+		fmt.Fprintf(&b, `<line class="grid" x1="%d" x2="%d" y1="%.1f" y2="%.1f"/>`,
+			reportPadLeft, reportWidth-reportPadRight, y(v), y(v))
+		fmt.Fprintf(&b, `<text class="axis" x="%d" y="%.1f" text-anchor="end">%s</text>`,
+			reportPadLeft-6, y(v)+4, html.EscapeString(spec.format(v)))
+	}
+	layout := "15:04:05"
+	switch {
+	case end.Sub(start) >= 24*time.Hour:
+		layout = "Jan 2 15:04"
+	case end.Sub(start) < 10*time.Second:
+		layout = "15:04:05.0"
+	}
+	for i := 0; i <= 4; i++ {
+		t := start.Add(time.Duration(span * float64(i) / 4 * float64(time.Second)))
+		anchor := "middle"
+		switch i {
+		case 0:
+			anchor = "start"
+		case 4:
+			anchor = "end"
+		}
+		fmt.Fprintf(&b, `<text class="axis" x="%.1f" y="%d" text-anchor="%s">%s</text>`,
+			x(t), reportHeight-6, anchor, t.Format(layout))
+	}
+	for i, m := range spec.metrics {
+		points := make([]string, k)
+		for j, v := range lines[i] {
+			points[j] = fmt.Sprintf("%.1f,%.1f", xs[j], y(v))
+		}
+		dash := ""
+		if m.dashed {
+			dash = ` stroke-dasharray="4 3"`
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5"%s points="%s"><title>%s</title></polyline>`,
+			m.color, dash, strings.Join(points, " "), html.EscapeString(m.name))
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+type reportLegend struct {
+	Name, Color string
+	Dashed      bool
+}
+
+type reportChart struct {
+	Title  string
+	SVG    template.HTML
+	Legend []reportLegend
+	Bands  bool
+}
+
+type reportStat struct {
+	Name, Mean, P95, Peak string
+}
+
+type reportThermal struct {
+	State    string
+	Duration string
+	Percent  float64
+}
+
+// reportData is what report.html renders.
+type reportData struct {
+	Title     string
+	Source    string
+	Version   string
+	Generated string
+	System    SystemInfo
+	Start     string
+	End       string
+	Duration  string
+	Samples   int
+	Energy    string
+	Alerts    int
+	Thermal   []reportThermal
+	Stats     []reportStat
+	Charts    []reportChart
+}
+
+// buildReport summarises and charts samples, which must be at least two.
+func buildReport(samples []HeadlessOutput, source, title string) reportData {
+	times := make([]time.Time, len(samples))
+	for i, s := range samples {
+		times[i] = s.capturedAt
+	}
+	duration := sessionDuration(times)
+	spans := sampleDurations(times)
+	last := samples[len(samples)-1]
+	if title == "" {
+		title = "mactop report"
+		if last.SystemInfo.Name != "" {
+			title += " - " + last.SystemInfo.Name
+		}
+	}
+	r := reportData{
+		Title:     title,
+		Source:    source,
+		Version:   version,
+		Generated: time.Now().Format(time.RFC3339),
+		System:    last.SystemInfo,
+		Start:     times[0].Format(time.RFC3339),
+		End:       times[len(times)-1].Format(time.RFC3339),
+		Duration:  duration.Round(time.Second).String(),
+		Samples:   len(samples),
+	}
+
+	watts := make([]float64, len(samples))
+	var counter []float64
+	seen := make(map[string]float64)
+	alerts := make(map[string]bool)
+	for i, s := range samples {
+		watts[i] = s.SocMetrics.TotalPower
+		if s.Energy != nil {
+			counter = append(counter, s.Energy.TotalJoules)
+		}
+		state := s.ThermalState
+		if state == "" {
+			state = "Normal"
+		}
+		seen[state] += spans[i].Seconds()
+		for _, a := range s.Alerts {
+			alerts[a.Name] = true
+		}
+	}
+	joules, _ := sessionEnergy(times, watts, counter)
+	r.Energy = energySummary(EnergyTotals{Total: joules})
+	r.Alerts = len(alerts)
+
+	states := append([]string(nil), thermalStates...)
+	var other []string
+	for state := range seen {
+		if !slices.Contains(thermalStates, state) {
+			other = append(other, state)
+		}
+	}
+	sort.Strings(other)
+	for _, state := range append(states, other...) {
+		if sec, ok := seen[state]; ok && sec > 0 {
+			r.Thermal = append(r.Thermal, reportThermal{
+				State:    state,
+				Duration: (time.Duration(sec * float64(time.Second))).Round(time.Second).String(),
+				Percent:  sec / duration.Seconds() * 100,
+			})
+		}
+	}
+
+	bands := thermalBands(samples, spans)
+	for _, spec := range reportCharts {
+		c := reportChart{Title: spec.title, Bands: spec.bands}
+		var chartBands []thermalBand
+		if spec.bands {
+			chartBands = bands
+		}
+		c.SVG = renderReportChart(spec, samples, chartBands)
+		for _, m := range spec.metrics {
+			c.Legend = append(c.Legend, reportLegend{Name: m.name, Color: m.color, Dashed: m.dashed})
+			if m.stat == "" {
+				continue
+			}
+			values := make([]float64, len(samples))
+			for i, s := range samples {
+				values[i] = m.value(s)
+			}
+			st := diffStats(values)
+			r.Stats = append(r.Stats, reportStat{
+				Name: m.stat,
+				Mean: spec.format(st.Mean),
+				P95:  spec.format(st.P95),
+				Peak: spec.format(st.Peak),
+			})
+		}
+		r.Charts = append(r.Charts, c)
+	}
+	return r
+}
+
+func writeReport(w io.Writer, r reportData) error {
+	return reportTemplate.Execute(w, r)
+}
+
+func runReportCommand(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	output := fs.String("output", "", "Write the report to this file (default: stdout)")
+	fs.StringVar(output, "o", "", "Shorthand for --output")
+	title := fs.String("title", "", "Report title (default: mactop report - <model>)")
+	fs.Float64Var(&energyPrice, "energy-price", 0, "Electricity price per kWh, for the energy cost")
+	fs.Float64Var(&carbonPerKWh, "carbon-intensity", 0, "Grid carbon intensity in grams of CO2 per kWh")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mactop report [options] input")
+		fmt.Fprintln(fs.Output(), "\nRender a --record recording or headless json, ndjson or json-seq output")
+		fmt.Fprintln(fs.Output(), "(- for stdin) as a single self-contained HTML page with inline SVG charts.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	loadConfig()
+	applyEnergyConfig()
+
+	// Options may come before or after the input.
+	var inputs []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		inputs = append(inputs, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(inputs) != 1 {
+		fs.Usage()
+		return errors.New("need exactly one input file")
+	}
+	if energyPrice < 0 || carbonPerKWh < 0 {
+		return errors.New("--energy-price and --carbon-intensity must not be negative")
+	}
+
+	samples, err := readReportSamples(inputs[0])
+	if err != nil {
+		return fmt.Errorf("%s: %v", inputs[0], err)
+	}
+	source := inputs[0]
+	if source == "-" {
+		source = "stdin"
+	}
+	var b bytes.Buffer
+	if err := writeReport(&b, buildReport(samples, source, *title)); err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+	return os.WriteFile(*output, b.Bytes(), 0644)
+}
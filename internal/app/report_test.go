@@ -0,0 +1,168 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReportSamples(t *testing.T) {
+	sample := func(sec int, watts float64) HeadlessOutput {
+		return HeadlessOutput{
+			SchemaVersion: headlessSchemaV1,
+			Timestamp:     time.Date(2025, 1, 1, 0, 0, sec, 0, time.UTC).Format(time.RFC3339),
+			SocMetrics:    SocMetrics{CPUPower: watts, TotalPower: watts},
+			SystemInfo:    SystemInfo{Name: "Apple M4"},
+			Alerts:        []Alert{},
+		}
+	}
+	samples := []HeadlessOutput{sample(0, 10), sample(0, 20), sample(1, 30)}
+
+	var ndjson, v2 []string
+	for _, s := range samples {
+		line, _ := json.Marshal(s)
+		ndjson = append(ndjson, string(line))
+		line, _ = json.Marshal(headlessOutputV2(s))
+		v2 = append(v2, string(line))
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"v1.ndjson":   strings.Join(ndjson, "\n") + "\n",
+		"v2.json":     "[" + strings.Join(v2, ",\n") + "]\n",
+		"v1.json-seq": "\x1e" + strings.Join(ndjson, "\n\x1e") + "\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readReportSamples(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(got) != 3 || got[1].SocMetrics.CPUPower != 20 || got[0].SystemInfo.Name != "Apple M4" {
+			t.Errorf("%s: got %+v", name, got)
+			continue
+		}
+		if d := got[1].capturedAt.Sub(got[0].capturedAt); d != 500*time.Millisecond {
+			t.Errorf("%s: second sample %v after the first, want 500ms", name, d)
+		}
+	}
+
+	path, live := recordDemoSession(t, 3)
+	got, err := readReportSamples(path)
+	if err != nil || len(got) != len(live) {
+		t.Errorf("recording: %d samples, %v", len(got), err)
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	os.WriteFile(bad, []byte("Timestamp,CPU_Usage\n"), 0644)
+	if _, err := readReportSamples(bad); err == nil {
+		t.Error("readReportSamples accepted CSV")
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var samples []HeadlessOutput
+	for i, state := range []string{"Normal", "Normal", "Serious", "Serious", "Normal"} {
+		samples = append(samples, HeadlessOutput{
+			SocMetrics:   SocMetrics{TotalPower: 3600, CPUTemp: float32(50 + i)},
+			CPUUsage:     float64(10 * i),
+			SystemInfo:   SystemInfo{Name: "Apple M4 <Pro>"},
+			ThermalState: state,
+			capturedAt:   base.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	r := buildReport(samples, "run.ndjson", "")
+	if r.Title != "mactop report - Apple M4 <Pro>" || r.Duration != "5s" || r.Energy != "5.00 Wh" {
+		t.Errorf("header: title %q, duration %q, energy %q", r.Title, r.Duration, r.Energy)
+	}
+	wantThermal := []reportThermal{{"Normal", "3s", 60}, {"Serious", "2s", 40}}
+	if len(r.Thermal) != len(wantThermal) || r.Thermal[0] != wantThermal[0] || r.Thermal[1] != wantThermal[1] {
+		t.Errorf("thermal = %+v, want %+v", r.Thermal, wantThermal)
+	}
+	if r.Stats[0] != (reportStat{"CPU usage", "20.0%", "40.0%", "40.0%"}) {
+		t.Errorf("stats[0] = %+v", r.Stats[0])
+	}
+	if len(r.Charts) != len(reportCharts) {
+		t.Errorf("got %d charts, want %d", len(r.Charts), len(reportCharts))
+	}
+
+	var b strings.Builder
+	if err := writeReport(&b, r); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"<title>mactop report - Apple M4 &lt;Pro&gt;</title>",
+		`<rect class="band-serious"`,
+		"<td>Serious</td>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report is missing %s", want)
+		}
+	}
+	if n := strings.Count(out, "<svg "); n != len(reportCharts) {
+		t.Errorf("report has %d charts, want %d", n, len(reportCharts))
+	}
+	// It is attached to tickets, so it must render offline.
+	if m := regexp.MustCompile(`(?i)(src|href)\s*=|@import|url\(`).FindString(out); m != "" {
+		t.Errorf("report loads an external resource: %s", m)
+	}
+}
+
+// report and diff measure the same file the same way.
+func TestReportEnergyMatchesDiff(t *testing.T) {
+	dir := t.TempDir()
+	line := func(sec int, watts, joules float64) string {
+		energy := ""
+		if joules > 0 {
+			energy = fmt.Sprintf(`,"energy":{"total_joules":%g}`, joules)
+		}
+		return fmt.Sprintf(`{"schema_version":1,"timestamp":"2025-01-01T00:00:%02dZ","soc_metrics":{"total_power":%g}%s}`, sec, watts, energy) + "\n"
+	}
+	// Eight samples at -i 200 span two whole-second timestamps.
+	var fast, metered string
+	for i := 0; i < 8; i++ {
+		fast += line(i/5, 3600+360*float64(i), 0)
+		metered += line(i, 3600, 100000+5000*float64(i))
+	}
+	files := map[string]string{}
+	for name, content := range map[string]string{"fast.ndjson": fast, "metered.ndjson": metered} {
+		files[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(files[name], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files["demo.rec"], _ = recordDemoSession(t, 3)
+
+	for name, path := range files {
+		samples, err := readReportSamples(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		series, err := readDiffSeries(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		joules, ok := series.EnergyJoules()
+		if !ok {
+			t.Fatalf("%s: diff has no energy", name)
+		}
+		r := buildReport(samples, name, "")
+		if want := energySummary(EnergyTotals{Total: joules}); r.Energy != want {
+			t.Errorf("%s: report energy %s, diff %s", name, r.Energy, want)
+		}
+		if want := series.Duration().Round(time.Second).String(); r.Duration != want {
+			t.Errorf("%s: report duration %s, diff %s", name, r.Duration, want)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// exitStatus is returned by a subcommand that should exit with this code
+// without printing an error, e.g. mactop run passing on its child's status.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// AvgPeak is the time-weighted mean and the maximum of a value over a run.
+type AvgPeak struct {
+	Avg  float64 `json:"avg"`
+	Peak float64 `json:"peak"`
+}
+
+type RunPowerReport struct {
+	CPU     AvgPeak `json:"cpu"`
+	GPU     AvgPeak `json:"gpu"`
+	ANE     AvgPeak `json:"ane"`
+	DRAM    AvgPeak `json:"dram"`
+	GPUSRAM AvgPeak `json:"gpu_sram"`
+	System  AvgPeak `json:"system"`
+	Total   AvgPeak `json:"total"`
+}
+
+type RunUsageReport struct {
+	CPU AvgPeak `json:"cpu"`
+	GPU AvgPeak `json:"gpu"`
+	ANE AvgPeak `json:"ane"`
+}
+
+type RunTempReport struct {
+	CPU float64 `json:"cpu"`
+	GPU float64 `json:"gpu"`
+}
+
+// RunReport summarises the samples taken while mactop run's command ran.
+type RunReport struct {
+	Command          []string       `json:"command"`
+	ExitCode         int            `json:"exit_code"`
+	Start            time.Time      `json:"start"`
+	DurationSeconds  float64        `json:"duration_seconds"`
+	Samples          int            `json:"samples"`
+	IntervalMs       int            `json:"interval_ms"`
+	PowerWatts       RunPowerReport `json:"power_watts"`
+	Energy           *EnergyOutput  `json:"energy"`
+	UsagePercent     RunUsageReport `json:"usage_percent"`
+	MaxTempCelsius   RunTempReport  `json:"max_temp_celsius"`
+	ThrottledSeconds float64        `json:"throttled_seconds"`
+	PeakMemoryBytes  uint64         `json:"peak_memory_bytes"`
+	PeakSwapBytes    uint64         `json:"peak_swap_bytes"`
+}
+
+// aneUsagePercent estimates ANE utilisation from its power, taking 8 W as
+// fully busy.
+func aneUsagePercent(watts float64) float64 {
+	return watts / 8.0 * 100
+}
+
+// runStat accumulates a time-weighted sum and a peak.
+type runStat struct {
+	sum, peak float64
+}
+
+func (s *runStat) add(v, dt float64) {
+	s.sum += v * dt
+	s.peak = math.Max(s.peak, v)
+}
+
+func (s runStat) result(seconds float64) AvgPeak {
+	if seconds <= 0 {
+		return AvgPeak{}
+	}
+	return AvgPeak{Avg: s.sum / seconds, Peak: s.peak}
+}
+
+// runProfile folds the snapshots taken during a run into a RunReport. Each
+// snapshot is weighted by the time it covers.
+type runProfile struct {
+	prev    time.Time
+	seconds float64
+	samples int
+	energy  EnergyTotals
+
+	power     [7]runStat // RunPowerReport order
+	usage     [3]runStat // cpu, gpu, ane
+	temp      RunTempReport
+	throttled float64
+	memory    uint64
+	swap      uint64
+}
+
+func (p *runProfile) Add(s Snapshot) {
+	dt := sampleSpan(p.prev, s.CapturedAt).Seconds()
+	p.prev = s.CapturedAt
+	p.seconds += dt
+	p.samples++
+	p.energy = s.Energy
+
+	c := s.CPU
+	for i, w := range []float64{c.CPUW, c.GPUW, c.ANEW, c.DRAMW, c.GPUSRAMW, c.SystemW, c.PackageW} {
+		p.power[i].add(w, dt)
+	}
+	for i, u := range []float64{s.CPUUsage(), math.Max(s.GPU.ActivePercent, 0), aneUsagePercent(c.ANEW)} {
+		p.usage[i].add(u, dt)
+	}
+	p.temp.CPU = math.Max(p.temp.CPU, c.CPUTemp)
+	p.temp.GPU = math.Max(p.temp.GPU, c.GPUTemp)
+	if s.Throttled {
+		p.throttled += dt
+	}
+	if s.Memory.Used > p.memory {
+		p.memory = s.Memory.Used
+	}
+	if s.Memory.SwapUsed > p.swap {
+		p.swap = s.Memory.SwapUsed
+	}
+}
+
+// Report summarises the run. Energy is what the session meter counted, as
+// the collector starts with the command.
+func (p *runProfile) Report() RunReport {
+	stat := func(s runStat) AvgPeak { return s.result(p.seconds) }
+	return RunReport{
+		Samples:    p.samples,
+		IntervalMs: updateInterval,
+		PowerWatts: RunPowerReport{
+			CPU:     stat(p.power[0]),
+			GPU:     stat(p.power[1]),
+			ANE:     stat(p.power[2]),
+			DRAM:    stat(p.power[3]),
+			GPUSRAM: stat(p.power[4]),
+			System:  stat(p.power[5]),
+			Total:   stat(p.power[6]),
+		},
+		Energy:           energyOutput(p.energy),
+		UsagePercent:     RunUsageReport{CPU: stat(p.usage[0]), GPU: stat(p.usage[1]), ANE: stat(p.usage[2])},
+		MaxTempCelsius:   p.temp,
+		ThrottledSeconds: p.throttled,
+		PeakMemoryBytes:  p.memory,
+		PeakSwapBytes:    p.swap,
+	}
+}
+
+// writeRunReport prints r as text, json or markdown.
+func writeRunReport(w io.Writer, format string, r RunReport) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "markdown", "md":
+		return writeRunMarkdown(w, r)
+	case "text":
+		return writeRunText(w, r)
+	}
+	return fmt.Errorf("unknown format %q, want text, json or markdown", format)
+}
+
+// runPowerRows pairs each power component with its label.
+func runPowerRows(p RunPowerReport) []struct {
+	name string
+	v    AvgPeak
+} {
+	return []struct {
+		name string
+		v    AvgPeak
+	}{
+		{"CPU", p.CPU}, {"GPU", p.GPU}, {"ANE", p.ANE}, {"DRAM", p.DRAM},
+		{"GPU SRAM", p.GPUSRAM}, {"System", p.System}, {"Total", p.Total},
+	}
+}
+
+// runEnergyText is the total energy with its cost and CO2 when configured.
+func runEnergyText(e *EnergyOutput) string {
+	if e == nil {
+		return "no samples"
+	}
+	s := fmt.Sprintf("%s (%.1f J)", formatEnergy(e.TotalJoules), e.TotalJoules)
+	if e.Cost != nil {
+		s += ", " + e.Currency + fmt.Sprintf("%.4f", *e.Cost)
+	}
+	if e.CO2Grams != nil {
+		s += ", " + formatCO2(*e.CO2Grams)
+	}
+	return s
+}
+
+// runSamplesText is e.g. "1.50 s (6 samples every 250 ms)".
+func runSamplesText(r RunReport) string {
+	noun := "samples"
+	if r.Samples == 1 {
+		noun = "sample"
+	}
+	return fmt.Sprintf("%.2f s (%d %s every %d ms)", r.DurationSeconds, r.Samples, noun, r.IntervalMs)
+}
+
+func writeRunText(w io.Writer, r RunReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "mactop run: %s\n", strings.Join(r.Command, " "))
+	fmt.Fprintf(&b, "  %-12s %d\n", "Exit code", r.ExitCode)
+	fmt.Fprintf(&b, "  %-12s %s\n", "Duration", runSamplesText(r))
+	fmt.Fprintf(&b, "  %-12s %s\n", "Energy", runEnergyText(r.Energy))
+	fmt.Fprintf(&b, "\n  %-12s %9s %9s\n", "Power", "avg", "peak")
+	for _, row := range runPowerRows(r.PowerWatts) {
+		fmt.Fprintf(&b, "  %-12s %8.2fW %8.2fW\n", row.name, row.v.Avg, row.v.Peak)
+	}
+	fmt.Fprintf(&b, "\n  %-12s %9s %9s\n", "Usage", "avg", "peak")
+	u := r.UsagePercent
+	for _, row := range []struct {
+		name string
+		v    AvgPeak
+	}{{"CPU", u.CPU}, {"GPU", u.GPU}, {"ANE", u.ANE}} {
+		fmt.Fprintf(&b, "  %-12s %8.1f%% %8.1f%%\n", row.name, row.v.Avg, row.v.Peak)
+	}
+	fmt.Fprintf(&b, "\n  %-12s CPU %s, GPU %s\n", "Max temp", formatTemp(r.MaxTempCelsius.CPU), formatTemp(r.MaxTempCelsius.GPU))
+	fmt.Fprintf(&b, "  %-12s %.1f s\n", "Throttled", r.ThrottledSeconds)
+	fmt.Fprintf(&b, "  %-12s %s (swap %s)\n", "Peak memory", formatBytes(float64(r.PeakMemoryBytes), "auto"), formatBytes(float64(r.PeakSwapBytes), "auto"))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeRunMarkdown(w io.Writer, r RunReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## mactop run: `%s`\n\n", strings.Join(r.Command, " "))
+	fmt.Fprintf(&b, "| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Exit code | %d |\n", r.ExitCode)
+	fmt.Fprintf(&b, "| Duration | %s |\n", runSamplesText(r))
+	fmt.Fprintf(&b, "| Energy | %s |\n", runEnergyText(r.Energy))
+	fmt.Fprintf(&b, "| Max temp | CPU %s, GPU %s |\n", formatTemp(r.MaxTempCelsius.CPU), formatTemp(r.MaxTempCelsius.GPU))
+	fmt.Fprintf(&b, "| Throttled | %.1f s |\n", r.ThrottledSeconds)
+	fmt.Fprintf(&b, "| Peak memory | %s (swap %s) |\n", formatBytes(float64(r.PeakMemoryBytes), "auto"), formatBytes(float64(r.PeakSwapBytes), "auto"))
+	fmt.Fprintf(&b, "\n| Power | Avg (W) | Peak (W) |\n|---|---:|---:|\n")
+	for _, row := range runPowerRows(r.PowerWatts) {
+		fmt.Fprintf(&b, "| %s | %.2f | %.2f |\n", row.name, row.v.Avg, row.v.Peak)
+	}
+	u := r.UsagePercent
+	fmt.Fprintf(&b, "\n| Usage | Avg (%%) | Peak (%%) |\n|---|---:|---:|\n")
+	fmt.Fprintf(&b, "| CPU | %.1f | %.1f |\n| GPU | %.1f | %.1f |\n| ANE | %.1f | %.1f |\n",
+		u.CPU.Avg, u.CPU.Peak, u.GPU.Avg, u.GPU.Peak, u.ANE.Avg, u.ANE.Peak)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// childExitCode is the status a shell would report for a finished command:
+// its exit code, or 128 plus the signal that killed it.
+func childExitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return 0, err
+	}
+	if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), nil
+	}
+	return ee.ExitCode(), nil
+}
+
+func runRunCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	interval := fs.Int("interval", 250, "Sample interval in milliseconds")
+	fs.IntVar(interval, "i", 250, "Sample interval in milliseconds")
+	format := fs.String("format", "text", "Report format: text, json or markdown")
+	output := fs.String("output", "", "Write the report to this file instead of stderr")
+	source := fs.String("source", defaultMetricSource, "Metric source: darwin (live IOReport/SMC) or demo (synthetic load)")
+	fs.Float64Var(&energyPrice, "energy-price", 0, "Electricity price per kWh, for the energy cost")
+	fs.Float64Var(&carbonPerKWh, "carbon-intensity", 0, "Grid carbon intensity in grams of CO2 per kWh")
+	fs.StringVar(&tempUnit, "unit-temp", "celsius", "Temperature unit: celsius, fahrenheit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mactop run [options] -- command [args ...]")
+		fmt.Fprintln(fs.Output(), "\nRun a command, sample it for its lifetime and print a power and")
+		fmt.Fprintln(fs.Output(), "utilisation report when it exits. mactop exits with the command's status.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	loadConfig()
+	applyEnergyConfig()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no command given")
+	}
+	if *interval < 100 {
+		return fmt.Errorf("interval must be at least 100ms")
+	}
+	if energyPrice < 0 || carbonPerKWh < 0 {
+		return errors.New("--energy-price and --carbon-intensity must not be negative")
+	}
+	*format = strings.ToLower(*format)
+	if err := writeRunReport(io.Discard, *format, RunReport{}); err != nil {
+		return err
+	}
+	report := os.Stderr
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		report = f
+	}
+
+	src, err := newMetricSource(*source)
+	if err != nil {
+		return err
+	}
+	metricSource = src
+	updateInterval = *interval
+	if err := metricSource.Init(); err != nil {
+		return fmt.Errorf("failed to initialize metrics: %v", err)
+	}
+	defer metricSource.Close()
+	// Prime the CPU counters so the first sample has a usage to report.
+	metricSource.CPUPercentages()
+
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	done := make(chan struct{})
+	sub := snapshotBus.Subscribe("run", 1024)
+	go collectSnapshots(done, snapshotBus, 1)
+
+	// Ctrl+C reaches the command through the terminal. mactop stays up to
+	// report on it, and passes on a SIGTERM sent to itself.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		close(done)
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var profile runProfile
+	var waitErr error
+loop:
+	for {
+		select {
+		case s := <-sub.C:
+			profile.Add(s)
+		case sig := <-sigChan:
+			if sig == syscall.SIGTERM {
+				cmd.Process.Signal(sig)
+			}
+		case waitErr = <-exited:
+			break loop
+		}
+	}
+	end := time.Now()
+	// A command shorter than one interval still gets the sample it overlapped.
+	if profile.samples == 0 {
+		select {
+		case s := <-sub.C:
+			profile.Add(s)
+		case <-time.After(2*time.Duration(updateInterval)*time.Millisecond + time.Second):
+		}
+	}
+	close(done)
+
+	code, err := childExitCode(waitErr)
+	if err != nil {
+		return err
+	}
+	r := profile.Report()
+	r.Command = fs.Args()
+	r.ExitCode = code
+	r.Start = start
+	r.DurationSeconds = end.Sub(start).Seconds()
+	if err := writeRunReport(report, *format, r); err != nil {
+		return err
+	}
+	if code != 0 {
+		return exitStatus(code)
+	}
+	return nil
+}
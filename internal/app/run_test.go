@@ -0,0 +1,121 @@
+package app
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunProfile(t *testing.T) {
+	saved := updateInterval
+	defer func() { updateInterval = saved }()
+	updateInterval = 1000
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(sec int, cpuW, usage, temp float64, throttled bool, used uint64) Snapshot {
+		return Snapshot{
+			CapturedAt: base.Add(time.Duration(sec) * time.Second),
+			CPU:        CPUMetrics{CPUW: cpuW, ANEW: 4, PackageW: cpuW + 4, CPUTemp: temp},
+			GPU:        GPUMetrics{ActivePercent: -1},
+			CoreUsages: []float64{usage, usage},
+			Throttled:  throttled,
+			Memory:     MemoryMetrics{Used: used},
+			Energy:     EnergyTotals{Seconds: float64(sec + 1), Total: 10},
+		}
+	}
+
+	var p runProfile
+	for _, s := range []Snapshot{
+		sample(0, 10, 20, 50, false, 100),
+		sample(1, 30, 60, 70, true, 300),
+		sample(4, 20, 40, 60, false, 200), // 3 s after the previous sample
+	} {
+		p.Add(s)
+	}
+	r := p.Report()
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"samples", r.Samples, 3},
+		{"cpu watts", r.PowerWatts.CPU, AvgPeak{Avg: 20, Peak: 30}},
+		{"total watts", r.PowerWatts.Total, AvgPeak{Avg: 24, Peak: 34}},
+		{"ane usage", r.UsagePercent.ANE, AvgPeak{Avg: 50, Peak: 50}},
+		{"cpu usage", r.UsagePercent.CPU, AvgPeak{Avg: 40, Peak: 60}},
+		{"gpu usage", r.UsagePercent.GPU, AvgPeak{}},
+		{"max cpu temp", r.MaxTempCelsius.CPU, 70.0},
+		{"throttled", r.ThrottledSeconds, 1.0},
+		{"peak memory", r.PeakMemoryBytes, uint64(300)},
+		{"energy", r.Energy.TotalJoules, 10.0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	var empty runProfile
+	if r := empty.Report(); r.Energy != nil || r.PowerWatts.Total != (AvgPeak{}) {
+		t.Errorf("empty profile reported %+v", r)
+	}
+}
+
+func TestWriteRunReport(t *testing.T) {
+	r := RunReport{
+		Command:         []string{"make", "-j8"},
+		ExitCode:        2,
+		DurationSeconds: 1.5,
+		Samples:         1,
+		IntervalMs:      250,
+		PowerWatts:      RunPowerReport{Total: AvgPeak{Avg: 12.5, Peak: 20}},
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"text", []string{"mactop run: make -j8", "Exit code    2", "1.50 s (1 sample every 250 ms)", "Total           12.50W    20.00W", "no samples"}},
+		{"markdown", []string{"## mactop run: `make -j8`", "| Exit code | 2 |", "| Total | 12.50 | 20.00 |"}},
+		{"json", []string{`"command": [`, `"exit_code": 2,`, `"energy": null,`}},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := writeRunReport(&b, tt.format, r); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%s report missing %q:\n%s", tt.format, want, b.String())
+			}
+		}
+		if tt.format == "json" && !json.Valid([]byte(b.String())) {
+			t.Errorf("json report is not valid JSON:\n%s", b.String())
+		}
+	}
+	if err := writeRunReport(&strings.Builder{}, "yaml", r); err == nil {
+		t.Error("writeRunReport accepted an unknown format")
+	}
+}
+
+func TestChildExitCode(t *testing.T) {
+	tests := []struct {
+		script string
+		want   int
+	}{
+		{"exit 0", 0},
+		{"exit 3", 3},
+		{"kill -TERM $$", 143},
+	}
+	for _, tt := range tests {
+		code, err := childExitCode(exec.Command("sh", "-c", tt.script).Run())
+		if err != nil || code != tt.want {
+			t.Errorf("%q: got %d, %v, want %d", tt.script, code, err, tt.want)
+		}
+	}
+	if _, err := childExitCode(exec.Command("/nonexistent/mactop-test").Run()); err == nil {
+		t.Error("childExitCode hid a failure to start the command")
+	}
+}
@@ -0,0 +1,420 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Headless schema versions. v1 is HeadlessOutput, which only gained
+// schema_version; v2 is HeadlessOutputV2.
+const (
+	headlessSchemaV1 = 1
+	headlessSchemaV2 = 2
+)
+
+// parseSchemaVersion accepts v1, v2, 1 or 2. An empty string is v1.
+func parseSchemaVersion(s string) (int, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "v") {
+	case "", "1":
+		return headlessSchemaV1, nil
+	case "2":
+		return headlessSchemaV2, nil
+	}
+	return 0, fmt.Errorf("unknown schema %q, want v1 or v2", s)
+}
+
+// HeadlessOutputV2 is the --schema v2 sample. Every value has a name of its
+// own, numbers carry their unit in the name, and related values are grouped.
+type HeadlessOutputV2 struct {
+	SchemaVersion int              `json:"schema_version" yaml:"schema_version" xml:"SchemaVersion" toon:"schema_version"`
+	Timestamp     string           `json:"timestamp" yaml:"timestamp" xml:"Timestamp" toon:"timestamp"`
+	System        SystemOutputV2   `json:"system" yaml:"system" xml:"System" toon:"system"`
+	CPU           CPUOutputV2      `json:"cpu" yaml:"cpu" xml:"CPU" toon:"cpu"`
+	GPU           GPUOutputV2      `json:"gpu" yaml:"gpu" xml:"GPU" toon:"gpu"`
+	Power         PowerOutputV2    `json:"power" yaml:"power" xml:"Power" toon:"power"`
+	Energy        *EnergyOutput    `json:"energy,omitempty" yaml:"energy,omitempty" xml:"Energy,omitempty" toon:"energy,omitempty"`
+	Temperature   TempOutputV2     `json:"temperature" yaml:"temperature" xml:"Temperature" toon:"temperature"`
+	ThermalState  string           `json:"thermal_state" yaml:"thermal_state" xml:"ThermalState" toon:"thermal_state"`
+	Memory        MemoryOutputV2   `json:"memory" yaml:"memory" xml:"Memory" toon:"memory"`
+	Network       NetworkOutputV2  `json:"network" yaml:"network" xml:"Network" toon:"network"`
+	Disk          DiskOutputV2     `json:"disk" yaml:"disk" xml:"Disk" toon:"disk"`
+	Thunderbolt   ThunderboltOutV2 `json:"thunderbolt" yaml:"thunderbolt" xml:"Thunderbolt" toon:"thunderbolt"`
+	RDMA          RDMAStatus       `json:"rdma" yaml:"rdma" xml:"RDMA" toon:"rdma"`
+	Alerts        []Alert          `json:"alerts" yaml:"alerts" xml:"Alerts>Alert" toon:"alerts"`
+	Peers         []Peer           `json:"peers,omitempty" yaml:"peers,omitempty" xml:"Peers>Peer,omitempty" toon:"peers,omitempty"`
+}
+
+type SystemOutputV2 struct {
+	Model    string `json:"model" yaml:"model" xml:"Model" toon:"model"`
+	Cores    int    `json:"cores" yaml:"cores" xml:"Cores" toon:"cores"`
+	ECores   int    `json:"e_cores" yaml:"e_cores" xml:"ECores" toon:"e_cores"`
+	PCores   int    `json:"p_cores" yaml:"p_cores" xml:"PCores" toon:"p_cores"`
+	GPUCores int    `json:"gpu_cores" yaml:"gpu_cores" xml:"GPUCores" toon:"gpu_cores"`
+}
+
+type CPUOutputV2 struct {
+	UsagePercent     float64         `json:"usage_percent" yaml:"usage_percent" xml:"UsagePercent" toon:"usage_percent"`
+	ECluster         CPUClusterOutV2 `json:"e_cluster" yaml:"e_cluster" xml:"ECluster" toon:"e_cluster"`
+	PCluster         CPUClusterOutV2 `json:"p_cluster" yaml:"p_cluster" xml:"PCluster" toon:"p_cluster"`
+	CoreUsagePercent []float64       `json:"core_usage_percent" yaml:"core_usage_percent" xml:"CoreUsagePercent" toon:"core_usage_percent"`
+}
+
+type CPUClusterOutV2 struct {
+	FreqMHz       int32   `json:"freq_mhz" yaml:"freq_mhz" xml:"FreqMHz" toon:"freq_mhz"`
+	ActivePercent float64 `json:"active_percent" yaml:"active_percent" xml:"ActivePercent" toon:"active_percent"`
+}
+
+type GPUOutputV2 struct {
+	UsagePercent float64 `json:"usage_percent" yaml:"usage_percent" xml:"UsagePercent" toon:"usage_percent"`
+	FreqMHz      int32   `json:"freq_mhz" yaml:"freq_mhz" xml:"FreqMHz" toon:"freq_mhz"`
+}
+
+// PowerOutputV2 splits the package draw into components. TotalWatts is the
+// whole system and SystemWatts what is left after the measured components.
+type PowerOutputV2 struct {
+	CPUWatts     float64 `json:"cpu_watts" yaml:"cpu_watts" xml:"CPUWatts" toon:"cpu_watts"`
+	GPUWatts     float64 `json:"gpu_watts" yaml:"gpu_watts" xml:"GPUWatts" toon:"gpu_watts"`
+	GPUSRAMWatts float64 `json:"gpu_sram_watts" yaml:"gpu_sram_watts" xml:"GPUSRAMWatts" toon:"gpu_sram_watts"`
+	ANEWatts     float64 `json:"ane_watts" yaml:"ane_watts" xml:"ANEWatts" toon:"ane_watts"`
+	DRAMWatts    float64 `json:"dram_watts" yaml:"dram_watts" xml:"DRAMWatts" toon:"dram_watts"`
+	SystemWatts  float64 `json:"system_watts" yaml:"system_watts" xml:"SystemWatts" toon:"system_watts"`
+	TotalWatts   float64 `json:"total_watts" yaml:"total_watts" xml:"TotalWatts" toon:"total_watts"`
+}
+
+type TempOutputV2 struct {
+	SocCelsius float32 `json:"soc_celsius" yaml:"soc_celsius" xml:"SocCelsius" toon:"soc_celsius"`
+	CPUCelsius float32 `json:"cpu_celsius" yaml:"cpu_celsius" xml:"CPUCelsius" toon:"cpu_celsius"`
+	GPUCelsius float32 `json:"gpu_celsius" yaml:"gpu_celsius" xml:"GPUCelsius" toon:"gpu_celsius"`
+}
+
+type MemoryOutputV2 struct {
+	TotalBytes     uint64 `json:"total_bytes" yaml:"total_bytes" xml:"TotalBytes" toon:"total_bytes"`
+	UsedBytes      uint64 `json:"used_bytes" yaml:"used_bytes" xml:"UsedBytes" toon:"used_bytes"`
+	AvailableBytes uint64 `json:"available_bytes" yaml:"available_bytes" xml:"AvailableBytes" toon:"available_bytes"`
+	SwapTotalBytes uint64 `json:"swap_total_bytes" yaml:"swap_total_bytes" xml:"SwapTotalBytes" toon:"swap_total_bytes"`
+	SwapUsedBytes  uint64 `json:"swap_used_bytes" yaml:"swap_used_bytes" xml:"SwapUsedBytes" toon:"swap_used_bytes"`
+}
+
+type NetworkOutputV2 struct {
+	InBytesPerSec    float64 `json:"in_bytes_per_sec" yaml:"in_bytes_per_sec" xml:"InBytesPerSec" toon:"in_bytes_per_sec"`
+	OutBytesPerSec   float64 `json:"out_bytes_per_sec" yaml:"out_bytes_per_sec" xml:"OutBytesPerSec" toon:"out_bytes_per_sec"`
+	InPacketsPerSec  float64 `json:"in_packets_per_sec" yaml:"in_packets_per_sec" xml:"InPacketsPerSec" toon:"in_packets_per_sec"`
+	OutPacketsPerSec float64 `json:"out_packets_per_sec" yaml:"out_packets_per_sec" xml:"OutPacketsPerSec" toon:"out_packets_per_sec"`
+}
+
+type DiskOutputV2 struct {
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec" yaml:"read_bytes_per_sec" xml:"ReadBytesPerSec" toon:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec" yaml:"write_bytes_per_sec" xml:"WriteBytesPerSec" toon:"write_bytes_per_sec"`
+	ReadOpsPerSec    float64 `json:"read_ops_per_sec" yaml:"read_ops_per_sec" xml:"ReadOpsPerSec" toon:"read_ops_per_sec"`
+	WriteOpsPerSec   float64 `json:"write_ops_per_sec" yaml:"write_ops_per_sec" xml:"WriteOpsPerSec" toon:"write_ops_per_sec"`
+}
+
+type ThunderboltOutV2 struct {
+	InBytesPerSec  float64                `json:"in_bytes_per_sec" yaml:"in_bytes_per_sec" xml:"InBytesPerSec" toon:"in_bytes_per_sec"`
+	OutBytesPerSec float64                `json:"out_bytes_per_sec" yaml:"out_bytes_per_sec" xml:"OutBytesPerSec" toon:"out_bytes_per_sec"`
+	Buses          []ThunderboltBusOutput `json:"buses" yaml:"buses" xml:"Buses>Bus" toon:"buses"`
+}
+
+// headlessOutputV2 converts a v1 sample to v2.
+func headlessOutputV2(o HeadlessOutput) HeadlessOutputV2 {
+	m := o.SocMetrics
+	v2 := HeadlessOutputV2{
+		SchemaVersion: headlessSchemaV2,
+		Timestamp:     o.Timestamp,
+		System: SystemOutputV2{
+			Model:    o.SystemInfo.Name,
+			Cores:    o.SystemInfo.CoreCount,
+			ECores:   o.SystemInfo.ECoreCount,
+			PCores:   o.SystemInfo.PCoreCount,
+			GPUCores: o.SystemInfo.GPUCoreCount,
+		},
+		CPU: CPUOutputV2{
+			UsagePercent:     o.CPUUsage,
+			ECluster:         CPUClusterOutV2{FreqMHz: m.EClusterFreqMHz, ActivePercent: m.EClusterActive},
+			PCluster:         CPUClusterOutV2{FreqMHz: m.PClusterFreqMHz, ActivePercent: m.PClusterActive},
+			CoreUsagePercent: o.CoreUsages,
+		},
+		GPU: GPUOutputV2{UsagePercent: o.GPUUsage, FreqMHz: m.GPUFreqMHz},
+		Power: PowerOutputV2{
+			CPUWatts:     m.CPUPower,
+			GPUWatts:     m.GPUPower,
+			GPUSRAMWatts: m.GPUSRAMPower,
+			ANEWatts:     m.ANEPower,
+			DRAMWatts:    m.DRAMPower,
+			SystemWatts:  m.SystemPower,
+			TotalWatts:   m.TotalPower,
+		},
+		Energy:       o.Energy,
+		Temperature:  TempOutputV2{SocCelsius: m.SocTemp, CPUCelsius: m.CPUTemp, GPUCelsius: m.GPUTemp},
+		ThermalState: o.ThermalState,
+		Memory: MemoryOutputV2{
+			TotalBytes:     o.Memory.Total,
+			UsedBytes:      o.Memory.Used,
+			AvailableBytes: o.Memory.Available,
+			SwapTotalBytes: o.Memory.SwapTotal,
+			SwapUsedBytes:  o.Memory.SwapUsed,
+		},
+		Network: NetworkOutputV2{
+			InBytesPerSec:    o.NetDisk.InBytesPerSec,
+			OutBytesPerSec:   o.NetDisk.OutBytesPerSec,
+			InPacketsPerSec:  o.NetDisk.InPacketsPerSec,
+			OutPacketsPerSec: o.NetDisk.OutPacketsPerSec,
+		},
+		Disk: DiskOutputV2{
+			ReadBytesPerSec:  o.NetDisk.ReadKBytesPerSec * 1024,
+			WriteBytesPerSec: o.NetDisk.WriteKBytesPerSec * 1024,
+			ReadOpsPerSec:    o.NetDisk.ReadOpsPerSec,
+			WriteOpsPerSec:   o.NetDisk.WriteOpsPerSec,
+		},
+		Thunderbolt: ThunderboltOutV2{
+			InBytesPerSec:  o.TBNetTotalBytesInSec,
+			OutBytesPerSec: o.TBNetTotalBytesOutSec,
+			Buses:          []ThunderboltBusOutput{},
+		},
+		RDMA:   o.RDMAStatus,
+		Alerts: o.Alerts,
+		Peers:  o.Peers,
+	}
+	if v2.CPU.CoreUsagePercent == nil {
+		v2.CPU.CoreUsagePercent = []float64{}
+	}
+	if o.ThunderboltInfo != nil && o.ThunderboltInfo.Buses != nil {
+		v2.Thunderbolt.Buses = o.ThunderboltInfo.Buses
+	}
+	if v2.Alerts == nil {
+		v2.Alerts = []Alert{}
+	}
+	return v2
+}
+
+// headlessOutputFromV2 converts a v2 sample back to v1, for readers of
+// saved output such as mactop report.
+func headlessOutputFromV2(v2 HeadlessOutputV2) HeadlessOutput {
+	p := v2.Power
+	o := HeadlessOutput{
+		SchemaVersion: headlessSchemaV1,
+		Timestamp:     v2.Timestamp,
+		SocMetrics: SocMetrics{
+			CPUPower:        p.CPUWatts,
+			GPUPower:        p.GPUWatts,
+			ANEPower:        p.ANEWatts,
+			DRAMPower:       p.DRAMWatts,
+			GPUSRAMPower:    p.GPUSRAMWatts,
+			SystemPower:     p.SystemWatts,
+			TotalPower:      p.TotalWatts,
+			GPUFreqMHz:      v2.GPU.FreqMHz,
+			EClusterActive:  v2.CPU.ECluster.ActivePercent,
+			PClusterActive:  v2.CPU.PCluster.ActivePercent,
+			EClusterFreqMHz: v2.CPU.ECluster.FreqMHz,
+			PClusterFreqMHz: v2.CPU.PCluster.FreqMHz,
+			SocTemp:         v2.Temperature.SocCelsius,
+			CPUTemp:         v2.Temperature.CPUCelsius,
+			GPUTemp:         v2.Temperature.GPUCelsius,
+		},
+		Memory: MemoryMetrics{
+			Total:     v2.Memory.TotalBytes,
+			Used:      v2.Memory.UsedBytes,
+			Available: v2.Memory.AvailableBytes,
+			SwapTotal: v2.Memory.SwapTotalBytes,
+			SwapUsed:  v2.Memory.SwapUsedBytes,
+		},
+		NetDisk: NetDiskMetrics{
+			InBytesPerSec:     v2.Network.InBytesPerSec,
+			OutBytesPerSec:    v2.Network.OutBytesPerSec,
+			InPacketsPerSec:   v2.Network.InPacketsPerSec,
+			OutPacketsPerSec:  v2.Network.OutPacketsPerSec,
+			ReadOpsPerSec:     v2.Disk.ReadOpsPerSec,
+			WriteOpsPerSec:    v2.Disk.WriteOpsPerSec,
+			ReadKBytesPerSec:  v2.Disk.ReadBytesPerSec / 1024,
+			WriteKBytesPerSec: v2.Disk.WriteBytesPerSec / 1024,
+		},
+		CPUUsage:   v2.CPU.UsagePercent,
+		GPUUsage:   v2.GPU.UsagePercent,
+		CoreUsages: v2.CPU.CoreUsagePercent,
+		SystemInfo: SystemInfo{
+			Name:         v2.System.Model,
+			CoreCount:    v2.System.Cores,
+			ECoreCount:   v2.System.ECores,
+			PCoreCount:   v2.System.PCores,
+			GPUCoreCount: v2.System.GPUCores,
+		},
+		ThermalState:          v2.ThermalState,
+		TBNetTotalBytesInSec:  v2.Thunderbolt.InBytesPerSec,
+		TBNetTotalBytesOutSec: v2.Thunderbolt.OutBytesPerSec,
+		RDMAStatus:            v2.RDMA,
+		Energy:                v2.Energy,
+		Alerts:                v2.Alerts,
+		Peers:                 v2.Peers,
+	}
+	if len(v2.Thunderbolt.Buses) > 0 {
+		o.ThunderboltInfo = &ThunderboltOutput{Buses: v2.Thunderbolt.Buses}
+	}
+	return o
+}
+
+// headlessSample returns output in the given schema version.
+func headlessSample(output HeadlessOutput, version int) any {
+	if version == headlessSchemaV2 {
+		return headlessOutputV2(output)
+	}
+	// Samples persisted before schema_version existed decode as 0.
+	output.SchemaVersion = headlessSchemaV1
+	return output
+}
+
+// headlessSchemaType is the Go type behind a schema version.
+func headlessSchemaType(version int) reflect.Type {
+	if version == headlessSchemaV2 {
+		return reflect.TypeOf(HeadlessOutputV2{})
+	}
+	return reflect.TypeOf(HeadlessOutput{})
+}
+
+// jsonSchema describes the JSON that encoding/json produces for a sample of
+// the given version, as a JSON Schema (draft 2020-12). Named structs go in
+// $defs; slices, maps and pointers may also be null, as encoding/json writes
+// nil ones.
+func jsonSchema(version int) fieldObject {
+	defs := fieldObject{}
+	root := fieldObject{
+		{Key: "$schema", Value: "https://json-schema.org/draft/2020-12/schema"},
+		{Key: "title", Value: "mactop headless output"},
+		{Key: "description", Value: fmt.Sprintf("One sample of mactop --headless --schema v%d", version)},
+	}
+	sample := schemaObject(headlessSchemaType(version), &defs)
+	for _, f := range sample {
+		if f.Key != "properties" {
+			continue
+		}
+		props := f.Value.(fieldObject)
+		for i := range props {
+			if props[i].Key == "schema_version" {
+				props[i].Value = fieldObject{{Key: "type", Value: "integer"}, {Key: "const", Value: version}}
+			}
+		}
+	}
+	root = append(root, sample...)
+	return append(root, fieldEntry{Key: "$defs", Value: defs})
+}
+
+// schemaObject describes struct type t by its exported, JSON-visible fields.
+func schemaObject(t reflect.Type, defs *fieldObject) fieldObject {
+	props := fieldObject{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props = append(props, fieldEntry{Key: name, Value: schemaFor(f.Type, defs)})
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+	return fieldObject{
+		{Key: "type", Value: "object"},
+		{Key: "properties", Value: props},
+		{Key: "required", Value: required},
+		{Key: "additionalProperties", Value: false},
+	}
+}
+
+// schemaFor describes t, adding the named structs it uses to defs.
+func schemaFor(t reflect.Type, defs *fieldObject) fieldObject {
+	switch t.Kind() {
+	case reflect.Bool:
+		return fieldObject{{Key: "type", Value: "boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fieldObject{{Key: "type", Value: "integer"}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fieldObject{{Key: "type", Value: "integer"}, {Key: "minimum", Value: 0}}
+	case reflect.Float32, reflect.Float64:
+		return fieldObject{{Key: "type", Value: "number"}}
+	case reflect.String:
+		return fieldObject{{Key: "type", Value: "string"}}
+	case reflect.Pointer:
+		return nullableSchema(schemaFor(t.Elem(), defs))
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nullableSchema(fieldObject{{Key: "type", Value: "string"}, {Key: "contentEncoding", Value: "base64"}})
+		}
+		return nullableSchema(fieldObject{{Key: "type", Value: "array"}, {Key: "items", Value: schemaFor(t.Elem(), defs)}})
+	case reflect.Array:
+		return fieldObject{{Key: "type", Value: "array"}, {Key: "items", Value: schemaFor(t.Elem(), defs)}}
+	case reflect.Map:
+		return nullableSchema(fieldObject{{Key: "type", Value: "object"}, {Key: "additionalProperties", Value: schemaFor(t.Elem(), defs)}})
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return fieldObject{{Key: "type", Value: "string"}, {Key: "format", Value: "date-time"}}
+		}
+		if t.Name() == "" {
+			return schemaObject(t, defs)
+		}
+		ref := fieldObject{{Key: "$ref", Value: "#/$defs/" + t.Name()}}
+		for _, d := range *defs {
+			if d.Key == t.Name() {
+				return ref
+			}
+		}
+		// Claim the name before recursing, in case t refers to itself.
+		*defs = append(*defs, fieldEntry{Key: t.Name()})
+		obj := schemaObject(t, defs)
+		for i := range *defs {
+			if (*defs)[i].Key == t.Name() {
+				(*defs)[i].Value = obj
+			}
+		}
+		return ref
+	}
+	return fieldObject{}
+}
+
+// nullableSchema lets s also be null.
+func nullableSchema(s fieldObject) fieldObject {
+	if len(s) > 0 && s[0].Key == "type" {
+		out := append(fieldObject{}, s...)
+		out[0].Value = []string{s[0].Value.(string), "null"}
+		return out
+	}
+	return fieldObject{{Key: "anyOf", Value: []any{s, fieldObject{{Key: "type", Value: "null"}}}}}
+}
+
+func runSchemaCommand(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	format := fs.String("format", "jsonschema", "Output format: jsonschema")
+	schema := fs.String("schema", "v1", "Headless output schema to describe: v1 or v2")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mactop schema [--format jsonschema] [--schema v1|v2]")
+		fmt.Fprintln(fs.Output(), "\nPrint the JSON Schema of one headless sample.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if strings.ToLower(*format) != "jsonschema" {
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+	version, err := parseSchemaVersion(*schema)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(jsonSchema(version), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(data))
+	return nil
+}
@@ -0,0 +1,216 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validateSchema checks doc against the subset of JSON Schema that
+// jsonSchema emits.
+func validateSchema(root, s map[string]any, doc any, at string) error {
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		def, ok := root["$defs"].(map[string]any)[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: missing definition %s", at, ref)
+		}
+		return validateSchema(root, def, doc, at)
+	}
+	if c, ok := s["const"]; ok && c != doc {
+		return fmt.Errorf("%s = %v, want const %v", at, doc, c)
+	}
+
+	var types []string
+	switch t := s["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, v := range t {
+			types = append(types, v.(string))
+		}
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	var got string
+	switch v := doc.(type) {
+	case nil:
+		got = "null"
+	case bool:
+		got = "boolean"
+	case string:
+		got = "string"
+	case float64:
+		got = "number"
+		if v == float64(int64(v)) {
+			got = "integer"
+		}
+	case []any:
+		got = "array"
+	case map[string]any:
+		got = "object"
+	}
+	match := false
+	for _, t := range types {
+		if t == got || (t == "number" && got == "integer") {
+			match = true
+		}
+	}
+	if !match {
+		return fmt.Errorf("%s is %s, want %v", at, got, types)
+	}
+
+	switch v := doc.(type) {
+	case []any:
+		items, _ := s["items"].(map[string]any)
+		for i, item := range v {
+			if err := validateSchema(root, items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		props, _ := s["properties"].(map[string]any)
+		for _, name := range s["required"].([]any) {
+			if _, ok := v[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %s", at, name)
+			}
+		}
+		for name, value := range v {
+			prop, ok := props[name].(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: unexpected property %s", at, name)
+			}
+			if err := validateSchema(root, prop, value, at+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestJSONSchemaMatchesOutput(t *testing.T) {
+	s := Snapshot{
+		CapturedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Soc:        SocMetrics{CPUPower: 4.5, GPUActive: 12, EClusterFreqMHz: 1000, EClusterActive: 20},
+		CoreUsages: []float64{10, 20},
+		Memory:     MemoryMetrics{Total: 64, Used: 32},
+		NetDisk:    NetDiskMetrics{ReadKBytesPerSec: 2},
+		Alerts:     []Alert{{Name: "cpu_hot"}},
+		Peers:      []Peer{{Hostname: "studio2"}},
+		Energy:     EnergyTotals{Seconds: 1, CPU: 4.5, Total: 4.5},
+	}
+	tb := &ThunderboltOutput{Buses: []ThunderboltBusOutput{{Name: "TB4 Bus 0", Status: "Active"}}}
+	info := SystemInfo{Name: "Apple M4", CoreCount: 2}
+
+	tests := []struct {
+		name    string
+		version int
+		tbInfo  *ThunderboltOutput
+	}{
+		{"v1", headlessSchemaV1, tb},
+		{"v1 without thunderbolt", headlessSchemaV1, nil},
+		{"v2", headlessSchemaV2, tb},
+		{"v2 without thunderbolt", headlessSchemaV2, nil},
+	}
+
+	for _, tt := range tests {
+		schemaJSON, err := json.Marshal(jsonSchema(tt.version))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(schemaJSON, &schema); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		sample := headlessSample(buildHeadlessOutput(s, info, tt.tbInfo), tt.version)
+		data, err := json.Marshal(sample)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var doc any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := validateSchema(schema, schema, doc, "$"); err != nil {
+			t.Errorf("%s: %v\n%s", tt.name, err, data)
+		}
+	}
+}
+
+func TestHeadlessOutputV2(t *testing.T) {
+	o := HeadlessOutput{
+		SocMetrics: SocMetrics{EClusterFreqMHz: 1000, EClusterActive: 20, PClusterFreqMHz: 3000, PClusterActive: 80, TotalPower: 30},
+		NetDisk:    NetDiskMetrics{ReadKBytesPerSec: 2, WriteKBytesPerSec: 0.5},
+	}
+	v2 := headlessOutputV2(o)
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"schema_version", v2.SchemaVersion, headlessSchemaV2},
+		{"e_cluster", v2.CPU.ECluster, CPUClusterOutV2{FreqMHz: 1000, ActivePercent: 20}},
+		{"p_cluster", v2.CPU.PCluster, CPUClusterOutV2{FreqMHz: 3000, ActivePercent: 80}},
+		{"total_watts", v2.Power.TotalWatts, 30.0},
+		{"read_bytes_per_sec", v2.Disk.ReadBytesPerSec, 2048.0},
+		{"write_bytes_per_sec", v2.Disk.WriteBytesPerSec, 512.0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseSchemaVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"", headlessSchemaV1, false},
+		{"v1", headlessSchemaV1, false},
+		{"V2", headlessSchemaV2, false},
+		{"2", headlessSchemaV2, false},
+		{"v3", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSchemaVersion(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSchemaVersion(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestHeadlessOutputFromV2(t *testing.T) {
+	o := HeadlessOutput{
+		SchemaVersion: headlessSchemaV1,
+		Timestamp:     "2025-01-01T00:00:00Z",
+		SocMetrics: SocMetrics{
+			CPUPower: 4.5, GPUPower: 3, ANEPower: 1, DRAMPower: 0.5, GPUSRAMPower: 0.25, SystemPower: 2, TotalPower: 11.25,
+			GPUFreqMHz: 1200, EClusterActive: 20, PClusterActive: 80, EClusterFreqMHz: 1000, PClusterFreqMHz: 3000,
+			SocTemp: 50, CPUTemp: 55, GPUTemp: 45,
+		},
+		Memory:                MemoryMetrics{Total: 64, Used: 32, Available: 32, SwapTotal: 8, SwapUsed: 1},
+		NetDisk:               NetDiskMetrics{InBytesPerSec: 1, OutBytesPerSec: 2, InPacketsPerSec: 3, OutPacketsPerSec: 4, ReadOpsPerSec: 5, WriteOpsPerSec: 6, ReadKBytesPerSec: 7, WriteKBytesPerSec: 8},
+		CPUUsage:              50,
+		GPUUsage:              12,
+		CoreUsages:            []float64{40, 60},
+		SystemInfo:            SystemInfo{Name: "Apple M4", CoreCount: 2, ECoreCount: 1, PCoreCount: 1, GPUCoreCount: 10},
+		ThermalState:          "Fair",
+		ThunderboltInfo:       &ThunderboltOutput{Buses: []ThunderboltBusOutput{{Name: "TB4 Bus 0"}}},
+		TBNetTotalBytesInSec:  9,
+		TBNetTotalBytesOutSec: 10,
+		Energy:                &EnergyOutput{TotalJoules: 3},
+		Alerts:                []Alert{{Name: "cpu_hot"}},
+	}
+	got := headlessOutputFromV2(headlessOutputV2(o))
+	if !reflect.DeepEqual(got, o) {
+		t.Errorf("round trip through v2:\n got %+v\nwant %+v", got, o)
+	}
+}
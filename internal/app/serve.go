@@ -0,0 +1,366 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	serveDefaultWindow     = 10 * time.Minute
+	serveDefaultLimit      = 50
+	serveKeepAliveInterval = 15 * time.Second
+)
+
+// serveSortColumns maps the /processes sort parameter to a process column.
+var serveSortColumns = map[string]string{
+	"pid":     "PID",
+	"user":    "USER",
+	"virt":    "VIRT",
+	"vsz":     "VIRT",
+	"res":     "RES",
+	"rss":     "RES",
+	"cpu":     "CPU",
+	"gpu":     "GPU",
+	"mem":     "MEM",
+	"memory":  "MEM",
+	"watts":   "WATTS",
+	"energy":  "ENERGY",
+	"time":    "TIME",
+	"cmd":     "CMD",
+	"command": "CMD",
+}
+
+// ProcessOutput is one process in the /processes response.
+type ProcessOutput struct {
+	PID           int     `json:"pid"`
+	User          string  `json:"user"`
+	Command       string  `json:"command"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryPercent float64 `json:"memory_percent"`
+	GPUMsPerSec   float64 `json:"gpu_ms_per_sec"`
+	Watts         float64 `json:"watts"`
+	EnergyJoules  float64 `json:"energy_joules"`
+	RSSBytes      int64   `json:"rss_bytes"`
+	VirtualBytes  int64   `json:"virtual_bytes"`
+	State         string  `json:"state"`
+	Started       string  `json:"started"`
+	CPUTime       string  `json:"cpu_time"`
+}
+
+// ProcessesResponse is the body of /processes.
+type ProcessesResponse struct {
+	Timestamp string          `json:"timestamp"`
+	Total     int             `json:"total"`
+	Processes []ProcessOutput `json:"processes"`
+}
+
+// serveSample is one sample kept for /history, as headless JSON.
+type serveSample struct {
+	at   time.Time
+	line []byte
+}
+
+// serveAPI is the HTTP API of `mactop serve`. It sits on top of the metrics
+// server, which tracks the latest sample, and keeps a window of recent
+// samples for /history.
+type serveAPI struct {
+	metrics   *metricsServer
+	bus       *SnapshotBus
+	info      SystemInfo
+	retention time.Duration
+	done      chan struct{}
+
+	mu      sync.RWMutex
+	samples []serveSample // oldest first
+}
+
+func newServeAPI(metrics *metricsServer, bus *SnapshotBus, info SystemInfo, retention time.Duration, done chan struct{}) *serveAPI {
+	return &serveAPI{metrics: metrics, bus: bus, info: info, retention: retention, done: done}
+}
+
+// Handler routes /snapshot, /processes, /history and /stream alongside the
+// metrics server's own endpoints.
+func (a *serveAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	a.register(mux)
+	return mux
+}
+
+func (a *serveAPI) register(mux *http.ServeMux) {
+	a.metrics.register(mux, promRegistry)
+	mux.HandleFunc("/snapshot", a.metrics.serveSnapshot)
+	mux.HandleFunc("/processes", a.serveProcesses)
+	mux.HandleFunc("/history", a.serveHistory)
+	mux.HandleFunc("/stream", a.serveStream)
+}
+
+// Add keeps s for /history and drops samples older than the retention.
+func (a *serveAPI) Add(s Snapshot) {
+	line, err := json.Marshal(buildHeadlessOutput(s, a.info, nil))
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.samples = append(a.samples, serveSample{s.CapturedAt, line})
+	cutoff := s.CapturedAt.Add(-a.retention)
+	drop := 0
+	for drop < len(a.samples) && a.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		a.samples = append(a.samples[:0], a.samples[drop:]...)
+	}
+}
+
+// run records every snapshot until done is closed.
+func (a *serveAPI) run(sub *Subscription) {
+	for {
+		select {
+		case <-a.done:
+			return
+		case s := <-sub.C:
+			a.Add(s)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (a *serveAPI) serveProcesses(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	column := "CPU"
+	if v := q.Get("sort"); v != "" {
+		var ok bool
+		if column, ok = serveSortColumns[strings.ToLower(v)]; !ok {
+			http.Error(w, fmt.Sprintf("unknown sort %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := serveDefaultLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	reverse, _ := strconv.ParseBool(q.Get("reverse"))
+
+	s, ok := a.metrics.Latest()
+	if !ok {
+		http.Error(w, "no sample collected yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, processesResponse(s, column, reverse, limit))
+}
+
+// processesResponse sorts a copy of the snapshot's processes and keeps the
+// first limit of them. A limit of 0 keeps all.
+func processesResponse(s Snapshot, column string, reverse bool, limit int) ProcessesResponse {
+	procs := append([]ProcessMetrics(nil), s.Processes...)
+	sortProcessesBy(procs, column, reverse)
+	if limit > 0 && len(procs) > limit {
+		procs = procs[:limit]
+	}
+	resp := ProcessesResponse{
+		Timestamp: s.CapturedAt.Format(time.RFC3339),
+		Total:     len(s.Processes),
+		Processes: make([]ProcessOutput, 0, len(procs)),
+	}
+	for _, p := range procs {
+		resp.Processes = append(resp.Processes, ProcessOutput{
+			PID:           p.PID,
+			User:          p.User,
+			Command:       p.Command,
+			CPUPercent:    p.CPU,
+			MemoryPercent: p.Memory,
+			GPUMsPerSec:   p.GPU,
+			Watts:         p.Watts,
+			EnergyJoules:  p.Energy,
+			RSSBytes:      p.RSS * 1024,
+			VirtualBytes:  p.VSZ * 1024,
+			State:         p.State,
+			Started:       p.Started,
+			CPUTime:       p.Time,
+		})
+	}
+	return resp
+}
+
+func (a *serveAPI) serveHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var metrics []string
+	for _, m := range strings.Split(q.Get("metric"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			metrics = append(metrics, m)
+		}
+	}
+	if len(metrics) == 0 {
+		http.Error(w, "metric is required, e.g. metric=soc_metrics.cpu_power", http.StatusBadRequest)
+		return
+	}
+	window := serveDefaultWindow
+	if v := q.Get("window"); v != "" {
+		d, err := parseAge(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	var step time.Duration
+	if v := q.Get("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, fmt.Sprintf("invalid step %q", v), http.StatusBadRequest)
+			return
+		}
+		step = d
+	}
+
+	rows, err := a.History(metrics, window, step)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if rows == nil {
+		rows = []HistoryRow{}
+	}
+	writeJSON(w, rows)
+}
+
+// History summarises metrics over the newest window of kept samples, in the
+// same rows as `mactop history --metric`.
+func (a *serveAPI) History(metrics []string, window, step time.Duration) ([]HistoryRow, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if len(a.samples) == 0 {
+		return nil, nil
+	}
+	since := a.samples[len(a.samples)-1].at.Add(-window)
+	return summariseHistory(metrics, step, func(fn func(at time.Time, line []byte) error) error {
+		for _, s := range a.samples {
+			if s.at.Before(since) {
+				continue
+			}
+			if err := fn(s.at, s.line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// serveStream sends every sample as a Server-Sent Event, starting with the
+// latest one, until the client goes away or the server stops.
+func (a *serveAPI) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sub := a.bus.Subscribe("stream", 16)
+	defer a.bus.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(s Snapshot) error {
+		data, err := json.Marshal(a.metrics.Output(s))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: snapshot\ndata: %s\n\n", s.Seq, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if s, ok := a.metrics.Latest(); ok {
+		if send(s) != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(serveKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-a.done:
+			return
+		case s := <-sub.C:
+			if send(s) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// runServe collects samples with the same loop as the TUI and serves them on
+// listen until interrupted.
+func runServe(listen string, retention time.Duration) error {
+	if err := metricSource.Init(); err != nil {
+		return fmt.Errorf("failed to initialize metrics: %v", err)
+	}
+	defer metricSource.Close()
+
+	ln, err := net.Listen("tcp", metricsListenAddr(listen))
+	if err != nil {
+		return err
+	}
+
+	serveAddr = listen
+	done := make(chan struct{})
+	metricsSrv = &metricsServer{}
+	api := newServeAPI(metricsSrv, snapshotBus, metricSource.SystemInfo(), retention, done)
+	startSnapshotConsumers(done)
+	go api.run(snapshotBus.Subscribe("serve", 16))
+	go collectSnapshots(done, snapshotBus, 1)
+
+	srv := &http.Server{Handler: api.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	stderrLogger.Printf("Serving the mactop API at http://%s/\n", metricsDisplayAddr(metricsListenAddr(listen)))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sigChan:
+	case err = <-errc:
+	}
+
+	close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	waitForSnapshotWriters()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServeAPI(t *testing.T) (*serveAPI, *SnapshotBus, *httptest.Server) {
+	t.Helper()
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	bus := NewSnapshotBus()
+	info := SystemInfo{Name: "Apple M4", CoreCount: 2, ECoreCount: 1, PCoreCount: 1}
+	api := newServeAPI(&metricsServer{info: info}, bus, info, time.Hour, done)
+	srv := httptest.NewServer(api.Handler())
+	t.Cleanup(srv.Close)
+	return api, bus, srv
+}
+
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServeProcesses(t *testing.T) {
+	api, _, srv := newTestServeAPI(t)
+	api.metrics.Observe(Snapshot{CapturedAt: time.Now(), Processes: []ProcessMetrics{
+		{PID: 1, Command: "launchd", CPU: 0.5, RSS: 10},
+		{PID: 200, Command: "clang", CPU: 90, RSS: 300},
+		{PID: 300, Command: "swift", CPU: 40, RSS: 900},
+	}}, time.Now())
+
+	tests := []struct {
+		query    string
+		wantCode int
+		wantPIDs []int
+	}{
+		{"", http.StatusOK, []int{200, 300, 1}},
+		{"?sort=rss&limit=2", http.StatusOK, []int{300, 200}},
+		{"?sort=cpu&reverse=true", http.StatusOK, []int{1, 300, 200}},
+		{"?sort=command&limit=1", http.StatusOK, []int{200}},
+		{"?sort=colour", http.StatusBadRequest, nil},
+		{"?limit=-1", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var resp ProcessesResponse
+			if code := getJSON(t, srv.URL+"/processes"+tt.query, &resp); code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var pids []int
+			for _, p := range resp.Processes {
+				pids = append(pids, p.PID)
+			}
+			if resp.Total != 3 || len(pids) != len(tt.wantPIDs) {
+				t.Fatalf("total %d, pids %v, want %v", resp.Total, pids, tt.wantPIDs)
+			}
+			for i := range pids {
+				if pids[i] != tt.wantPIDs[i] {
+					t.Errorf("pids = %v, want %v", pids, tt.wantPIDs)
+					break
+				}
+			}
+		})
+	}
+
+	var resp ProcessesResponse
+	getJSON(t, srv.URL+"/processes?sort=pid&limit=1", &resp)
+	if resp.Processes[0].RSSBytes != 10*1024 || resp.Processes[0].Command != "launchd" {
+		t.Errorf("process = %+v", resp.Processes[0])
+	}
+}
+
+func TestServeHistory(t *testing.T) {
+	api, _, srv := newTestServeAPI(t)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		api.Add(Snapshot{CapturedAt: start.Add(time.Duration(i) * time.Minute), Soc: SocMetrics{CPUPower: float64(i)}})
+	}
+
+	var rows []HistoryRow
+	if code := getJSON(t, srv.URL+"/history?metric=soc_metrics.cpu_power&window=5m", &rows); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(rows) != 6 || rows[0].Avg != 14 || rows[5].Avg != 19 {
+		t.Errorf("rows = %+v, want minutes 14..19", rows)
+	}
+
+	rows = nil
+	getJSON(t, srv.URL+"/history?metric=soc_metrics.cpu_power&window=1h&step=10m", &rows)
+	if len(rows) != 2 || rows[0].Count != 10 || rows[0].Avg != 4.5 {
+		t.Errorf("10m rows = %+v", rows)
+	}
+
+	for query, want := range map[string]int{
+		"": http.StatusBadRequest,
+		"?metric=soc_metrics.cpu_power&window=soon": http.StatusBadRequest,
+		"?metric=no_such.metric":                    http.StatusNotFound,
+	} {
+		if code := getJSON(t, srv.URL+"/history"+query, &rows); code != want {
+			t.Errorf("/history%s status = %d, want %d", query, code, want)
+		}
+	}
+
+	// Samples older than the retention are dropped as new ones arrive.
+	api.retention = 10 * time.Minute
+	api.Add(Snapshot{CapturedAt: start.Add(20 * time.Minute)})
+	if n := len(api.samples); n != 11 {
+		t.Errorf("kept %d samples, want 11", n)
+	}
+}
+
+func TestServeStream(t *testing.T) {
+	api, bus, srv := newTestServeAPI(t)
+	api.metrics.Observe(Snapshot{Seq: 1, CapturedAt: time.Now()}, time.Now())
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1<<20)
+		var event []string
+		for scanner.Scan() {
+			if scanner.Text() == "" {
+				events <- strings.Join(event, "\n")
+				event = nil
+				continue
+			}
+			event = append(event, scanner.Text())
+		}
+		close(events)
+	}()
+
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return ""
+		}
+	}
+
+	// The latest sample is sent straight away, then each published one.
+	if e := next(); !strings.HasPrefix(e, "id: 1\nevent: snapshot\ndata: {") {
+		t.Errorf("first event = %q", e)
+	}
+	bus.Publish(Snapshot{CapturedAt: time.Now(), Soc: SocMetrics{CPUPower: 7}})
+	e := next()
+	var out HeadlessOutput
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(e[strings.Index(e, "data: "):], "data: ")), &out); err != nil {
+		t.Fatalf("event data is not JSON: %v\n%s", err, e)
+	}
+	if out.SocMetrics.CPUPower != 7 {
+		t.Errorf("streamed cpu_power = %v, want 7", out.SocMetrics.CPUPower)
+	}
+
+	resp.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		bus.mu.Lock()
+		n := len(bus.subs)
+		bus.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream subscription was not removed after the client left")
+		}
+		bus.Publish(Snapshot{})
+		time.Sleep(10 * time.Millisecond)
+	}
+}
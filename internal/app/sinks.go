@@ -0,0 +1,86 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// headerFlags collects repeated "Name: value" flags into HTTP headers.
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerFlags) Set(v string) error {
+	name, value, ok := strings.Cut(v, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected \"Name: value\", got %q", v)
+	}
+	*h = append(*h, strings.TrimSpace(name)+": "+strings.TrimSpace(value))
+	return nil
+}
+
+// Header returns the collected headers.
+func (h headerFlags) Header() http.Header {
+	header := make(http.Header, len(h))
+	for _, v := range h {
+		name, value, _ := strings.Cut(v, ": ")
+		header.Add(name, value)
+	}
+	return header
+}
+
+// configureSinks creates the outbound exporters selected by flags. They are
+// started as snapshot consumers by startSnapshotConsumers.
+func configureSinks() error {
+	if webhookURL != "" {
+		sink, err := newWebhookSink(webhookURL, webhookHeaders.Header(), webhookBatch, webhookFlush,
+			defaultSpoolDir("webhook"), int64(webhookSpoolMB)<<20)
+		if err != nil {
+			return fmt.Errorf("--webhook: %v", err)
+		}
+		webhook = sink
+	}
+	if otlpEndpoint != "" {
+		exp, err := newOTLPExporter(otlpEndpoint, otlpHeaders.Header(), otlpInterval)
+		if err != nil {
+			return fmt.Errorf("--otlp-endpoint: %v", err)
+		}
+		otlp = exp
+	}
+	if influxURL != "" {
+		token := influxToken
+		if token == "" {
+			token = os.Getenv("INFLUX_TOKEN")
+		}
+		w, err := newInfluxWriter(influxURL, influxOrg, influxBucket, token, influxInterval)
+		if err != nil {
+			return fmt.Errorf("--influx-url: %v", err)
+		}
+		influx = w
+	}
+	if statsdAddr != "" {
+		sink, err := newStatsdSink(statsdAddr, statsdPrefix, parseStatsdTags(statsdTags), statsdPlain)
+		if err != nil {
+			return fmt.Errorf("--statsd: %v", err)
+		}
+		statsd = sink
+	}
+	if rwURL != "" {
+		password, token := rwPassword, rwBearerToken
+		if password == "" {
+			password = os.Getenv("MACTOP_REMOTE_WRITE_PASSWORD")
+		}
+		if token == "" && rwUsername == "" {
+			token = os.Getenv("MACTOP_REMOTE_WRITE_TOKEN")
+		}
+		w, err := newRemoteWriter(rwURL, rwUsername, password, token, rwLabels.Labels(), rwInterval,
+			defaultSpoolDir("remote_write"), int64(rwQueueMB)<<20)
+		if err != nil {
+			return fmt.Errorf("--remote-write: %v", err)
+		}
+		remoteWrite = w
+	}
+	return nil
+}
@@ -1,3 +1,5 @@
+//go:build darwin
+
 // smc.c
 #include "smc.h"
 #include <stdio.h>
@@ -0,0 +1,329 @@
+package app
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is one coherent sample of every collector, taken on a single tick.
+// CPU and GPU are the UI views derived from Soc.
+type Snapshot struct {
+	Seq          uint64
+	CapturedAt   time.Time
+	Soc          SocMetrics
+	CPU          CPUMetrics
+	GPU          GPUMetrics
+	CoreUsages   []float64
+	Memory       MemoryMetrics
+	NetDisk      NetDiskMetrics
+	TBNetStats   []ThunderboltNetStats
+	Processes    []ProcessMetrics
+	ThermalState string
+	Throttled    bool
+	RDMA         RDMAStatus
+	Alerts       []Alert
+	Peers        []Peer
+	Energy       EnergyTotals // since mactop started
+}
+
+// deriveMetrics fills CPU and GPU from the raw SoC reading. The package total is
+// the larger of the measured system rail and the component sum.
+func (s *Snapshot) deriveMetrics() {
+	m := s.Soc
+	componentSum := m.TotalPower
+	totalPower := componentSum
+	systemResidual := 0.0
+
+	if m.SystemPower > componentSum {
+		totalPower = m.SystemPower
+		systemResidual = m.SystemPower - componentSum
+	}
+
+	s.CPU = CPUMetrics{
+		CPUW:            m.CPUPower,
+		GPUW:            m.GPUPower,
+		ANEW:            m.ANEPower,
+		DRAMW:           m.DRAMPower,
+		GPUSRAMW:        m.GPUSRAMPower,
+		SystemW:         systemResidual,
+		PackageW:        totalPower,
+		Throttled:       s.Throttled,
+		CPUTemp:         float64(m.CPUTemp),
+		GPUTemp:         float64(m.GPUTemp),
+		EClusterActive:  int(m.EClusterActive),
+		PClusterActive:  int(m.PClusterActive),
+		EClusterFreqMHz: int(m.EClusterFreqMHz),
+		PClusterFreqMHz: int(m.PClusterFreqMHz),
+		CoreUsages:      s.CoreUsages,
+	}
+	s.GPU = GPUMetrics{
+		FreqMHz:       int(m.GPUFreqMHz),
+		ActivePercent: m.GPUActive,
+		Power:         m.GPUPower + m.GPUSRAMPower,
+		Temp:          m.GPUTemp,
+	}
+}
+
+// CPUUsage is the mean utilisation across all cores.
+func (s Snapshot) CPUUsage() float64 {
+	if len(s.CoreUsages) == 0 {
+		return 0
+	}
+	var total float64
+	for _, u := range s.CoreUsages {
+		total += u
+	}
+	return total / float64(len(s.CoreUsages))
+}
+
+// takeSnapshot reads every metric from src once. The SoC sample blocks for
+// sampleMs on live sources. Replays hand back their recorded frames as-is.
+func takeSnapshot(src MetricSource, sampleMs int) Snapshot {
+	if r, ok := src.(*replaySource); ok {
+		return r.Snapshot()
+	}
+
+	s := Snapshot{Soc: src.SocMetrics(sampleMs), CapturedAt: time.Now()}
+	s.ThermalState, s.Throttled = src.ThermalState()
+
+	cores, err := src.CPUPercentages()
+	if err != nil {
+		stderrLogger.Printf("Error getting CPU percentages: %v\n", err)
+	}
+	s.CoreUsages = cores
+	s.Memory = src.Memory()
+	s.NetDisk = src.NetDisk()
+	s.TBNetStats = src.ThunderboltNetStats()
+	s.RDMA = CheckRDMAAvailable()
+
+	if procs, err := src.Processes(s.Soc.GPUActive); err == nil {
+		s.Processes = procs
+	} else {
+		stderrLogger.Printf("Error getting process list: %v\n", err)
+	}
+
+	s.deriveMetrics()
+	return s
+}
+
+// Subscription receives snapshots from a SnapshotBus. A subscriber that falls
+// behind loses its oldest queued snapshots, never the newest.
+type Subscription struct {
+	name    string
+	C       <-chan Snapshot
+	ch      chan Snapshot
+	dropped atomic.Uint64
+}
+
+func (s *Subscription) Name() string { return s.name }
+
+// Dropped reports how many snapshots this subscriber never received.
+func (s *Subscription) Dropped() uint64 { return s.dropped.Load() }
+
+// SnapshotBus fans each published Snapshot out to every subscriber and stamps
+// it with a sequence number.
+type SnapshotBus struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs []*Subscription
+}
+
+func NewSnapshotBus() *SnapshotBus {
+	return &SnapshotBus{}
+}
+
+func (b *SnapshotBus) Subscribe(name string, buffer int) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan Snapshot, buffer)
+	sub := &Subscription{name: name, C: ch, ch: ch}
+
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe stops delivery to sub. Its channel is left open.
+func (b *SnapshotBus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, s := range b.subs {
+		if s == sub {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Publish assigns the next sequence number and delivers s without blocking.
+func (b *SnapshotBus) Publish(s Snapshot) Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	s.Seq = b.seq
+	for _, sub := range b.subs {
+		b.deliver(sub, s)
+	}
+	return s
+}
+
+func (b *SnapshotBus) deliver(sub *Subscription, s Snapshot) {
+	for {
+		select {
+		case sub.ch <- s:
+			return
+		default:
+		}
+		select {
+		case <-sub.ch:
+			sub.dropped.Add(1)
+			snapshotsDropped.WithLabelValues(sub.name).Inc()
+		default:
+		}
+	}
+}
+
+// Dropped is the total number of snapshots lost across all subscribers.
+func (b *SnapshotBus) Dropped() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var total uint64
+	for _, sub := range b.subs {
+		total += sub.Dropped()
+	}
+	return total
+}
+
+// startSnapshotConsumers subscribes the optional Prometheus exporter, session
+// recorder and history writer to snapshotBus.
+func startSnapshotConsumers(done chan struct{}) {
+	if discoverPeers {
+		d, err := startPeerDiscovery(done, discoverIface, discoverPort)
+		if err != nil {
+			stderrLogger.Printf("Peer discovery disabled: %v\n", err)
+		} else {
+			discovery = d
+		}
+	}
+	if historyFile != nil {
+		sub := snapshotBus.Subscribe("history", 64)
+		snapshotWriters.Add(1)
+		go func() {
+			defer snapshotWriters.Done()
+			runHistoryWriter(done, historyFile, sub)
+		}()
+	}
+	if webAddr != "" {
+		startWebDashboard(done, webAddr)
+	}
+	// The remote writer updates the gauges itself so that each sample it
+	// takes matches the snapshot it came from.
+	if metricsSrv != nil {
+		go runMetricsServer(done, metricsSrv, snapshotBus.Subscribe("prometheus", 4), remoteWrite == nil)
+	}
+	if webhook != nil {
+		sub := snapshotBus.Subscribe("webhook", 256)
+		snapshotWriters.Add(1)
+		go func() {
+			defer snapshotWriters.Done()
+			runWebhookSink(done, webhook, sub)
+		}()
+	}
+	if otlp != nil {
+		sub := snapshotBus.Subscribe("otlp", 4)
+		snapshotWriters.Add(1)
+		go func() {
+			defer snapshotWriters.Done()
+			runOTLPExporter(done, otlp, sub)
+		}()
+	}
+	if influx != nil {
+		sub := snapshotBus.Subscribe("influx", 64)
+		snapshotWriters.Add(1)
+		go func() {
+			defer snapshotWriters.Done()
+			runInfluxWriter(done, influx, sub)
+		}()
+	}
+	if statsd != nil {
+		sub := snapshotBus.Subscribe("statsd", 16)
+		snapshotWriters.Add(1)
+		go func() {
+			defer snapshotWriters.Done()
+			runStatsdSink(done, statsd, sub)
+		}()
+	}
+	if remoteWrite != nil {
+		sub := snapshotBus.Subscribe("remote_write", 64)
+		snapshotWriters.Add(1)
+		go func() {
+			defer snapshotWriters.Done()
+			runRemoteWriter(done, remoteWrite, sub)
+		}()
+	}
+	if recording != nil {
+		sub := snapshotBus.Subscribe("recorder", 64)
+		snapshotWriters.Add(1)
+		go func() {
+			defer snapshotWriters.Done()
+			runRecorder(done, recording, sub)
+		}()
+	}
+}
+
+// waitForSnapshotWriters gives the recorder, history writer and exporters a
+// moment to drain, flush and close their files once done has been closed.
+func waitForSnapshotWriters() {
+	finished := make(chan struct{})
+	go func() {
+		snapshotWriters.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+	}
+}
+
+// collectSnapshots samples metricSource once per updateInterval and publishes
+// the result. SoC power is averaged over interval/windowDiv of each tick and
+// integrated into the session and per-process energy.
+func collectSnapshots(done chan struct{}, bus *SnapshotBus, windowDiv int) {
+	var energy energyMeter
+	for {
+		start := time.Now()
+
+		sampleDuration := updateInterval
+		if sampleDuration < 100 {
+			sampleDuration = 100
+		}
+
+		s := takeSnapshot(metricSource, sampleDuration/windowDiv)
+		energy.Add(&s)
+		evaluateAlerts(&s)
+		if discovery != nil {
+			s.Peers = discovery.Peers(s.CapturedAt)
+		}
+		bus.Publish(s)
+
+		elapsed := time.Since(start)
+		sleepTime := time.Duration(updateInterval)*time.Millisecond - elapsed
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if sleepTime > 0 {
+			select {
+			case <-done:
+				return
+			case <-time.After(sleepTime):
+			case <-interruptChan:
+			}
+		}
+	}
+}
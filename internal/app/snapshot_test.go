@@ -0,0 +1,78 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestSnapshotBusDelivery(t *testing.T) {
+	bus := NewSnapshotBus()
+	fast := bus.Subscribe("fast", 8)
+	slow := bus.Subscribe("slow", 2)
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(Snapshot{})
+	}
+
+	tests := []struct {
+		name        string
+		sub         *Subscription
+		wantSeqs    []uint64
+		wantDropped uint64
+	}{
+		{"keeps everything when the buffer fits", fast, []uint64{1, 2, 3, 4, 5}, 0},
+		{"drops the oldest when behind", slow, []uint64{4, 5}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint64
+			for len(tt.sub.C) > 0 {
+				got = append(got, (<-tt.sub.C).Seq)
+			}
+			if len(got) != len(tt.wantSeqs) {
+				t.Fatalf("received seqs %v, want %v", got, tt.wantSeqs)
+			}
+			for i := range got {
+				if got[i] != tt.wantSeqs[i] {
+					t.Fatalf("received seqs %v, want %v", got, tt.wantSeqs)
+				}
+			}
+			if d := tt.sub.Dropped(); d != tt.wantDropped {
+				t.Errorf("Dropped() = %d, want %d", d, tt.wantDropped)
+			}
+		})
+	}
+
+	if total := bus.Dropped(); total != 3 {
+		t.Errorf("bus Dropped() = %d, want 3", total)
+	}
+}
+
+func TestSnapshotDeriveMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		soc         SocMetrics
+		wantPackage float64
+		wantSystem  float64
+	}{
+		{"system rail above components", SocMetrics{CPUPower: 4, GPUPower: 2, TotalPower: 6, SystemPower: 10}, 10, 4},
+		{"components above system rail", SocMetrics{CPUPower: 5, GPUPower: 3, TotalPower: 8, SystemPower: 6}, 8, 0},
+		{"no system rail", SocMetrics{CPUPower: 1, TotalPower: 1}, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Snapshot{Soc: tt.soc, CoreUsages: []float64{20, 40}}
+			s.deriveMetrics()
+			if s.CPU.PackageW != tt.wantPackage {
+				t.Errorf("PackageW = %.2f, want %.2f", s.CPU.PackageW, tt.wantPackage)
+			}
+			if s.CPU.SystemW != tt.wantSystem {
+				t.Errorf("SystemW = %.2f, want %.2f", s.CPU.SystemW, tt.wantSystem)
+			}
+			if got := s.CPUUsage(); got != 30 {
+				t.Errorf("CPUUsage() = %.2f, want 30", got)
+			}
+		})
+	}
+}
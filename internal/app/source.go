@@ -0,0 +1,119 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MetricSource is the backend every collector reads from. The darwin source
+// wraps IOReport/SMC and the Mach/sysctl APIs; the demo source synthesizes
+// load so the TUI and headless pipeline can run anywhere.
+type MetricSource interface {
+	Name() string
+	Init() error
+	Close()
+	SystemInfo() SystemInfo
+	SocMetrics(durationMs int) SocMetrics
+	CPUPercentages() ([]float64, error)
+	Memory() MemoryMetrics
+	NetDisk() NetDiskMetrics
+	Processes(systemGpuPercent float64) ([]ProcessMetrics, error)
+	ThunderboltNetStats() []ThunderboltNetStats
+	ThermalState() (string, bool)
+}
+
+const (
+	SourceDarwin = "darwin"
+	SourceDemo   = "demo"
+)
+
+func newMetricSource(name string) (MetricSource, error) {
+	switch strings.ToLower(name) {
+	case SourceDarwin:
+		return newDarwinSource()
+	case SourceDemo:
+		return newDemoSource(), nil
+	default:
+		return nil, fmt.Errorf("unknown metric source: %s (expected %s or %s)", name, SourceDarwin, SourceDemo)
+	}
+}
+
+// configureMetricSource sets metricSource from the --source, --record,
+// --replay and --persist flags. Replays pace themselves to the recorded
+// interval unless the user chose one explicitly.
+func configureMetricSource(intervalSet bool) error {
+	if recordPath != "" && replayPath != "" {
+		return errors.New("--record and --replay cannot be used together")
+	}
+	if persistHistory && replayPath != "" {
+		return errors.New("--persist and --replay cannot be used together")
+	}
+
+	if replayPath != "" {
+		speed, err := parseReplaySpeed(replaySpeed)
+		if err != nil {
+			return err
+		}
+		replay, err = newReplaySource(replayPath, speed)
+		if err != nil {
+			return err
+		}
+		if !intervalSet {
+			updateInterval = replay.PlaybackInterval()
+			if !headless && updateInterval < 100 {
+				updateInterval = 100
+			}
+		}
+		replay.sequential = headless
+		metricSource = replay
+		return nil
+	}
+
+	src, err := newMetricSource(sourceName)
+	if err != nil {
+		return err
+	}
+	metricSource = src
+
+	if persistHistory {
+		maxAge, err := parseAge(persistMaxAge)
+		if err != nil {
+			return fmt.Errorf("--persist-max-age: %v", err)
+		}
+		historyFile, err = newHistoryWriter(defaultHistoryDir(), maxAge, int64(persistMaxMB)<<20)
+		if err != nil {
+			return err
+		}
+	}
+
+	if recordPath != "" {
+		recording, err = newSessionRecorder(recordPath, recordHeader{
+			Version:    version,
+			Source:     src.Name(),
+			IntervalMs: updateInterval,
+			SystemInfo: src.SystemInfo(),
+			Started:    time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// thermalStateLevel maps a thermal state name to the 0-3 scale used by the
+// Prometheus gauge.
+func thermalStateLevel(state string) int {
+	switch state {
+	case "Fair":
+		return 1
+	case "Serious":
+		return 2
+	case "Critical":
+		return 3
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,34 @@
+package app
+
+const defaultMetricSource = SourceDarwin
+
+// darwinSource reads live metrics from IOReport, SMC and the Mach/sysctl APIs.
+type darwinSource struct{}
+
+func newDarwinSource() (MetricSource, error) {
+	return darwinSource{}, nil
+}
+
+func (darwinSource) Name() string { return SourceDarwin }
+
+func (darwinSource) Init() error { return initSocMetrics() }
+
+func (darwinSource) Close() { cleanupSocMetrics() }
+
+func (darwinSource) SystemInfo() SystemInfo { return getSOCInfo() }
+
+func (darwinSource) SocMetrics(durationMs int) SocMetrics { return sampleSocMetrics(durationMs) }
+
+func (darwinSource) CPUPercentages() ([]float64, error) { return GetCPUPercentages() }
+
+func (darwinSource) Memory() MemoryMetrics { return getMemoryMetrics() }
+
+func (darwinSource) NetDisk() NetDiskMetrics { return getNetDiskMetrics() }
+
+func (darwinSource) Processes(systemGpuPercent float64) ([]ProcessMetrics, error) {
+	return getProcessList(systemGpuPercent)
+}
+
+func (darwinSource) ThunderboltNetStats() []ThunderboltNetStats { return GetThunderboltNetStats() }
+
+func (darwinSource) ThermalState() (string, bool) { return getThermalStateString() }
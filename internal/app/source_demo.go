@@ -0,0 +1,443 @@
+package app
+
+import (
+	"math"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// demoSource synthesizes a busy workstation: a periodic training job on the
+// GPU, compile bursts on the P-cores, ANE inference spikes and temperatures
+// that lag behind power. It needs no cgo, so it runs on any platform.
+type demoSource struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	start time.Time
+	rng   *rand.Rand
+	info  SystemInfo
+	user  string
+
+	cpuTemp, gpuTemp float64
+	lastThermal      time.Time
+
+	procs       []demoProcess
+	lastProcs   time.Time
+	tbCounters  map[string]*ThunderboltNetStats
+	lastTBStats time.Time
+}
+
+type demoProcess struct {
+	pid        int
+	user       string
+	command    string
+	rssKB      int64
+	vszKB      int64
+	cpuBase    float64
+	cpuSeconds float64
+	role       string
+}
+
+// demoLoad is the noiseless workload shape at one point in time.
+type demoLoad struct {
+	eCores, pCores []float64
+	gpuActive      float64
+	aneW           float64
+	training       bool
+	compiling      bool
+}
+
+const (
+	demoTotalMemory = 64 << 30
+	demoSwapTotal   = 4 << 30
+	demoTrainPeriod = 120.0
+	demoBuildPeriod = 90.0
+	demoANEPeriod   = 45.0
+)
+
+func newDemoSource() *demoSource {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "demo"
+	}
+	return &demoSource{
+		now:  time.Now,
+		rng:  rand.New(rand.NewPCG(1, 2)),
+		user: user,
+		info: SystemInfo{
+			Name:         "Apple M4 Max (demo)",
+			CoreCount:    16,
+			ECoreCount:   4,
+			PCoreCount:   12,
+			GPUCoreCount: 40,
+		},
+	}
+}
+
+func (d *demoSource) Name() string { return SourceDemo }
+
+func (d *demoSource) Init() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.start = d.now()
+	d.cpuTemp, d.gpuTemp = 42, 38
+	d.lastThermal = d.start
+	d.procs = []demoProcess{
+		{pid: 1, user: "root", command: "launchd", rssKB: 12 << 10, vszKB: 400 << 10, cpuBase: 0.2, role: "idle"},
+		{pid: 142, user: "_windowserver", command: "WindowServer", rssKB: 380 << 10, vszKB: 12 << 20, cpuBase: 6, role: "display"},
+		{pid: 333, user: "root", command: "mds_stores", rssKB: 90 << 10, vszKB: 2 << 20, cpuBase: 1.5, role: "idle"},
+		{pid: 421, user: "_coreaudiod", command: "coreaudiod", rssKB: 24 << 10, vszKB: 900 << 10, cpuBase: 0.8, role: "idle"},
+		{pid: 873, user: d.user, command: "Safari", rssKB: 1200 << 10, vszKB: 24 << 20, cpuBase: 3, role: "idle"},
+		{pid: 1204, user: d.user, command: "Xcode", rssKB: 2100 << 10, vszKB: 36 << 20, cpuBase: 2, role: "idle"},
+		{pid: 2311, user: d.user, command: "swift-frontend", rssKB: 1500 << 10, vszKB: 8 << 20, cpuBase: 0, role: "build"},
+		{pid: 4242, user: d.user, command: "python3", rssKB: 18 << 20, vszKB: 96 << 20, cpuBase: 8, role: "train"},
+		{pid: 4300, user: d.user, command: "aned-client", rssKB: 300 << 10, vszKB: 3 << 20, cpuBase: 0.5, role: "ane"},
+		{pid: 5150, user: d.user, command: "mactop", rssKB: 60 << 10, vszKB: 1 << 20, cpuBase: 1, role: "idle"},
+	}
+	d.lastProcs = d.start
+	d.tbCounters = map[string]*ThunderboltNetStats{
+		"en2": {InterfaceName: "en2"},
+		"en3": {InterfaceName: "en3"},
+	}
+	d.lastTBStats = d.start
+	return nil
+}
+
+func (d *demoSource) Close() {}
+
+func (d *demoSource) SystemInfo() SystemInfo { return d.info }
+
+// phase reports whether t falls in the active part of a duty cycle, and how far
+// into that active window it is (0-1).
+func phase(t, period, duty float64) (bool, float64) {
+	pos := math.Mod(t, period) / period
+	if pos >= duty {
+		return false, 0
+	}
+	return true, pos / duty
+}
+
+func (d *demoSource) loadAt(t float64) demoLoad {
+	load := demoLoad{
+		eCores: make([]float64, d.info.ECoreCount),
+		pCores: make([]float64, d.info.PCoreCount),
+	}
+	var trainPos float64
+	load.training, trainPos = phase(t, demoTrainPeriod, 0.65)
+	load.compiling, _ = phase(t+30, demoBuildPeriod, 0.35)
+
+	for i := range load.eCores {
+		load.eCores[i] = 22 + 12*math.Sin(t/7+float64(i))
+	}
+	for i := range load.pCores {
+		base := 6 + 4*math.Sin(t/11+float64(i)*0.7)
+		if load.compiling {
+			base = 82 + 10*math.Sin(t/3+float64(i))
+		}
+		if load.training && i < 2 {
+			base = math.Max(base, 70)
+		}
+		load.pCores[i] = base
+	}
+
+	load.gpuActive = 4 + 3*math.Sin(t/5)
+	if load.training {
+		load.gpuActive = 95
+		// Periodic evaluation passes dip utilization for a few seconds.
+		if math.Mod(trainPos*demoTrainPeriod*0.65, 15) < 2 {
+			load.gpuActive = 45
+		}
+	}
+
+	if active, pos := phase(t+10, demoANEPeriod, 0.4); active {
+		load.aneW = 1.5 + 4*math.Sin(pos*math.Pi)
+	}
+	return load
+}
+
+func (d *demoSource) jitter(spread float64) float64 {
+	return (d.rng.Float64()*2 - 1) * spread
+}
+
+func clampPercent(v float64) float64 {
+	return math.Min(100, math.Max(0, v))
+}
+
+func (d *demoSource) elapsed() float64 {
+	return d.now().Sub(d.start).Seconds()
+}
+
+func (d *demoSource) SocMetrics(durationMs int) SocMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	load := d.loadAt(now.Sub(d.start).Seconds())
+
+	var eSum, pSum float64
+	for _, v := range load.eCores {
+		eSum += clampPercent(v + d.jitter(4))
+	}
+	for _, v := range load.pCores {
+		pSum += clampPercent(v + d.jitter(4))
+	}
+	eActive := eSum / float64(max(1, len(load.eCores)))
+	pActive := pSum / float64(max(1, len(load.pCores)))
+	gpuActive := clampPercent(load.gpuActive + d.jitter(2))
+
+	cpuW := 0.4 + eSum/100*0.3 + pSum/100*3.6
+	gpuW := 0.3 + gpuActive/100*42
+	gpuSRAMW := 0.1 + gpuActive/100*1.8
+	aneW := math.Max(0, load.aneW+d.jitter(0.2))
+	dramW := 1.1 + (pActive+gpuActive)/200*4.5
+	components := cpuW + gpuW + gpuSRAMW + aneW + dramW
+
+	d.advanceThermals(now, cpuW, gpuW)
+
+	return SocMetrics{
+		CPUPower:        cpuW,
+		GPUPower:        gpuW,
+		ANEPower:        aneW,
+		DRAMPower:       dramW,
+		GPUSRAMPower:    gpuSRAMW,
+		SystemPower:     components + 6 + d.jitter(0.8),
+		TotalPower:      components,
+		GPUFreqMHz:      int32(338 + gpuActive/100*(1578-338)),
+		GPUActive:       gpuActive,
+		EClusterActive:  eActive,
+		PClusterActive:  pActive,
+		EClusterFreqMHz: int32(1020 + eActive/100*(2592-1020)),
+		PClusterFreqMHz: int32(1260 + pActive/100*(4512-1260)),
+		SocTemp:         float32(math.Max(d.cpuTemp, d.gpuTemp)),
+		CPUTemp:         float32(d.cpuTemp),
+		GPUTemp:         float32(d.gpuTemp),
+	}
+}
+
+// advanceThermals moves the die temperatures toward the steady state implied by
+// the current power draw with a ~20s time constant. The clusters share a
+// package, so each one also warms with the other's load.
+func (d *demoSource) advanceThermals(now time.Time, cpuW, gpuW float64) {
+	dt := now.Sub(d.lastThermal).Seconds()
+	d.lastThermal = now
+	if dt <= 0 {
+		return
+	}
+	alpha := 1 - math.Exp(-dt/20)
+	d.cpuTemp += (40+cpuW*1.3+gpuW*0.3-d.cpuTemp)*alpha + d.jitter(0.3)
+	d.gpuTemp += (38+gpuW*1.2+cpuW*0.3-d.gpuTemp)*alpha + d.jitter(0.3)
+}
+
+func (d *demoSource) CPUPercentages() ([]float64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	load := d.loadAt(d.elapsed())
+	usages := make([]float64, 0, len(load.eCores)+len(load.pCores))
+	for _, v := range load.eCores {
+		usages = append(usages, clampPercent(v+d.jitter(6)))
+	}
+	for _, v := range load.pCores {
+		usages = append(usages, clampPercent(v+d.jitter(6)))
+	}
+	return usages, nil
+}
+
+func (d *demoSource) Memory() MemoryMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := d.elapsed()
+	load := d.loadAt(t)
+	used := 30.0 + 2*math.Sin(t/60)
+	if load.training {
+		used += 16
+	}
+	if load.compiling {
+		used += 4
+	}
+	usedBytes := uint64(used * (1 << 30))
+	var swapUsed uint64
+	if over := used - 46; over > 0 {
+		swapUsed = uint64(math.Min(over*(1<<30), demoSwapTotal))
+	}
+	return MemoryMetrics{
+		Total:     demoTotalMemory,
+		Used:      usedBytes,
+		Available: demoTotalMemory - usedBytes,
+		SwapTotal: demoSwapTotal,
+		SwapUsed:  swapUsed,
+	}
+}
+
+func (d *demoSource) NetDisk() NetDiskMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := d.elapsed()
+	load := d.loadAt(t)
+	inBytes := 180e3 + 120e3*math.Abs(math.Sin(t/4))
+	outBytes := 40e3 + 30e3*math.Abs(math.Sin(t/6))
+	readKB := 600 + 400*math.Abs(math.Sin(t/9))
+	writeKB := 300 + 200*math.Abs(math.Sin(t/13))
+	if starting, pos := phase(t, demoTrainPeriod, 0.1); starting && load.training {
+		// The training job streams its dataset in at the start of each run.
+		inBytes += 80e6 * (1 - pos)
+		readKB += 350e3 * (1 - pos)
+	}
+	if load.compiling {
+		readKB += 40e3
+		writeKB += 25e3
+	}
+	inBytes *= 1 + d.jitter(0.1)
+	outBytes *= 1 + d.jitter(0.1)
+	readKB *= 1 + d.jitter(0.1)
+	writeKB *= 1 + d.jitter(0.1)
+	return NetDiskMetrics{
+		InBytesPerSec:     inBytes,
+		OutBytesPerSec:    outBytes,
+		InPacketsPerSec:   inBytes / 1200,
+		OutPacketsPerSec:  outBytes / 900,
+		ReadKBytesPerSec:  readKB,
+		WriteKBytesPerSec: writeKB,
+		ReadOpsPerSec:     readKB / 64,
+		WriteOpsPerSec:    writeKB / 32,
+	}
+}
+
+func (d *demoSource) processCPU(p demoProcess, load demoLoad) float64 {
+	switch p.role {
+	case "build":
+		if load.compiling {
+			return 650 + d.jitter(80)
+		}
+		return 0
+	case "train":
+		if load.training {
+			return 140 + d.jitter(20)
+		}
+		return p.cpuBase + d.jitter(2)
+	case "ane":
+		return p.cpuBase + load.aneW*4 + d.jitter(0.5)
+	case "display":
+		return p.cpuBase + load.gpuActive/20 + d.jitter(1.5)
+	default:
+		return p.cpuBase + d.jitter(p.cpuBase/2)
+	}
+}
+
+func (d *demoSource) Processes(systemGpuPercent float64) ([]ProcessMetrics, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	dt := now.Sub(d.lastProcs).Seconds()
+	d.lastProcs = now
+	load := d.loadAt(now.Sub(d.start).Seconds())
+
+	gpuPercent := systemGpuPercent
+	if gpuPercent <= 0 {
+		gpuPercent = load.gpuActive
+	}
+
+	processes := make([]ProcessMetrics, 0, len(d.procs))
+	for i := range d.procs {
+		p := &d.procs[i]
+		cpu := math.Max(0, d.processCPU(*p, load))
+		p.cpuSeconds += cpu / 100 * math.Max(0, dt)
+
+		rss := p.rssKB
+		if p.role == "train" && !load.training {
+			rss /= 6
+		}
+		if p.role == "build" && !load.compiling {
+			continue
+		}
+
+		// GPU is tracked in ms/s of GPU time, the same unit the IOKit
+		// AGXDeviceUserClient accounting produces.
+		var gpu float64
+		switch p.role {
+		case "train":
+			if load.training {
+				gpu = gpuPercent * 10 * 0.92
+			}
+		case "display":
+			gpu = math.Min(gpuPercent*10, 25+d.rng.Float64()*10)
+		}
+
+		processes = append(processes, ProcessMetrics{
+			PID:         p.pid,
+			User:        p.user,
+			CPU:         cpu,
+			GPU:         gpu,
+			Memory:      float64(rss*1024) / demoTotalMemory * 100,
+			VSZ:         p.vszKB,
+			RSS:         rss,
+			Command:     p.command,
+			State:       "S",
+			Time:        formatTime(p.cpuSeconds),
+			LastUpdated: now,
+		})
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].CPU > processes[j].CPU
+	})
+	return processes, nil
+}
+
+func (d *demoSource) ThunderboltNetStats() []ThunderboltNetStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	dt := now.Sub(d.lastTBStats).Seconds()
+	d.lastTBStats = now
+	load := d.loadAt(now.Sub(d.start).Seconds())
+
+	names := make([]string, 0, len(d.tbCounters))
+	for name := range d.tbCounters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := make([]ThunderboltNetStats, 0, len(names))
+	for i, name := range names {
+		counter := d.tbCounters[name]
+		rate := 20e3 + d.rng.Float64()*10e3
+		if load.training {
+			// Gradient all-reduce across the bridge, split over both links.
+			rate = 1.8e9/float64(len(names)) + d.jitter(150e6) - float64(i)*50e6
+		}
+		if dt > 0 {
+			counter.BytesInPerSec = rate
+			counter.BytesOutPerSec = rate * 0.97
+			counter.BytesIn += uint64(counter.BytesInPerSec * dt)
+			counter.BytesOut += uint64(counter.BytesOutPerSec * dt)
+			counter.PacketsIn += uint64(counter.BytesInPerSec * dt / 9000)
+			counter.PacketsOut += uint64(counter.BytesOutPerSec * dt / 9000)
+		}
+		stats = append(stats, *counter)
+	}
+	return stats
+}
+
+func (d *demoSource) ThermalState() (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hottest := math.Max(d.cpuTemp, d.gpuTemp)
+	switch {
+	case hottest >= 105:
+		return "Critical", true
+	case hottest >= 98:
+		return "Serious", true
+	case hottest >= 88:
+		return "Fair", true
+	default:
+		return "Normal", false
+	}
+}
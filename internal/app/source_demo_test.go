@@ -0,0 +1,162 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestDemoSource(t *testing.T) (*demoSource, *time.Time) {
+	t.Helper()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	src := newDemoSource()
+	src.now = func() time.Time { return clock }
+	if err := src.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	return src, &clock
+}
+
+func TestNewMetricSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{"Demo", "demo", SourceDemo, false},
+		{"Demo uppercase", "DEMO", SourceDemo, false},
+		{"Unknown", "linux", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := newMetricSource(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newMetricSource(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+			}
+			if err == nil && src.Name() != tt.want {
+				t.Errorf("Name() = %q, want %q", src.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDemoSourceSamplesStayInRange(t *testing.T) {
+	src, clock := newTestDemoSource(t)
+	info := src.SystemInfo()
+
+	for step := 0; step < 300; step++ {
+		*clock = clock.Add(time.Second)
+
+		m := src.SocMetrics(updateInterval)
+		if m.GPUActive < 0 || m.GPUActive > 100 {
+			t.Fatalf("step %d: GPUActive = %.2f, want 0-100", step, m.GPUActive)
+		}
+		sum := m.CPUPower + m.GPUPower + m.ANEPower + m.DRAMPower + m.GPUSRAMPower
+		if diff := sum - m.TotalPower; diff > 1e-9 || diff < -1e-9 {
+			t.Fatalf("step %d: TotalPower = %.3f, components sum to %.3f", step, m.TotalPower, sum)
+		}
+		if m.SystemPower < m.TotalPower {
+			t.Fatalf("step %d: SystemPower %.2f below component total %.2f", step, m.SystemPower, m.TotalPower)
+		}
+		if m.CPUTemp < 20 || m.CPUTemp > 110 {
+			t.Fatalf("step %d: CPUTemp = %.1f out of plausible range", step, m.CPUTemp)
+		}
+
+		usages, err := src.CPUPercentages()
+		if err != nil {
+			t.Fatalf("CPUPercentages() error = %v", err)
+		}
+		if len(usages) != info.ECoreCount+info.PCoreCount {
+			t.Fatalf("len(CPUPercentages()) = %d, want %d", len(usages), info.ECoreCount+info.PCoreCount)
+		}
+		for i, u := range usages {
+			if u < 0 || u > 100 {
+				t.Fatalf("step %d: core %d usage = %.2f", step, i, u)
+			}
+		}
+
+		mem := src.Memory()
+		if mem.Used > mem.Total || mem.SwapUsed > mem.SwapTotal {
+			t.Fatalf("step %d: memory out of bounds: %+v", step, mem)
+		}
+	}
+}
+
+func TestDemoSourceProducesLoadCycles(t *testing.T) {
+	src, clock := newTestDemoSource(t)
+
+	var sawTraining, sawIdle, sawThrottle bool
+	for step := 0; step < int(demoTrainPeriod)*2; step++ {
+		*clock = clock.Add(time.Second)
+		m := src.SocMetrics(updateInterval)
+		if m.GPUActive > 80 {
+			sawTraining = true
+		}
+		if m.GPUActive < 15 {
+			sawIdle = true
+		}
+		if _, throttled := src.ThermalState(); throttled {
+			sawThrottle = true
+		}
+	}
+
+	if !sawTraining || !sawIdle {
+		t.Errorf("expected both busy and idle GPU phases, training=%v idle=%v", sawTraining, sawIdle)
+	}
+	if !sawThrottle {
+		t.Error("expected sustained training load to raise the thermal state")
+	}
+}
+
+func TestDemoSourceProcesses(t *testing.T) {
+	src, clock := newTestDemoSource(t)
+	*clock = clock.Add(2 * time.Second)
+
+	procs, err := src.Processes(0)
+	if err != nil {
+		t.Fatalf("Processes() error = %v", err)
+	}
+	if len(procs) == 0 {
+		t.Fatal("expected synthetic processes")
+	}
+	for i := 1; i < len(procs); i++ {
+		if procs[i-1].CPU < procs[i].CPU {
+			t.Fatalf("processes not sorted by CPU: %.1f before %.1f", procs[i-1].CPU, procs[i].CPU)
+		}
+	}
+
+	var trainer *ProcessMetrics
+	for i := range procs {
+		if procs[i].Command == "python3" {
+			trainer = &procs[i]
+		}
+	}
+	if trainer == nil {
+		t.Fatal("expected the training process in the list")
+	}
+	if trainer.GPU <= 0 {
+		t.Errorf("training process GPU = %.1f ms/s, want > 0 while training", trainer.GPU)
+	}
+}
+
+func TestDemoSourceThunderboltCounters(t *testing.T) {
+	src, clock := newTestDemoSource(t)
+
+	*clock = clock.Add(time.Second)
+	first := src.ThunderboltNetStats()
+	*clock = clock.Add(time.Second)
+	second := src.ThunderboltNetStats()
+
+	if len(first) != len(second) || len(first) == 0 {
+		t.Fatalf("expected a stable set of interfaces, got %d then %d", len(first), len(second))
+	}
+	for i := range second {
+		if second[i].BytesIn < first[i].BytesIn {
+			t.Errorf("%s: BytesIn went backwards (%d -> %d)", second[i].InterfaceName, first[i].BytesIn, second[i].BytesIn)
+		}
+		if second[i].BytesInPerSec <= 0 {
+			t.Errorf("%s: BytesInPerSec = %.0f, want > 0", second[i].InterfaceName, second[i].BytesInPerSec)
+		}
+	}
+}
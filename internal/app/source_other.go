@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package app
+
+import "fmt"
+
+const defaultMetricSource = SourceDemo
+
+func newDarwinSource() (MetricSource, error) {
+	return nil, fmt.Errorf("the %s metric source requires macOS on Apple Silicon; use --source %s", SourceDarwin, SourceDemo)
+}
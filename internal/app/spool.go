@@ -0,0 +1,251 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spoolSenderQueue is how many batches may wait for the delivery goroutine
+// before new ones go straight to the spool.
+const spoolSenderQueue = 16
+
+// defaultSpoolDir is ~/.mactop/spool/<name>.
+func defaultSpoolDir(name string) string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = os.TempDir()
+	}
+	return filepath.Join(homeDir, ".mactop", "spool", name)
+}
+
+// diskSpool keeps undelivered batches as one file each, named so that they
+// sort oldest first, dropping the oldest once the directory grows past
+// maxBytes.
+type diskSpool struct {
+	dir      string
+	ext      string
+	maxBytes int64
+}
+
+func newDiskSpool(dir, ext string, maxBytes int64) (*diskSpool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %v", err)
+	}
+	return &diskSpool{dir: dir, ext: ext, maxBytes: maxBytes}, nil
+}
+
+// List returns the spooled batches, oldest first.
+func (s *diskSpool) List() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+s.ext))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Put stores a batch made at `at` and trims the spool back under maxBytes.
+// Batches are named after the time they were made, so they sort in the order
+// they are to be sent whenever they were spooled.
+func (s *diskSpool) Put(at time.Time, body []byte) error {
+	name := fmt.Sprintf("%020d%s", at.UnixNano(), s.ext)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, body, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		return err
+	}
+	return s.trim()
+}
+
+func (s *diskSpool) trim() error {
+	if s.maxBytes <= 0 {
+		return nil
+	}
+	paths, err := s.List()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(paths))
+	var total int64
+	for i, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	dropped := 0
+	for i := 0; i < len(paths)-1 && total > s.maxBytes; i++ {
+		if err := os.Remove(paths[i]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		total -= sizes[i]
+		dropped++
+	}
+	if dropped > 0 {
+		stderrLogger.Printf("Spool %s full, dropped %d oldest batch(es)\n", s.dir, dropped)
+	}
+	return nil
+}
+
+// batchTime is the time the batch at path was made.
+func (s *diskSpool) batchTime(path string) time.Time {
+	ns, _ := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), s.ext), 10, 64)
+	return time.Unix(0, ns)
+}
+
+// Len is the number of spooled batches.
+func (s *diskSpool) Len() int {
+	paths, _ := s.List()
+	return len(paths)
+}
+
+// spoolSender delivers batches with post, retrying transient failures with
+// exponential backoff, and spools those it cannot deliver. Errors wrapping
+// rejected mean retrying will not help, and such batches are dropped.
+//
+// Once Start has been called, batches are delivered by a goroutine of their
+// own, so a slow or unreachable endpoint never holds up the caller.
+type spoolSender struct {
+	spool      *diskSpool
+	post       func(ctx context.Context, body []byte) error
+	rejected   error
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	name       string // what a batch is called in log lines
+
+	queue   chan spoolBatch
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// spoolBatch is an encoded batch and the time it was made.
+type spoolBatch struct {
+	at   time.Time
+	body []byte
+}
+
+// Start runs the delivery goroutine. Deliver then only queues batches.
+func (s *spoolSender) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	queue, stopped := make(chan spoolBatch, spoolSenderQueue), make(chan struct{})
+	s.queue, s.cancel, s.stopped = queue, cancel, stopped
+	go func() {
+		defer close(stopped)
+		for b := range queue {
+			s.deliver(ctx, b)
+		}
+	}()
+}
+
+// Stop waits up to wait for the queued batches to be delivered. Whatever is
+// left after that is spooled for the next run.
+func (s *spoolSender) Stop(wait time.Duration) {
+	close(s.queue)
+	s.queue = nil
+	select {
+	case <-s.stopped:
+	case <-time.After(wait):
+		s.cancel()
+		<-s.stopped
+	}
+	s.cancel()
+}
+
+// Deliver sends body, or hands it to the delivery goroutine once Start has
+// been called. It does not block then: while the goroutine is behind, body
+// is spooled instead and ctx is not used.
+func (s *spoolSender) Deliver(ctx context.Context, body []byte) {
+	b := spoolBatch{at: time.Now(), body: body}
+	if s.queue == nil {
+		s.deliver(ctx, b)
+		return
+	}
+	select {
+	case s.queue <- b:
+	default:
+		s.put(b)
+	}
+}
+
+// deliver sends the spooled batches older than b, then b, so the endpoint
+// sees them in order. While the spool is still failing, b is spooled behind
+// it without another round of retries. Batches spooled after b, because the
+// queue was full, wait for the next one.
+func (s *spoolSender) deliver(ctx context.Context, b spoolBatch) {
+	if err := s.drain(ctx, b.at); err != nil {
+		s.put(b)
+		return
+	}
+	if err := s.send(ctx, b.body); err != nil {
+		if errors.Is(err, s.rejected) {
+			stderrLogger.Printf("Dropping %s: %v\n", s.name, err)
+			return
+		}
+		stderrLogger.Printf("Could not deliver %s, spooling it: %v\n", s.name, err)
+		s.put(b)
+	}
+}
+
+func (s *spoolSender) put(b spoolBatch) {
+	if err := s.spool.Put(b.at, b.body); err != nil {
+		stderrLogger.Printf("Error spooling %s: %v\n", s.name, err)
+	}
+}
+
+// drain sends the batches spooled before `before`, oldest first, and stops
+// at the first one that still fails.
+func (s *spoolSender) drain(ctx context.Context, before time.Time) error {
+	paths, err := s.spool.List()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if !s.spool.batchTime(path).Before(before) {
+			break
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			os.Remove(path)
+			continue
+		}
+		if err := s.send(ctx, body); err != nil {
+			if !errors.Is(err, s.rejected) {
+				return err
+			}
+			stderrLogger.Printf("Dropping spooled %s: %v\n", s.name, err)
+		}
+		os.Remove(path)
+	}
+	return nil
+}
+
+// send posts body, retrying transient failures with exponential backoff
+// until retries is reached or ctx ends.
+func (s *spoolSender) send(ctx context.Context, body []byte) error {
+	delay := s.backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = s.post(ctx, body); err == nil || errors.Is(err, s.rejected) {
+			return err
+		}
+		if attempt >= s.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, s.maxBackoff)
+	}
+}
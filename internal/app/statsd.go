@@ -0,0 +1,226 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// statsdMaxPacket keeps datagrams within a typical 1500 byte MTU after IP and
+// UDP headers, as the DogStatsD clients do.
+const statsdMaxPacket = 1432
+
+// statsdSkip lists HeadlessOutput fields that are not plain gauges. Core
+// usages get their own tagged gauge; the cluster arrays repeat soc_metrics.
+var statsdSkip = map[string]bool{
+	"schema_version":   true,
+	"timestamp":        true,
+	"system_info":      true,
+	"thunderbolt_info": true,
+	"core_usages":      true,
+	"ecpu_usage":       true,
+	"pcpu_usage":       true,
+	"alerts":           true,
+	"thermal_state":    true,
+}
+
+var (
+	statsdNameSanitizer = strings.NewReplacer(":", "_", "|", "_", "@", "_", " ", "_", "\n", "_")
+	statsdTagSanitizer  = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_", "\n", "_")
+)
+
+// statsdSink sends every sample as StatsD gauges over UDP.
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+	// tags are sent with every gauge in DogStatsD format. plain drops all
+	// tags for servers that only speak the original StatsD protocol.
+	tags  []string
+	plain bool
+}
+
+func newStatsdSink(addr, prefix string, extraTags []string, plain bool) (*statsdSink, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid address %q: expected host:port", addr)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdSink{conn: conn, prefix: strings.TrimSuffix(prefix, "."), tags: extraTags, plain: plain}, nil
+}
+
+// parseStatsdTags splits "team:ci,env:prod" into tags.
+func parseStatsdTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, statsdTagSanitizer.Replace(t))
+		}
+	}
+	return tags
+}
+
+func statsdLine(name string, value float64, tags []string) string {
+	line := statsdNameSanitizer.Replace(name) + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|g"
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// flattenStatsd walks a decoded JSON sample and collects every number and
+// boolean under its dotted field path.
+func flattenStatsd(prefix string, node any, out map[string]float64) {
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if prefix == "" && statsdSkip[k] {
+				continue
+			}
+			name := k
+			if prefix != "" {
+				name = prefix + "." + k
+			}
+			flattenStatsd(name, child, out)
+		}
+	case float64:
+		out[prefix] = v
+	case bool:
+		out[prefix] = 0
+		if v {
+			out[prefix] = 1
+		}
+	}
+}
+
+// statsdLines renders one sample as gauge lines, sorted by name. Core usage
+// is one gauge tagged by core label and type, or one gauge per core label
+// when tags are off.
+func statsdLines(o HeadlessOutput, prefix string, tags []string, plain bool, coreLabels []string) ([]string, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	values := map[string]float64{}
+	flattenStatsd("", doc, values)
+	values["thermal_level"] = float64(thermalStateLevel(o.ThermalState))
+	values["alerts_firing"] = float64(len(o.Alerts))
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if plain {
+		tags = nil
+	}
+	lines := make([]string, 0, len(names)+len(o.CoreUsages))
+	for _, name := range names {
+		lines = append(lines, statsdLine(prefix+"."+name, values[name], tags))
+	}
+	for i, usage := range o.CoreUsages {
+		label := strconv.Itoa(i)
+		if i < len(coreLabels) && coreLabels[i] != "" {
+			label = coreLabels[i]
+		}
+		if plain {
+			lines = append(lines, statsdLine(prefix+".core_usage."+label, usage, nil))
+			continue
+		}
+		coreTags := append(tags[:len(tags):len(tags)], "core:"+label)
+		switch label[0] {
+		case 'E':
+			coreTags = append(coreTags, "core_type:e")
+		case 'P':
+			coreTags = append(coreTags, "core_type:p")
+		}
+		lines = append(lines, statsdLine(prefix+".core_usage", usage, coreTags))
+	}
+	return lines, nil
+}
+
+// packStatsd joins lines with newlines into packets of at most maxSize
+// bytes. A line longer than maxSize is sent on its own.
+func packStatsd(lines []string, maxSize int) [][]byte {
+	var packets [][]byte
+	var cur []byte
+	for _, line := range lines {
+		if len(cur) > 0 && len(cur)+1+len(line) > maxSize {
+			packets = append(packets, cur)
+			cur = nil
+		}
+		if len(cur) > 0 {
+			cur = append(cur, '\n')
+		}
+		cur = append(cur, line...)
+	}
+	if len(cur) > 0 {
+		packets = append(packets, cur)
+	}
+	return packets
+}
+
+// Send writes one sample.
+func (s *statsdSink) Send(o HeadlessOutput, coreLabels []string) error {
+	lines, err := statsdLines(o, s.prefix, s.tags, s.plain, coreLabels)
+	if err != nil {
+		return err
+	}
+	for _, p := range packStatsd(lines, statsdMaxPacket) {
+		if _, err := s.conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStatsdSink sends every snapshot it receives, including any still queued
+// when done is closed.
+func runStatsdSink(done chan struct{}, s *statsdSink, sub *Subscription) {
+	defer s.conn.Close()
+	info := metricSource.SystemInfo()
+	labels := coreLabelsByIndex(info)
+	if !s.plain {
+		host, _ := os.Hostname()
+		s.tags = append([]string{
+			"model:" + statsdTagSanitizer.Replace(info.Name),
+			"host:" + statsdTagSanitizer.Replace(host),
+		}, s.tags...)
+	}
+
+	failing := false
+	send := func(snap Snapshot) {
+		err := s.Send(buildHeadlessOutput(snap, info, nil), labels)
+		if err != nil && !failing {
+			stderrLogger.Printf("StatsD send failed: %v\n", err)
+		}
+		failing = err != nil
+	}
+	for {
+		select {
+		case <-done:
+		drain:
+			for {
+				select {
+				case snap := <-sub.C:
+					send(snap)
+				default:
+					break drain
+				}
+			}
+			return
+		case snap := <-sub.C:
+			send(snap)
+		}
+	}
+}
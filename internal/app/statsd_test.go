@@ -0,0 +1,114 @@
+package app
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsdLines(t *testing.T) {
+	o := buildHeadlessOutput(Snapshot{
+		CapturedAt:   time.Now(),
+		Soc:          SocMetrics{CPUPower: 4.5},
+		CoreUsages:   []float64{10, 90},
+		Memory:       MemoryMetrics{SwapUsed: 1 << 20},
+		ThermalState: "Serious",
+	}, SystemInfo{Name: "M4", CoreCount: 2, ECoreCount: 1, PCoreCount: 1}, nil)
+
+	tests := []struct {
+		name  string
+		plain bool
+		want  []string
+	}{
+		{"DogStatsD", false, []string{
+			"mactop.soc_metrics.cpu_power:4.5|g|#model:M4",
+			"mactop.memory.swap_used:1048576|g|#model:M4",
+			"mactop.rdma_status.available:0|g|#model:M4",
+			"mactop.thermal_level:2|g|#model:M4",
+			"mactop.core_usage:10|g|#model:M4,core:E0,core_type:e",
+			"mactop.core_usage:90|g|#model:M4,core:P0,core_type:p",
+		}},
+		{"Plain", true, []string{
+			"mactop.soc_metrics.cpu_power:4.5|g",
+			"mactop.core_usage.E0:10|g",
+			"mactop.core_usage.P0:90|g",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := statsdLines(o, "mactop", []string{"model:M4"}, tt.plain, []string{"E0", "P0"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := "\n" + strings.Join(lines, "\n") + "\n"
+			for _, want := range tt.want {
+				if !strings.Contains(got, "\n"+want+"\n") {
+					t.Errorf("missing %q in:%s", want, got)
+				}
+			}
+			for _, skipped := range []string{"schema_version", "system_info", "timestamp", "ecpu_usage", "thunderbolt_info"} {
+				if strings.Contains(got, skipped) {
+					t.Errorf("output contains skipped field %s", skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestPackStatsd(t *testing.T) {
+	lines := []string{strings.Repeat("a", 600), strings.Repeat("b", 600), strings.Repeat("c", 600), strings.Repeat("d", 2000)}
+	packets := packStatsd(lines, statsdMaxPacket)
+	if len(packets) != 3 {
+		t.Fatalf("got %d packets, want 3", len(packets))
+	}
+	if got := string(packets[0]); got != lines[0]+"\n"+lines[1] {
+		t.Errorf("first packet is %d bytes, want the first two lines", len(got))
+	}
+	if len(packets[2]) != 2000 {
+		t.Errorf("oversized line was split or merged: %d bytes", len(packets[2]))
+	}
+}
+
+func TestStatsdSinkSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := newStatsdSink(conn.LocalAddr().String(), "mac.", []string{"team:ci"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.conn.Close()
+
+	o := HeadlessOutput{CoreUsages: make([]float64, 64)}
+	if err := s.Send(o, nil); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	var received []string
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > statsdMaxPacket {
+			t.Errorf("packet of %d bytes exceeds %d", n, statsdMaxPacket)
+		}
+		received = append(received, strings.Split(string(buf[:n]), "\n")...)
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	}
+
+	want, _ := statsdLines(o, "mac", []string{"team:ci"}, false, nil)
+	if len(received) != len(want) {
+		t.Fatalf("received %d lines, want %d", len(received), len(want))
+	}
+	if received[len(received)-1] != "mac.core_usage:0|g|#team:ci,core:63" {
+		t.Errorf("last line = %q", received[len(received)-1])
+	}
+}
@@ -1,3 +1,5 @@
+//go:build darwin
+
 package app
 
 /*
@@ -15,14 +17,6 @@ import (
 	"unsafe"
 )
 
-type VolumeInfo struct {
-	Name      string
-	Total     float64
-	Used      float64
-	Available float64
-	UsedPct   float64
-}
-
 func getVolumes() []VolumeInfo {
 	var volumes []VolumeInfo
 	partitions, err := GetNativePartitions(false)
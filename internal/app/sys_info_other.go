@@ -0,0 +1,15 @@
+//go:build !darwin
+
+package app
+
+func getVolumes() []VolumeInfo {
+	return nil
+}
+
+func getSOCInfo() SystemInfo {
+	return SystemInfo{}
+}
+
+func getThermalStateString() (string, bool) {
+	return "Normal", false
+}
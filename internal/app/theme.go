@@ -466,6 +466,7 @@ func applyCatppuccinFullTheme(colorName string, palette *CatppuccinPalette, ligh
 }
 
 func applyTheme(colorName string, lightMode bool) {
+	defer publishWebTheme()
 	color, resolvedName := resolveThemeColor(colorName)
 	currentConfig.Theme = resolvedName
 	color = setLightModeColors(lightMode, color)
@@ -623,25 +624,8 @@ func cycleBackground() {
 // applyBackground sets the terminal background color
 // Accepts named backgrounds (from bgColorMap) or hex colors
 func applyBackground(bgName string) {
-	var bgColor ui.Color
-	var ok bool
-
-	// Check if bgName is a hex color
-	if IsHexColor(bgName) {
-		if parsed, err := ParseHexColor(bgName); err == nil {
-			bgColor = parsed
-			ok = true
-		}
-	}
-
-	// Try named background lookup if not a hex color
-	if !ok {
-		bgColor, ok = bgColorMap[bgName]
-	}
-
-	if !ok {
-		bgColor = ui.ColorClear
-	}
+	defer publishWebTheme()
+	bgColor := resolveBackgroundColor(bgName)
 
 	// Store current background color globally
 	CurrentBgColor = bgColor
@@ -660,6 +644,21 @@ func applyBackground(bgName string) {
 	applyBackgroundToStepCharts(bgColor)
 }
 
+// resolveBackgroundColor resolves a background name or hex color to a
+// ui.Color, falling back to clear
+func resolveBackgroundColor(bgName string) ui.Color {
+	// Check if bgName is a hex color
+	if IsHexColor(bgName) {
+		if parsed, err := ParseHexColor(bgName); err == nil {
+			return parsed
+		}
+	}
+	if bgColor, ok := bgColorMap[bgName]; ok {
+		return bgColor
+	}
+	return ui.ColorClear
+}
+
 func applyBackgroundToBlocks(bgColor ui.Color) {
 	if mainBlock != nil {
 		mainBlock.BackgroundColor = bgColor
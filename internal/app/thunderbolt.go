@@ -3,6 +3,7 @@ package app
 import (
 	"fmt"
 	"os/exec"
+	"slices"
 	"strings"
 )
 
@@ -174,6 +175,15 @@ type ThunderboltOutput struct {
 	Buses []ThunderboltBusOutput `json:"buses"`
 }
 
+// clone copies o and its buses, which buildHeadlessOutput annotates with the
+// network and RDMA details of each sample. The devices are shared.
+func (o *ThunderboltOutput) clone() *ThunderboltOutput {
+	if o == nil {
+		return nil
+	}
+	return &ThunderboltOutput{Buses: slices.Clone(o.Buses)}
+}
+
 type ThunderboltBusOutput struct {
 	Name         string                    `json:"name"`
 	Status       string                    `json:"status"` // Active, Inactive
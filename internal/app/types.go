@@ -34,6 +34,25 @@ type SystemInfo struct {
 	GPUCoreCount int    `json:"gpu_core_count"`
 }
 
+type SocMetrics struct {
+	CPUPower        float64 `json:"cpu_power"`
+	GPUPower        float64 `json:"gpu_power"`
+	ANEPower        float64 `json:"ane_power"`
+	DRAMPower       float64 `json:"dram_power"`
+	GPUSRAMPower    float64 `json:"gpu_sram_power"`
+	SystemPower     float64 `json:"system_power"`
+	TotalPower      float64 `json:"total_power"`
+	GPUFreqMHz      int32   `json:"gpu_freq_mhz"`
+	GPUActive       float64 `json:"-"`
+	EClusterActive  float64 `json:"e_cluster_active"`
+	PClusterActive  float64 `json:"p_cluster_active"`
+	EClusterFreqMHz int32   `json:"e_cluster_freq_mhz"`
+	PClusterFreqMHz int32   `json:"p_cluster_freq_mhz"`
+	SocTemp         float32 `json:"soc_temp"`
+	CPUTemp         float32 `json:"cpu_temp"`
+	GPUTemp         float32 `json:"gpu_temp"`
+}
+
 type NetDiskMetrics struct {
 	OutPacketsPerSec  float64 `json:"out_packets_per_sec"`
 	OutBytesPerSec    float64 `json:"out_bytes_per_sec"`
@@ -55,6 +74,7 @@ type GPUMetrics struct {
 type ProcessMetrics struct {
 	PID                                      int
 	CPU, LastTime, Memory, GPU               float64 // GPU is ms/s of GPU time
+	Watts, Energy                            float64 // attributed W and J since first seen
 	VSZ, RSS                                 int64
 	User, TTY, State, Started, Time, Command string
 	LastUpdated                              time.Time
@@ -68,6 +88,14 @@ type MemoryMetrics struct {
 	SwapUsed  uint64 `json:"swap_used"`
 }
 
+type VolumeInfo struct {
+	Name      string
+	Total     float64
+	Used      float64
+	Available float64
+	UsedPct   float64
+}
+
 type EventThrottler struct {
 	timer       *time.Timer
 	gracePeriod time.Duration
@@ -114,8 +142,22 @@ func (e *EventThrottler) Notify() {
 }
 
 func NewCPUCoreWidget(modelInfo SystemInfo) *CPUCoreWidget {
-	modelName := modelInfo.Name
+	labels, eCount, pCount, cpuIndexMap := resolveCoreLabels(modelInfo)
+
+	return &CPUCoreWidget{
+		Block:       ui.NewBlock(),
+		cores:       make([]float64, len(labels)),
+		labels:      labels,
+		eCoreCount:  eCount,
+		pCoreCount:  pCount,
+		modelName:   modelInfo.Name,
+		cpuIndexMap: cpuIndexMap,
+	}
+}
 
+// resolveCoreLabels returns the E/P core labels in display order, the E and P
+// counts, and the display index to Mach API index map.
+func resolveCoreLabels(modelInfo SystemInfo) ([]string, int, int, []int) {
 	// Use dynamic core topology detection from IORegistry
 	labels, eCount, pCount, cpuIndexMap := BuildCoreLabels()
 
@@ -138,18 +180,20 @@ func NewCPUCoreWidget(modelInfo SystemInfo) *CPUCoreWidget {
 		eCount = eCoreCount
 		pCount = pCoreCount
 	}
+	return labels, eCount, pCount, cpuIndexMap
+}
 
-	totalCores := len(labels)
-
-	return &CPUCoreWidget{
-		Block:       ui.NewBlock(),
-		cores:       make([]float64, totalCores),
-		labels:      labels,
-		eCoreCount:  eCount,
-		pCoreCount:  pCount,
-		modelName:   modelName,
-		cpuIndexMap: cpuIndexMap,
+// coreLabelsByIndex returns the E/P label of each entry of CoreUsages, which
+// is in Mach API order.
+func coreLabelsByIndex(modelInfo SystemInfo) []string {
+	labels, _, _, cpuIndexMap := resolveCoreLabels(modelInfo)
+	byIndex := make([]string, len(labels))
+	for displayIdx, cpuIdx := range cpuIndexMap {
+		if cpuIdx < len(byIndex) {
+			byIndex[cpuIdx] = labels[displayIdx]
+		}
 	}
+	return byIndex
 }
 
 func (w *CPUCoreWidget) UpdateUsage(usage []float64) {
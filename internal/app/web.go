@@ -0,0 +1,104 @@
+package app
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	ui "github.com/metaspartan/gotui/v5"
+)
+
+// webHistoryWindow is how much history the dashboard charts load when the
+// page is opened.
+const webHistoryWindow = 10 * time.Minute
+
+//go:embed web
+var webFiles embed.FS
+
+// webThemeColors is the body of the dashboard's /theme endpoint. Empty
+// colors mean the terminal default, which the page picks from Light.
+type webThemeColors struct {
+	Foreground string `json:"foreground"`
+	Background string `json:"background"`
+	Light      bool   `json:"light"`
+}
+
+// webTheme is the active theme as last applied by the TUI. It is read by
+// HTTP handlers, so it is swapped rather than modified.
+var webTheme atomic.Pointer[webThemeColors]
+
+func colorHex(c ui.Color) string {
+	if h := c.Hex(); h >= 0 {
+		return fmt.Sprintf("#%06X", h)
+	}
+	return ""
+}
+
+// publishWebTheme records the current foreground and background for the
+// dashboard.
+func publishWebTheme() {
+	webTheme.Store(&webThemeColors{
+		Foreground: colorHex(GetThemeColorWithLightMode(currentConfig.Theme, IsLightMode)),
+		Background: colorHex(CurrentBgColor),
+		Light:      IsLightMode,
+	})
+}
+
+// configuredWebTheme resolves the theme from theme.json and the saved config
+// for modes that never apply a theme, such as --headless.
+func configuredWebTheme() *webThemeColors {
+	fg, bg := currentConfig.Theme, currentConfig.Background
+	if theme := loadThemeFile(); theme != nil {
+		if IsHexColor(theme.Foreground) {
+			fg = theme.Foreground
+		}
+		if IsHexColor(theme.Background) {
+			bg = theme.Background
+		}
+	}
+	return &webThemeColors{
+		Foreground: colorHex(GetThemeColorWithLightMode(fg, IsLightMode)),
+		Background: colorHex(resolveBackgroundColor(bg)),
+		Light:      IsLightMode,
+	}
+}
+
+// webHandler serves the embedded dashboard at / on top of the serve API.
+func webHandler(api *serveAPI) http.Handler {
+	mux := http.NewServeMux()
+	api.register(mux)
+	static, _ := fs.Sub(webFiles, "web")
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.HandleFunc("/theme", func(w http.ResponseWriter, r *http.Request) {
+		theme := webTheme.Load()
+		if theme == nil {
+			theme = configuredWebTheme()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(theme)
+	})
+	return mux
+}
+
+// startWebDashboard serves the dashboard on addr until the process exits. It
+// shares metricsSrv with --prometheus, creating it if needed, so it must run
+// before the metrics server is subscribed to the bus.
+func startWebDashboard(done chan struct{}, addr string) {
+	if metricsSrv == nil {
+		metricsSrv = &metricsServer{}
+	}
+	api := newServeAPI(metricsSrv, snapshotBus, metricSource.SystemInfo(), webHistoryWindow, done)
+	go api.run(snapshotBus.Subscribe("web", 16))
+
+	addr = metricsListenAddr(addr)
+	go func() {
+		if err := http.ListenAndServe(addr, webHandler(api)); err != nil {
+			stderrLogger.Printf("Failed to start web dashboard: %v\n", err)
+		}
+	}()
+	stderrLogger.Printf("Web dashboard available at http://%s/\n", metricsDisplayAddr(addr))
+}
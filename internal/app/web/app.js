@@ -0,0 +1,303 @@
+// mactop web dashboard. Everything is served by the mactop binary itself:
+// /theme for colors, /history to fill the charts on load, /stream for live
+// samples and /processes for the process table.
+"use strict";
+
+const WINDOW_MS = 10 * 60 * 1000;
+const GB = 1024 * 1024 * 1024;
+
+const series = {
+  cpu: [],   // cpu_usage %
+  gpu: [],   // gpu_usage %
+  power: [], // soc_metrics.total_power W
+  mem: [],   // memory.used bytes
+  swap: [],  // memory.swap_used bytes
+};
+let memTotal = 0;
+let maxPower = 0.1;
+
+const $ = (id) => document.getElementById(id);
+
+function fmtBytes(n) {
+  if (n >= GB) return (n / GB).toFixed(1) + "G";
+  if (n >= 1024 * 1024) return (n / 1024 / 1024).toFixed(0) + "M";
+  return (n / 1024).toFixed(0) + "K";
+}
+
+// Theme
+
+function applyTheme(t) {
+  const root = document.documentElement.style;
+  const light = t.light;
+  root.setProperty("--fg", t.foreground || (light ? "#020202" : "#00ff00"));
+  root.setProperty("--bg", t.background || (light ? "#ffffff" : "#0d0d13"));
+  root.setProperty("--text", light ? "#020202" : "#c0c0c0");
+  root.setProperty("--dim", light ? "#606060" : "#808080");
+  drawCharts();
+}
+
+function loadTheme() {
+  fetch("theme").then((r) => r.json()).then(applyTheme).catch(() => {});
+}
+
+// Gauges
+
+function setGauge(id, percent, label) {
+  const el = $(id);
+  el.querySelector(".fill").style.width = Math.max(0, Math.min(100, percent)) + "%";
+  el.querySelector(".label").textContent = label;
+}
+
+function updateGauges(s) {
+  const soc = s.soc_metrics;
+  const info = s.system_info;
+  setGauge("gauge-cpu", s.cpu_usage,
+    `${info.core_count} Cores (${info.e_core_count}E/${info.p_core_count}P) ${s.cpu_usage.toFixed(2)}%`);
+  setGauge("gauge-gpu", s.gpu_usage, `${s.gpu_usage.toFixed(0)}% @ ${soc.gpu_freq_mhz} MHz`);
+  const ane = soc.ane_power / 8.0 * 100;
+  setGauge("gauge-ane", ane, `${ane.toFixed(2)}% @ ${soc.ane_power.toFixed(2)} W`);
+  const m = s.memory;
+  setGauge("gauge-mem", m.total ? m.used / m.total * 100 : 0,
+    `${(m.used / GB).toFixed(2)} / ${(m.total / GB).toFixed(2)} GB (Swap ${(m.swap_used / GB).toFixed(2)} GB)`);
+
+  $("model").textContent = `${info.name} · ${s.thermal_state}`;
+  const status = $("status");
+  status.textContent = `${soc.total_power.toFixed(2)} W · ${new Date(s.timestamp).toLocaleTimeString()}`;
+  status.className = "live";
+}
+
+// History charts
+
+function push(name, t, v) {
+  const pts = series[name];
+  pts.push({ t, v });
+  while (pts.length && pts[0].t < t - WINDOW_MS) pts.shift();
+}
+
+function record(s) {
+  const t = Date.parse(s.timestamp);
+  push("cpu", t, s.cpu_usage);
+  push("gpu", t, s.gpu_usage);
+  push("power", t, s.soc_metrics.total_power);
+  push("mem", t, s.memory.used);
+  push("swap", t, s.memory.swap_used);
+  memTotal = s.memory.total;
+  maxPower = Math.max(maxPower, s.soc_metrics.total_power);
+}
+
+function stats(pts) {
+  if (!pts.length) return { last: 0, avg: 0, max: 0 };
+  let sum = 0, max = 0;
+  for (const p of pts) { sum += p.v; max = Math.max(max, p.v); }
+  return { last: pts[pts.length - 1].v, avg: sum / pts.length, max };
+}
+
+// stepChart draws each series as a step line over the last WINDOW_MS,
+// newest on the right, like the TUI's StepChart.
+function stepChart(canvas, lines, maxVal) {
+  const dpr = window.devicePixelRatio || 1;
+  const w = canvas.clientWidth, h = canvas.clientHeight;
+  canvas.width = w * dpr;
+  canvas.height = h * dpr;
+  const ctx = canvas.getContext("2d");
+  ctx.scale(dpr, dpr);
+  ctx.clearRect(0, 0, w, h);
+
+  const style = getComputedStyle(document.documentElement);
+  const fg = style.getPropertyValue("--fg").trim();
+  const now = Date.now();
+  const x = (t) => w - (now - t) / WINDOW_MS * w;
+  const y = (v) => h - 1 - Math.min(v / (maxVal || 1), 1) * (h - 2);
+
+  lines.forEach((pts, i) => {
+    if (!pts.length) return;
+    ctx.beginPath();
+    ctx.moveTo(x(pts[0].t), y(pts[0].v));
+    for (let j = 1; j < pts.length; j++) {
+      ctx.lineTo(x(pts[j].t), y(pts[j - 1].v));
+      ctx.lineTo(x(pts[j].t), y(pts[j].v));
+    }
+    ctx.lineTo(w, y(pts[pts.length - 1].v));
+    ctx.strokeStyle = fg;
+    ctx.globalAlpha = i === 0 ? 1 : 0.5;
+    ctx.lineWidth = 1.5;
+    ctx.stroke();
+    ctx.lineTo(w, h);
+    ctx.lineTo(x(pts[0].t), h);
+    ctx.closePath();
+    ctx.fillStyle = fg;
+    ctx.globalAlpha = i === 0 ? 0.15 : 0.08;
+    ctx.fill();
+    ctx.globalAlpha = 1;
+  });
+}
+
+function drawCharts() {
+  const cpu = stats(series.cpu), gpu = stats(series.gpu), power = stats(series.power);
+  $("title-cpu").textContent = `CPU Usage History (${cpu.last.toFixed(0)}%, Avg: ${cpu.avg.toFixed(1)}%)`;
+  $("title-gpu").textContent = `GPU Usage History (${gpu.last.toFixed(0)}%, Avg: ${gpu.avg.toFixed(1)}%)`;
+  $("title-power").textContent = `Power History (Avg: ${power.avg.toFixed(1)}W, Max: ${maxPower.toFixed(1)}W)`;
+  const mem = stats(series.mem), swap = stats(series.swap);
+  $("title-mem").textContent = `Memory/Swap History (${(mem.last / GB).toFixed(1)}G / ${(swap.last / GB).toFixed(1)}G)`;
+
+  stepChart($("chart-cpu"), [series.cpu], 100);
+  stepChart($("chart-gpu"), [series.gpu], 100);
+  stepChart($("chart-power"), [series.power], maxPower * 1.1);
+  stepChart($("chart-mem"), [series.mem, series.swap], memTotal);
+}
+
+function loadHistory() {
+  const metrics = {
+    cpu_usage: "cpu", gpu_usage: "gpu", "soc_metrics.total_power": "power",
+    "memory.used": "mem", "memory.swap_used": "swap",
+  };
+  return fetch("history?window=10m&metric=" + Object.keys(metrics).join(","))
+    .then((r) => (r.ok ? r.json() : []))
+    .then((rows) => {
+      for (const row of rows) {
+        const name = metrics[row.metric];
+        series[name].push({ t: Date.parse(row.timestamp), v: row.avg });
+        if (name === "power") maxPower = Math.max(maxPower, row.max);
+      }
+    })
+    .catch(() => {});
+}
+
+// Process table
+
+let procs = [];
+let sortKey = "cpu_percent";
+let sortAsc = false;
+let loadingProcs = false;
+
+function compare(a, b) {
+  const x = a[sortKey], y = b[sortKey];
+  const c = typeof x === "string" ? x.localeCompare(y) : x - y;
+  return sortAsc ? c : -c;
+}
+
+function renderProcs() {
+  const q = $("search").value.trim().toLowerCase();
+  const rows = procs.filter((p) => !q ||
+    String(p.pid).includes(q) || p.user.toLowerCase().includes(q) || p.command.toLowerCase().includes(q));
+  rows.sort(compare);
+
+  const body = document.createDocumentFragment();
+  for (const p of rows.slice(0, 200)) {
+    const tr = document.createElement("tr");
+    const cells = [
+      [p.pid], [p.user], [fmtBytes(p.virtual_bytes), "num"], [fmtBytes(p.rss_bytes), "num"],
+      [p.cpu_percent.toFixed(1) + "%", "num"], [p.gpu_ms_per_sec.toFixed(1), "num"],
+      [p.memory_percent.toFixed(1) + "%", "num"], [p.watts.toFixed(2), "num"],
+      [(p.energy_joules / 3600).toFixed(2) + " Wh", "num"], [p.cpu_time, "num"], [p.command],
+    ];
+    for (const [text, cls] of cells) {
+      const td = document.createElement("td");
+      td.textContent = text;
+      if (cls) td.className = cls;
+      tr.appendChild(td);
+    }
+    body.appendChild(tr);
+  }
+  $("procs").replaceChildren(body);
+
+  for (const th of document.querySelectorAll("th")) {
+    th.classList.toggle("sorted", th.dataset.key === sortKey);
+    th.classList.toggle("asc", th.dataset.key === sortKey && sortAsc);
+  }
+}
+
+function loadProcs() {
+  if (loadingProcs) return;
+  loadingProcs = true;
+  fetch("processes?limit=0")
+    .then((r) => (r.ok ? r.json() : { processes: [] }))
+    .then((resp) => { procs = resp.processes; renderProcs(); })
+    .catch(() => {})
+    .finally(() => { loadingProcs = false; });
+}
+
+for (const th of document.querySelectorAll("th")) {
+  th.addEventListener("click", () => {
+    if (sortKey === th.dataset.key) {
+      sortAsc = !sortAsc;
+    } else {
+      sortKey = th.dataset.key;
+      sortAsc = ["pid", "user", "command"].includes(sortKey);
+    }
+    renderProcs();
+  });
+}
+$("search").addEventListener("input", renderProcs);
+
+// Thunderbolt bus tree
+
+let lastTB = "";
+
+function node(text, cls, children) {
+  const li = document.createElement("li");
+  const span = document.createElement("span");
+  span.textContent = text;
+  if (cls) span.className = cls;
+  li.appendChild(span);
+  if (children && children.length) {
+    const ul = document.createElement("ul");
+    ul.append(...children);
+    li.appendChild(ul);
+  }
+  return li;
+}
+
+function renderThunderbolt(s) {
+  const key = JSON.stringify([s.thunderbolt_info, s.rdma_status]);
+  if (key === lastTB) return;
+  lastTB = key;
+
+  const items = [];
+  for (const bus of (s.thunderbolt_info && s.thunderbolt_info.buses) || []) {
+    const children = [];
+    if (bus.speed) children.push(node("Speed: " + bus.speed, "detail"));
+    for (const d of bus.devices || []) {
+      const detail = [d.vendor, d.mode, d.info_string].filter(Boolean).join(" · ");
+      children.push(node(d.name + (detail ? "  " + detail : "")));
+    }
+    if (bus.network_stats) {
+      const n = bus.network_stats;
+      children.push(node(`${n.interface_name}: ↓ ${fmtBytes(n.bytes_in_per_sec)}/s ↑ ${fmtBytes(n.bytes_out_per_sec)}/s`, "detail"));
+    }
+    if (bus.rdma_device) {
+      const r = bus.rdma_device;
+      children.push(node(`RDMA ${r.name} ${r.port_state} MTU ${r.active_mtu}`, "detail"));
+    }
+    items.push(node(`${bus.icon} ${bus.name} (${bus.status})`, bus.status === "Active" ? "active" : "", children));
+  }
+  if (s.rdma_status) {
+    items.push(node("RDMA: " + (s.rdma_status.status || (s.rdma_status.available ? "available" : "unavailable")), "detail"));
+  }
+  if (!items.length) items.push(node("No Thunderbolt buses found", "detail"));
+  $("tb-tree").replaceChildren(...items);
+}
+
+// Live updates
+
+function onSnapshot(s) {
+  record(s);
+  updateGauges(s);
+  drawCharts();
+  renderThunderbolt(s);
+  loadProcs();
+}
+
+function connect() {
+  const events = new EventSource("stream");
+  events.addEventListener("snapshot", (e) => onSnapshot(JSON.parse(e.data)));
+  events.onerror = () => {
+    $("status").textContent = "disconnected, retrying…";
+    $("status").className = "";
+  };
+}
+
+loadTheme();
+setInterval(loadTheme, 5000);
+window.addEventListener("resize", drawCharts);
+loadHistory().then(connect);
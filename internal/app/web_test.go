@@ -0,0 +1,95 @@
+package app
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebHandler(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	info := SystemInfo{Name: "Apple M4"}
+	api := newServeAPI(&metricsServer{info: info}, NewSnapshotBus(), info, time.Hour, done)
+	srv := httptest.NewServer(webHandler(api))
+	defer srv.Close()
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"/", "text/html"},
+		{"/app.js", "text/javascript"},
+		{"/style.css", "text/css"},
+		{"/theme", "application/json"},
+		{"/healthz", "application/json"},
+	}
+
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+			t.Errorf("%s Content-Type = %q, want %s", tt.path, ct, tt.contentType)
+		}
+	}
+}
+
+// The dashboard has to work on networks without internet access.
+func TestWebFilesAreSelfContained(t *testing.T) {
+	external := regexp.MustCompile(`(?i)(src|href)\s*=\s*["']?(https?:)?//|@import|url\(\s*["']?(https?:)?//`)
+	err := fs.WalkDir(webFiles, "web", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := webFiles.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		if m := external.Find(data); m != nil {
+			t.Errorf("%s loads an external resource: %s", path, m)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebTheme(t *testing.T) {
+	saved, savedBg := currentConfig, CurrentBgColor
+	defer func() {
+		currentConfig, CurrentBgColor = saved, savedBg
+		webTheme.Store(nil)
+	}()
+
+	tests := []struct {
+		theme, background string
+		want              webThemeColors
+	}{
+		{"green", "clear", webThemeColors{Foreground: "#008000"}},
+		{"#9580FF", "#22212C", webThemeColors{Foreground: "#9580FF", Background: "#22212C"}},
+		{"coral", "deep-space", webThemeColors{Foreground: "#FF7F50", Background: "#0D0D13"}},
+	}
+
+	for _, tt := range tests {
+		currentConfig.Theme = tt.theme
+		CurrentBgColor = resolveBackgroundColor(tt.background)
+		publishWebTheme()
+		if got := *webTheme.Load(); got != tt.want {
+			t.Errorf("theme %s on %s = %+v, want %+v", tt.theme, tt.background, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	webhookRetries       = 4
+	webhookFirstBackoff  = 500 * time.Millisecond
+	webhookMaxBackoff    = 30 * time.Second
+	webhookClientTimeout = 10 * time.Second
+	// webhookShutdownWait bounds the final flush so quitting stays quick;
+	// anything not delivered by then is spooled.
+	webhookShutdownWait = time.Second
+)
+
+// errWebhookRejected marks a response that retrying will not fix (4xx other
+// than 408 and 429). Such batches are dropped rather than spooled.
+var errWebhookRejected = errors.New("rejected by endpoint")
+
+// webhookSink POSTs headless samples to an HTTP endpoint as JSON arrays of
+// up to batchSize samples. Batches that cannot be delivered are spooled to
+// disk and sent, oldest first, once the endpoint recovers.
+type webhookSink struct {
+	url        string
+	headers    http.Header
+	client     *http.Client
+	batchSize  int
+	flushEvery time.Duration
+	spoolSender
+
+	pending []HeadlessOutput
+}
+
+func newWebhookSink(rawURL string, headers http.Header, batchSize int, flushEvery time.Duration, spoolDir string, spoolBytes int64) (*webhookSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if flushEvery <= 0 {
+		return nil, errors.New("flush interval must be positive")
+	}
+	spool, err := newDiskSpool(spoolDir, ".json", spoolBytes)
+	if err != nil {
+		return nil, err
+	}
+	w := &webhookSink{
+		url:        rawURL,
+		headers:    headers,
+		client:     &http.Client{Timeout: webhookClientTimeout},
+		batchSize:  batchSize,
+		flushEvery: flushEvery,
+	}
+	w.spoolSender = spoolSender{
+		spool:      spool,
+		post:       w.post,
+		rejected:   errWebhookRejected,
+		retries:    webhookRetries,
+		backoff:    webhookFirstBackoff,
+		maxBackoff: webhookMaxBackoff,
+		name:       "webhook batch",
+	}
+	return w, nil
+}
+
+// Add queues a sample and flushes once a full batch is pending.
+func (w *webhookSink) Add(ctx context.Context, sample HeadlessOutput) {
+	w.pending = append(w.pending, sample)
+	if len(w.pending) >= w.batchSize {
+		w.Flush(ctx)
+	}
+}
+
+// Flush delivers the pending batch.
+func (w *webhookSink) Flush(ctx context.Context) {
+	if len(w.pending) == 0 {
+		return
+	}
+	body, err := json.Marshal(w.pending)
+	w.pending = w.pending[:0]
+	if err != nil {
+		stderrLogger.Printf("Error encoding webhook batch: %v\n", err)
+		return
+	}
+	w.Deliver(ctx, body)
+}
+
+func (w *webhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mactop/"+version)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", errWebhookRejected, resp.Status)
+	}
+	return fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// runWebhookSink batches every snapshot it receives until done is closed,
+// then makes one last short attempt before spooling what is left.
+func runWebhookSink(done chan struct{}, w *webhookSink, sub *Subscription) {
+	// Batches are delivered off this loop, so a slow endpoint never holds
+	// up sampling.
+	w.Start()
+	ctx := context.Background()
+	sysInfo := metricSource.SystemInfo()
+	ticker := time.NewTicker(w.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+		drain:
+			for {
+				select {
+				case s := <-sub.C:
+					w.pending = append(w.pending, buildHeadlessOutput(s, sysInfo, nil))
+				default:
+					break drain
+				}
+			}
+			w.Flush(ctx)
+			w.Stop(webhookShutdownWait)
+			return
+		case s := <-sub.C:
+			w.Add(ctx, buildHeadlessOutput(s, sysInfo, nil))
+		case <-ticker.C:
+			w.Flush(ctx)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRecorder is an httptest handler that answers with the queued status
+// codes (then 200) and keeps every accepted batch.
+type webhookRecorder struct {
+	mu       sync.Mutex
+	statuses []int
+	batches  [][]HeadlessOutput
+	headers  []http.Header
+	requests int
+}
+
+func (r *webhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	if status == http.StatusOK {
+		var batch []HeadlessOutput
+		if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+			status = http.StatusBadRequest
+		} else {
+			r.batches = append(r.batches, batch)
+			r.headers = append(r.headers, req.Header.Clone())
+		}
+	}
+	w.WriteHeader(status)
+}
+
+func newTestWebhook(t *testing.T, url string, batchSize int) *webhookSink {
+	t.Helper()
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer secret")
+	w, err := newWebhookSink(url, headers, batchSize, time.Minute, t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("newWebhookSink() error = %v", err)
+	}
+	w.backoff = time.Millisecond
+	return w
+}
+
+func webhookSample(i int) HeadlessOutput {
+	return HeadlessOutput{Timestamp: time.Unix(int64(i), 0).UTC().Format(time.RFC3339), GPUUsage: float64(i)}
+}
+
+func TestWebhookBatching(t *testing.T) {
+	rec := &webhookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	w := newTestWebhook(t, srv.URL, 3)
+
+	ctx := context.Background()
+	for i := 0; i < 7; i++ {
+		w.Add(ctx, webhookSample(i))
+	}
+	w.Flush(ctx)
+
+	want := []int{3, 3, 1}
+	if len(rec.batches) != len(want) {
+		t.Fatalf("got %d batches, want %d", len(rec.batches), len(want))
+	}
+	for i, n := range want {
+		if len(rec.batches[i]) != n {
+			t.Errorf("batch %d has %d samples, want %d", i, len(rec.batches[i]), n)
+		}
+	}
+	if got := rec.headers[0].Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization header = %q", got)
+	}
+	if got := rec.headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	rec := &webhookRecorder{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	w := newTestWebhook(t, srv.URL, 1)
+
+	w.Add(context.Background(), webhookSample(1))
+	if rec.requests != 3 || len(rec.batches) != 1 {
+		t.Errorf("requests = %d, batches = %d, want 3 and 1", rec.requests, len(rec.batches))
+	}
+	if n := w.spool.Len(); n != 0 {
+		t.Errorf("spool has %d batches, want 0", n)
+	}
+}
+
+func TestWebhookRejectedIsDropped(t *testing.T) {
+	rec := &webhookRecorder{statuses: []int{http.StatusUnauthorized}}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	w := newTestWebhook(t, srv.URL, 1)
+
+	w.Add(context.Background(), webhookSample(1))
+	if rec.requests != 1 || w.spool.Len() != 0 {
+		t.Errorf("requests = %d, spooled = %d, want 1 and 0", rec.requests, w.spool.Len())
+	}
+}
+
+func TestWebhookSpoolsWhileDown(t *testing.T) {
+	rec := &webhookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	w := newTestWebhook(t, srv.URL, 1)
+	ctx := context.Background()
+
+	// Every attempt fails for the first batch and for the retry of the spool
+	// before the second, so both end up spooled in order.
+	down := make([]int, 2*(webhookRetries+1))
+	for i := range down {
+		down[i] = http.StatusBadGateway
+	}
+	rec.statuses = down
+	w.Add(ctx, webhookSample(1))
+	w.Add(ctx, webhookSample(2))
+	if n := w.spool.Len(); n != 2 {
+		t.Fatalf("spool has %d batches, want 2", n)
+	}
+
+	w.Add(ctx, webhookSample(3))
+	if n := w.spool.Len(); n != 0 {
+		t.Errorf("spool has %d batches after recovery, want 0", n)
+	}
+	var got []float64
+	for _, b := range rec.batches {
+		for _, s := range b {
+			got = append(got, s.GPUUsage)
+		}
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("delivered %v, want [1 2 3] in order", got)
+	}
+}
+
+func TestWebhookDoesNotBlock(t *testing.T) {
+	rec := &webhookRecorder{}
+	release := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		once.Do(func() { <-release })
+		rec.ServeHTTP(rw, req)
+	}))
+	defer srv.Close()
+	w := newTestWebhook(t, srv.URL, 1)
+	w.Start()
+	ctx := context.Background()
+
+	// The first request hangs, so the queue fills up and the rest is spooled,
+	// all without holding up Add.
+	const n = 2 * spoolSenderQueue
+	start := time.Now()
+	for i := 1; i <= n; i++ {
+		w.Add(ctx, webhookSample(i))
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Add blocked for %v", d)
+	}
+	if w.spool.Len() == 0 {
+		t.Error("nothing was spooled while the endpoint hung")
+	}
+	close(release)
+	w.Stop(5 * time.Second)
+
+	// The next batch takes the spool along with it.
+	w.Add(ctx, webhookSample(n+1))
+	if l := w.spool.Len(); l != 0 {
+		t.Errorf("spool has %d batches after recovery, want 0", l)
+	}
+	var got []float64
+	for _, b := range rec.batches {
+		for _, s := range b {
+			got = append(got, s.GPUUsage)
+		}
+	}
+	if len(got) != n+1 {
+		t.Fatalf("delivered %d samples, want %d", len(got), n+1)
+	}
+	for i, v := range got {
+		if v != float64(i+1) {
+			t.Fatalf("delivered %v, want 1..%d in order", got, n+1)
+		}
+	}
+}
+
+func TestWebhookSpoolTrim(t *testing.T) {
+	s, err := newDiskSpool(t.TempDir(), ".json", 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.Put(time.Now(), []byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.Len(); n != 2 {
+		t.Errorf("spool kept %d batches, want 2", n)
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	var h headerFlags
+	if err := h.Set("X-Token:  abc "); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Set("no separator"); err == nil {
+		t.Error("expected an error without a colon")
+	}
+	if got := h.Header().Get("X-Token"); got != "abc" {
+		t.Errorf("X-Token = %q, want abc", got)
+	}
+}